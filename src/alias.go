@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// expandAlias replaces a leading alias name with the command line it stands
+// for. Built-in commands always win, so an alias can never hide one.
+func expandAlias(args []string) ([]string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args, nil
+	}
+	if isBuiltinCommand(args[0]) {
+		return args, nil
+	}
+	config, err := loadConfig()
+	if err != nil {
+		// Let the command itself report the broken config.
+		return args, nil
+	}
+	commandLine, ok := config.Aliases[strings.ToLower(args[0])]
+	if !ok {
+		return args, nil
+	}
+	expanded, err := splitCommandLine(commandLine)
+	if err != nil {
+		return nil, fmt.Errorf("alias %q: %w", args[0], err)
+	}
+	return append(expanded, args[1:]...), nil
+}
+
+func isBuiltinCommand(name string) bool {
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return name == "help" || name == "completion"
+}
+
+// splitCommandLine splits a command line into arguments the way a shell
+// would for quoting: single quotes are literal, double quotes allow
+// backslash escapes.
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func aliasAdd(cmd *cobra.Command, args []string) {
+	name := strings.ToLower(strings.TrimSpace(args[0]))
+	commandLine := strings.TrimSpace(strings.Join(args[1:], " "))
+
+	if !aliasNameRegex.MatchString(name) {
+		printError("Error: alias names may only contain letters, digits, '-' and '_'")
+		os.Exit(1)
+	}
+	if isBuiltinCommand(name) {
+		printError("Error: %q is a built-in command and cannot be used as an alias", name)
+		os.Exit(1)
+	}
+	expanded, err := splitCommandLine(commandLine)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if len(expanded) == 0 || !isBuiltinCommand(expanded[0]) {
+		printError("Error: an alias must start with a cdjf command, e.g. \"format --profile club\"")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if config.Aliases == nil {
+		config.Aliases = make(map[string]string)
+	}
+	_, existed := config.Aliases[name]
+	config.Aliases[name] = commandLine
+	if err := saveConfig(config); err != nil {
+		printError("Error saving alias: %v", err)
+		os.Exit(1)
+	}
+
+	if existed {
+		fmt.Printf("Alias %q updated: cdjf %s\n", name, commandLine)
+	} else {
+		fmt.Printf("Alias %q saved: cdjf %s\n", name, commandLine)
+	}
+}
+
+func aliasList(cmd *cobra.Command, args []string) {
+	config, err := loadConfig()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if len(config.Aliases) == 0 {
+		fmt.Println("No aliases saved yet.")
+		return
+	}
+
+	fmt.Println("Saved aliases:")
+	for _, name := range sortedKeys(config.Aliases) {
+		fmt.Printf("  %-16s cdjf %s\n", name, config.Aliases[name])
+	}
+}
+
+func aliasRemove(cmd *cobra.Command, args []string) {
+	name := strings.ToLower(strings.TrimSpace(args[0]))
+	config, err := loadConfig()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if _, ok := config.Aliases[name]; !ok {
+		printError("Alias %q not found.", name)
+		os.Exit(1)
+	}
+	delete(config.Aliases, name)
+	if err := saveConfig(config); err != nil {
+		printError("Error removing alias: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Alias %q removed.\n", name)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// answerablePrompts are the prompts an --answers file can answer, by the
+// name used in the file.
+var answerablePrompts = map[string]string{
+	"confirm-format":      "Are you sure you want to continue? (before formatting)",
+	"format-whole-disk":   "Format the whole disk instead of the volume given? (macOS)",
+	"erase-apfs":          "Destroy the APFS container and all of its volumes?",
+	"erase-bitlocker":     "Erase the encrypted drive?",
+	"use-exfat":           "Format as exFAT instead?",
+	"proceed-on-slow":     "Do you want to proceed anyway? (after a slow benchmark)",
+	"eject":               "Do you want to eject the newly formatted drive(s)?",
+	"long-verify":         "This will take a while. Continue? (verify)",
+	"confirm-image-write": "Are you sure you want to continue? (image write)",
+	"confirm-receive":     "Are you sure you want to continue? (receive)",
+	"submit-result":       "Submit this result? (contribute)",
+	"defrag":              "Defragment now?",
+	"zerofree":            "Continue? (zerofree)",
+	"clean":               "Delete these files? (clean)",
+	"rename-files":        "Rename these files? (check --fix-names)",
+	"normalize-times":     "Normalize these modification times? (check --fix-times)",
+}
+
+// promptAnswers holds the answers loaded with --answers, by prompt name.
+var promptAnswers map[string]string
+
+// answersFromStdin is set when --answers - read the answers from standard
+// input, which leaves nothing there for the prompts the answers skip.
+var answersFromStdin bool
+
+// loadAnswers reads an answers file, or standard input when path is "-".
+func loadAnswers(path string) error {
+	if path == "" {
+		return nil
+	}
+	var data []byte
+	var err error
+	source := path
+	if path == "-" {
+		source = "stdin"
+		answersFromStdin = true
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read answers: %w", err)
+	}
+	answers, err := parseAnswers(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	promptAnswers = answers
+	return nil
+}
+
+// parseAnswers reads "name: answer" lines, the flat subset of YAML an
+// answers file needs. Blank lines and # comments are ignored, answers may be
+// quoted, and YAML's true and false stand for yes and no.
+func parseAnswers(data []byte) (map[string]string, error) {
+	answers := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"name: answer\"", lineNumber)
+		}
+		name = strings.TrimSpace(name)
+		if _, known := answerablePrompts[name]; !known {
+			return nil, fmt.Errorf("line %d: unknown prompt %q; prompts that can be answered are %s", lineNumber, name, strings.Join(sortedKeys(answerablePrompts), ", "))
+		}
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = value[:comment]
+		}
+		value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"'`))
+		switch value {
+		case "true", "y":
+			value = "yes"
+		case "false", "n":
+			value = "no"
+		}
+		if value != "yes" && value != "no" {
+			return nil, fmt.Errorf("line %d: answer %s with yes or no", lineNumber, name)
+		}
+		answers[name] = value
+	}
+	return answers, scanner.Err()
+}
+
+// ask shows a yes/no prompt and returns the answer in lower case. A prompt
+// answered in the --answers file prints its answer instead of waiting for
+// one; any other prompt is read from the terminal as usual. When input ends
+// before an answer the prompt is answered no, so a closed stdin never
+// confirms an erase or an eject by taking the default.
+func ask(name, question string) string {
+	fmt.Fprint(consoleOut, question)
+	if answer, ok := promptAnswers[name]; ok {
+		fmt.Fprintf(consoleOut, "%s (from answers file)\n", answer)
+		return answer
+	}
+	if answersFromStdin {
+		fmt.Fprintln(consoleOut)
+		printError("Error: the answers read from stdin have no answer for %q; add '%s: yes' or '%s: no', or pass the answers in a file so the prompt can be answered at the terminal", name, name, name)
+		os.Exit(1)
+	}
+	response, err := stdinReader().ReadString('\n')
+	if err != nil && strings.TrimSpace(response) == "" {
+		fmt.Fprintln(consoleOut, "no (no input)")
+		return "no"
+	}
+	return strings.ToLower(strings.TrimSpace(response))
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// APFSVolume is one volume inside an APFS container.
+type APFSVolume struct {
+	Device    string
+	Name      string
+	FileVault bool
+	Locked    bool
+}
+
+// APFSContainer is an APFS container and the volumes it holds. Erasing any
+// disk that backs a container destroys every volume in it.
+type APFSContainer struct {
+	Reference string
+	Stores    []string
+	Volumes   []APFSVolume
+}
+
+// apfsContainersOn returns the APFS containers stored on device, or on the
+// disk holding it. It returns nil on other systems and for fake drives.
+func apfsContainersOn(device string) []APFSContainer {
+	if runtime.GOOS != "darwin" || activeFakeBackend() != nil {
+		return nil
+	}
+	output, err := execCommand("diskutil", "apfs", "list", "-plist").Output()
+	if err != nil {
+		return nil
+	}
+	containers, err := parseAPFSList(output)
+	if err != nil {
+		return nil
+	}
+
+	disk := wholeDiskIdentifier(device)
+	var found []APFSContainer
+	for _, container := range containers {
+		matches := container.Reference == disk
+		for _, store := range container.Stores {
+			if wholeDiskIdentifier(store) == disk {
+				matches = true
+			}
+		}
+		if matches {
+			found = append(found, container)
+		}
+	}
+	return found
+}
+
+// parseAPFSList reads the output of 'diskutil apfs list -plist'.
+func parseAPFSList(output []byte) ([]APFSContainer, error) {
+	root, err := parsePlist(output)
+	if err != nil {
+		return nil, err
+	}
+	top, _ := root.(map[string]any)
+	entries, _ := top["Containers"].([]any)
+
+	var containers []APFSContainer
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		container := APFSContainer{}
+		container.Reference, _ = fields["ContainerReference"].(string)
+		stores, _ := fields["PhysicalStores"].([]any)
+		for _, store := range stores {
+			if storeFields, ok := store.(map[string]any); ok {
+				if id, _ := storeFields["DeviceIdentifier"].(string); id != "" {
+					container.Stores = append(container.Stores, id)
+				}
+			}
+		}
+		volumes, _ := fields["Volumes"].([]any)
+		for _, volume := range volumes {
+			volumeFields, ok := volume.(map[string]any)
+			if !ok {
+				continue
+			}
+			apfsVolume := APFSVolume{}
+			apfsVolume.Device, _ = volumeFields["DeviceIdentifier"].(string)
+			apfsVolume.Name, _ = volumeFields["Name"].(string)
+			apfsVolume.FileVault, _ = volumeFields["FileVault"].(bool)
+			apfsVolume.Locked, _ = volumeFields["Locked"].(bool)
+			container.Volumes = append(container.Volumes, apfsVolume)
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// printAPFSWarning explains what erasing device destroys when it holds APFS
+// containers.
+func printAPFSWarning(device string, containers []APFSContainer) {
+	printWarning("%s holds APFS, the format macOS uses for Time Machine and system disks.", device)
+	fmt.Println("   Formatting destroys the whole container, including every volume in it:")
+	for _, container := range containers {
+		for _, volume := range container.Volumes {
+			name := volume.Name
+			if name == "" {
+				name = "(unnamed)"
+			}
+			var notes []string
+			if volume.FileVault {
+				notes = append(notes, "FileVault encrypted")
+			}
+			if volume.Locked {
+				notes = append(notes, "locked")
+			}
+			line := fmt.Sprintf("     - %s (%s, container %s)", name, volume.Device, container.Reference)
+			if len(notes) > 0 {
+				line += " - " + strings.Join(notes, ", ")
+			}
+			fmt.Println(line)
+		}
+	}
+	fmt.Println("   Encrypted volumes cannot be recovered afterwards, even with the password.")
+}
+
+// parsePlist decodes an XML property list into maps, slices, strings, bools,
+// int64s, and float64s.
+func parsePlist(data []byte) (any, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistValue(decoder, start)
+		}
+	}
+}
+
+func decodePlistValue(decoder *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]any)
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.EndElement:
+				return dict, nil
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var text string
+					if err := decoder.DecodeElement(&text, &t); err != nil {
+						return nil, err
+					}
+					key = text
+					continue
+				}
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			}
+		}
+	case "array":
+		var array []any
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.EndElement:
+				return array, nil
+			case xml.StartElement:
+				value, err := decodePlistValue(decoder, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	switch start.Name.Local {
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	}
+	return text, nil
+}
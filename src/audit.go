@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditEntry is one destructive operation recorded in the audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	Operation string    `json:"operation"`
+	Device    string    `json:"device"`
+	Serial    string    `json:"serial,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	SizeGB    float64   `json:"size_gb"`
+	Label     string    `json:"label,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Error     string    `json:"error,omitempty"`
+	// Warnings are those raised about the drive during the operation.
+	Warnings []RunWarning `json:"warnings,omitempty"`
+}
+
+func auditLogPath() (string, error) {
+	return configFilePath("audit.jsonl")
+}
+
+// recordAudit appends an entry for an operation that erased a drive. The log
+// is only ever appended to; failures to write it are reported but never stop
+// the operation.
+func recordAudit(operation, device, label string, opErr error) {
+	entry := AuditEntry{
+		Time:      time.Now(),
+		User:      auditUser(),
+		Operation: operation,
+		Device:    device,
+		Serial:    getDriveSerial(device),
+		Model:     getDriveModel(device),
+		SizeGB:    getDriveSize(device),
+		Label:     label,
+		Outcome:   auditOutcomeSuccess,
+		Warnings:  warningsFor(device),
+	}
+	entry.Host, _ = os.Hostname()
+	if opErr != nil {
+		entry.Outcome = auditOutcomeFailure
+		entry.Error = opErr.Error()
+	}
+
+	if err := appendAuditEntry(entry); err != nil {
+		printWarning("[%s] Unable to write audit log: %v", device, err)
+	}
+}
+
+func appendAuditEntry(entry AuditEntry) error {
+	path, err := auditLogPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// auditUser names the person behind the operation, looking through sudo.
+func auditUser() string {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		return sudoUser
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USERNAME")
+}
+
+func readAuditLog() ([]AuditEntry, error) {
+	path, err := auditLogPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func showHistory(cmd *cobra.Command, args []string) {
+	limit, _ := cmd.Flags().GetInt("limit")
+	deviceFilter, _ := cmd.Flags().GetString("device")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	entries, err := readAuditLog()
+	if err != nil {
+		printError("Error reading audit log: %v", err)
+		os.Exit(1)
+	}
+
+	var matched []AuditEntry
+	for _, entry := range entries {
+		if deviceFilter != "" && !strings.EqualFold(entry.Device, deviceFilter) &&
+			!strings.EqualFold(entry.Serial, deviceFilter) && !strings.EqualFold(entry.Label, deviceFilter) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+
+	if asJSON {
+		for _, entry := range matched {
+			data, _ := json.Marshal(entry)
+			fmt.Println(string(data))
+		}
+		return
+	}
+
+	title := "Operation History"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	if len(matched) == 0 {
+		fmt.Println("No destructive operations recorded yet.")
+		return
+	}
+	fmt.Printf("%-16s %-12s %-12s %-7s %-12s %-20s %8s  %s\n", "Time", "User", "Operation", "Device", "Label", "Serial", "Size", "Outcome")
+	for _, entry := range matched {
+		outcome := entry.Outcome
+		if entry.Error != "" {
+			outcome += ": " + entry.Error
+		}
+		if len(entry.Warnings) > 0 {
+			outcome += fmt.Sprintf(" (%d warnings)", len(entry.Warnings))
+		}
+		line := fmt.Sprintf("%-16s %-12s %-12s %-7s %-12s %-20s %6.1fGB  %s",
+			entry.Time.Local().Format("2006-01-02 15:04"), entry.User, entry.Operation, entry.Device,
+			entry.Label, entry.Serial, entry.SizeGB, outcome)
+		severity := SeverityInfo
+		if entry.Outcome == auditOutcomeFailure {
+			severity = SeverityError
+		}
+		fmt.Println(colorize(severity, line))
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "os"
+
+// DeviceBackend finds drives and carries out the operations that change them.
+// The system backend drives diskutil on macOS and wmic/format on Windows;
+// setting CDJF_FAKE_DEVICES swaps in a fake backend so the format, verify,
+// and list flows can be exercised in CI without real hardware.
+type DeviceBackend interface {
+	// Enumerate lists the removable drives currently connected.
+	Enumerate() []string
+	// Info gathers the fields shown by cdjf list for one drive.
+	Info(device string) DriveInfo
+	Format(device string, opts FormatOptions) error
+	Eject(device string) error
+}
+
+// systemBackend operates on the real drives of this machine.
+type systemBackend struct{}
+
+var deviceBackend DeviceBackend = systemBackend{}
+
+// initDeviceBackend selects the fake backend when CDJF_FAKE_DEVICES names a
+// fake devices file.
+func initDeviceBackend() error {
+	path := os.Getenv("CDJF_FAKE_DEVICES")
+	if path == "" {
+		return nil
+	}
+	fake, err := newFakeBackend(path)
+	if err != nil {
+		return err
+	}
+	deviceBackend = fake
+	return nil
+}
+
+// activeFakeBackend returns the fake backend when it is in use, so code that
+// talks to the operating system directly can answer from it instead.
+func activeFakeBackend() *fakeBackend {
+	fake, _ := deviceBackend.(*fakeBackend)
+	return fake
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -13,6 +14,8 @@ import (
 type BenchmarkResult struct {
 	WriteMBps float64
 	ReadMBps  float64
+	// SampleBytes is how much the benchmark wrote to the drive.
+	SampleBytes int64
 }
 
 type IntegrityResult struct {
@@ -26,11 +29,18 @@ func (r IntegrityResult) Success() bool {
 	return len(r.Errors) == 0
 }
 
+// BenchmarkThresholds grade measured speeds in MB/s. Writes and reads are
+// graded separately because players mostly read from the drive.
 type BenchmarkThresholds struct {
 	ExtremelySlow float64 `json:"extremely_slow,omitempty"`
 	VerySlow      float64 `json:"very_slow,omitempty"`
 	SlightlySlow  float64 `json:"slightly_slow,omitempty"`
 	Prompt        float64 `json:"prompt,omitempty"`
+
+	ReadExtremelySlow float64 `json:"read_extremely_slow,omitempty"`
+	ReadVerySlow      float64 `json:"read_very_slow,omitempty"`
+	ReadSlightlySlow  float64 `json:"read_slightly_slow,omitempty"`
+	ReadPrompt        float64 `json:"read_prompt,omitempty"`
 }
 
 var defaultBenchmarkThresholds = BenchmarkThresholds{
@@ -38,65 +48,151 @@ var defaultBenchmarkThresholds = BenchmarkThresholds{
 	VerySlow:      3,
 	SlightlySlow:  6,
 	Prompt:        5,
+
+	ReadExtremelySlow: 5,
+	ReadVerySlow:      8,
+	ReadSlightlySlow:  15,
+	ReadPrompt:        10,
 }
 
-func benchmarkSeverity(speed float64, thresholds BenchmarkThresholds) string {
+// speedRating describes a speed against three thresholds, or returns "" when
+// it meets all of them.
+func speedRating(speed, extremelySlow, verySlow, slightlySlow float64) string {
 	switch {
-	case speed <= 0:
-		return "Unable to benchmark drive."
-	case thresholds.ExtremelySlow > 0 && speed < thresholds.ExtremelySlow:
-		return "WARNING: Drive appears to be extremely slow."
-	case thresholds.VerySlow > 0 && speed < thresholds.VerySlow:
-		return "WARNING: Drive appears to be very slow."
-	case thresholds.SlightlySlow > 0 && speed < thresholds.SlightlySlow:
-		return "WARNING: Drive appears to be slightly slow."
-	default:
-		return "Performance is OK."
+	case extremelySlow > 0 && speed < extremelySlow:
+		return "extremely slow"
+	case verySlow > 0 && speed < verySlow:
+		return "very slow"
+	case slightlySlow > 0 && speed < slightlySlow:
+		return "slightly slow"
 	}
+	return ""
 }
 
-func benchmarkSummary(result BenchmarkResult, thresholds BenchmarkThresholds) string {
+func writeRating(result BenchmarkResult, thresholds BenchmarkThresholds) string {
+	if result.WriteMBps <= 0 {
+		return ""
+	}
+	return speedRating(result.WriteMBps, thresholds.ExtremelySlow, thresholds.VerySlow, thresholds.SlightlySlow)
+}
+
+func readRating(result BenchmarkResult, thresholds BenchmarkThresholds) string {
+	if result.ReadMBps <= 0 {
+		return ""
+	}
+	return speedRating(result.ReadMBps, thresholds.ReadExtremelySlow, thresholds.ReadVerySlow, thresholds.ReadSlightlySlow)
+}
+
+// benchmarkSeverity grades write and read speed and names whichever falls
+// short.
+func benchmarkSeverity(result BenchmarkResult, thresholds BenchmarkThresholds) string {
 	if result.WriteMBps <= 0 && result.ReadMBps <= 0 {
-		return benchmarkSeverity(result.WriteMBps, thresholds)
+		return "Unable to benchmark drive."
+	}
+	var problems []string
+	if rating := writeRating(result, thresholds); rating != "" {
+		problems = append(problems, "writes are "+rating)
+	}
+	if rating := readRating(result, thresholds); rating != "" {
+		problems = append(problems, "reads are "+rating)
 	}
+	if len(problems) == 0 {
+		return "Performance is OK."
+	}
+	return "WARNING: Drive " + strings.Join(problems, " and ") + "."
+}
 
-	lines := []string{benchmarkSeverity(result.WriteMBps, thresholds)}
+// belowPrompt reports whether a drive is slow enough that formatting it
+// should be confirmed.
+func (t BenchmarkThresholds) belowPrompt(result BenchmarkResult) bool {
+	return (t.Prompt > 0 && result.WriteMBps > 0 && result.WriteMBps < t.Prompt) ||
+		(t.ReadPrompt > 0 && result.ReadMBps > 0 && result.ReadMBps < t.ReadPrompt)
+}
 
-	if result.WriteMBps > 0 {
-		lines = append(lines, fmt.Sprintf("  Write Speed: %.2f MB/s", result.WriteMBps))
-	} else {
-		lines = append(lines, "  Write Speed: unavailable")
+// recordBenchmarkWarning keeps a slow drive warning for the end of the run.
+func recordBenchmarkWarning(device string, result BenchmarkResult, thresholds BenchmarkThresholds) {
+	if grade := benchmarkSeverity(result, thresholds); strings.HasPrefix(grade, "WARNING: ") {
+		recordWarning(device, warnSlowDrive, fmt.Sprintf("%s (write %.2f MB/s, read %.2f MB/s)", strings.TrimSuffix(strings.TrimPrefix(grade, "WARNING: "), "."), result.WriteMBps, result.ReadMBps))
 	}
+}
 
-	if result.ReadMBps > 0 {
-		lines = append(lines, fmt.Sprintf("  Read Speed: %.2f MB/s", result.ReadMBps))
-	} else {
-		lines = append(lines, "  Read Speed: unavailable")
+func benchmarkSummary(result BenchmarkResult, thresholds BenchmarkThresholds) string {
+	severity := benchmarkSeverity(result, thresholds)
+	if result.WriteMBps <= 0 && result.ReadMBps <= 0 {
+		return colorize(SeverityWarn, severity)
 	}
 
+	lines := []string{colorize(severityOf(severity), severity)}
+	lines = append(lines, speedLine("Write Speed", result.WriteMBps, writeRating(result, thresholds)))
+	lines = append(lines, speedLine("Read Speed", result.ReadMBps, readRating(result, thresholds)))
 	return strings.Join(lines, "\n")
 }
 
+func speedLine(name string, speed float64, rating string) string {
+	switch {
+	case speed <= 0:
+		return fmt.Sprintf("  %s: unavailable", name)
+	case rating != "":
+		return fmt.Sprintf("  %s: %.2f MB/s (%s)", name, speed, rating)
+	}
+	return fmt.Sprintf("  %s: %.2f MB/s", name, speed)
+}
+
+// defaultBenchmarkMaxSample is how far the benchmark may grow its sample to
+// get a stable reading on fast drives.
+const defaultBenchmarkMaxSample = 256 * 1024 * 1024
+
 func benchmarkDrive(device string) BenchmarkResult {
+	return benchmarkDriveLimited(device, defaultBenchmarkMaxSample, false)
+}
+
+// benchmarkDriveLimited benchmarks a drive without writing more than
+// maxSample bytes. Quiet runs print nothing so several can run at once.
+func benchmarkDriveLimited(device string, maxSample int64, quiet bool) BenchmarkResult {
 	testFile, _, err := resolveTestFilePath(device, "cdjf_benchmark_test.tmp")
 	if err != nil {
 		return BenchmarkResult{}
 	}
-	return runIOMeasure(testFile)
+	result := runIOMeasure(testFile, maxSample, quiet)
+	recordDriveWrites(device, "benchmark", result.SampleBytes)
+	recordDriveSpeed(device, result)
+	return result
+}
+
+// estimateRunDuration predicts how long writing and reading back size bytes
+// takes at the measured speeds. It returns zero when either speed is unknown.
+func estimateRunDuration(size int64, result BenchmarkResult) time.Duration {
+	if result.WriteMBps <= 0 || result.ReadMBps <= 0 {
+		return 0
+	}
+	sizeMB := float64(size) / (1024 * 1024)
+	seconds := sizeMB/result.WriteMBps + sizeMB/result.ReadMBps
+	return time.Duration(seconds * float64(time.Second))
 }
 
-func runIOMeasure(testFile string) BenchmarkResult {
+func runIOMeasure(testFile string, maxSampleSize int64, quiet bool) BenchmarkResult {
 	const (
 		mib               = int64(1024 * 1024)
 		chunkSize         = 4 * mib
 		minSampleDuration = 400 * time.Millisecond
-		initialSampleSize = 32 * mib
-		maxSampleSize     = 256 * mib
 	)
+	initialSampleSize := min(32*mib, maxSampleSize)
 
 	result := BenchmarkResult{}
 	chunk := make([]byte, chunkSize)
+	logf := func(format string, args ...any) {
+		if !quiet {
+			fmt.Fprintf(consoleOut, format, args...)
+		}
+	}
+	newBar := func(label string, total int64) *ProgressBar {
+		if quiet {
+			return nil
+		}
+		return NewProgressBar(label, total)
+	}
 
+	simulation := simulationFor(testFile)
 	_ = os.Remove(testFile)
 	file, err := os.Create(testFile)
 	if err != nil {
@@ -105,8 +201,8 @@ func runIOMeasure(testFile string) BenchmarkResult {
 	defer os.Remove(testFile)
 
 	currentSampleTarget := initialSampleSize
-	fmt.Printf("  Running write benchmark (minimum %.0f MB sample)...\n", float64(initialSampleSize)/float64(mib))
-	writeBar := NewProgressBar("Write", currentSampleTarget)
+	logf("  Running write benchmark (minimum %.0f MB sample)...\n", float64(initialSampleSize)/float64(mib))
+	writeBar := newBar("Write", currentSampleTarget)
 	defer writeBar.Stop()
 
 	writeStart := time.Now()
@@ -123,6 +219,7 @@ func runIOMeasure(testFile string) BenchmarkResult {
 		}
 
 		n, writeErr := file.Write(toWrite)
+		simulation.wrote(n)
 		if n > 0 {
 			bytesWritten += int64(n)
 			writeBar.Add(int64(n))
@@ -148,10 +245,11 @@ func runIOMeasure(testFile string) BenchmarkResult {
 			}
 			currentSampleTarget = nextTarget
 			writeBar.UpdateTotal(currentSampleTarget)
-			fmt.Printf("  Extending write sample to %.0f MB to improve accuracy...\n", float64(currentSampleTarget)/float64(mib))
+			logf("  Extending write sample to %.0f MB to improve accuracy...\n", float64(currentSampleTarget)/float64(mib))
 		}
 	}
 
+	result.SampleBytes = bytesWritten
 	if syncErr := file.Sync(); syncErr != nil {
 		file.Close()
 		return result
@@ -173,14 +271,15 @@ func runIOMeasure(testFile string) BenchmarkResult {
 	}
 	defer readFile.Close()
 
-	fmt.Println("  Running read benchmark...")
-	readBar := NewProgressBar("Read", bytesWritten)
+	logf("  Running read benchmark...\n")
+	readBar := newBar("Read", bytesWritten)
 	defer readBar.Stop()
 
 	readStart := time.Now()
 	var totalRead int64
 	for {
 		n, readErr := readFile.Read(chunk)
+		simulation.readBack(chunk[:n])
 		if n > 0 {
 			totalRead += int64(n)
 			readBar.Add(int64(n))
@@ -205,81 +304,213 @@ func runIOMeasure(testFile string) BenchmarkResult {
 	readBar.Finish()
 
 	if writeDuration < minSampleDuration {
-		fmt.Println("  Write benchmark completed very quickly even at the maximum payload; reported write speed may understate sustained performance.")
+		logf("  Write benchmark completed very quickly even at the maximum payload; reported write speed may understate sustained performance.\n")
 	}
 	if readDuration < minSampleDuration {
-		fmt.Println("  Read benchmark completed very quickly; reported read speed may benefit from OS caching.")
+		logf("  Read benchmark completed very quickly; reported read speed may benefit from OS caching.\n")
 	}
 
 	return result
 }
 
-func runIntegrityCheck(testFile string, testSize int64) IntegrityResult {
+// VerifyCheckpoint records how far an integrity check got so an interrupted
+// run can continue with --resume. It is stored next to the test file.
+type VerifyCheckpoint struct {
+	TestSize  int64     `json:"test_size"`
+	Seed      uint64    `json:"seed"`
+	Phase     string    `json:"phase"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	checkpointPhaseWrite = "write"
+	checkpointPhaseRead  = "read"
+	checkpointInterval   = 256 * 1024 * 1024
+)
+
+func verifyCheckpointPath(testFile string) string {
+	return testFile + ".checkpoint"
+}
+
+func loadVerifyCheckpoint(testFile string) (VerifyCheckpoint, error) {
+	data, err := os.ReadFile(verifyCheckpointPath(testFile))
+	if err != nil {
+		return VerifyCheckpoint{}, err
+	}
+	var checkpoint VerifyCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return VerifyCheckpoint{}, err
+	}
+	return checkpoint, nil
+}
+
+func saveVerifyCheckpoint(testFile string, checkpoint VerifyCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(verifyCheckpointPath(testFile), data, 0o644)
+}
+
+func clearVerifyCheckpoint(testFile string) {
+	os.Remove(verifyCheckpointPath(testFile))
+	os.Remove(testFile)
+}
+
+// resumeCheckpoint returns the checkpoint to continue from, or a fresh one with
+// a new pattern seed when there is nothing usable to resume.
+func resumeCheckpoint(testFile string, testSize int64, resume bool) VerifyCheckpoint {
+	fresh := VerifyCheckpoint{TestSize: testSize, Seed: uint64(time.Now().UnixNano()), Phase: checkpointPhaseWrite}
+
+	checkpoint, err := loadVerifyCheckpoint(testFile)
+	if err != nil {
+		if resume {
+			fmt.Fprintln(consoleOut, "  No interrupted run found; starting from the beginning.")
+		}
+		return fresh
+	}
+	if !resume {
+		fmt.Fprintf(consoleOut, "  Discarding an interrupted run from %s (use --resume to continue it).\n", checkpoint.UpdatedAt.Format("2006-01-02 15:04"))
+		return fresh
+	}
+	if checkpoint.TestSize != testSize {
+		fmt.Fprintf(consoleOut, "  Interrupted run used a %.1f MB test; starting over with %.1f MB.\n",
+			float64(checkpoint.TestSize)/(1024*1024), float64(testSize)/(1024*1024))
+		return fresh
+	}
+	needed := checkpoint.Offset
+	if checkpoint.Phase == checkpointPhaseRead {
+		needed = testSize
+	}
+	if info, err := os.Stat(testFile); err != nil || info.Size() < needed {
+		fmt.Fprintln(consoleOut, "  Test data from the interrupted run is missing; starting from the beginning.")
+		return fresh
+	}
+
+	fmt.Fprintf(consoleOut, "  Resuming %s phase at %.1f MB.\n", checkpoint.Phase, float64(checkpoint.Offset)/(1024*1024))
+	return checkpoint
+}
+
+func runIntegrityCheck(testFile string, testSize int64, resume bool, limiter *RateLimiter) IntegrityResult {
 	const chunkSize = 1024 * 1024
 
 	result := IntegrityResult{}
 	chunk := make([]byte, chunkSize)
 	expected := make([]byte, chunkSize)
 
-	file, err := os.Create(testFile)
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("create test file: %v", err))
-		return result
-	}
-	defer os.Remove(testFile)
+	checkpoint := resumeCheckpoint(testFile, testSize, resume)
+	seed := checkpoint.Seed
+	simulation := simulationFor(testFile)
 
-	writeBar := NewProgressBar("Write", testSize)
-	defer writeBar.Stop()
+	// Errors end the run for good, so only an interruption leaves a checkpoint behind.
+	completed := false
+	defer func() {
+		if completed || len(result.Errors) > 0 {
+			clearVerifyCheckpoint(testFile)
+		}
+	}()
 
 	var bytesWritten int64
-	writeStart := time.Now()
-	for bytesWritten < testSize {
-		remaining := testSize - bytesWritten
-		toWrite := chunkSize
-		if remaining < int64(toWrite) {
-			toWrite = int(remaining)
+	if checkpoint.Phase == checkpointPhaseRead {
+		bytesWritten = testSize
+	} else {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if checkpoint.Offset > 0 {
+			flags = os.O_WRONLY
+		}
+		file, err := os.OpenFile(testFile, flags, 0o644)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("create test file: %v", err))
+			return result
+		}
+		bytesWritten = checkpoint.Offset
+		if bytesWritten > 0 {
+			if err := file.Truncate(bytesWritten); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("resume test file: %v", err))
+				file.Close()
+				return result
+			}
+			if _, err := file.Seek(bytesWritten, io.SeekStart); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("resume test file: %v", err))
+				file.Close()
+				return result
+			}
 		}
 
-		fillPattern(chunk[:toWrite], bytesWritten)
-		n, writeErr := file.Write(chunk[:toWrite])
-		offset := bytesWritten
-		if n > 0 {
-			writeBar.Add(int64(n))
-			bytesWritten += int64(n)
+		writeBar := NewProgressBar("Write", testSize)
+		defer writeBar.Stop()
+		writeBar.Add(bytesWritten)
+
+		resumedAt := bytesWritten
+		lastCheckpoint := bytesWritten
+		writeStart := time.Now()
+		for bytesWritten < testSize {
+			remaining := testSize - bytesWritten
+			toWrite := chunkSize
+			if remaining < int64(toWrite) {
+				toWrite = int(remaining)
+			}
+
+			fillPattern(chunk[:toWrite], bytesWritten, seed)
+			limiter.Wait(toWrite)
+			// Data writes and reads are never retried: an I/O error on a
+			// failing sector is what verify exists to find, and a retry
+			// that happened to succeed would hide it.
+			n, writeErr := file.Write(chunk[:toWrite])
+			simulation.wrote(n)
+			offset := bytesWritten
+			if n > 0 {
+				writeBar.Add(int64(n))
+				bytesWritten += int64(n)
+			}
+			if writeErr != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("write at offset %d: %v", offset, writeErr))
+				file.Close()
+				result.BytesWritten = bytesWritten
+				return result
+			}
+			if n != toWrite {
+				result.Errors = append(result.Errors, fmt.Sprintf("short write at offset %d (expected %d wrote %d)", offset, toWrite, n))
+				file.Close()
+				result.BytesWritten = bytesWritten
+				return result
+			}
+
+			// Sync before recording progress so a checkpoint never covers unwritten data.
+			if bytesWritten-lastCheckpoint >= checkpointInterval && bytesWritten < testSize {
+				if file.Sync() == nil {
+					saveVerifyCheckpoint(testFile, VerifyCheckpoint{TestSize: testSize, Seed: seed, Phase: checkpointPhaseWrite, Offset: bytesWritten})
+					lastCheckpoint = bytesWritten
+				}
+			}
 		}
-		if writeErr != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("write at offset %d: %v", offset, writeErr))
+
+		if syncErr := file.Sync(); syncErr != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("sync: %v", syncErr))
 			file.Close()
 			result.BytesWritten = bytesWritten
 			return result
 		}
-		if n != toWrite {
-			result.Errors = append(result.Errors, fmt.Sprintf("short write at offset %d (expected %d wrote %d)", offset, toWrite, n))
-			file.Close()
+
+		if closeErr := file.Close(); closeErr != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("close after write: %v", closeErr))
 			result.BytesWritten = bytesWritten
 			return result
 		}
-	}
 
-	if syncErr := file.Sync(); syncErr != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("sync: %v", syncErr))
-		file.Close()
-		result.BytesWritten = bytesWritten
-		return result
-	}
-
-	if closeErr := file.Close(); closeErr != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("close after write: %v", closeErr))
-		result.BytesWritten = bytesWritten
-		return result
-	}
-
-	writeElapsed := time.Since(writeStart).Seconds()
-	if writeElapsed > 0 && bytesWritten > 0 {
-		result.WriteMBps = float64(bytesWritten) / writeElapsed / (1024 * 1024)
+		writeElapsed := time.Since(writeStart).Seconds()
+		if writeElapsed > 0 && bytesWritten > resumedAt {
+			result.WriteMBps = float64(bytesWritten-resumedAt) / writeElapsed / (1024 * 1024)
+		}
+		writeBar.Finish()
+		checkpoint = VerifyCheckpoint{TestSize: testSize, Seed: seed, Phase: checkpointPhaseRead}
+		if testSize >= checkpointInterval {
+			saveVerifyCheckpoint(testFile, checkpoint)
+		}
 	}
 	result.BytesWritten = bytesWritten
-	writeBar.Finish()
 
 	readFile, err := os.Open(testFile)
 	if err != nil {
@@ -288,15 +519,25 @@ func runIntegrityCheck(testFile string, testSize int64) IntegrityResult {
 	}
 	defer readFile.Close()
 
+	bytesVerified := checkpoint.Offset
+	if _, err := readFile.Seek(bytesVerified, io.SeekStart); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("resume verification: %v", err))
+		return result
+	}
+
 	verifyBar := NewProgressBar("Verify", bytesWritten)
 	defer verifyBar.Stop()
+	verifyBar.Add(bytesVerified)
 
-	var bytesVerified int64
+	resumedAt := bytesVerified
+	lastCheckpoint := bytesVerified
 	readStart := time.Now()
 	for {
 		n, readErr := readFile.Read(chunk)
+		limiter.Wait(n)
+		simulation.readBack(chunk[:n])
 		if n > 0 {
-			fillPattern(expected[:n], bytesVerified)
+			fillPattern(expected[:n], bytesVerified, seed)
 			if !bytes.Equal(chunk[:n], expected[:n]) {
 				result.Errors = append(result.Errors, fmt.Sprintf("data mismatch at offset %d", bytesVerified))
 				bytesVerified += int64(n)
@@ -305,6 +546,11 @@ func runIntegrityCheck(testFile string, testSize int64) IntegrityResult {
 			}
 			bytesVerified += int64(n)
 			verifyBar.Add(int64(n))
+
+			if bytesVerified-lastCheckpoint >= checkpointInterval && bytesVerified < bytesWritten {
+				saveVerifyCheckpoint(testFile, VerifyCheckpoint{TestSize: testSize, Seed: seed, Phase: checkpointPhaseRead, Offset: bytesVerified})
+				lastCheckpoint = bytesVerified
+			}
 		}
 
 		if readErr != nil {
@@ -317,21 +563,39 @@ func runIntegrityCheck(testFile string, testSize int64) IntegrityResult {
 	}
 
 	readElapsed := time.Since(readStart).Seconds()
-	if readElapsed > 0 && bytesVerified > 0 {
-		result.ReadMBps = float64(bytesVerified) / readElapsed / (1024 * 1024)
+	if readElapsed > 0 && bytesVerified > resumedAt {
+		result.ReadMBps = float64(bytesVerified-resumedAt) / readElapsed / (1024 * 1024)
 	}
 	result.BytesVerified = bytesVerified
 	verifyBar.Finish()
 
+	completed = true
 	return result
 }
 
-func fillPattern(buf []byte, offset int64) {
+// fillPattern fills buf with the test pattern for the given file offset. The
+// seed varies the data between runs so stale blocks from an earlier test or a
+// drive that wraps its address space cannot pass verification.
+func fillPattern(buf []byte, offset int64, seed uint64) {
+	var word uint64
+	wordIndex := int64(-1)
 	for i := range buf {
-		buf[i] = byte((offset + int64(i)) & 0xFF)
+		pos := offset + int64(i)
+		if pos/8 != wordIndex {
+			wordIndex = pos / 8
+			word = splitmix64(seed + uint64(wordIndex))
+		}
+		buf[i] = byte(word >> (8 * uint(pos%8)))
 	}
 }
 
+func splitmix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
 func writeVerifyLog(device, mountPoint string, testSize int64, result IntegrityResult) (string, error) {
 	timestamp := time.Now()
 	fileName := fmt.Sprintf("cdjf-verify-%s-%s.log", sanitizeDeviceName(device), timestamp.Format("20060102-150405"))
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// BitLockerStatus describes BitLocker To Go protection on a Windows drive.
+type BitLockerStatus struct {
+	Protected bool
+	Locked    bool
+	// Details are the status lines manage-bde printed, when it could run.
+	Details []string
+}
+
+// bitLockerStatus reports whether a drive is protected by BitLocker. The
+// shell's BitLockerProtection property works without administrator rights;
+// manage-bde confirms it and adds detail when cdjf runs elevated.
+func bitLockerStatus(device string) BitLockerStatus {
+	if fake := activeFakeBackend(); fake != nil {
+		state := fake.drive(device).BitLocker
+		return BitLockerStatus{Protected: state != "", Locked: state == "locked"}
+	}
+	if runtime.GOOS != "windows" {
+		return BitLockerStatus{}
+	}
+
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+	status := BitLockerStatus{}
+	psCmd := fmt.Sprintf("(New-Object -ComObject Shell.Application).NameSpace(17).ParseName('%s:').ExtendedProperty('System.Volume.BitLockerProtection')", driveLetter)
+	if output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output(); err == nil {
+		// 1 on, 3 encrypting, 4 decrypting, 5 suspended, 6 on and locked;
+		// 2 or empty means off.
+		switch strings.TrimSpace(string(output)) {
+		case "1", "3", "4", "5":
+			status.Protected = true
+		case "6":
+			status.Protected = true
+			status.Locked = true
+		}
+	}
+
+	if output, err := execCommand("manage-bde", "-status", driveLetter+":").Output(); err == nil {
+		if confirmed, ok := parseManageBDEStatus(output); ok {
+			return confirmed
+		}
+	}
+	return status
+}
+
+// parseManageBDEStatus reads 'manage-bde -status X:'. ok is false when the
+// output has no conversion status, as when the drive is not BitLocker-capable.
+func parseManageBDEStatus(output []byte) (status BitLockerStatus, ok bool) {
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "Conversion Status":
+			ok = true
+			status.Protected = !strings.EqualFold(value, "Fully Decrypted")
+		case "Lock Status":
+			status.Locked = strings.EqualFold(value, "Locked")
+		case "Protection Status", "Encryption Method":
+		default:
+			continue
+		}
+		status.Details = append(status.Details, key+": "+value)
+	}
+	if status.Locked {
+		status.Protected = true
+	}
+	return status, ok
+}
+
+// printBitLockerWarning explains what formatting a BitLocker drive means.
+func printBitLockerWarning(device string, status BitLockerStatus) {
+	if status.Locked {
+		printWarning("%s is encrypted with BitLocker and is locked.", device)
+	} else {
+		printWarning("%s is encrypted with BitLocker.", device)
+	}
+	for _, detail := range status.Details {
+		fmt.Printf("   %s\n", detail)
+	}
+	fmt.Println("   Formatting removes BitLocker and the data on the drive can never be recovered,")
+	fmt.Println("   even with the password or recovery key. Players cannot read BitLocker drives,")
+	fmt.Println("   so the drive is rebuilt from scratch with a new partition table.")
+}
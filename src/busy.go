@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// volumeHolder is a process with files open on a volume.
+type volumeHolder struct {
+	PID     int
+	Process string
+	// Files are relative to the volume root. Windows reports only the
+	// process, so they are empty there.
+	Files []string
+}
+
+// busyHints explain the programs that most often keep a stick from being
+// ejected, matched by a lower-case substring of the process name.
+var busyHints = []struct {
+	Match string
+	Hint  string
+}{
+	{"rekordbox", "quit rekordbox, or wait for its export or analysis to finish"},
+	{"mds", "wait for Spotlight to finish indexing the drive, or turn indexing off with 'mdutil -i off <mount point>'"},
+	{"mdworker", "wait for Spotlight to finish indexing the drive, or turn indexing off with 'mdutil -i off <mount point>'"},
+	{"finder", "close Finder windows showing the drive"},
+	{"explorer", "close Explorer windows showing the drive"},
+	{"quicklook", "close Quick Look previews of files on the drive"},
+	{"serato", "quit Serato, or eject the drive from its sidebar"},
+	{"engine", "quit Engine DJ, or eject the drive from within it"},
+}
+
+func busyHint(process string) string {
+	lower := strings.ToLower(process)
+	for _, hint := range busyHints {
+		if strings.Contains(lower, hint.Match) {
+			return hint.Hint
+		}
+	}
+	return ""
+}
+
+// findVolumeHolders lists the processes with files open on the volume
+// mounted at mountPoint: from lsof on macOS and Linux, and from the Restart
+// Manager on Windows.
+func findVolumeHolders(device, mountPoint string) ([]volumeHolder, error) {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).holders(), nil
+	}
+	if runtime.GOOS == "windows" {
+		return restartManagerHolders(mountPoint)
+	}
+	return lsofHolders(mountPoint)
+}
+
+// lsofHolders runs lsof on a mount point, which lists every file open on
+// that filesystem, working directories included.
+func lsofHolders(mountPoint string) ([]volumeHolder, error) {
+	output, err := execCommand("lsof", "-w", "-F", "pcn", "--", mountPoint).Output()
+	if err != nil {
+		// lsof exits with status 1 when nothing is open, and also when it
+		// could not read some processes; what it did find is still printed.
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("lsof failed: %w", err)
+		}
+	}
+	return parseLsofOutput(output, mountPoint), nil
+}
+
+// parseLsofOutput reads lsof's -F output: a "p" line starts each process,
+// followed by its "c" command name and an "n" line per open file.
+func parseLsofOutput(output []byte, mountPoint string) []volumeHolder {
+	var holders []volumeHolder
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		value := line[1:]
+		switch line[0] {
+		case 'p':
+			pid, _ := strconv.Atoi(value)
+			holders = append(holders, volumeHolder{PID: pid})
+			seen = make(map[string]bool)
+		case 'c':
+			if len(holders) > 0 {
+				holders[len(holders)-1].Process = value
+			}
+		case 'n':
+			if len(holders) == 0 {
+				continue
+			}
+			rel, err := filepath.Rel(mountPoint, value)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = value
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				rel = "(root folder)"
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				holders[len(holders)-1].Files = append(holders[len(holders)-1].Files, rel)
+			}
+		}
+	}
+	return holders
+}
+
+func showVolumeHolders(cmd *cobra.Command, args []string) {
+	device := args[0]
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		os.Exit(1)
+	}
+
+	holders, err := findVolumeHolders(device, mountPoint)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Programs using %s (%s)", device, mountPoint)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	if len(holders) == 0 {
+		printOK("No program has files open on %s.", device)
+		if runtime.GOOS == "windows" {
+			fmt.Println("Explorer windows and command prompts showing the drive are not listed; close them if ejecting still fails.")
+		}
+		return
+	}
+
+	sort.Slice(holders, func(i, j int) bool {
+		if !strings.EqualFold(holders[i].Process, holders[j].Process) {
+			return strings.ToLower(holders[i].Process) < strings.ToLower(holders[j].Process)
+		}
+		return holders[i].PID < holders[j].PID
+	})
+	for _, holder := range holders {
+		fmt.Println()
+		fmt.Printf("%s (PID %d)\n", holder.Process, holder.PID)
+		printPathList(holder.Files, 5)
+		if hint := busyHint(holder.Process); hint != "" {
+			fmt.Printf("  To release it: %s\n", hint)
+		}
+	}
+	fmt.Println()
+	printWarning("%d program(s) have files open on %s, so it cannot be ejected or formatted until they let go.", len(holders), device)
+	os.Exit(1)
+}
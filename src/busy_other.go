@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// restartManagerHolders is only available on Windows; other systems use lsof.
+func restartManagerHolders(mountPoint string) ([]volumeHolder, error) {
+	return nil, fmt.Errorf("the Restart Manager is only available on Windows")
+}
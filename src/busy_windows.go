@@ -0,0 +1,116 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	rstrtmgr                = windows.NewLazySystemDLL("rstrtmgr.dll")
+	procRmStartSession      = rstrtmgr.NewProc("RmStartSession")
+	procRmRegisterResources = rstrtmgr.NewProc("RmRegisterResources")
+	procRmGetList           = rstrtmgr.NewProc("RmGetList")
+	procRmEndSession        = rstrtmgr.NewProc("RmEndSession")
+)
+
+const (
+	rmSessionKeyLen = 32
+	rmMaxAppName    = 255
+	rmMaxSvcName    = 63
+	// rmRegisterBatch is how many files are passed to the Restart Manager
+	// per call, to keep each call's array a sensible size.
+	rmRegisterBatch = 1000
+)
+
+// rmProcessInfo mirrors the RM_PROCESS_INFO structure.
+type rmProcessInfo struct {
+	ProcessID        uint32
+	ProcessStartTime windows.Filetime
+	AppName          [rmMaxAppName + 1]uint16
+	ServiceShortName [rmMaxSvcName + 1]uint16
+	ApplicationType  uint32
+	AppStatus        uint32
+	TSSessionID      uint32
+	Restartable      int32
+}
+
+// restartManagerHolders asks the Restart Manager, the API installers use to
+// find programs holding files, which processes have files on the volume
+// open. It only knows about files, so every file on the volume is registered;
+// open folders, such as an Explorer window, are not reported.
+func restartManagerHolders(mountPoint string) ([]volumeHolder, error) {
+	var files []*uint16
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if entry != nil && entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if name, err := windows.UTF16PtrFromString(path); err == nil {
+				files = append(files, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the files on %s: %w", mountPoint, err)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	var session uint32
+	var key [rmSessionKeyLen + 1]uint16
+	if rc, _, _ := procRmStartSession.Call(uintptr(unsafe.Pointer(&session)), 0, uintptr(unsafe.Pointer(&key[0]))); rc != 0 {
+		return nil, fmt.Errorf("unable to start a Restart Manager session: %w", windows.Errno(rc))
+	}
+	defer procRmEndSession.Call(uintptr(session))
+
+	for start := 0; start < len(files); start += rmRegisterBatch {
+		batch := files[start:min(start+rmRegisterBatch, len(files))]
+		rc, _, _ := procRmRegisterResources.Call(uintptr(session),
+			uintptr(len(batch)), uintptr(unsafe.Pointer(&batch[0])), 0, 0, 0, 0)
+		if rc != 0 {
+			return nil, fmt.Errorf("unable to register files with the Restart Manager: %w", windows.Errno(rc))
+		}
+	}
+
+	// The list can grow between calls, so ask again until it fits.
+	var infos []rmProcessInfo
+	for {
+		var needed, reasons uint32
+		count := uint32(len(infos))
+		var first uintptr
+		if count > 0 {
+			first = uintptr(unsafe.Pointer(&infos[0]))
+		}
+		rc, _, _ := procRmGetList.Call(uintptr(session), uintptr(unsafe.Pointer(&needed)),
+			uintptr(unsafe.Pointer(&count)), first, uintptr(unsafe.Pointer(&reasons)))
+		if windows.Errno(rc) == windows.ERROR_MORE_DATA {
+			infos = make([]rmProcessInfo, needed)
+			continue
+		}
+		if rc != 0 {
+			return nil, fmt.Errorf("unable to get the Restart Manager's process list: %w", windows.Errno(rc))
+		}
+		infos = infos[:count]
+		break
+	}
+
+	holders := make([]volumeHolder, 0, len(infos))
+	for _, info := range infos {
+		holders = append(holders, volumeHolder{
+			PID:     int(info.ProcessID),
+			Process: windows.UTF16ToString(info.AppName[:]),
+		})
+	}
+	return holders, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func checkDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	fsDetails, _ := cmd.Flags().GetBool("fs-details")
+	names, _ := cmd.Flags().GetBool("names")
+	fixNames, _ := cmd.Flags().GetBool("fix-names")
+	maxName, _ := cmd.Flags().GetInt("max-name")
+	times, _ := cmd.Flags().GetBool("times")
+	fixTimes, _ := cmd.Flags().GetBool("fix-times")
+	shiftTimes, _ := cmd.Flags().GetDuration("shift-times")
+	noLock, _ := cmd.Flags().GetBool("no-lock")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	checkTitle := fmt.Sprintf("Drive Check for %s", device)
+	fmt.Println(checkTitle)
+	fmt.Println(strings.Repeat("=", len(checkTitle)))
+
+	// Fixing names or times needs a writable drive; anything else is read-only.
+	unlock := func() {}
+	if !noLock && !fixNames && !fixTimes {
+		unlock = lockForInspection(device)
+	}
+	defer unlock()
+
+	filesystem := getDriveFilesystem(device)
+	if filesystem != "" {
+		fmt.Printf("Filesystem: %s\n", filesystem)
+	}
+	if warning := filesystemCompatibilityWarning(filesystem); warning != "" {
+		printWarning("%s", warning)
+	}
+	if names || fixNames {
+		checkNames(device, maxName, fixNames)
+	}
+	if times || fixTimes || shiftTimes != 0 {
+		checkTimestamps(device, shiftTimes, fixTimes)
+	}
+	checkExport(device)
+
+	fmt.Println()
+	partTitle := "Partition Table:"
+	fmt.Println(partTitle)
+	fmt.Println(strings.Repeat("-", len(partTitle)))
+	table, err := readPartitionTable(device)
+	if err != nil {
+		printError("Error reading partition table: %v", err)
+		unlock()
+		os.Exit(1)
+	}
+	printPartitionTable(table)
+	printAlignmentReport(table)
+
+	if strings.Contains(strings.ToUpper(filesystem), "FAT32") {
+		fmt.Println()
+		fragTitle := "Fragmentation:"
+		fmt.Println(fragTitle)
+		fmt.Println(strings.Repeat("-", len(fragTitle)))
+		if report, err := analyzeFragmentation(device); err != nil {
+			fmt.Printf("Unable to read the FAT: %v\n", err)
+		} else {
+			printFragmentationReport(report, 5)
+			if len(report.Fragmented) > 0 && float64(report.FragmentedBytes()) >= float64(report.Bytes)*0.1 {
+				printWarning("Fragmentation slows track loading and browsing on players. Run 'cdjf defrag %s' to rewrite the fragmented files.", device)
+			}
+		}
+	}
+
+	if !fsDetails {
+		return
+	}
+
+	fmt.Println()
+	bootTitle := "Boot Sector:"
+	fmt.Println(bootTitle)
+	fmt.Println(strings.Repeat("-", len(bootTitle)))
+	boot, offset, err := readBootSector(device)
+	if err != nil {
+		printError("Error reading boot sector: %v", err)
+		unlock()
+		os.Exit(1)
+	}
+	printBootSector(boot, offset)
+}
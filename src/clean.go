@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// rekordboxLayout is one way rekordbox lays out an export. A drive can hold
+// both when it has been exported from more than one version.
+type rekordboxLayout struct {
+	Name string
+	// Marker is the file, relative to the volume root, whose presence shows
+	// the layout is on the drive.
+	Marker string
+}
+
+var (
+	rekordboxPDBLayout     = rekordboxLayout{"rekordbox 6 and earlier (export.pdb)", "PIONEER/rekordbox/export.pdb"}
+	rekordboxLibraryLayout = rekordboxLayout{"Device Library Plus, rekordbox 6.8 and later (exportLibrary.db)", "PIONEER/rekordbox/exportLibrary.db"}
+	rekordboxLayouts       = []rekordboxLayout{rekordboxPDBLayout, rekordboxLibraryLayout}
+)
+
+// rekordboxLeftoverRule recognizes files a crashed or interrupted rekordbox
+// export leaves behind. Players read the PIONEER folder as a whole, and some
+// refuse a stick outright when it holds half-written analysis files or a
+// database with a journal next to it.
+type rekordboxLeftoverRule struct {
+	// Layout is the export the rule applies to; nil applies to every drive
+	// with a PIONEER folder.
+	Layout *rekordboxLayout
+	Reason string
+	// Keep marks files that are reported but never deleted, because they
+	// can hold data the export still needs.
+	Keep bool
+	// Match gets the path relative to PIONEER in lower case.
+	Match func(rel string, info fs.FileInfo) bool
+}
+
+var rekordboxLeftoverRules = []rekordboxLeftoverRule{
+	{
+		Reason: "unfinished ANLZ analysis file",
+		Match: func(rel string, info fs.FileInfo) bool {
+			name := filepath.Base(rel)
+			return strings.HasPrefix(rel, "usbanlz/") && (strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, "~"))
+		},
+	},
+	{
+		Reason: "empty ANLZ analysis file",
+		Match: func(rel string, info fs.FileInfo) bool {
+			switch filepath.Ext(rel) {
+			case ".dat", ".ext", ".2ex":
+				return strings.HasPrefix(rel, "usbanlz/") && info.Size() == 0
+			}
+			return false
+		},
+	},
+	{
+		Reason: "export lock",
+		Match: func(rel string, info fs.FileInfo) bool {
+			return strings.HasSuffix(rel, ".lock") || strings.HasSuffix(rel, ".lck")
+		},
+	},
+	{
+		Layout: &rekordboxPDBLayout,
+		Reason: "stale export journal",
+		Match: func(rel string, info fs.FileInfo) bool {
+			return strings.HasPrefix(rel, "rekordbox/") && strings.HasSuffix(rel, ".edb")
+		},
+	},
+	{
+		Layout: &rekordboxPDBLayout,
+		Reason: "unfinished export database",
+		Match: func(rel string, info fs.FileInfo) bool {
+			return strings.HasPrefix(rel, "rekordbox/") && strings.HasSuffix(rel, ".pdb.tmp")
+		},
+	},
+	{
+		// SQLite keeps committed changes in the WAL until a checkpoint
+		// writes them into the database, and a rollback journal is needed to
+		// undo a half-written transaction, so deleting either loses or
+		// corrupts the library.
+		Layout: &rekordboxLibraryLayout,
+		Reason: "Device Library Plus journal, not deleted",
+		Keep:   true,
+		Match: func(rel string, info fs.FileInfo) bool {
+			for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+				if rel == "rekordbox/exportlibrary.db"+suffix {
+					return true
+				}
+			}
+			return false
+		},
+	},
+}
+
+// rekordboxLeftover is a file on a drive that a rule matched.
+type rekordboxLeftover struct {
+	// Path is relative to the volume root.
+	Path   string
+	Size   int64
+	Reason string
+	Keep   bool
+}
+
+// detectRekordboxLayouts returns the export layouts found on a volume.
+func detectRekordboxLayouts(mountPoint string) []rekordboxLayout {
+	var found []rekordboxLayout
+	for _, layout := range rekordboxLayouts {
+		if _, err := os.Stat(filepath.Join(mountPoint, filepath.FromSlash(layout.Marker))); err == nil {
+			found = append(found, layout)
+		}
+	}
+	return found
+}
+
+// findRekordboxLeftovers walks the PIONEER folder of a volume for files the
+// rules for the given layouts match. A volume without one has nothing to clean.
+func findRekordboxLeftovers(mountPoint string, layouts []rekordboxLayout) ([]rekordboxLeftover, error) {
+	root := filepath.Join(mountPoint, "PIONEER")
+	var leftovers []rekordboxLeftover
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relToRoot, _ := filepath.Rel(root, path)
+		rel := strings.ToLower(filepath.ToSlash(relToRoot))
+		for _, rule := range rekordboxLeftoverRules {
+			if rule.Layout != nil && !containsLayout(layouts, *rule.Layout) {
+				continue
+			}
+			if rule.Match(rel, info) {
+				volumeRel, _ := filepath.Rel(mountPoint, path)
+				leftovers = append(leftovers, rekordboxLeftover{Path: filepath.ToSlash(volumeRel), Size: info.Size(), Reason: rule.Reason, Keep: rule.Keep})
+				break
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	sort.Slice(leftovers, func(i, j int) bool { return leftovers[i].Path < leftovers[j].Path })
+	return leftovers, err
+}
+
+func containsLayout(layouts []rekordboxLayout, layout rekordboxLayout) bool {
+	for _, candidate := range layouts {
+		if candidate == layout {
+			return true
+		}
+	}
+	return false
+}
+
+func cleanDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Clean %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+
+	layouts := detectRekordboxLayouts(mountPoint)
+	if len(layouts) == 0 {
+		fmt.Println("Export: none found; checking for leftovers common to every rekordbox version")
+	}
+	for _, layout := range layouts {
+		fmt.Printf("Export: %s\n", layout.Name)
+	}
+
+	leftovers, err := findRekordboxLeftovers(mountPoint, layouts)
+	if err != nil {
+		printError("Error scanning %s: %v", mountPoint, err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	if len(leftovers) == 0 {
+		printOK("No rekordbox leftovers found.")
+		return
+	}
+
+	byReason := make(map[string][]string)
+	var deletable []rekordboxLeftover
+	var total int64
+	kept := 0
+	for _, leftover := range leftovers {
+		byReason[leftover.Reason] = append(byReason[leftover.Reason], leftover.Path)
+		if leftover.Keep {
+			kept++
+			continue
+		}
+		deletable = append(deletable, leftover)
+		total += leftover.Size
+	}
+	for _, reason := range sortedKeys(byReason) {
+		fmt.Printf("%s (%d):\n", reason, len(byReason[reason]))
+		printPathList(byReason[reason], 10)
+	}
+	if kept > 0 {
+		printWarning("%d Device Library Plus journal file(s) may hold library changes not yet written to exportLibrary.db. Connect the drive to rekordbox so it can finish writing them, or export the drive again.", kept)
+	}
+	if len(deletable) == 0 {
+		return
+	}
+	fmt.Printf("%d file(s), %s in total, can be deleted.\n", len(deletable), formatByteSize(total))
+	if dryRun {
+		return
+	}
+
+	if err := checkWriteProtection(device, true); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	// rekordbox may still be writing the export these files belong to.
+	holders, err := findVolumeHolders(device, mountPoint)
+	if err != nil {
+		printError("Error: unable to check whether programs have files open on %s: %v", device, err)
+		os.Exit(1)
+	}
+	if len(holders) > 0 {
+		var names []string
+		for _, holder := range holders {
+			names = append(names, fmt.Sprintf("%s (PID %d)", holder.Process, holder.PID))
+		}
+		printError("Error: %s has files open on %s; nothing was deleted. Quit it and run clean again, or see 'cdjf busy %s'.", strings.Join(names, ", "), device, device)
+		os.Exit(1)
+	}
+	if !skipConfirm {
+		response := ask("clean", "Delete these files? (y/N): ")
+		if response != "y" && response != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	deleted := 0
+	for _, leftover := range deletable {
+		if err := os.Remove(filepath.Join(mountPoint, filepath.FromSlash(leftover.Path))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			warn(device, warnSetup, "Unable to delete %s: %v", leftover.Path, err)
+			continue
+		}
+		deleted++
+	}
+	forgetDriveInfo()
+	printOK("Deleted %d of %d file(s).", deleted, len(deletable))
+	fmt.Println("If rekordbox crashed during an export, export the drive again so its library is complete.")
+}
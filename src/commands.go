@@ -1,6 +1,11 @@
 package main
 
-import "github.com/spf13/cobra"
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
 
 var version = "0.1.0"
 
@@ -10,7 +15,10 @@ var rootCmd = &cobra.Command{
 	Long: `CDJF is a command line tool designed to help DJs prepare USB drives
 for use on standalone systems with rekordbox.
 
-It formats drives to FAT32 with optimal settings for rekordbox compatibility on macOS and Windows.`,
+It formats drives to FAT32 with optimal settings for rekordbox compatibility on macOS and Windows.
+
+Every flag can also be set with a CDJF_* environment variable named after it,
+for example CDJF_LABEL=REKORDBOX or CDJF_YES=true.`,
 	Version: version,
 }
 
@@ -21,10 +29,18 @@ var formatCmd = &cobra.Command{
 
 WARNING: This will erase all data on the selected drive(s)!
 
+New partitions start on a 1 MiB boundary, which flash drives write fastest at.
+On Windows that applies to --docs-partition, since a plain format keeps the
+existing partition table. On macOS it applies to the default single MBR
+partition, which cdjf moves when diskutil places it elsewhere; GPT layouts and
+--docs-partition keep diskutil's offsets. A misaligned result is reported after
+the format.
+
 Examples:
 	cdjf format disk2          (macOS - single drive)
 	cdjf format E:             (Windows - single drive)
-	cdjf format F: G: H:       (Windows - multiple drives)`,
+	cdjf format F: G: H:       (Windows - multiple drives)
+	cdjf format --target cdj3000 disk2`,
 	Args: cobra.MinimumNArgs(0),
 	Run:  formatDrive,
 }
@@ -32,8 +48,24 @@ Examples:
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available drives",
-	Long:  `List all available drives that can be formatted for rekordbox.`,
-	Run:   listDrives,
+	Long: `List all available drives that can be formatted for rekordbox.
+
+Drives are queried a few at a time and each is printed as soon as it answers,
+so one slow card reader does not hold up the list. A drive that has not
+answered within --timeout is reported and skipped.
+
+Filter with --min-size and --fs, include internal drives with --all, and sort
+with --sort. Sorting by speed uses each drive's last benchmark, saved by any
+command that benchmarks it. --compact prints one short line per drive.
+
+Drives cdjf has prepared or checked before show when that last happened, such
+as "formatted 3 days ago, verified OK 2 days ago".
+
+Examples:
+	cdjf list --min-size 16GB --fs fat32
+	cdjf list --sort speed
+	cdjf list --compact --sort label`,
+	Run: listDrives,
 }
 
 var ejectCmd = &cobra.Command{
@@ -60,6 +92,99 @@ Examples:
 	Run:  showDriveInfo,
 }
 
+var lockCmd = &cobra.Command{
+	Use:   "lock [device]",
+	Short: "Make a drive read-only",
+	Long: `Mark a drive's volume read-only so a finished gig stick can't be modified by accident.
+
+macOS remounts the volume read-only until it is next mounted. Windows sets the
+disk's read-only attribute until 'cdjf unlock' is run.
+
+Examples:
+	cdjf lock disk2       (macOS)
+	cdjf lock E:          (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  lockDrive,
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock [device]",
+	Short: "Make a locked drive writable again",
+	Long: `Remove the read-only lock set by 'cdjf lock'.
+
+Examples:
+	cdjf unlock disk2     (macOS)
+	cdjf unlock E:        (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  unlockDrive,
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check [device]",
+	Short: "Inspect a drive's partition table and filesystem",
+	Long: `Inspect a drive's partition layout and filesystem for player compatibility problems.
+
+Use --fs-details to decode the FAT boot sector (bytes per sector, sectors per
+cluster, FAT count, volume ID, and label) exactly as the player will see it.
+Reading the raw device may require sudo (macOS) or an administrator prompt (Windows).
+
+Use --names to find file names that players may not show or load, and
+--fix-names to rename them. Use --times and --fix-times to normalize file
+modification times to what FAT can store.
+
+When the drive holds a rekordbox export, the tracks in export.pdb are matched
+against the files on the drive: missing files show on players but do not
+play, and audio files missing from the export do not show at all.
+
+The drive is made read-only while it is inspected, as with cdjf lock, and
+writable again afterwards, so a check can never change it. --fix-names and
+--fix-times leave it writable; --no-lock skips the lock.
+
+Examples:
+	cdjf check disk2                 (macOS)
+	cdjf check --fs-details E:       (Windows)
+	cdjf check --fix-names E:        (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  checkDrive,
+}
+
+var preflightCmd = &cobra.Command{
+	Use:   "preflight [device]",
+	Short: "Check whether a finished stick is ready to play on a CDJ",
+	Long: `Run every check a DJ needs the night before a gig and report a single PASS/FAIL.
+
+Checks the filesystem, partition layout, the filesystem dirty bit, the presence of
+a rekordbox export (PIONEER/rekordbox/export.pdb), free space, and drive speed.
+It also warns about a label or file names in scripts the player has no font for,
+such as Cyrillic or CJK on older CDJs; the scripts come from --target, or from
+the profile's target and scripts.
+Checks that need raw device access are skipped without sudo (macOS) or an
+administrator prompt (Windows). Exits with status 1 when any check fails.
+
+Examples:
+	sudo cdjf preflight disk2                (macOS)
+	cdjf preflight E: --min-free 2GB         (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  preflightDrive,
+}
+
+var rescueCmd = &cobra.Command{
+	Use:   "rescue [device]",
+	Short: "Recover audio files from an accidentally quick-formatted drive",
+	Long: `Scan a quick-formatted FAT32/FAT16/exFAT drive for surviving directory entries
+and MP3/WAV/AIFF/FLAC signatures, and copy anything found into a folder.
+
+The drive is only read. Stop using it immediately after an accidental format and
+save recovered files to a different drive.
+
+Examples:
+	sudo cdjf rescue disk2                    (macOS)
+	cdjf rescue E: --output D:\rescued        (Windows)
+	cdjf rescue E: --list                     (only list what was found)`,
+	Args: cobra.ExactArgs(1),
+	Run:  rescueDrive,
+}
+
 var verifyCmd = &cobra.Command{
 	Use:   "verify [device...]",
 	Short: "Run read/write integrity checks on a drive",
@@ -75,6 +200,486 @@ Examples:
 	Run:  verifyDrive,
 }
 
+var defragCmd = &cobra.Command{
+	Use:   "defrag [device]",
+	Short: "Rewrite fragmented files on a FAT32 drive contiguously",
+	Long: `Find files on a FAT32 drive whose clusters are scattered and rewrite each one so
+it is stored in one piece. Exports that rekordbox updates again and again
+fragment over time, and players then take longer to load tracks and browse.
+
+The drive's FAT is read directly, which needs sudo (macOS) or an administrator
+prompt (Windows). Files are rewritten through the mounted volume: each is copied
+and the copy replaces the original. Use --analyze to only report fragmentation.
+
+Examples:
+	sudo cdjf defrag disk2 --analyze     (macOS)
+	cdjf defrag E:                       (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  defragDrive,
+}
+
+var dupesCmd = &cobra.Command{
+	Use:   "dupes [device]",
+	Short: "Find duplicate tracks wasting space on a drive",
+	Long: `Find audio files on a drive with identical content, such as the same track
+exported into several folders over the years, and report how much space
+removing the extra copies would free. Nothing is deleted.
+
+Files of the same size are compared by a hash of their first and last 64KB,
+and only files that still match are hashed in full. The PIONEER and Engine
+Library folders are skipped. The drive is read-only while it is scanned
+unless --no-lock is given.
+
+Examples:
+	cdjf dupes /dev/sdb          (Linux)
+	cdjf dupes E: --limit 0      (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  findDriveDupes,
+}
+
+var sealCmd = &cobra.Command{
+	Use:   "seal [device]",
+	Short: "Record a signed manifest of every file on a drive",
+	Long: `Hash every file on a drive and save the list, signed, in the local drive
+inventory. Run cdjf verify-seal later to prove that nothing was added, removed,
+or changed in between, for example from prep to gig.
+
+The signature uses a key created in the cdjf config folder on first use, so a
+seal can only be verified on the computer that made it. Sealing again replaces
+the previous seal. The drive must report a serial number.
+
+Examples:
+	cdjf seal disk2      (macOS)
+	cdjf seal E:         (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  sealDrive,
+}
+
+var verifySealCmd = &cobra.Command{
+	Use:   "verify-seal [device]",
+	Short: "Report files changed on a drive since it was sealed",
+	Long: `Hash every file on a sealed drive again and list the files added, removed, or
+changed since cdjf seal. Exits with status 1 if anything changed. Files whose
+content is the same but whose modification time moved are counted separately.
+
+The drive is read-only while it is checked unless --no-lock is given.
+
+Examples:
+	cdjf verify-seal disk2      (macOS)
+	cdjf verify-seal E:         (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  verifyDriveSeal,
+}
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Compare the space lost to slack at different cluster sizes",
+	Long: `Model how much space partly filled clusters waste for a library, to help choose
+a cluster size. Nothing is read from a drive.
+
+Give the number of files and their average size. Repeat --files and --avg-size
+for groups of very different sizes, such as tracks and the artwork and ANLZ
+analysis files rekordbox writes for them.
+
+Examples:
+	cdjf estimate --files 4000 --avg-size 12MB --cluster 64K
+	cdjf estimate --files 4000 --avg-size 12MB --files 12000 --avg-size 30KB`,
+	Args: cobra.NoArgs,
+	Run:  estimateOverhead,
+}
+
+var fitCmd = &cobra.Command{
+	Use:   "fit [library-folder] [device]",
+	Short: "Check whether a music library will fit on a drive after formatting",
+	Long: `Work out whether a rekordbox export or music folder will fit on a drive once it
+is formatted, and by how much it falls short if not.
+
+Every file takes whole clusters, so a library of many small files needs more
+space than its size suggests. The filesystem and cluster size come from
+--target, --fs, and --cluster-size as with cdjf format. Exits with status 1
+when the library does not fit.
+
+Examples:
+	cdjf fit ~/Music/rekordbox-export disk2              (macOS)
+	cdjf fit D:\Music E: --target cdj3000                (Windows)`,
+	Args: cobra.ExactArgs(2),
+	Run:  fitLibrary,
+}
+
+var zerofreeCmd = &cobra.Command{
+	Use:   "zerofree [device]",
+	Short: "Overwrite a drive's free space with zeros",
+	Long: `Fill the free space of a drive with zeros, then delete the filler, so tracks
+that were deleted earlier cannot be recovered. Files on the drive are kept.
+
+Use this before handing a stick to another DJ. It writes the whole free space,
+so it takes about as long as filling the drive with music.
+
+Examples:
+	cdjf zerofree disk2     (macOS)
+	cdjf zerofree E: --yes  (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  zeroFreeDrive,
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean [device]",
+	Short: "Delete files a crashed rekordbox export left on a drive",
+	Long: `Find and delete the temporary files, locks, and journals that rekordbox leaves
+in the PIONEER folder when it crashes or the drive is pulled during an export.
+Some players refuse a stick that still has them.
+
+cdjf first detects which export layouts are on the drive (export.pdb from
+rekordbox 6 and earlier, exportLibrary.db from rekordbox 6.8 and later) and
+only looks for the leftovers of those. Your tracks and the export itself are
+never touched, and Device Library Plus journals are only reported, since they
+can hold library changes. Nothing is deleted while a program such as rekordbox
+has files open on the drive. Use --dry-run to only list what would be deleted.
+
+Examples:
+	cdjf clean disk2 --dry-run   (macOS)
+	cdjf clean E: --yes          (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  cleanDrive,
+}
+
+var busyCmd = &cobra.Command{
+	Use:   "busy [device]",
+	Short: "Show which programs have files open on a drive",
+	Long: `List the programs holding files open on a drive, the usual reason an eject or
+format fails because the volume is busy. Known culprits such as rekordbox,
+Spotlight, and Explorer come with a hint on how to release the drive. Exits
+with status 1 when any program has files open.
+
+macOS uses lsof and lists the open files too. Windows asks the Restart Manager,
+which names the programs but not their files, and cannot see folders that are
+merely open in Explorer or a command prompt.
+
+Examples:
+	cdjf busy disk2     (macOS)
+	cdjf busy E:        (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  showVolumeHolders,
+}
+
+var targetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "List built-in player and software targets",
+	Long: `List the built-in player and DJ software targets and the filesystem,
+partition scheme, cluster size, maximum recommended capacity, and folder
+skeleton each one selects.
+
+Examples:
+	cdjf targets
+	cdjf format --target cdj3000 disk2
+	cdjf format --target cdj2000nxs2 --cluster-size 16K E:`,
+	Args: cobra.NoArgs,
+	Run:  listTargets,
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Schedule periodic drive verification",
+	Long:  "Register a background job that runs preflight on your gig drives when they are connected and notifies you of failures.",
+}
+
+var scheduleVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check known drives periodically when they are connected",
+	Long: `Register a launchd agent (macOS) or Scheduled Task (Windows) that runs the
+preflight checks on connected drives once per interval and shows a desktop
+notification when one fails, so degrading sticks are caught before a gig.
+
+Drives are matched by volume label with --drive. Without --drive, any connected
+drive holding a rekordbox export is checked.
+
+Examples:
+	cdjf schedule verify --every 30d
+	cdjf schedule verify --every 2w --drive CDJ-MAIN --drive CDJ-BACKUP`,
+	Args: cobra.NoArgs,
+	Run:  scheduleVerify,
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove the scheduled verification job",
+	Args:  cobra.NoArgs,
+	Run:   scheduleRemove,
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run due scheduled checks (invoked by the OS scheduler)",
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	Run:    scheduleRun,
+}
+
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Capture a prepared drive as an image and flash it to other drives",
+	Long:  "Capture a \"golden\" prepared stick once and flash it to as many drives as you need.",
+}
+
+var imageCreateCmd = &cobra.Command{
+	Use:   "create [device] [file.img[.gz|.zst]]",
+	Short: "Capture a whole drive to an image file",
+	Long: `Copy a drive into an image file. FAT32 and exFAT drives are captured as
+allocated clusters only; other drives (or --full) are copied sector by sector.
+Names ending in .gz or .zst are compressed with gzip or zstd, and --encrypt
+seals the image with AES-256 under a passphrase. Reading the raw device
+requires sudo (macOS) or an administrator prompt (Windows).
+
+Examples:
+	sudo cdjf image create disk2 golden.img.gz               (macOS)
+	sudo cdjf image create disk2 golden.img.zst --encrypt    (macOS)
+	cdjf image create E: D:\images\golden.img                (Windows)`,
+	Args: cobra.ExactArgs(2),
+	Run:  imageCreate,
+}
+
+var imageWriteCmd = &cobra.Command{
+	Use:   "write [file.img[.gz|.zst]] [device...]",
+	Short: "Flash an image to one or more drives",
+	Long: `Write an image to one or more drives at once. The image is read a single time
+and each block is written to every drive concurrently. Each drive is then read
+back and checked against the image's SHA-256 unless --no-verify is given.
+Compressed and encrypted images are detected automatically; encrypted images
+prompt for their passphrase.
+
+Examples:
+	sudo cdjf image write golden.img.gz disk2 disk3 disk4   (macOS)
+	cdjf image write golden.img F: G: H:                    (Windows)`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  imageWrite,
+}
+
+var sendCmd = &cobra.Command{
+	Use:   "send [device]",
+	Short: "Share a drive's contents with another machine on the network",
+	Long: `Serve a drive to cdjf receive on another machine over TLS. Only allocated
+clusters of FAT32/exFAT drives are sent unless --full is given. The command
+prints the address, certificate fingerprint, and one-time secret the receiver
+needs, and waits for it to reconnect if the transfer is interrupted. A machine
+that connects without the secret is turned away before it is told anything
+about the drive.
+
+Examples:
+	sudo cdjf send disk2                (macOS)
+	cdjf send E: --listen :9000         (Windows)`,
+	Args: cobra.ExactArgs(1),
+	Run:  sendDrive,
+}
+
+var receiveCmd = &cobra.Command{
+	Use:   "receive [device]",
+	Short: "Replicate a drive being shared with cdjf send",
+	Long: `Connect to cdjf send on another machine and write its drive onto a local
+drive, erasing it. The connection is only trusted when the sender's
+certificate matches --fingerprint, and the sender only talks to a receiver
+that gives its one-time secret. The secret is asked for without echoing it,
+or read from --secret-file, so it never shows up in the process list or shell
+history. Interrupted transfers reconnect automatically, and running the same
+command again resumes where it stopped.
+
+Examples:
+	sudo cdjf receive disk3 --from 192.168.1.20:8790 --fingerprint 3F2A-91C0-...   (macOS)
+	cdjf receive F: --from 192.168.1.20:8790 --fingerprint 3F2A-91C0-...           (Windows)
+	cdjf receive disk3 --from 192.168.1.20:8790 --fingerprint 3F2A-91C0-... --secret-file - < secret.txt`,
+	Args: cobra.ExactArgs(1),
+	Run:  receiveDrive,
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP API for web and tablet frontends",
+	Long: `Serve a token-protected REST API so a locally hosted web UI or booth tablet
+can list drives and run format and verify jobs. Job output and progress are
+streamed as server-sent events.
+
+Endpoints:
+	GET  /api/drives                 List removable drives
+	GET  /api/drives/{device}        Drive details and partition table
+	POST /api/jobs                   Start a job: {"command": "format", "devices": ["disk2"], "options": {"label": "GIG"}}
+	GET  /api/jobs                   List jobs
+	GET  /api/jobs/{id}              Job state and full output
+	GET  /api/jobs/{id}/events       Live output, progress, and completion (text/event-stream)
+	POST /api/jobs/{id}/stream-token One-minute, single-use ?stream_token= for the events URL
+	GET  /metrics                    Prometheus metrics
+
+The API listens on 127.0.0.1 by default. Because it can erase drives, any
+address other machines can reach must be served over HTTPS with --tls-cert
+and --tls-key.
+
+Examples:
+	sudo cdjf serve
+	cdjf serve --token mysecret
+	sudo cdjf serve --listen :8787 --tls-cert booth.pem --tls-key booth-key.pem`,
+	Args: cobra.NoArgs,
+	Run:  serveAPI,
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run a long-lived JSON-RPC service for GUI frontends",
+	Long: `Listen on a local Unix socket for JSON-RPC 2.0 requests, one JSON message per
+line. Connected clients are pushed device.added, device.removed, job.output,
+job.progress, and job.done notifications instead of polling the CLI.
+
+Methods: drives.list, drives.info {"device"}, jobs.list, jobs.get {"id"},
+jobs.start {"command", "devices", "options"} (same request as cdjf serve).
+
+Examples:
+	sudo cdjf daemon
+	cdjf daemon --socket /tmp/cdjf.sock`,
+	Args: cobra.NoArgs,
+	Run:  runDaemon,
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the audit log of destructive operations",
+	Long: `Show formats, image writes, and received drives recorded in the audit log,
+oldest first. Each entry lists when it happened, who ran it, the drive's serial
+number and size, the label, and the outcome. The log is append-only.
+
+Examples:
+	cdjf history
+	cdjf history --limit 100
+	cdjf history --device disk4
+	cdjf history --json`,
+	Args: cobra.NoArgs,
+	Run:  showHistory,
+}
+
+var wizardCmd = &cobra.Command{
+	Use:   "wizard",
+	Short: "Prepare a drive step by step, without flags",
+	Long: `Walk through preparing a USB drive one question at a time: pick the drive from
+the connected drives, pick the player it is for, name it, and check a summary
+before anything is erased. The drive is then formatted, verified, and ejected.`,
+	Args: cobra.NoArgs,
+	Run:  runWizard,
+}
+
+var manCmd = &cobra.Command{
+	Use:   "man [directory]",
+	Short: "Write man pages for every command",
+	Long: `Write a man page for every cdjf command and help topic. Commands go into the
+man1 folder and help topics into man7 under the given directory, the current
+one by default.
+
+Examples:
+	cdjf man /usr/local/share/man
+	cdjf man ./man`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  generateManCommand,
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Check cdjf's config files",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check config.json and profiles.json for mistakes",
+	Long: `Check config.json, profiles.json, and any shared profiles file for syntax
+errors, misspelled or unknown fields, and invalid values. Each problem is reported
+with its line number and field.
+
+Examples:
+	cdjf config validate
+	cdjf config validate --profile-path /Volumes/Crew/cdjf`,
+	Args: cobra.NoArgs,
+	Run:  configValidate,
+}
+
+var contributeCmd = &cobra.Command{
+	Use:   "contribute [device]",
+	Short: "Share a drive's benchmark with the community database",
+	Long: `Benchmark a drive and submit its model, size, speeds, and grade to the community
+database set as "community_url" in config.json. The exact data is shown before
+anything is sent. Serial numbers, labels, and host or user names are never included.
+
+Examples:
+	cdjf contribute disk4
+	cdjf contribute E:`,
+	Args: cobra.ExactArgs(1),
+	Run:  contributeDrive,
+}
+
+var lookupCmd = &cobra.Command{
+	Use:   "lookup [model]",
+	Short: "Look up community benchmark results for a drive model",
+	Long: `Query the community database for aggregated benchmark results, to check how a
+stick performs before buying it.
+
+Examples:
+	cdjf lookup "SanDisk Ultra Fit"`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  lookupModel,
+}
+
+var driveDBCmd = &cobra.Command{
+	Use:   "drivedb",
+	Short: "Show or update the database of problem drives",
+	Long: `cdjf ships a small database of drive models and USB vendors known to misbehave
+on Pioneer players. list, info, and preflight warn when a connected drive matches.`,
+}
+
+var driveDBListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the known problem drives",
+	Args:  cobra.NoArgs,
+	Run:   driveDBList,
+}
+
+var driveDBUpdateCmd = &cobra.Command{
+	Use:   "update [file or URL]",
+	Short: "Install a newer drive database",
+	Long: `Install a drive database from a JSON file or an http(s) URL. It is used in
+addition to the built-in database.
+
+Examples:
+	cdjf drivedb update knowndrives.json
+	cdjf drivedb update https://example.com/cdjf/knowndrives.json`,
+	Args: cobra.ExactArgs(1),
+	Run:  driveDBUpdate,
+}
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage shortcuts for long command lines",
+	Long: `Save a command line under a short name and run it as if it were a built-in
+command. Extra arguments are appended to the saved command line.
+
+Examples:
+	cdjf alias add clubstick "format --profile club --countdown 5"
+	cdjf clubstick F:`,
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:   "add [name] [command line]",
+	Short: "Create or update an alias",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   aliasAdd,
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved aliases",
+	Args:  cobra.NoArgs,
+	Run:   aliasList,
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Delete an alias",
+	Args:  cobra.ExactArgs(1),
+	Run:   aliasRemove,
+}
+
 var profileCmd = &cobra.Command{
 	Use:   "profile",
 	Short: "Manage CDJF format profiles",
@@ -110,29 +715,238 @@ var profileDeleteCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().Bool("no-color", false, "Disable colored output (also honors NO_COLOR)")
+	rootCmd.PersistentFlags().CountP("verbose", "v", "Show each step of diskutil and format (-v), or their full output (-vv)")
+	rootCmd.PersistentFlags().String("profile-path", "", "Shared profiles file or folder merged with your own (also honors CDJF_PROFILE_PATH)")
+	rootCmd.PersistentFlags().String("record", "", "Record every external command, its output, and your answers to a transcript file")
+	rootCmd.PersistentFlags().StringArray("simulate", nil, "Use a simulated drive instead of real hardware, e.g. size=64GB,write=4MB/s,read=20MB/s,errors=0.001 (repeatable)")
+	rootCmd.PersistentFlags().Int("usb-retries", retryPolicy.Retries, "Times to retry a format or eject that fails with a transient USB error")
+	rootCmd.PersistentFlags().Duration("usb-retry-backoff", retryPolicy.Backoff, "Wait before the first retry, doubled after each one")
+	rootCmd.PersistentFlags().Duration("stall-timeout", stallTimeout, "Warn when a drive operation makes no progress for this long (0 disables)")
+	rootCmd.PersistentFlags().String("replay", "", "Replay a transcript recorded with --record instead of running external commands")
+	rootCmd.PersistentFlags().String("answers", "", "File of prompt answers such as 'eject: no', or - to read them from stdin; other prompts still ask")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if err := applyEnvFlags(cmd); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		noColor, _ := cmd.Flags().GetBool("no-color")
+		configureColor(noColor)
+		verbosity, _ = cmd.Flags().GetCount("verbose")
+		sharedProfilePath, _ = cmd.Flags().GetString("profile-path")
+		retryPolicy.Retries, _ = cmd.Flags().GetInt("usb-retries")
+		retryPolicy.Backoff, _ = cmd.Flags().GetDuration("usb-retry-backoff")
+		if retryPolicy.Retries < 0 || retryPolicy.Backoff < 0 {
+			printError("Error: --usb-retries and --usb-retry-backoff cannot be negative")
+			os.Exit(1)
+		}
+		stallTimeout, _ = cmd.Flags().GetDuration("stall-timeout")
+		simulate, _ := cmd.Flags().GetStringArray("simulate")
+		if err := startSimulation(simulate); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		answersPath, _ := cmd.Flags().GetString("answers")
+		if err := loadAnswers(answersPath); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		recordPath, _ := cmd.Flags().GetString("record")
+		replayPath, _ := cmd.Flags().GetString("replay")
+		if err := startTranscript(recordPath, replayPath); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		printWarningSummary()
+	}
+
 	rootCmd.AddCommand(formatCmd)
+	rootCmd.AddCommand(wizardCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(ejectCmd)
+	rootCmd.AddCommand(busyCmd)
 	rootCmd.AddCommand(infoCmd)
 	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(preflightCmd)
+	rootCmd.AddCommand(rescueCmd)
+	rootCmd.AddCommand(zerofreeCmd)
+	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(fitCmd)
+	rootCmd.AddCommand(estimateCmd)
+	rootCmd.AddCommand(dupesCmd)
+	rootCmd.AddCommand(sealCmd)
+	rootCmd.AddCommand(verifySealCmd)
+	rootCmd.AddCommand(defragCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(targetsCmd)
 	rootCmd.AddCommand(profileCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(imageCmd)
+	rootCmd.AddCommand(sendCmd)
+	rootCmd.AddCommand(receiveCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(aliasCmd)
+	rootCmd.AddCommand(driveDBCmd)
+	rootCmd.AddCommand(contributeCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(manCmd)
+	rootCmd.AddCommand(helpTopicCommands()...)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(lookupCmd)
+
+	imageCmd.AddCommand(imageCreateCmd)
+	imageCmd.AddCommand(imageWriteCmd)
+
+	scheduleCmd.AddCommand(scheduleVerifyCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+
+	driveDBCmd.AddCommand(driveDBListCmd)
+	driveDBCmd.AddCommand(driveDBUpdateCmd)
+
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
 
 	profileCmd.AddCommand(profileSaveCmd)
 	profileCmd.AddCommand(profileListCmd)
 	profileCmd.AddCommand(profileShowCmd)
 	profileCmd.AddCommand(profileDeleteCmd)
 
+	listCmd.Flags().Duration("timeout", 10*time.Second, "Skip drives that have not answered after this long (0 to wait indefinitely)")
+	listCmd.Flags().Bool("removable-only", true, "Only list removable drives")
+	listCmd.Flags().Bool("all", false, "Also list internal and system drives (same as --removable-only=false)")
+	listCmd.Flags().String("min-size", "", "Only list drives at least this large (e.g. 16GB)")
+	listCmd.Flags().String("fs", "", "Only list drives with this filesystem (e.g. fat32, exfat)")
+	listCmd.Flags().String("sort", "", "Sort by device, size, label, or speed (last benchmark) instead of listing drives as they answer")
+	listCmd.Flags().Bool("compact", false, "Print one short line per drive")
+
 	formatCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt")
 	formatCmd.Flags().StringP("label", "l", "REKORDBOX", "Volume label for the drive")
 	formatCmd.Flags().String("profile", "", "Apply settings from a saved profile")
 	formatCmd.Flags().String("cluster-size", "", "Cluster size to use when formatting (Windows only, e.g. 32K)")
+	formatCmd.Flags().String("target", "", "Player target to prepare the drive for (see 'cdjf targets')")
+	formatCmd.Flags().String("fs", "", "Filesystem to create, overriding the target (fat32, exfat, or udf - experimental)")
+	formatCmd.Flags().String("scheme", "", "Partition scheme to create, overriding the target (mbr or gpt)")
+	formatCmd.Flags().String("docs-partition", "", "Create a second documents partition of this size (e.g. 2GB)")
+	formatCmd.Flags().String("volume-id", "", "Volume ID to write after formatting: 'preserve' or XXXX-XXXX")
+	formatCmd.Flags().Bool("skip-benchmark", false, "Skip the pre-format speed test")
+	formatCmd.Flags().Bool("full-format", false, "Write every sector while formatting to find bad sectors (much slower than the default quick format)")
+	formatCmd.Flags().String("expect-size", "", "Refuse drives outside this capacity range, e.g. 57GB..60GB, 57GB.., or ..60GB")
+	formatCmd.Flags().String("expect-model", "", "Refuse drives whose vendor and model do not contain this text, e.g. \"SanDisk Ultra\"")
+	formatCmd.Flags().Bool("only-if-empty", false, "Refuse to format a drive that holds any user files, in case the wrong one was plugged in")
+	formatCmd.Flags().Bool("trim", false, "Discard the free space after formatting so USB SSDs stay fast (Windows)")
+	formatCmd.Flags().Bool("erase-bitlocker", false, "Allow erasing BitLocker-encrypted drives without asking (Windows)")
+	formatCmd.Flags().Bool("erase-apfs", false, "Allow destroying APFS containers and their volumes without asking (macOS)")
+	formatCmd.Flags().Bool("parallel-benchmark", false, "Benchmark all drives of a multi-drive format at once instead of one by one")
+	formatCmd.Flags().Int("countdown", 0, "Show the target drives and wait this many seconds before formatting; any key cancels")
+	formatCmd.Flags().Bool("notify", false, "Show a desktop notification when formatting finishes or fails")
+	formatCmd.Flags().Bool("bell", false, "Ring the terminal bell when formatting finishes or fails")
+	formatCmd.Flags().Bool("sound", false, "Play a system sound when formatting finishes or fails")
+	fitCmd.Flags().String("target", "", "Player or software target whose filesystem and cluster size to assume (see 'cdjf targets')")
+	fitCmd.Flags().String("fs", "", "Filesystem to assume, overriding the target (fat32, exfat, or udf)")
+	fitCmd.Flags().String("cluster-size", "", "Cluster size to assume (e.g. 32K); defaults to what the formatter picks")
+
+	defragCmd.Flags().Bool("analyze", false, "Only report fragmented files without rewriting them")
+	defragCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation")
+
+	estimateCmd.Flags().IntSlice("files", nil, "Number of files in a group (repeat for several groups)")
+	estimateCmd.Flags().StringSlice("avg-size", nil, "Average file size of a group (e.g. 12MB, 30KB)")
+	estimateCmd.Flags().String("cluster", "", "Cluster size you plan to use, highlighted in the table (e.g. 64K)")
+
+	dupesCmd.Flags().Int("limit", 20, "Number of duplicate groups to list, largest first (0 lists all)")
+	dupesCmd.Flags().Bool("no-lock", false, "Inspect without making the drive read-only first")
+
+	verifySealCmd.Flags().Bool("no-lock", false, "Inspect without making the drive read-only first")
+
+	zerofreeCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation")
+
+	cleanCmd.Flags().Bool("dry-run", false, "Only list the leftovers without deleting them")
+	cleanCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation")
+
 	verifyCmd.Flags().IntP("size", "s", 64, "Size of the integrity test file in megabytes")
+	verifyCmd.Flags().String("profile", "", "Apply the test size and speed thresholds from a saved profile")
+	verifyCmd.Flags().String("report", "", "Also save a shareable report per drive (html or pdf)")
+	verifyCmd.Flags().BoolP("yes", "y", false, "Skip the duration estimate and confirmation")
+	verifyCmd.Flags().Duration("confirm-over", 30*time.Minute, "Ask before starting when the estimated duration exceeds this (0 disables)")
+	verifyCmd.Flags().String("limit", "", "Cap read/write throughput (e.g. 20MB/s) to leave USB bandwidth for other devices")
+	verifyCmd.Flags().Bool("resume", false, "Continue an interrupted verification from its last checkpoint")
+	verifyCmd.Flags().Bool("notify", false, "Show a desktop notification when verification finishes or fails")
+	verifyCmd.Flags().Bool("bell", false, "Ring the terminal bell when verification finishes or fails")
+	verifyCmd.Flags().Bool("sound", false, "Play a system sound when verification finishes or fails")
+	infoCmd.Flags().String("profile", "", "Grade the benchmark with the thresholds from a saved profile")
+	checkCmd.Flags().Bool("fs-details", false, "Decode and show the FAT boot sector parameters")
+	checkCmd.Flags().Bool("names", false, "Look for file names that are too long, use characters players mishandle, or differ only by case")
+	checkCmd.Flags().Bool("fix-names", false, "Like --names, then offer to rename the problem files and save a list of the renames")
+	checkCmd.Flags().Int("max-name", defaultMaxNameLength, "Longest file name in characters for --names")
+	checkCmd.Flags().Bool("times", false, "Look for modification times FAT cannot store exactly, in the future, or out of range")
+	checkCmd.Flags().Bool("fix-times", false, "Like --times, then offer to round the times to FAT's two-second steps and clamp them")
+	checkCmd.Flags().Duration("shift-times", 0, "Move every modification time by this much (e.g. -1h) when fixing a drive written in another time zone")
+	checkCmd.Flags().Bool("no-lock", false, "Inspect without making the drive read-only first")
+
+	preflightCmd.Flags().String("min-free", "1GB", "Minimum free space required (e.g. 500MB, 2GB)")
+	preflightCmd.Flags().String("profile", "", "Grade the speed test with the thresholds from a saved profile")
+	preflightCmd.Flags().String("target", "", "Player target whose fonts to check names against (see 'cdjf targets'); defaults to the profile's target")
+	preflightCmd.Flags().String("report", "", "Also save a shareable report (html or pdf)")
+	scheduleVerifyCmd.Flags().String("every", "30d", "How often each drive is checked (e.g. 12h, 30d, 2w)")
+	scheduleVerifyCmd.Flags().StringSlice("drive", nil, "Volume label of a drive to check (repeatable)")
+	scheduleVerifyCmd.Flags().String("min-free", "1GB", "Minimum free space required (e.g. 500MB, 2GB)")
+
+	imageCreateCmd.Flags().Bool("full", false, "Copy every sector instead of only allocated clusters")
+	imageCreateCmd.Flags().String("compress", "auto", "Compression: auto (from the file name), none, gzip, or zstd")
+	imageCreateCmd.Flags().Bool("encrypt", false, "Encrypt the image with AES-256 using a passphrase")
+	imageWriteCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt")
+	imageWriteCmd.Flags().Bool("no-verify", false, "Skip reading each drive back after writing")
+
+	sendCmd.Flags().String("listen", ":8790", "Address to listen on")
+	sendCmd.Flags().Bool("full", false, "Send every sector instead of only allocated clusters")
+	receiveCmd.Flags().String("from", "", "Address printed by cdjf send (host:port)")
+	receiveCmd.Flags().String("fingerprint", "", "Certificate fingerprint printed by cdjf send")
+	receiveCmd.Flags().String("secret-file", "", "Read the one-time secret printed by cdjf send from this file (- for standard input) instead of asking for it")
+	receiveCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt")
+	receiveCmd.Flags().Bool("no-verify", false, "Skip reading the drive back after writing")
+	receiveCmd.Flags().Int("retries", 5, "Reconnect attempts before giving up")
+
+	serveCmd.Flags().String("listen", "127.0.0.1:8787", "Address to listen on; any address other machines can reach needs --tls-cert and --tls-key")
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate file (PEM) to serve HTTPS")
+	serveCmd.Flags().String("tls-key", "", "TLS private key file (PEM) for --tls-cert")
+	serveCmd.Flags().String("token", "", "API token clients must send (default: a random token printed at startup)")
+	daemonCmd.Flags().String("socket", "", "Socket path (default: cdjf.sock in the cdjf config folder)")
+	daemonCmd.Flags().String("metrics", "", "Also serve Prometheus metrics, without a token, on this address (e.g. 127.0.0.1:9787)")
+	// Everything after the alias name belongs to the saved command line.
+	aliasAddCmd.Flags().SetInterspersed(false)
+	contributeCmd.Flags().BoolP("yes", "y", false, "Submit without asking for confirmation")
+	historyCmd.Flags().Int("limit", 20, "Show at most this many recent entries (0 for all)")
+	historyCmd.Flags().String("device", "", "Only show entries for this device, serial number, or label")
+	historyCmd.Flags().Bool("json", false, "Print entries as JSON lines")
+
+	rescueCmd.Flags().StringP("output", "o", "", "Folder to save recovered files to (default: cdjf-rescue-<device>-<time>)")
+	rescueCmd.Flags().Bool("list", false, "Only list recoverable files without extracting them")
 
 	profileSaveCmd.Flags().String("label", "", "Set the default volume label")
 	profileSaveCmd.Flags().String("cluster-size", "", "Set the cluster size (Windows only, e.g. 32K)")
+	profileSaveCmd.Flags().String("target", "", "Set the default player target (see 'cdjf targets')")
+	profileSaveCmd.Flags().String("payload", "", "Folder whose contents are copied to every drive after formatting (empty to clear)")
+	profileSaveCmd.Flags().String("payload-order", payloadOrderMetadataFirst, "Order to copy the payload in: metadata-first (PIONEER and artwork before audio) or folder")
+	profileSaveCmd.Flags().StringSlice("scripts", nil, "Scripts your players show, checked by preflight (e.g. Latin,Cyrillic; empty for the target's default)")
+	profileSaveCmd.Flags().String("expect-size", "", "Capacity range every drive formatted with this profile must fall in, e.g. 57GB..60GB (empty to clear)")
+	profileSaveCmd.Flags().String("expect-model", "", "Vendor and model text every drive formatted with this profile must contain, e.g. \"SanDisk Ultra\" (empty to clear)")
+	profileSaveCmd.Flags().Bool("skip-benchmark", false, "Skip the pre-format speed test when formatting with this profile")
+	profileSaveCmd.Flags().Int("benchmark-size", 0, "Limit the pre-format speed test sample to this many megabytes (0 for the default)")
+	profileSaveCmd.Flags().Int("verify-size", 0, "Set the integrity test size used by 'cdjf verify' in megabytes (0 for the default)")
 	profileSaveCmd.Flags().Float64("extremely-slow", 0, "Threshold under which drives are classified as extremely slow (MB/s)")
 	profileSaveCmd.Flags().Float64("very-slow", 0, "Threshold under which drives are classified as very slow (MB/s)")
 	profileSaveCmd.Flags().Float64("slightly-slow", 0, "Threshold under which drives are classified as slightly slow (MB/s)")
 	profileSaveCmd.Flags().Float64("prompt", 0, "Threshold under which the formatter will prompt before continuing (MB/s)")
+	profileSaveCmd.Flags().Float64("read-extremely-slow", 0, "Read speed under which drives are classified as extremely slow (MB/s)")
+	profileSaveCmd.Flags().Float64("read-very-slow", 0, "Read speed under which drives are classified as very slow (MB/s)")
+	profileSaveCmd.Flags().Float64("read-slightly-slow", 0, "Read speed under which drives are classified as slightly slow (MB/s)")
+	profileSaveCmd.Flags().Float64("read-prompt", 0, "Read speed under which the formatter will prompt before continuing (MB/s)")
 	profileSaveCmd.Flags().Bool("reset-benchmarks", false, "Reset benchmark thresholds to defaults")
 }
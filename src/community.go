@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const communityTimeout = 15 * time.Second
+
+// CommunitySample is what 'cdjf contribute' submits. It deliberately carries
+// nothing that identifies the user or the individual drive: no serial number,
+// label, host name, or user name.
+type CommunitySample struct {
+	Model     string  `json:"model"`
+	VendorID  string  `json:"vendor_id,omitempty"`
+	SizeGB    int     `json:"size_gb"`
+	WriteMBps float64 `json:"write_mbps"`
+	ReadMBps  float64 `json:"read_mbps"`
+	Grade     string  `json:"grade"`
+	OS        string  `json:"os"`
+	Version   string  `json:"cdjf_version"`
+}
+
+// CommunityStats is the aggregate returned for a model by 'cdjf lookup'.
+type CommunityStats struct {
+	Model           string         `json:"model"`
+	Samples         int            `json:"samples"`
+	MedianWriteMBps float64        `json:"median_write_mbps"`
+	MedianReadMBps  float64        `json:"median_read_mbps"`
+	Grades          map[string]int `json:"grades"`
+}
+
+// communityURL returns the community database endpoint from config.json.
+func communityURL() (string, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	endpoint := strings.TrimRight(strings.TrimSpace(config.CommunityURL), "/")
+	if endpoint == "" {
+		return "", errors.New("no community database configured; set \"community_url\" in config.json")
+	}
+	return endpoint, nil
+}
+
+// communityGrade reduces a benchmark to a coarse, default-threshold grade so
+// samples from different users are comparable.
+func communityGrade(result BenchmarkResult) string {
+	write := writeRating(result, defaultBenchmarkThresholds)
+	read := readRating(result, defaultBenchmarkThresholds)
+	for _, rating := range []string{"extremely slow", "very slow", "slightly slow"} {
+		if write == rating || read == rating {
+			return rating
+		}
+	}
+	return "ok"
+}
+
+func contributeDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+
+	endpoint, err := communityURL()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	model := getDriveModel(device)
+	if model == "" {
+		printError("Error: %s does not report a model name, so there is nothing to contribute", device)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Benchmarking %s...\n", device)
+	result := benchmarkDrive(device)
+	if result.WriteMBps <= 0 || result.ReadMBps <= 0 {
+		printError("Error: unable to benchmark %s", device)
+		os.Exit(1)
+	}
+
+	sample := CommunitySample{
+		Model:     model,
+		VendorID:  getDriveVendorID(device),
+		SizeGB:    int(getDriveSize(device) + 0.5),
+		WriteMBps: result.WriteMBps,
+		ReadMBps:  result.ReadMBps,
+		Grade:     communityGrade(result),
+		OS:        runtime.GOOS,
+		Version:   version,
+	}
+	body, err := json.MarshalIndent(sample, "", "  ")
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	fmt.Println()
+	fmt.Printf("The following will be sent to %s:\n", endpoint)
+	fmt.Println(string(body))
+	if !skipConfirm {
+		response := ask("submit-result", "Submit this result? (y/N): ")
+		if response != "y" && response != "yes" {
+			fmt.Println("Nothing was sent.")
+			return
+		}
+	}
+
+	client := &http.Client{Timeout: communityTimeout}
+	resp, err := client.Post(endpoint+"/samples", "application/json", bytes.NewReader(body))
+	if err != nil {
+		printError("Error submitting result: %v", err)
+		os.Exit(1)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		printError("Error submitting result: %s", resp.Status)
+		os.Exit(1)
+	}
+	printOK("Thanks! Your result for %s was submitted.", model)
+}
+
+func lookupModel(cmd *cobra.Command, args []string) {
+	model := strings.Join(args, " ")
+	endpoint, err := communityURL()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	client := &http.Client{Timeout: communityTimeout}
+	resp, err := client.Get(endpoint + "/drives?model=" + url.QueryEscape(model))
+	if err != nil {
+		printError("Error querying the community database: %v", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Printf("No community results for %q yet.\n", model)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		printError("Error querying the community database: %s", resp.Status)
+		os.Exit(1)
+	}
+
+	var results []CommunityStats
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil {
+		err = json.Unmarshal(data, &results)
+	}
+	if err != nil {
+		printError("Error: unexpected response from the community database: %v", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 {
+		fmt.Printf("No community results for %q yet.\n", model)
+		return
+	}
+
+	title := fmt.Sprintf("Community results for %q", model)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	for _, stats := range results {
+		fmt.Printf("\n%s (%d samples)\n", stats.Model, stats.Samples)
+		fmt.Printf("  Median write: %.2f MB/s\n", stats.MedianWriteMBps)
+		fmt.Printf("  Median read: %.2f MB/s\n", stats.MedianReadMBps)
+		for _, grade := range sortedKeys(stats.Grades) {
+			fmt.Printf("  %s: %d\n", grade, stats.Grades[grade])
+		}
+	}
+}
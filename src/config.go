@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the settings in config.json in the cdjf config folder.
+type Config struct {
+	// Version is the file's format version, see configSchemaVersion.
+	Version int `json:"version,omitempty"`
+
+	Hooks    map[string][]string `json:"hooks,omitempty"`
+	Webhooks []string            `json:"webhooks,omitempty"`
+
+	// Allowlist, when set, limits cdjf to drives with these serial numbers.
+	// Blocklist names serials cdjf must never touch.
+	Allowlist []string `json:"allowlist,omitempty"`
+	Blocklist []string `json:"blocklist,omitempty"`
+
+	// Aliases maps a name to the cdjf command line it runs.
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// CommunityURL is the drive performance database used by contribute and
+	// lookup. Nothing is sent unless it is set.
+	CommunityURL string `json:"community_url,omitempty"`
+}
+
+func configPath() (string, error) {
+	return configFilePath("config.json")
+}
+
+// loadConfig reads config.json. A missing file is an empty config.
+func loadConfig() (Config, error) {
+	var config Config
+	path, err := configPath()
+	if err != nil {
+		return config, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	data, err = migrateConfigData(path, data, configSchemaVersion, configMigrations)
+	if err != nil {
+		return config, err
+	}
+	if err := decodeConfigJSON(data, &config, false); err != nil {
+		return config, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// saveConfig writes config.json, creating the config folder if needed.
+func saveConfig(config Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	config.Version = configSchemaVersion
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// configProblem is one mistake found in a config file, located by the JSON
+// path of the field and, when known, its line.
+type configProblem struct {
+	Line    int
+	Field   string
+	Message string
+}
+
+func (p configProblem) String() string {
+	location := p.Field
+	if p.Line > 0 && location != "" {
+		location = fmt.Sprintf("line %d: %s", p.Line, p.Field)
+	} else if p.Line > 0 {
+		location = fmt.Sprintf("line %d", p.Line)
+	}
+	if location == "" {
+		return p.Message
+	}
+	return location + ": " + p.Message
+}
+
+// decodeConfigJSON decodes a config file and turns encoding/json errors into
+// messages that name the line and field at fault. In strict mode, fields cdjf
+// does not know about are reported too, since they are usually typos.
+func decodeConfigJSON(data []byte, v any, strict bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return describeJSONError(data, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		line, _ := lineColumn(data, decoder.InputOffset())
+		return fmt.Errorf("line %d: unexpected content after the closing }", line)
+	}
+	return nil
+}
+
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, column := lineColumn(data, syntaxErr.Offset)
+		message := strings.TrimPrefix(syntaxErr.Error(), "json: ")
+		if strings.Contains(message, "looking for beginning of object key string") ||
+			strings.Contains(message, "looking for beginning of value") {
+			message += " (is there a trailing comma or a missing quote?)"
+		}
+		return fmt.Errorf("line %d, column %d: %s", line, column, message)
+	case errors.As(err, &typeErr):
+		line, _ := lineColumn(data, typeErr.Offset)
+		field := typeErr.Field
+		if field == "" {
+			return fmt.Errorf("line %d: the file must contain %s", line, jsonTypeName(typeErr.Type))
+		}
+		return fmt.Errorf("line %d: %s must be %s, not %s", line, field, jsonTypeName(typeErr.Type), jsonValueName(typeErr.Value))
+	case errors.Is(err, io.EOF):
+		return errors.New("the file is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		line, _ := lineColumn(data, int64(len(data)))
+		return fmt.Errorf("line %d: the file ends unexpectedly; check for a missing } or ]", line)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if path, line := findJSONField(data, name); line > 0 {
+			return fmt.Errorf("line %d: unknown field %s", line, path)
+		}
+		return fmt.Errorf("unknown field %q", name)
+	}
+	return err
+}
+
+// lineColumn converts a byte offset into a 1-based line and column.
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "text in quotes"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Float64, reflect.Float32:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list [...]"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "an object {...}"
+	}
+	return t.String()
+}
+
+func jsonValueName(value string) string {
+	switch value {
+	case "string":
+		return "text"
+	case "bool":
+		return "true/false"
+	case "array":
+		return "a list"
+	case "object":
+		return "an object"
+	}
+	return value
+}
+
+// jsonFieldLines maps the dotted path of every field in a JSON document to
+// the line it is on, e.g. "profiles.club.label" or "webhooks[1]".
+func jsonFieldLines(data []byte) map[string]int {
+	type frame struct {
+		path      string
+		object    bool
+		expectKey bool
+		key       string
+		index     int
+	}
+
+	lines := make(map[string]int)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var stack []*frame
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return lines
+		}
+		line, _ := lineColumn(data, decoder.InputOffset())
+
+		if delim, ok := token.(json.Delim); ok && (delim == '}' || delim == ']') {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && top.object && top.expectKey {
+			name, _ := token.(string)
+			top.key = joinJSONPath(top.path, name)
+			top.expectKey = false
+			lines[top.key] = line
+			continue
+		}
+
+		path := ""
+		if top != nil {
+			if top.object {
+				path = top.key
+				top.expectKey = true
+			} else {
+				path = fmt.Sprintf("%s[%d]", top.path, top.index)
+				top.index++
+				lines[path] = line
+			}
+		}
+		if delim, ok := token.(json.Delim); ok {
+			stack = append(stack, &frame{path: path, object: delim == '{', expectKey: delim == '{'})
+		}
+	}
+}
+
+func joinJSONPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// findJSONField returns the first field called name and its line.
+func findJSONField(data []byte, name string) (string, int) {
+	best, bestLine := "", 0
+	for path, line := range jsonFieldLines(data) {
+		if path != name && !strings.HasSuffix(path, "."+name) {
+			continue
+		}
+		if bestLine == 0 || line < bestLine {
+			best, bestLine = path, line
+		}
+	}
+	return best, bestLine
+}
+
+func validateConfigFile(config Config) []configProblem {
+	var problems []configProblem
+	add := func(field, format string, args ...any) {
+		problems = append(problems, configProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if config.Version > configSchemaVersion {
+		add("version", "written by a newer cdjf (this version understands format version %d)", configSchemaVersion)
+	}
+
+	for _, hook := range sortedKeys(config.Hooks) {
+		field := "hooks." + hook
+		switch hook {
+		case hookPreFormat, hookPostFormat, hookPostVerify:
+		default:
+			add(field, "unknown hook; use %s, %s, or %s", hookPreFormat, hookPostFormat, hookPostVerify)
+		}
+		for i, command := range config.Hooks[hook] {
+			if strings.TrimSpace(command) == "" {
+				add(fmt.Sprintf("%s[%d]", field, i), "hook command is empty")
+			}
+		}
+	}
+
+	for i, webhook := range config.Webhooks {
+		if err := validateHTTPURL(webhook); err != nil {
+			add(fmt.Sprintf("webhooks[%d]", i), "%v", err)
+		}
+	}
+
+	blocked := make(map[string]bool)
+	for i, serial := range config.Blocklist {
+		if strings.TrimSpace(serial) == "" {
+			add(fmt.Sprintf("blocklist[%d]", i), "serial number is empty")
+		}
+		blocked[strings.ToLower(strings.TrimSpace(serial))] = true
+	}
+	for i, serial := range config.Allowlist {
+		field := fmt.Sprintf("allowlist[%d]", i)
+		switch {
+		case strings.TrimSpace(serial) == "":
+			add(field, "serial number is empty")
+		case blocked[strings.ToLower(strings.TrimSpace(serial))]:
+			add(field, "%s is on both the allowlist and the blocklist", serial)
+		}
+	}
+
+	for _, name := range sortedKeys(config.Aliases) {
+		field := "aliases." + name
+		if !aliasNameRegex.MatchString(name) {
+			add(field, "alias names may only contain letters, digits, '-' and '_'")
+			continue
+		}
+		if isBuiltinCommand(name) {
+			add(field, "%q is a built-in command and cannot be used as an alias", name)
+			continue
+		}
+		expanded, err := splitCommandLine(config.Aliases[name])
+		if err != nil {
+			add(field, "%v", err)
+		} else if len(expanded) == 0 || !isBuiltinCommand(expanded[0]) {
+			add(field, "an alias must start with a cdjf command, e.g. \"format --profile club\"")
+		}
+	}
+
+	if config.CommunityURL != "" {
+		if err := validateHTTPURL(config.CommunityURL); err != nil {
+			add("community_url", "%v", err)
+		}
+	}
+	return problems
+}
+
+func validateHTTPURL(value string) error {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http:// or https:// URL", value)
+	}
+	return nil
+}
+
+func validateProfiles(store profileStore) []configProblem {
+	var problems []configProblem
+	add := func(field, format string, args ...any) {
+		problems = append(problems, configProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if store.Version > profileSchemaVersion {
+		add("version", "written by a newer cdjf (this version understands format version %d)", profileSchemaVersion)
+	}
+
+	for _, key := range sortedKeys(store.Profiles) {
+		profile := store.Profiles[key]
+		field := "profiles." + key
+		if expected, err := profileMapKey(key); err != nil || expected != key {
+			add(field, "profile keys must be lower case with no surrounding spaces")
+		}
+		if profile.ClusterSize != "" {
+			if _, err := normalizeClusterSize(profile.ClusterSize); err != nil {
+				add(field+".cluster_size", "%v", err)
+			}
+		}
+		if profile.Target != "" {
+			if _, err := lookupTarget(profile.Target); err != nil {
+				add(field+".target", "%v", err)
+			}
+		}
+		if profile.VerifySizeMB < 0 {
+			add(field+".verify_size_mb", "cannot be negative")
+		}
+		if profile.BenchmarkSizeMB < 0 {
+			add(field+".benchmark_size_mb", "cannot be negative")
+		}
+		if profile.Payload != "" {
+			if info, err := os.Stat(profile.Payload); err != nil || !info.IsDir() {
+				add(field+".payload", "%s is not an existing folder", profile.Payload)
+			}
+		}
+		if _, err := normalizePayloadOrder(profile.PayloadOrder); err != nil {
+			add(field+".payload_order", "%v", err)
+		}
+		if _, err := normalizeScripts(profile.Scripts); err != nil {
+			add(field+".scripts", "%v", err)
+		}
+		if _, err := parseSizeRange(profile.ExpectSize); err != nil {
+			add(field+".expect_size", "%v", err)
+		}
+		if profile.BenchmarkThresholds != nil {
+			if err := validateBenchmarkThresholds(mergedBenchmarkThresholds(profile.BenchmarkThresholds)); err != nil {
+				add(field+".benchmark_thresholds", "%v", err)
+			}
+		}
+	}
+	return problems
+}
+
+// checkConfigFile validates one file and prints what it found. It returns
+// false when the file has problems.
+func checkConfigFile(title, path string, validate func(data []byte) ([]configProblem, error)) bool {
+	fmt.Printf("%s (%s)\n", title, path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("  not found; defaults are used")
+		return true
+	}
+	if err != nil {
+		printError("  unable to read: %v", err)
+		return false
+	}
+
+	problems, err := validate(data)
+	if err != nil {
+		printError("  %v", err)
+		return false
+	}
+	if len(problems) == 0 {
+		printOK("  OK")
+		return true
+	}
+
+	lines := jsonFieldLines(data)
+	for i := range problems {
+		problems[i].Line = lines[problems[i].Field]
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	for _, problem := range problems {
+		printError("  %s", problem)
+	}
+	return false
+}
+
+func configValidate(cmd *cobra.Command, args []string) {
+	ok := true
+
+	if path, err := configPath(); err != nil {
+		printError("Error: %v", err)
+		ok = false
+	} else {
+		ok = checkConfigFile("Config", path, func(data []byte) ([]configProblem, error) {
+			var config Config
+			if err := decodeConfigJSON(data, &config, true); err != nil {
+				return nil, err
+			}
+			return validateConfigFile(config), nil
+		}) && ok
+	}
+
+	validateStore := func(data []byte) ([]configProblem, error) {
+		var store profileStore
+		if err := decodeConfigJSON(data, &store, true); err != nil {
+			return nil, err
+		}
+		return validateProfiles(store), nil
+	}
+	if path, err := profileConfigPath(); err != nil {
+		printError("Error: %v", err)
+		ok = false
+	} else {
+		ok = checkConfigFile("Profiles", path, validateStore) && ok
+	}
+	if path := sharedProfileStorePath(); path != "" {
+		ok = checkConfigFile("Shared profiles", path, validateStore) && ok
+	}
+
+	fmt.Println()
+	if !ok {
+		printError("Problems found. Fix the lines above and run 'cdjf config validate' again.")
+		os.Exit(1)
+	}
+	printOK("All config files are valid.")
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	daemonPollInterval = 2 * time.Second
+
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// rpcMessage is a JSON-RPC 2.0 request, response, or notification.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// rpcClient is one frontend connected to the daemon. Writes are serialized
+// because notifications and responses are sent from different goroutines.
+type rpcClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+func (c *rpcClient) send(message rpcMessage) error {
+	message.JSONRPC = "2.0"
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.enc.Encode(message)
+}
+
+// daemon serves the JSON-RPC API and pushes device and job events to every
+// connected client.
+type daemon struct {
+	api *apiServer
+
+	mu      sync.Mutex
+	clients map[*rpcClient]struct{}
+}
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	socketPath, _ := cmd.Flags().GetString("socket")
+	metricsAddress, _ := cmd.Flags().GetString("metrics")
+
+	executable, err := os.Executable()
+	if err != nil {
+		printError("Error: unable to locate the cdjf executable: %v", err)
+		os.Exit(1)
+	}
+	if socketPath == "" {
+		if socketPath, err = configFilePath("cdjf.sock"); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	listener, err := listenDaemonSocket(socketPath)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	defer os.Remove(socketPath)
+
+	d := &daemon{
+		api:     &apiServer{executable: executable, jobs: make(map[string]*apiJob), metrics: newServerMetrics()},
+		clients: make(map[*rpcClient]struct{}),
+	}
+	d.api.jobStarted = d.followJob
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		listener.Close()
+	}()
+
+	fmt.Printf("CDJF daemon listening on %s (JSON-RPC 2.0, one message per line)\n", socketPath)
+	go d.watchDevices()
+	if metricsAddress != "" {
+		go d.serveMetrics(metricsAddress)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			printError("Error: %v", err)
+			continue
+		}
+		go d.serveClient(conn)
+	}
+}
+
+// serveMetrics exposes /metrics over HTTP for Prometheus.
+func (d *daemon) serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", d.api.handleMetrics)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Printf("Metrics available at http://%s/metrics\n", address)
+	if err := server.ListenAndServe(); err != nil {
+		printWarning("Metrics endpoint stopped: %v", err)
+	}
+}
+
+// listenDaemonSocket opens the Unix socket (also supported by Windows 10 and
+// later), replacing a stale socket left by a daemon that did not shut down.
+func listenDaemonSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %v", filepath.Dir(path), err)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("a cdjf daemon is already running on %s", path)
+	}
+	os.Remove(path)
+
+	// Only the current user may drive the daemon, so the socket must never
+	// exist with looser permissions, not even for a moment.
+	listener, err := listenPrivateSocket(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %v", path, err)
+	}
+	return listener, nil
+}
+
+func (d *daemon) serveClient(conn net.Conn) {
+	client := &rpcClient{conn: conn, enc: json.NewEncoder(conn)}
+	d.mu.Lock()
+	d.clients[client] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, client)
+		d.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var request rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			client.send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+		if request.Method == "" {
+			client.send(rpcMessage{ID: request.ID, Error: &rpcError{Code: rpcInvalidRequest, Message: "method is required"}})
+			continue
+		}
+		// Requests may take a while (drive info reads the disk), so each runs
+		// on its own and answers when ready.
+		go func(request rpcMessage) {
+			result, rpcErr := d.call(request.Method, request.Params)
+			if len(request.ID) == 0 {
+				return
+			}
+			client.send(rpcMessage{ID: request.ID, Result: result, Error: rpcErr})
+		}(request)
+	}
+}
+
+func (d *daemon) call(method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "drives.list":
+		return listDriveInfo(), nil
+
+	case "drives.info":
+		var args struct {
+			Device string `json:"device"`
+		}
+		if err := decodeRPCParams(params, &args); err != nil {
+			return nil, err
+		}
+		details, err := driveDetails(args.Device)
+		if err != nil {
+			return nil, rpcFailure(err)
+		}
+		return details, nil
+
+	case "jobs.list":
+		return d.api.listJobs(), nil
+
+	case "jobs.get":
+		var args struct {
+			ID string `json:"id"`
+		}
+		if err := decodeRPCParams(params, &args); err != nil {
+			return nil, err
+		}
+		job := d.api.job(args.ID)
+		if job == nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "job not found"}
+		}
+		return job.snapshot(true), nil
+
+	case "jobs.start":
+		var request JobRequest
+		if err := decodeRPCParams(params, &request); err != nil {
+			return nil, err
+		}
+		job, err := d.api.startJob(request)
+		if err != nil {
+			return nil, rpcFailure(err)
+		}
+		return job.snapshot(false), nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+}
+
+func decodeRPCParams(params json.RawMessage, target any) *rpcError {
+	if len(params) == 0 {
+		return &rpcError{Code: rpcInvalidParams, Message: "params are required"}
+	}
+	if err := json.Unmarshal(params, target); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func rpcFailure(err error) *rpcError {
+	var failure *apiError
+	if errors.As(err, &failure) {
+		return &rpcError{Code: rpcServerError, Message: failure.message, Data: map[string]int{"status": failure.status}}
+	}
+	return &rpcError{Code: rpcServerError, Message: err.Error()}
+}
+
+// broadcast pushes a notification to every connected client.
+func (d *daemon) broadcast(method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	clients := make([]*rpcClient, 0, len(d.clients))
+	for client := range d.clients {
+		clients = append(clients, client)
+	}
+	d.mu.Unlock()
+
+	for _, client := range clients {
+		if err := client.send(rpcMessage{Method: method, Params: data}); err != nil {
+			client.conn.Close()
+		}
+	}
+}
+
+// followJob relays a job's output, progress, and completion as notifications.
+func (d *daemon) followJob(job *apiJob) {
+	sent := 0
+	for {
+		events, changed, done := job.eventsSince(&sent)
+		for _, event := range events {
+			d.broadcast("job."+event.name, map[string]any{"id": job.ID, event.name: event.data})
+		}
+		if done {
+			return
+		}
+		<-changed
+	}
+}
+
+// watchDevices polls for removable drives and announces arrivals and removals.
+func (d *daemon) watchDevices() {
+	known := make(map[string]bool)
+	for _, device := range removableDevices() {
+		known[device] = true
+	}
+	for range time.Tick(daemonPollInterval) {
+		current := make(map[string]bool)
+		for _, device := range removableDevices() {
+			current[device] = true
+			if !known[device] {
+				d.broadcast("device.added", collectDriveInfo(device))
+			}
+		}
+		for device := range known {
+			if !current[device] {
+				d.broadcast("device.removed", map[string]string{"device": device})
+			}
+		}
+		known = current
+	}
+}
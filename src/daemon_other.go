@@ -0,0 +1,29 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenPrivateSocket creates a Unix socket only its owner can connect to.
+// The umask is tightened while the socket is created, since a chmod afterwards
+// would leave it open to other users in between. The umask is process-wide,
+// which is safe here because the daemon creates no other files at startup.
+func listenPrivateSocket(path string) (net.Listener, error) {
+	previous := unix.Umask(0o077)
+	listener, err := net.Listen("unix", path)
+	unix.Umask(previous)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "net"
+
+// listenPrivateSocket creates a Unix socket. Windows ignores file modes on
+// sockets; the socket gets the access list of its folder, which for the
+// default location in the user's AppData only the user can open.
+func listenPrivateSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
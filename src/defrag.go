@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/spf13/cobra"
+)
+
+// fatVolume is a FAT32 volume read through the raw disk, with its first FAT
+// held in memory.
+type fatVolume struct {
+	file *os.File
+	base int64
+	boot BootSector
+	fat  []uint32
+}
+
+// FragmentedFile is a file whose clusters are not in one contiguous run.
+type FragmentedFile struct {
+	// Path is relative to the volume root, with forward slashes.
+	Path      string
+	Size      int64
+	Fragments int
+}
+
+// FragmentationReport sums up how the files on a volume are laid out.
+type FragmentationReport struct {
+	Files int
+	Bytes int64
+	// Fragments counts the contiguous runs of all files together, so it
+	// equals Files on a volume without fragmentation.
+	Fragments  int
+	Fragmented []FragmentedFile
+}
+
+// FragmentedBytes is the size of the fragmented files together.
+func (r FragmentationReport) FragmentedBytes() int64 {
+	var total int64
+	for _, file := range r.Fragmented {
+		total += file.Size
+	}
+	return total
+}
+
+// sortWorstFirst orders the fragmented files by their number of pieces.
+func (r FragmentationReport) sortWorstFirst() {
+	sort.SliceStable(r.Fragmented, func(i, j int) bool {
+		return r.Fragmented[i].Fragments > r.Fragmented[j].Fragments
+	})
+}
+
+func openFATVolume(device string) (*fatVolume, error) {
+	boot, base, err := readBootSector(device)
+	if err != nil {
+		return nil, err
+	}
+	if boot.FilesystemType != "FAT32" {
+		return nil, fmt.Errorf("%s is %s; defrag only supports FAT32", device, boot.FilesystemType)
+	}
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, int64(boot.SectorsPerFAT)*int64(boot.BytesPerSector))
+	if _, err := file.ReadAt(raw, base+int64(boot.ReservedSectors)*int64(boot.BytesPerSector)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read FAT: %w", err)
+	}
+	entries := min(len(raw)/4, int(boot.ClusterCount)+2)
+	fat := make([]uint32, entries)
+	for i := range fat {
+		fat[i] = binary.LittleEndian.Uint32(raw[i*4:]) & 0x0FFFFFFF
+	}
+	return &fatVolume{file: file, base: base, boot: boot, fat: fat}, nil
+}
+
+func (v *fatVolume) Close() error {
+	return v.file.Close()
+}
+
+// chain follows the FAT from first and returns the file's clusters in order.
+func (v *fatVolume) chain(first uint32) ([]uint32, error) {
+	var clusters []uint32
+	for cluster := first; cluster >= 2 && cluster < 0x0FFFFFF7; cluster = v.fat[cluster] {
+		if int(cluster) >= len(v.fat) {
+			return nil, fmt.Errorf("cluster %d is past the end of the FAT", cluster)
+		}
+		if len(clusters) >= len(v.fat) {
+			return nil, fmt.Errorf("cluster chain from %d loops", first)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+func (v *fatVolume) readChain(clusters []uint32) ([]byte, error) {
+	clusterSize := int64(v.boot.ClusterSize())
+	heapStart := v.base + v.boot.DataRegionOffset()
+	data := make([]byte, int64(len(clusters))*clusterSize)
+	for i, cluster := range clusters {
+		if _, err := v.file.ReadAt(data[int64(i)*clusterSize:int64(i+1)*clusterSize], heapStart+int64(cluster-2)*clusterSize); err != nil {
+			return nil, fmt.Errorf("read cluster %d: %w", cluster, err)
+		}
+	}
+	return data, nil
+}
+
+// countFragments returns how many contiguous runs a chain is split into.
+func countFragments(clusters []uint32) int {
+	if len(clusters) == 0 {
+		return 0
+	}
+	fragments := 1
+	for i := 1; i < len(clusters); i++ {
+		if clusters[i] != clusters[i-1]+1 {
+			fragments++
+		}
+	}
+	return fragments
+}
+
+// fatShortName reads an 8.3 name, applying the lower-case flags Windows sets
+// for names like "readme.txt" that need no long name.
+func fatShortName(entry []byte) string {
+	name := strings.TrimRight(string(entry[0:8]), " ")
+	ext := strings.TrimRight(string(entry[8:11]), " ")
+	if name != "" && name[0] == 0x05 {
+		name = "\xe5" + name[1:]
+	}
+	if entry[12]&0x08 != 0 {
+		name = strings.ToLower(name)
+	}
+	if entry[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return name
+	}
+	return name + "." + ext
+}
+
+// longNameChars reads the 13 UTF-16 characters of a long-name entry.
+func longNameChars(entry []byte) []uint16 {
+	var chars []uint16
+	for _, span := range [][2]int{{1, 11}, {14, 26}, {28, 32}} {
+		for i := span[0]; i < span[1]; i += 2 {
+			chars = append(chars, binary.LittleEndian.Uint16(entry[i:]))
+		}
+	}
+	return chars
+}
+
+// scanFragmentation walks every directory from the root and counts how many
+// pieces each file is stored in.
+func (v *fatVolume) scanFragmentation() (FragmentationReport, error) {
+	var report FragmentationReport
+	visited := make(map[uint32]bool)
+
+	var walk func(dir string, first uint32) error
+	walk = func(dir string, first uint32) error {
+		if visited[first] {
+			return nil
+		}
+		visited[first] = true
+		clusters, err := v.chain(first)
+		if err != nil {
+			return err
+		}
+		data, err := v.readChain(clusters)
+		if err != nil {
+			return err
+		}
+
+		var longName []uint16
+		for i := 0; i+32 <= len(data); i += 32 {
+			entry := data[i : i+32]
+			if entry[0] == 0x00 {
+				break
+			}
+			if entry[0] == 0xE5 {
+				longName = nil
+				continue
+			}
+			attr := entry[11]
+			if attr == 0x0F {
+				// Long-name parts come last part first, each holding 13
+				// characters at position (sequence-1)*13.
+				sequence := int(entry[0] & 0x1F)
+				if entry[0]&0x40 != 0 {
+					longName = make([]uint16, sequence*13)
+				}
+				if sequence >= 1 && sequence*13 <= len(longName) {
+					copy(longName[(sequence-1)*13:], longNameChars(entry))
+				}
+				continue
+			}
+
+			name := fatShortName(entry)
+			if longName != nil {
+				end := len(longName)
+				for j, char := range longName {
+					if char == 0x0000 || char == 0xFFFF {
+						end = j
+						break
+					}
+				}
+				name = string(utf16.Decode(longName[:end]))
+				longName = nil
+			}
+			if attr&0x08 != 0 || name == "." || name == ".." {
+				continue
+			}
+
+			start := uint32(binary.LittleEndian.Uint16(entry[20:22]))<<16 | uint32(binary.LittleEndian.Uint16(entry[26:28]))
+			entryPath := path.Join(dir, name)
+			if attr&0x10 != 0 {
+				if start >= 2 {
+					if err := walk(entryPath, start); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			size := int64(binary.LittleEndian.Uint32(entry[28:32]))
+			chain, err := v.chain(start)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entryPath, err)
+			}
+			fragments := countFragments(chain)
+			report.Files++
+			report.Bytes += size
+			report.Fragments += fragments
+			if fragments > 1 {
+				report.Fragmented = append(report.Fragmented, FragmentedFile{
+					Path:      entryPath,
+					Size:      size,
+					Fragments: fragments,
+				})
+			}
+		}
+		return nil
+	}
+
+	err := walk("", v.boot.RootCluster)
+	return report, err
+}
+
+// analyzeFragmentation opens the volume, scans it, and closes it again.
+func analyzeFragmentation(device string) (FragmentationReport, error) {
+	volume, err := openFATVolume(device)
+	if err != nil {
+		return FragmentationReport{}, err
+	}
+	defer volume.Close()
+	return volume.scanFragmentation()
+}
+
+// printFragmentationReport prints overall statistics and up to limit of the
+// most fragmented files.
+func printFragmentationReport(report FragmentationReport, limit int) {
+	if len(report.Fragmented) == 0 {
+		printOK("All %d files are stored in one piece.", report.Files)
+		return
+	}
+	fragmentedBytes := report.FragmentedBytes()
+	fmt.Printf("Fragmented files: %d of %d (%.1f%% of the data, %s)\n", len(report.Fragmented), report.Files, float64(fragmentedBytes)/float64(max(report.Bytes, 1))*100, formatByteSize(fragmentedBytes))
+	fmt.Printf("Pieces per file: %.2f on average\n", float64(report.Fragments)/float64(report.Files))
+
+	report.sortWorstFirst()
+	fmt.Println("Most fragmented:")
+	for i, file := range report.Fragmented {
+		if i == limit {
+			fmt.Printf("  ...and %d more\n", len(report.Fragmented)-i)
+			break
+		}
+		fmt.Printf("  %-50s %4d pieces  %s\n", file.Path, file.Fragments, formatByteSize(file.Size))
+	}
+}
+
+// rewriteContiguous copies a file to a new file next to it and replaces the
+// original with the copy. The filesystem allocates the copy in one go, so it
+// lands in a contiguous run when there is enough free space in one place.
+func rewriteContiguous(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	temp := path + ".cdjf-defrag"
+	if err := copyPayloadFile(path, temp); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if copied, err := os.Stat(temp); err != nil || copied.Size() != info.Size() {
+		os.Remove(temp)
+		return fmt.Errorf("copy of %s is incomplete", filepath.Base(path))
+	}
+	if err := os.Chtimes(temp, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+func defragDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	analyzeOnly, _ := cmd.Flags().GetBool("analyze")
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	report, err := analyzeFragmentation(device)
+	if err != nil {
+		printError("Error reading filesystem: %v", err)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Fragmentation of %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	printFragmentationReport(report, 10)
+	if len(report.Fragmented) == 0 || analyzeOnly {
+		return
+	}
+
+	// Player metadata first, as cdjf copies payloads, then the worst files.
+	fragmented := report.Fragmented
+	sort.SliceStable(fragmented, func(i, j int) bool {
+		return payloadCopyRank(fragmented[i].Path) < payloadCopyRank(fragmented[j].Path)
+	})
+	totalBytes := report.FragmentedBytes()
+	var largest int64
+	for _, file := range fragmented {
+		largest = max(largest, file.Size)
+	}
+
+	if err := checkWriteProtection(device, true); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		os.Exit(1)
+	}
+	if freeGB, ok := getDriveFreeSpace(device); ok && int64(freeGB*1024*1024*1024) < largest {
+		fmt.Printf("Only %.2f GB is free; files larger than that are skipped.\n", freeGB)
+	}
+
+	fmt.Println()
+	fmt.Println("Each fragmented file is copied and the copy replaces the original. Do not")
+	fmt.Println("unplug the drive until cdjf finishes; back up the drive first if you can.")
+	if !skipConfirm {
+		response := ask("defrag", "Defragment now? (y/N): ")
+		if response != "y" && response != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	// Problems are reported once the bar is done so they do not break it up.
+	var skipped, failures []string
+	bar := NewProgressBar("Defrag", totalBytes)
+	var written int64
+	for _, file := range fragmented {
+		if freeGB, ok := getDriveFreeSpace(device); ok && int64(freeGB*1024*1024*1024) < file.Size {
+			skipped = append(skipped, file.Path)
+		} else if err := rewriteContiguous(filepath.Join(mountPoint, filepath.FromSlash(file.Path))); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", file.Path, err))
+		} else {
+			written += file.Size
+		}
+		// The next file's free space check must see what this one used.
+		forgetDriveInfo()
+		bar.Add(file.Size)
+	}
+	bar.Finish()
+	recordDriveWrites(device, "defrag", written)
+	for _, path := range skipped {
+		warn(device, warnCapacity, "Skipped %s: not enough free space to rewrite it", path)
+	}
+	for _, failure := range failures {
+		warn(device, warnSetup, "Unable to rewrite %s", failure)
+	}
+	failed := len(skipped) + len(failures)
+
+	after, err := analyzeFragmentation(device)
+	if err != nil {
+		printWarning("Unable to check the result: %v", err)
+		return
+	}
+	if len(after.Fragmented) == 0 {
+		printOK("Defragmented %s: all %d files are now contiguous.", device, after.Files)
+		return
+	}
+	fmt.Printf("%d files are still fragmented", len(after.Fragmented))
+	if failed > 0 {
+		fmt.Printf(" (%d could not be rewritten)", failed)
+	}
+	fmt.Println(".")
+	fmt.Println("   The free space itself is fragmented. Copy the files off, run 'cdjf format',")
+	fmt.Println("   and copy them back to lay everything out in one piece.")
+}
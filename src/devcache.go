@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// driveInfoTTL is how long the answer to a drive query is reused. Checking a
+// drive before a format or verify asks the OS about it a dozen times within a
+// second or two; anything that changes a drive clears the cache, so the TTL
+// only guards against changes made outside cdjf, such as a stick being pulled.
+const driveInfoTTL = 3 * time.Second
+
+type cachedDriveQuery struct {
+	value any
+	err   error
+	at    time.Time
+}
+
+var driveInfoCache = struct {
+	sync.Mutex
+	entries map[string]cachedDriveQuery
+}{entries: make(map[string]cachedDriveQuery)}
+
+// cachedDriveInfo returns the result of query for key, running it only when
+// there is no answer younger than driveInfoTTL. Failed queries are cached too,
+// so a missing drive is not asked about over and over.
+func cachedDriveInfo[T any](key string, query func() (T, error)) (T, error) {
+	driveInfoCache.Lock()
+	entry, ok := driveInfoCache.entries[key]
+	driveInfoCache.Unlock()
+	if ok && time.Since(entry.at) < driveInfoTTL {
+		value, _ := entry.value.(T)
+		return value, entry.err
+	}
+
+	value, err := query()
+	driveInfoCache.Lock()
+	driveInfoCache.entries[key] = cachedDriveQuery{value: value, err: err, at: time.Now()}
+	driveInfoCache.Unlock()
+	return value, err
+}
+
+// forgetDriveInfo clears every cached drive query. It is called whenever cdjf
+// formats, partitions, mounts, unmounts, locks, or ejects a drive, writes its
+// raw sectors, or adds or deletes files on it, since the cached answers
+// include the label, mount point, and free space. The whole cache goes, since
+// a change to disk4 also changes what disk4s1 reports.
+func forgetDriveInfo() {
+	driveInfoCache.Lock()
+	driveInfoCache.entries = make(map[string]cachedDriveQuery)
+	driveInfoCache.Unlock()
+}
+
+// macDiskInfo returns the output of 'diskutil info' for a disk or volume.
+func macDiskInfo(device string) ([]byte, error) {
+	return cachedDriveInfo("diskutil info "+device, func() ([]byte, error) {
+		return execCommand("diskutil", "info", device).Output()
+	})
+}
+
+// cachedLogicalDisks is queryLogicalDisks through the drive info cache.
+func cachedLogicalDisks(filter string) ([]LogicalDisk, error) {
+	return cachedDriveInfo("logicaldisk "+strings.ToUpper(filter), func() ([]LogicalDisk, error) {
+		return queryLogicalDisks(filter)
+	})
+}
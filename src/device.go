@@ -1,9 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -11,16 +11,22 @@ import (
 )
 
 type DriveInfo struct {
-	Device     string
-	Label      string
-	Filesystem string
-	SizeGB     float64
-	FreeGB     float64
-	Type       string
-	IsSystem   bool
+	Device     string  `json:"device"`
+	Label      string  `json:"label"`
+	Filesystem string  `json:"filesystem"`
+	SizeGB     float64 `json:"size_gb"`
+	FreeGB     float64 `json:"free_gb"`
+	// MountPoint is where the drive's volume is mounted, when known and
+	// different from Device.
+	MountPoint string `json:"mount_point,omitempty"`
+	Type       string `json:"type"`
+	IsSystem   bool   `json:"is_system"`
 }
 
 func validateDevice(device string) error {
+	if activeFakeBackend() != nil {
+		return nil
+	}
 	switch runtime.GOOS {
 	case "darwin":
 		if !strings.HasPrefix(device, "disk") {
@@ -34,18 +40,60 @@ func validateDevice(device string) error {
 	return nil
 }
 
+// ensureRemovableDevice checks the drive holding device, so a macOS volume
+// such as disk4s1 passes or fails along with its disk.
 func ensureRemovableDevice(device string) error {
-	if isSystemDrive(device) {
+	disk := physicalDiskIdentifier(device)
+	if isSystemDrive(disk) {
 		return fmt.Errorf("%s appears to be a system/internal drive. Operation blocked for safety", device)
 	}
 
-	if !isRemovableDrive(device) {
+	if !isRemovableDrive(disk) {
 		return fmt.Errorf("%s is not detected as a removable USB drive. Only removable drives are supported", device)
 	}
 
+	if err := checkDeviceLists(disk); err != nil {
+		return err
+	}
+	return checkVendorPolicy(disk)
+}
+
+// checkDeviceLists applies the serial number allowlist and blocklist from
+// config.json. A drive whose serial cannot be read never matches the
+// allowlist.
+func checkDeviceLists(device string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if len(config.Allowlist) == 0 && len(config.Blocklist) == 0 {
+		return nil
+	}
+
+	serial := getDriveSerial(device)
+	if serial != "" && containsFold(config.Blocklist, serial) {
+		return fmt.Errorf("%s (serial %s) is on the blocklist in config.json. Operation blocked for safety", device, serial)
+	}
+	if len(config.Allowlist) > 0 {
+		if serial == "" {
+			return fmt.Errorf("unable to read the serial number of %s, and config.json only allows listed drives", device)
+		}
+		if !containsFold(config.Allowlist, serial) {
+			return fmt.Errorf("%s (serial %s) is not on the allowlist in config.json. Operation blocked for safety", device, serial)
+		}
+	}
 	return nil
 }
 
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), target) {
+			return true
+		}
+	}
+	return false
+}
+
 func parseSizeToGB(sizeStr string) float64 {
 	matches := sizeRegex.FindStringSubmatch(sizeStr)
 	if len(matches) >= 3 {
@@ -66,10 +114,12 @@ func parseSizeToGB(sizeStr string) float64 {
 }
 
 func isSystemDrive(device string) bool {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).System
+	}
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("diskutil", "info", device)
-		output, err := cmd.Output()
+		output, err := macDiskInfo(device)
 		if err != nil {
 			return false
 		}
@@ -100,10 +150,13 @@ func isSystemDrive(device string) bool {
 }
 
 func isRemovableDrive(device string) bool {
+	if fake := activeFakeBackend(); fake != nil {
+		drive := fake.drive(device)
+		return drive.Device != "" && !drive.Internal
+	}
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("diskutil", "info", device)
-		output, err := cmd.Output()
+		output, err := macDiskInfo(device)
 		if err != nil {
 			return false
 		}
@@ -147,29 +200,23 @@ func windowsDriveType(device string) (string, error) {
 		return "", fmt.Errorf("invalid drive letter")
 	}
 
-	cmd := exec.Command("wmic", "logicaldisk", "where", fmt.Sprintf("name='%s:'", driveLetter), "get", "drivetype")
-	output, err := cmd.Output()
+	disk, err := windowsLogicalDisk(driveLetter)
 	if err != nil {
 		return "", err
 	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.EqualFold(line, "DriveType") {
-			continue
-		}
-		return line, nil
+	if disk.DriveType == "" {
+		return "", fmt.Errorf("drive type not found")
 	}
-
-	return "", fmt.Errorf("drive type not found")
+	return disk.DriveType, nil
 }
 
 func getDriveSize(device string) float64 {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).SizeGB
+	}
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("diskutil", "info", device)
-		output, err := cmd.Output()
+		output, err := macDiskInfo(device)
 		if err != nil {
 			return 0
 		}
@@ -185,25 +232,369 @@ func getDriveSize(device string) float64 {
 		}
 
 	case "windows":
-		driveLetter := strings.TrimSuffix(device, ":")
-		cmd := exec.Command("wmic", "logicaldisk", "where", fmt.Sprintf("name='%s:'", driveLetter), "get", "size")
-		output, err := cmd.Output()
+		disk, err := windowsLogicalDisk(device)
 		if err != nil {
 			return 0
 		}
+		if disk.Size == 0 {
+			// RAW volumes report no size; fall back to the disk itself.
+			if size, err := getDiskSizeBytes(device); err == nil {
+				return float64(size) / (1024 * 1024 * 1024)
+			}
+		}
+		return float64(disk.Size) / (1024 * 1024 * 1024)
+	}
+	return 0
+}
+
+// getDiskSizeBytes returns the exact size of the whole disk behind a device.
+func getDiskSizeBytes(device string) (int64, error) {
+	if fake := activeFakeBackend(); fake != nil {
+		return int64(fake.drive(device).SizeGB * 1024 * 1024 * 1024), nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(wholeDiskIdentifier(device))
+		if err != nil {
+			return 0, fmt.Errorf("diskutil info failed: %v", err)
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if !strings.Contains(line, "Disk Size:") {
+				continue
+			}
+			if matches := byteCountRegex.FindStringSubmatch(line); len(matches) == 2 {
+				return strconv.ParseInt(matches[1], 10, 64)
+			}
+		}
+		return 0, fmt.Errorf("unable to determine the size of %s", device)
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return 0, err
+		}
+		return windowsDiskSize(diskNumber)
+	}
+
+	return 0, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// getDiskBlockSize returns the logical block size of a macOS disk, the unit
+// its MBR partition entries are counted in. Most USB sticks use 512 bytes,
+// but some large SSDs and card readers present 4096-byte blocks.
+func getDiskBlockSize(device string) (int, error) {
+	output, err := macDiskInfo(wholeDiskIdentifier(device))
+	if err != nil {
+		return 0, fmt.Errorf("diskutil info failed: %v", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Device Block Size:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Device Block Size:"))
+		if len(fields) > 0 {
+			if size, err := strconv.Atoi(fields[0]); err == nil && size > 0 {
+				return size, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unable to determine the block size of %s", device)
+}
+
+// getDriveFreeSpace returns the free space on the drive's volume in GB and
+// whether it could be determined.
+func getDriveFreeSpace(device string) (float64, bool) {
+	if fake := activeFakeBackend(); fake != nil {
+		drive := fake.drive(device)
+		return drive.freeGB(), drive.Device != ""
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(macVolumeIdentifier(device))
+		if err != nil {
+			return 0, false
+		}
 
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && line != "Size" {
-				size, err := strconv.ParseFloat(line, 64)
-				if err == nil {
-					return size / (1024 * 1024 * 1024)
+			if strings.Contains(line, "Volume Free Space:") || strings.Contains(line, "Volume Available Space:") {
+				parts := strings.SplitN(line, ":", 2)
+				if len(parts) == 2 {
+					return parseSizeToGB(parts[1]), true
 				}
 			}
 		}
+
+	case "windows":
+		disk, err := windowsLogicalDisk(device)
+		if err != nil || disk.Size == 0 {
+			return 0, false
+		}
+		return float64(disk.FreeSpace) / (1024 * 1024 * 1024), true
 	}
-	return 0
+	return 0, false
+}
+
+// isRawVolume reports whether a drive has no filesystem the OS recognizes,
+// as with corrupted or freshly wiped sticks that Windows shows as RAW. Such
+// drives cannot be mounted, so they are repartitioned from scratch.
+func isRawVolume(device string) bool {
+	filesystem := strings.TrimSpace(getDriveFilesystem(device))
+	return filesystem == "" || strings.EqualFold(filesystem, "RAW")
+}
+
+func getDriveFilesystem(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).Filesystem
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(macVolumeIdentifier(device))
+		if err != nil {
+			return ""
+		}
+		return parseMacDiskInfo(output).Filesystem
+
+	case "windows":
+		disk, err := windowsLogicalDisk(device)
+		if err != nil {
+			return ""
+		}
+		return disk.FileSystem
+	}
+	return ""
+}
+
+// getDriveModel returns the manufacturer's name for the disk behind a device.
+func getDriveModel(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).Model
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(wholeDiskIdentifier(device))
+		if err != nil {
+			return ""
+		}
+		return parseMacDiskInfo(output).Type
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return ""
+		}
+		psCmd := fmt.Sprintf("(Get-Disk -Number %d).FriendlyName", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+	return ""
+}
+
+// getDriveSerial returns the hardware serial number of the disk behind a
+// device, or "" when the system does not report one.
+func getDriveSerial(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).Serial
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		serial, _ := macUSBDevice(device)["serial_num"].(string)
+		return serial
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return ""
+		}
+		psCmd := fmt.Sprintf("(Get-Disk -Number %d).SerialNumber", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+	return ""
+}
+
+// getDriveVendorID returns the USB vendor ID of the disk behind a device as
+// four lowercase hex digits, or "" when it is not a USB device.
+func getDriveVendorID(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).VendorID
+	}
+	var source string
+	switch runtime.GOOS {
+	case "darwin":
+		source, _ = macUSBDevice(device)["vendor_id"].(string)
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return ""
+		}
+		// The USB storage device's parent is the USB device itself, whose
+		// instance ID starts with USB\VID_xxxx&PID_xxxx.
+		psCmd := fmt.Sprintf("$d = Get-CimInstance Win32_DiskDrive | Where-Object Index -eq %d; "+
+			"(Get-PnpDeviceProperty -InstanceId $d.PNPDeviceID -KeyName DEVPKEY_Device_Parent).Data", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return ""
+		}
+		source = string(output)
+	}
+	if matches := usbVendorIDRegex.FindStringSubmatch(source); len(matches) == 2 {
+		return strings.ToLower(matches[1])
+	}
+	return ""
+}
+
+// getDriveVendorName returns the name of the company that made the disk behind
+// a device, or "" when the system does not report one separately from the
+// model. Windows includes it in the model name.
+func getDriveVendorName(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).Vendor
+	}
+	if runtime.GOOS == "darwin" {
+		vendor, _ := macUSBDevice(device)["manufacturer"].(string)
+		return strings.TrimSpace(vendor)
+	}
+	return ""
+}
+
+// macUSBDevice returns system_profiler's entry for the USB device holding a
+// disk, or nil when the disk is not on USB.
+func macUSBDevice(device string) map[string]any {
+	path := macUSBPath(device)
+	if len(path) == 0 {
+		return nil
+	}
+	return path[len(path)-1]
+}
+
+// macUSBPath returns system_profiler's entries from the USB bus down to the
+// device holding a disk.
+func macUSBPath(device string) []map[string]any {
+	output, err := execCommand("system_profiler", "SPUSBDataType", "-json").Output()
+	if err != nil {
+		return nil
+	}
+	var report map[string]any
+	if json.Unmarshal(output, &report) != nil {
+		return nil
+	}
+	return findUSBPath(report, wholeDiskIdentifier(device))
+}
+
+// findUSBPath walks system_profiler's USB tree for the device whose media has
+// the given BSD name and returns the entries leading to it.
+func findUSBPath(node any, bsdName string) []map[string]any {
+	switch value := node.(type) {
+	case map[string]any:
+		if media, ok := value["Media"].([]any); ok {
+			for _, item := range media {
+				if entry, ok := item.(map[string]any); ok && entry["bsd_name"] == bsdName {
+					return []map[string]any{value}
+				}
+			}
+		}
+		for _, child := range value {
+			if path := findUSBPath(child, bsdName); path != nil {
+				return append([]map[string]any{value}, path...)
+			}
+		}
+	case []any:
+		for _, child := range value {
+			if path := findUSBPath(child, bsdName); path != nil {
+				return path
+			}
+		}
+	}
+	return nil
+}
+
+// getDriveHubs names the external USB hubs between the host and the disk
+// behind a device, nearest the host first.
+func getDriveHubs(device string) []string {
+	if activeFakeBackend() != nil {
+		return nil
+	}
+	var hubs []string
+	switch runtime.GOOS {
+	case "darwin":
+		path := macUSBPath(device)
+		if len(path) == 0 {
+			return nil
+		}
+		for _, entry := range path[:len(path)-1] {
+			name, _ := entry["_name"].(string)
+			vendor, _ := entry["vendor_id"].(string)
+			// Apple's own hubs are built into the machine or its displays.
+			if strings.Contains(strings.ToLower(name), "hub") && !strings.Contains(strings.ToLower(vendor), "apple") {
+				hubs = append(hubs, name)
+			}
+		}
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return nil
+		}
+		// Walk up the device tree from the disk and list every ancestor.
+		psCmd := fmt.Sprintf("$id = (Get-CimInstance Win32_DiskDrive | Where-Object Index -eq %d).PNPDeviceID; "+
+			"while ($id) { $id = (Get-PnpDeviceProperty -InstanceId $id -KeyName DEVPKEY_Device_Parent -ErrorAction SilentlyContinue).Data; "+
+			"if ($id) { (Get-PnpDevice -InstanceId $id).FriendlyName } }", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return nil
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			name := strings.TrimSpace(line)
+			lower := strings.ToLower(name)
+			if strings.Contains(lower, "hub") && !strings.Contains(lower, "root hub") {
+				hubs = append([]string{name}, hubs...)
+			}
+		}
+	}
+	return hubs
+}
+
+// warnIfBehindHub warns before a long write when the drive is connected
+// through a USB hub. Bus-powered hubs brown out under sustained writes, which
+// later shows up as verify errors.
+func warnIfBehindHub(device string) {
+	hubs := getDriveHubs(device)
+	if len(hubs) == 0 {
+		return
+	}
+	warn(device, warnUSBHub, "%s is connected through a USB hub (%s)", device, strings.Join(hubs, " > "))
+	fmt.Println("   Bus-powered hubs often cause intermittent write failures. Connect the drive directly or use a powered hub.")
+}
+
+func getVolumeLabel(device string) string {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).Label
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(macVolumeIdentifier(device))
+		if err != nil {
+			return ""
+		}
+		return parseMacDiskInfo(output).Label
+
+	case "windows":
+		disk, err := windowsLogicalDisk(device)
+		if err != nil {
+			return ""
+		}
+		return disk.VolumeName
+	}
+	return ""
 }
 
 func resolveTestFilePath(device, fileName string) (string, string, error) {
@@ -214,11 +605,23 @@ func resolveTestFilePath(device, fileName string) (string, string, error) {
 	return filepath.Join(mountPoint, fileName), mountPoint, nil
 }
 
+// getVolumeMountPoint resolves the mount point of a drive's volume, falling
+// back to the first partition when a whole macOS disk is given.
+func getVolumeMountPoint(device string) (string, error) {
+	mountPoint, err := getDeviceMountPoint(device)
+	if err != nil && runtime.GOOS == "darwin" {
+		mountPoint, err = getDeviceMountPoint(macVolumeIdentifier(device))
+	}
+	return mountPoint, err
+}
+
 func getDeviceMountPoint(device string) (string, error) {
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.drive(device).mountPoint()
+	}
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("diskutil", "info", device)
-		output, err := cmd.Output()
+		output, err := macDiskInfo(device)
 		if err != nil {
 			return "", err
 		}
@@ -259,3 +662,61 @@ func getDeviceMountPoint(device string) (string, error) {
 
 	return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 }
+
+// diskMountPoints returns the mount points of every mounted volume on the
+// physical disk behind device, such as the documents partition next to the
+// music one, since formatting the disk erases all of them.
+func diskMountPoints(device string) ([]string, error) {
+	if activeFakeBackend() != nil {
+		mountPoint, err := getVolumeMountPoint(device)
+		if err != nil {
+			return nil, err
+		}
+		return []string{mountPoint}, nil
+	}
+	var mountPoints []string
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := execCommand("diskutil", "list", "-plist").Output()
+		if err != nil {
+			return nil, fmt.Errorf("diskutil list failed: %v", err)
+		}
+		var collect func(node *DiskNode)
+		collect = func(node *DiskNode) {
+			if node.MountPoint != "" {
+				mountPoints = append(mountPoints, node.MountPoint)
+			}
+			for _, child := range node.Children {
+				collect(child)
+			}
+		}
+		disk := physicalDiskIdentifier(device)
+		for _, tree := range parseDiskTree(output) {
+			if tree.Device == disk {
+				collect(tree)
+			}
+		}
+
+	case "windows":
+		diskNumber, err := windowsDiskNumber(strings.ToUpper(strings.TrimSuffix(device, ":")))
+		if err != nil {
+			return nil, err
+		}
+		psCmd := fmt.Sprintf("Get-Partition -DiskNumber %d | Where-Object DriveLetter | ForEach-Object { $_.DriveLetter }", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the volumes on disk %d: %v", diskNumber, err)
+		}
+		for _, letter := range strings.Fields(string(output)) {
+			mountPoints = append(mountPoints, strings.ToUpper(letter)+":\\")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+
+	if len(mountPoints) == 0 {
+		return nil, fmt.Errorf("no volume on %s is mounted", device)
+	}
+	return mountPoints, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	knownDriveBad     = "bad"
+	knownDriveCaution = "caution"
+)
+
+// builtinDriveDB lists drive models known to misbehave on Pioneer players.
+// 'cdjf drivedb update' installs a newer copy in the config folder, which is
+// consulted in addition to this one.
+//
+//go:embed knowndrives.json
+var builtinDriveDB []byte
+
+// KnownDrive flags a model or USB vendor with a known problem. Every field
+// that is set must match.
+type KnownDrive struct {
+	Model    string `json:"model,omitempty"`
+	VendorID string `json:"vendor_id,omitempty"`
+	Severity string `json:"severity"`
+	Issue    string `json:"issue"`
+}
+
+type driveDB struct {
+	Version string       `json:"version"`
+	Drives  []KnownDrive `json:"drives"`
+}
+
+func driveDBPath() (string, error) {
+	return configFilePath("knowndrives.json")
+}
+
+func parseDriveDB(data []byte) (driveDB, error) {
+	var db driveDB
+	if err := json.Unmarshal(data, &db); err != nil {
+		return db, err
+	}
+	for i, drive := range db.Drives {
+		if strings.TrimSpace(drive.Model) == "" && strings.TrimSpace(drive.VendorID) == "" {
+			return db, fmt.Errorf("entry %d has neither a model nor a vendor_id", i+1)
+		}
+		if drive.Severity != knownDriveBad && drive.Severity != knownDriveCaution {
+			return db, fmt.Errorf("entry %d has severity %q; use %q or %q", i+1, drive.Severity, knownDriveBad, knownDriveCaution)
+		}
+	}
+	return db, nil
+}
+
+// loadKnownDrives returns the built-in entries plus any installed update.
+func loadKnownDrives() []KnownDrive {
+	builtin, _ := parseDriveDB(builtinDriveDB)
+	drives := builtin.Drives
+
+	path, err := driveDBPath()
+	if err != nil {
+		return drives
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return drives
+	}
+	update, err := parseDriveDB(data)
+	if err != nil {
+		printWarning("Ignoring invalid drive database %s: %v", path, err)
+		return drives
+	}
+	return append(drives, update.Drives...)
+}
+
+// matchKnownDrives returns the entries that apply to a model and vendor ID.
+func matchKnownDrives(drives []KnownDrive, model, vendorID string) []KnownDrive {
+	var matches []KnownDrive
+	for _, drive := range drives {
+		if drive.Model != "" && !strings.Contains(strings.ToLower(model), strings.ToLower(drive.Model)) {
+			continue
+		}
+		if drive.VendorID != "" && strings.TrimPrefix(strings.ToLower(drive.VendorID), "0x") != vendorID {
+			continue
+		}
+		matches = append(matches, drive)
+	}
+	return matches
+}
+
+// knownDriveIssues looks a device up in the drive database. The vendor ID is
+// only read when an entry needs it, since that is slow on macOS.
+func knownDriveIssues(device, model string) []KnownDrive {
+	drives := loadKnownDrives()
+	vendorID := ""
+	for _, drive := range drives {
+		if drive.VendorID != "" {
+			vendorID = getDriveVendorID(device)
+			break
+		}
+	}
+	return matchKnownDrives(drives, model, vendorID)
+}
+
+func printKnownDriveIssues(device string, issues []KnownDrive) {
+	for _, issue := range issues {
+		if issue.Severity == knownDriveBad {
+			fmt.Println(colorize(SeverityError, fmt.Sprintf("  KNOWN BAD (%s): %s", device, issue.Issue)))
+		} else {
+			warn(device, warnKnownIssue, "%s: %s", device, issue.Issue)
+		}
+	}
+}
+
+func driveDBList(cmd *cobra.Command, args []string) {
+	builtin, _ := parseDriveDB(builtinDriveDB)
+	title := fmt.Sprintf("Known drive database (built-in version %s)", builtin.Version)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	if path, err := driveDBPath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			if update, err := parseDriveDB(data); err == nil {
+				fmt.Printf("Installed update: version %s (%s)\n", update.Version, path)
+			}
+		}
+	}
+	fmt.Println()
+	for _, drive := range loadKnownDrives() {
+		match := drive.Model
+		if drive.VendorID != "" {
+			if match != "" {
+				match += ", "
+			}
+			match += "vendor " + drive.VendorID
+		}
+		fmt.Printf("[%s] %s\n", drive.Severity, match)
+		fmt.Printf("    %s\n", drive.Issue)
+	}
+}
+
+// driveDBUpdate installs a drive database from a file or an http(s) URL.
+func driveDBUpdate(cmd *cobra.Command, args []string) {
+	source := args[0]
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		data, err = fetchDriveDB(source)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		printError("Error reading %s: %v", source, err)
+		os.Exit(1)
+	}
+
+	db, err := parseDriveDB(data)
+	if err != nil {
+		printError("Error: %s is not a valid drive database: %v", source, err)
+		os.Exit(1)
+	}
+
+	path, err := driveDBPath()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		printError("Error saving drive database: %v", err)
+		os.Exit(1)
+	}
+	printOK("Installed drive database version %s with %d entries.", db.Version, len(db.Drives))
+}
+
+func fetchDriveDB(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
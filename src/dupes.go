@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// dupeSampleSize is how much of each end of a file the quick hash reads.
+const dupeSampleSize = 64 * 1024
+
+// DuplicateGroup is a set of files with identical content.
+type DuplicateGroup struct {
+	Size int64
+	// Paths are relative to the volume root, shortest first.
+	Paths []string
+}
+
+// Reclaimable is the space freed by keeping only one copy.
+func (g DuplicateGroup) Reclaimable() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// hashFile hashes a whole file, or only its first and last dupeSampleSize
+// bytes when sampled.
+func hashFile(path string, size int64, sampled bool, progress *ProgressBar) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if !sampled || size <= 2*dupeSampleSize {
+		n, err := io.Copy(hash, file)
+		progress.Add(n)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		buf := make([]byte, dupeSampleSize)
+		for _, offset := range []int64{0, size - dupeSampleSize} {
+			if _, err := file.ReadAt(buf, offset); err != nil {
+				return "", err
+			}
+			hash.Write(buf)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// groupBy splits paths into groups with the same key, dropping groups of one.
+func groupBy(paths []string, key func(string) (string, error)) ([][]string, error) {
+	byKey := make(map[string][]string)
+	var order []string
+	for _, path := range paths {
+		k, err := key(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := byKey[k]; !ok {
+			order = append(order, k)
+		}
+		byKey[k] = append(byKey[k], path)
+	}
+	var groups [][]string
+	for _, k := range order {
+		if len(byKey[k]) > 1 {
+			groups = append(groups, byKey[k])
+		}
+	}
+	return groups, nil
+}
+
+// findDuplicates finds audio files with identical content under mountPoint.
+// Files are compared by size, then by a hash of their ends, and only the
+// remaining candidates are hashed in full.
+func findDuplicates(mountPoint string) ([]DuplicateGroup, int, error) {
+	bySize := make(map[int64][]string)
+	files := 0
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if entry.IsDir() {
+			if rel != "." && (strings.HasPrefix(entry.Name(), ".") || containsFold(payloadMetadataFolders, strings.Split(filepath.ToSlash(rel), "/")[0])) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") || !payloadAudioExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			return nil
+		}
+		files++
+		bySize[info.Size()] = append(bySize[info.Size()], path)
+		return nil
+	})
+	if err != nil {
+		return nil, files, err
+	}
+
+	var candidates [][]string
+	var fullBytes int64
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		groups, err := groupBy(paths, func(path string) (string, error) {
+			return hashFile(path, size, true, nil)
+		})
+		if err != nil {
+			return nil, files, err
+		}
+		for _, group := range groups {
+			candidates = append(candidates, group)
+			fullBytes += size * int64(len(group))
+		}
+	}
+
+	var duplicates []DuplicateGroup
+	if len(candidates) == 0 {
+		return duplicates, files, nil
+	}
+	progress := NewProgressBar("Hash", fullBytes)
+	defer progress.Stop()
+	for _, paths := range candidates {
+		info, err := os.Stat(paths[0])
+		if err != nil {
+			return nil, files, err
+		}
+		groups, err := groupBy(paths, func(path string) (string, error) {
+			return hashFile(path, info.Size(), false, progress)
+		})
+		if err != nil {
+			return nil, files, err
+		}
+		for _, group := range groups {
+			var rels []string
+			for _, path := range group {
+				rel, _ := filepath.Rel(mountPoint, path)
+				rels = append(rels, filepath.ToSlash(rel))
+			}
+			sort.Slice(rels, func(i, j int) bool {
+				if len(rels[i]) != len(rels[j]) {
+					return len(rels[i]) < len(rels[j])
+				}
+				return rels[i] < rels[j]
+			})
+			duplicates = append(duplicates, DuplicateGroup{Size: info.Size(), Paths: rels})
+		}
+	}
+	progress.Finish()
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Reclaimable() != duplicates[j].Reclaimable() {
+			return duplicates[i].Reclaimable() > duplicates[j].Reclaimable()
+		}
+		return duplicates[i].Paths[0] < duplicates[j].Paths[0]
+	})
+	return duplicates, files, nil
+}
+
+func findDriveDupes(cmd *cobra.Command, args []string) {
+	device := args[0]
+	limit, _ := cmd.Flags().GetInt("limit")
+	noLock, _ := cmd.Flags().GetBool("no-lock")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Duplicate tracks on %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+
+	unlock := func() {}
+	if !noLock {
+		unlock = lockForInspection(device)
+	}
+	defer unlock()
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		unlock()
+		os.Exit(1)
+	}
+	duplicates, files, err := findDuplicates(mountPoint)
+	if err != nil {
+		printError("Error scanning %s: %v", mountPoint, err)
+		unlock()
+		os.Exit(1)
+	}
+	if len(duplicates) == 0 {
+		printOK("No duplicates among %d audio files.", files)
+		return
+	}
+
+	var reclaimable int64
+	copies := 0
+	for _, group := range duplicates {
+		reclaimable += group.Reclaimable()
+		copies += len(group.Paths) - 1
+	}
+	for i, group := range duplicates {
+		if limit > 0 && i == limit {
+			fmt.Printf("...and %d more groups (use --limit 0 to list all)\n\n", len(duplicates)-i)
+			break
+		}
+		fmt.Printf("%d copies of %s, %s reclaimable:\n", len(group.Paths), formatByteSize(group.Size), formatByteSize(group.Reclaimable()))
+		for _, path := range group.Paths {
+			fmt.Printf("  %s\n", path)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%d of %d audio files are extra copies; removing them would free %s.\n", copies, files, formatByteSize(reclaimable))
+	fmt.Println("Delete duplicates from your DJ library and export again, so playlists keep working.")
+}
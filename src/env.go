@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const envPrefix = "CDJF_"
+
+// flagEnvName returns the environment variable that configures a flag, for
+// example CDJF_SKIP_BENCHMARK for --skip-benchmark.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvFlags fills every flag not given on the command line from its
+// CDJF_* environment variable. A value from the environment counts as if it
+// had been passed on the command line, so it also overrides profile settings.
+// CDJF_HOOK_* variables describe the drive to hook scripts and never set flags.
+func applyEnvFlags(cmd *cobra.Command) error {
+	var firstErr error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if firstErr != nil || flag.Changed || flag.Name == "help" || flag.Name == "version" {
+			return
+		}
+		name := flagEnvName(flag.Name)
+		if strings.HasPrefix(name, hookEnvPrefix) {
+			return
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := cmd.Flags().Set(flag.Name, strings.TrimSpace(value)); err != nil {
+			firstErr = fmt.Errorf("invalid %s value %q: %v", name, value, err)
+		}
+	})
+	return firstErr
+}
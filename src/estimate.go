@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// estimateClusterSizes are the cluster sizes compared by cdjf estimate.
+// FAT32 stops at 64K; exFAT allows larger clusters.
+var estimateClusterSizes = []int64{4 * 1024, 8 * 1024, 16 * 1024, 32 * 1024, 64 * 1024, 128 * 1024, 256 * 1024}
+
+// FileGroup is a number of files of about the same size, such as tracks or
+// the artwork and ANLZ analysis files rekordbox writes for them.
+type FileGroup struct {
+	Files   int
+	AvgSize int64
+}
+
+// slackBytes models the space lost to partly filled clusters. Files of
+// varying size waste half a cluster on average, and files smaller than a
+// cluster waste at least the rest of it.
+func (g FileGroup) slackBytes(cluster int64) int64 {
+	perFile := max(cluster/2, cluster-g.AvgSize)
+	return int64(g.Files) * perFile
+}
+
+// parseByteSize reads sizes such as 12MB, 40KB, or 1.5G. A plain number is in
+// megabytes.
+func parseByteSize(value string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"G", 1024 * 1024 * 1024},
+		{"M", 1024 * 1024},
+		{"K", 1024},
+		{"B", 1},
+	}
+	multiplier := 1024.0 * 1024
+	for _, unit := range units {
+		if strings.HasSuffix(trimmed, unit.suffix) {
+			trimmed = strings.TrimSuffix(trimmed, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSpace(trimmed), 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(amount * multiplier), nil
+}
+
+// formatByteSize shows a size with the largest unit that keeps it above one.
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1024*1024*1024:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1024*1024*1024))
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	default:
+		return fmt.Sprintf("%.0f KB", float64(n)/1024)
+	}
+}
+
+func estimateOverhead(cmd *cobra.Command, args []string) {
+	counts, _ := cmd.Flags().GetIntSlice("files")
+	sizeValues, _ := cmd.Flags().GetStringSlice("avg-size")
+	clusterInput, _ := cmd.Flags().GetString("cluster")
+
+	if len(counts) == 0 || len(counts) != len(sizeValues) {
+		printError("Error: give each --files with an --avg-size, e.g. --files 4000 --avg-size 12MB")
+		os.Exit(1)
+	}
+	var groups []FileGroup
+	var totalFiles int
+	var totalBytes int64
+	for i, count := range counts {
+		size, err := parseByteSize(sizeValues[i])
+		if err != nil || count <= 0 {
+			printError("Error: invalid group %d: %d files of %q; use a value such as --files 4000 --avg-size 12MB", i+1, count, sizeValues[i])
+			os.Exit(1)
+		}
+		groups = append(groups, FileGroup{Files: count, AvgSize: size})
+		totalFiles += count
+		totalBytes += int64(count) * size
+	}
+
+	var chosen int64
+	if strings.TrimSpace(clusterInput) != "" {
+		normalized, err := normalizeClusterSize(clusterInput)
+		if err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		chosen = int64(clusterSizeBytes(normalized))
+	}
+
+	title := fmt.Sprintf("Cluster-size overhead for %d files (%s)", totalFiles, formatByteSize(totalBytes))
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	for _, group := range groups {
+		fmt.Printf("  %d files of about %s\n", group.Files, formatByteSize(group.AvgSize))
+	}
+	fmt.Println()
+
+	sizes := estimateClusterSizes
+	if chosen > 0 && !containsInt64(sizes, chosen) {
+		sizes = append([]int64{chosen}, sizes...)
+	}
+	fmt.Printf("%-9s %-12s %-12s %s\n", "CLUSTER", "ON DISK", "SLACK", "OVERHEAD")
+	for _, cluster := range sizes {
+		var slack int64
+		for _, group := range groups {
+			slack += group.slackBytes(cluster)
+		}
+		name := fmt.Sprintf("%dK", cluster/1024)
+		if cluster < 1024 {
+			name = strconv.FormatInt(cluster, 10)
+		}
+		line := fmt.Sprintf("%-9s %-12s %-12s %5.1f%%", name, formatByteSize(totalBytes+slack), formatByteSize(slack), float64(slack)/float64(totalBytes)*100)
+		if cluster > 64*1024 {
+			line += "  (exFAT only)"
+		}
+		if cluster == chosen {
+			line = colorize(SeverityWarn, line+"  <- --cluster")
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+	fmt.Println("Larger clusters read faster on players but waste more space on small files.")
+	fmt.Println("Check which cluster sizes your players support with 'cdjf targets'.")
+}
+
+func containsInt64(values []int64, target int64) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
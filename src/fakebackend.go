@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fakeDrive is one drive in a CDJF_FAKE_DEVICES file.
+type fakeDrive struct {
+	Device     string  `json:"device"`
+	Vendor     string  `json:"vendor,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Serial     string  `json:"serial,omitempty"`
+	VendorID   string  `json:"vendor_id,omitempty"`
+	SizeGB     float64 `json:"size_gb"`
+	FreeGB     float64 `json:"free_gb,omitempty"`
+	Filesystem string  `json:"filesystem,omitempty"`
+	Label      string  `json:"label,omitempty"`
+	// MountPoint is a folder standing in for the mounted volume, so
+	// benchmarks, verify, and payload copies do real file I/O. A relative
+	// path is resolved against the devices file.
+	MountPoint string `json:"mount_point,omitempty"`
+	// Image is a disk image file read in place of the raw device, so the
+	// boot sector, partition table, and dirty bit checks see real bytes. It
+	// is only read, and a format drops it. A relative path is resolved
+	// against the devices file.
+	Image    string `json:"image,omitempty"`
+	Internal bool   `json:"internal,omitempty"`
+	System   bool   `json:"system,omitempty"`
+	// WriteProtected simulates a hardware lock switch; Locked is what
+	// 'cdjf lock' sets.
+	WriteProtected bool `json:"write_protected,omitempty"`
+	Locked         bool `json:"locked,omitempty"`
+	Ejected        bool `json:"ejected,omitempty"`
+	// FormatError makes formatting this drive fail with the given message.
+	FormatError string `json:"format_error,omitempty"`
+	// WriteMBps and ReadMBps cap the speed of file I/O under the mount
+	// point, and ErrorRate is the chance that each 1 MiB block reads back
+	// corrupted.
+	WriteMBps float64 `json:"write_mbps,omitempty"`
+	ReadMBps  float64 `json:"read_mbps,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// BitLocker is "on" or "locked" to simulate an encrypted drive.
+	BitLocker string `json:"bitlocker,omitempty"`
+	// SSD marks a drive that accepts TRIM.
+	SSD bool `json:"ssd,omitempty"`
+	// OpenFiles are the files processes hold open on the drive, for
+	// 'cdjf busy'.
+	OpenFiles []fakeOpenFile `json:"open_files,omitempty"`
+	// TransientErrors makes the next formats or ejects fail as if the drive
+	// had reset, one per failure, to exercise the retry logic.
+	TransientErrors int `json:"transient_errors,omitempty"`
+}
+
+// fakeOpenFile is a file a simulated process holds open. Path is relative to
+// the volume root.
+type fakeOpenFile struct {
+	PID     int    `json:"pid"`
+	Process string `json:"process"`
+	Path    string `json:"path"`
+}
+
+type fakeDevicesFile struct {
+	Drives []fakeDrive `json:"drives"`
+}
+
+// fakeBackend keeps its drives in a JSON file, which it rewrites after every
+// change so scripts can inspect the result and later runs see it.
+type fakeBackend struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newFakeBackend(path string) (*fakeBackend, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fake := &fakeBackend{path: abs}
+	if _, err := fake.load(); err != nil {
+		return nil, err
+	}
+	return fake, nil
+}
+
+func (f *fakeBackend) load() (fakeDevicesFile, error) {
+	var file fakeDevicesFile
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return file, fmt.Errorf("unable to read CDJF_FAKE_DEVICES file: %w", err)
+	}
+	if err := decodeConfigJSON(data, &file, true); err != nil {
+		return file, fmt.Errorf("invalid CDJF_FAKE_DEVICES file %s: %w", f.path, err)
+	}
+	return file, nil
+}
+
+// resolve turns a mount point from the file into an absolute path.
+func (f *fakeBackend) resolve(mountPoint string) string {
+	if mountPoint == "" || filepath.IsAbs(mountPoint) {
+		return mountPoint
+	}
+	return filepath.Join(filepath.Dir(f.path), mountPoint)
+}
+
+func (f *fakeBackend) save(file fakeDevicesFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, append(data, '\n'), 0o644)
+}
+
+// drive returns a connected fake drive, or a zero fakeDrive for devices that
+// are unknown or ejected so they never pass the removable-drive checks.
+func (f *fakeBackend) drive(device string) fakeDrive {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := f.load()
+	if err != nil {
+		return fakeDrive{}
+	}
+	for _, drive := range file.Drives {
+		if drive.Device == device && !drive.Ejected {
+			drive.MountPoint = f.resolve(drive.MountPoint)
+			drive.Image = f.resolve(drive.Image)
+			return drive
+		}
+	}
+	return fakeDrive{}
+}
+
+// update applies change to a connected fake drive and saves the file.
+func (f *fakeBackend) update(device string, change func(*fakeDrive) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := f.load()
+	if err != nil {
+		return err
+	}
+	for i := range file.Drives {
+		if file.Drives[i].Device != device || file.Drives[i].Ejected {
+			continue
+		}
+		if err := change(&file.Drives[i]); err != nil {
+			return err
+		}
+		return f.save(file)
+	}
+	return fmt.Errorf("no fake drive named %s", device)
+}
+
+func (f *fakeBackend) Enumerate() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := f.load()
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	for _, drive := range file.Drives {
+		if !drive.Ejected && !drive.Internal && !drive.System {
+			devices = append(devices, drive.Device)
+		}
+	}
+	return devices
+}
+
+// allDevices lists every attached fake drive, internal and system ones too.
+func (f *fakeBackend) allDevices() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := f.load()
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	for _, drive := range file.Drives {
+		if !drive.Ejected {
+			devices = append(devices, drive.Device)
+		}
+	}
+	return devices
+}
+
+func (f *fakeBackend) Info(device string) DriveInfo {
+	drive := f.drive(device)
+	driveType := "Removable"
+	if drive.Internal {
+		driveType = "Local"
+	}
+	return DriveInfo{
+		Device:     device,
+		Label:      drive.Label,
+		Filesystem: drive.Filesystem,
+		SizeGB:     drive.SizeGB,
+		FreeGB:     drive.freeGB(),
+		MountPoint: f.resolve(drive.MountPoint),
+		Type:       driveType,
+		IsSystem:   drive.System,
+	}
+}
+
+// Format empties the drive's mount point folder and records the new
+// filesystem and label, which also removes any BitLocker encryption.
+func (f *fakeBackend) Format(device string, opts FormatOptions) error {
+	if err := f.failTransiently(device); err != nil {
+		return err
+	}
+	return f.update(device, func(drive *fakeDrive) error {
+		if drive.FormatError != "" {
+			return fmt.Errorf("%s", drive.FormatError)
+		}
+		if drive.WriteProtected {
+			return fmt.Errorf("%s is write-protected", device)
+		}
+		if mountPoint := f.resolve(drive.MountPoint); mountPoint != "" {
+			if err := os.RemoveAll(mountPoint); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(mountPoint, 0o755); err != nil {
+				return err
+			}
+		}
+		drive.Filesystem = opts.Filesystem
+		drive.Label = opts.Label
+		drive.Image = ""
+		drive.BitLocker = ""
+		drive.FreeGB = 0
+		return nil
+	})
+}
+
+func (f *fakeBackend) Eject(device string) error {
+	if err := f.failTransiently(device); err != nil {
+		return err
+	}
+	return f.update(device, func(drive *fakeDrive) error {
+		drive.Ejected = true
+		return nil
+	})
+}
+
+// failTransiently uses up one of the drive's simulated USB resets, returning
+// the error the operation would have failed with.
+func (f *fakeBackend) failTransiently(device string) error {
+	reset := false
+	f.update(device, func(drive *fakeDrive) error {
+		if drive.TransientErrors > 0 {
+			drive.TransientErrors--
+			reset = true
+		}
+		return nil
+	})
+	if reset {
+		return fmt.Errorf("%s: input/output error", device)
+	}
+	return nil
+}
+
+func (f *fakeBackend) setLocked(device string, locked bool) error {
+	return f.update(device, func(drive *fakeDrive) error {
+		drive.Locked = locked
+		return nil
+	})
+}
+
+// freeGB reports the whole drive as free unless the file says otherwise.
+func (d fakeDrive) freeGB() float64 {
+	if d.FreeGB > 0 {
+		return d.FreeGB
+	}
+	return d.SizeGB
+}
+
+func (d fakeDrive) mountPoint() (string, error) {
+	if d.Device == "" || d.MountPoint == "" {
+		return "", fmt.Errorf("device is not mounted")
+	}
+	if _, err := os.Stat(d.MountPoint); err != nil {
+		return "", fmt.Errorf("unable to access mount point %s: %w", d.MountPoint, err)
+	}
+	return d.MountPoint, nil
+}
+
+// holders groups a drive's open files by process.
+func (d fakeDrive) holders() []volumeHolder {
+	var holders []volumeHolder
+	index := make(map[int]int)
+	for _, file := range d.OpenFiles {
+		i, ok := index[file.PID]
+		if !ok {
+			i = len(holders)
+			index[file.PID] = i
+			holders = append(holders, volumeHolder{PID: file.PID, Process: file.Process})
+		}
+		holders[i].Files = append(holders[i].Files, file.Path)
+	}
+	return holders
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFakeDevices writes drives to a CDJF_FAKE_DEVICES file in a temporary
+// folder and selects the fake backend for the rest of the test. It returns the
+// backend so tests can read back what an operation changed.
+func useFakeDevices(t *testing.T, drives ...fakeDrive) *fakeBackend {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "devices.json")
+	data, err := json.Marshal(fakeDevicesFile{Drives: drives})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Audit logs, inventory, and hooks live in the config folder.
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	previous := deviceBackend
+	t.Setenv("CDJF_FAKE_DEVICES", path)
+	if err := initDeviceBackend(); err != nil {
+		t.Fatal(err)
+	}
+	forgetDriveInfo()
+	t.Cleanup(func() {
+		deviceBackend = previous
+		forgetDriveInfo()
+	})
+	return activeFakeBackend()
+}
+
+// captureOutput returns what run prints to standard output, including what
+// goes through consoleOut.
+func captureOutput(t *testing.T, run func()) string {
+	t.Helper()
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(read)
+		output <- string(data)
+	}()
+
+	stdout, out := os.Stdout, consoleOut
+	os.Stdout, consoleOut = write, consoleWriter{write}
+	defer func() {
+		os.Stdout, consoleOut = stdout, out
+	}()
+	run()
+	write.Close()
+	return <-output
+}
+
+func TestListDrivesFake(t *testing.T) {
+	useFakeDevices(t,
+		fakeDrive{Device: "disk9", Model: "Fake Stick", SizeGB: 16, Filesystem: "FAT32", Label: "GIGSTICK"},
+		fakeDrive{Device: "disk8", Model: "Ejected Stick", SizeGB: 32, Ejected: true},
+		fakeDrive{Device: "disk0", Model: "Internal SSD", SizeGB: 500, Internal: true, System: true},
+	)
+
+	output := captureOutput(t, func() { listDrives(listCmd, nil) })
+	for _, want := range []string{"disk9", "GIGSTICK", "FAT32"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("list output is missing %q:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"disk8", "disk0"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("list output shows %s, which is ejected or internal:\n%s", unwanted, output)
+		}
+	}
+}
+
+func TestFormatSingleDriveFake(t *testing.T) {
+	mountPoint := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mountPoint, "old.mp3"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := useFakeDevices(t, fakeDrive{Device: "disk9", SizeGB: 16, Filesystem: "FAT32", Label: "OLD", MountPoint: mountPoint})
+
+	previousAnswers := promptAnswers
+	promptAnswers = map[string]string{"eject": "no"}
+	t.Cleanup(func() { promptAnswers = previousAnswers })
+
+	output := captureOutput(t, func() {
+		formatSingleDrive("disk9", FormatOptions{Filesystem: "exFAT", Label: "GIG", Folders: []string{"Music"}})
+	})
+
+	drive := fake.drive("disk9")
+	if drive.Filesystem != "exFAT" || drive.Label != "GIG" {
+		t.Errorf("drive is %s %q after format, want exFAT \"GIG\"", drive.Filesystem, drive.Label)
+	}
+	if _, err := os.Stat(filepath.Join(mountPoint, "old.mp3")); !os.IsNotExist(err) {
+		t.Errorf("old.mp3 survived the format (stat error %v)", err)
+	}
+	if info, err := os.Stat(filepath.Join(mountPoint, "Music")); err != nil || !info.IsDir() {
+		t.Errorf("Music folder was not created: %v", err)
+	}
+	if !strings.Contains(output, "Format completed successfully") {
+		t.Errorf("format output does not report success:\n%s", output)
+	}
+}
+
+func TestFormatBatchDriveFakeFailure(t *testing.T) {
+	useFakeDevices(t, fakeDrive{Device: "disk9", SizeGB: 16, Filesystem: "FAT32", FormatError: "media is bad"})
+
+	var result string
+	captureOutput(t, func() {
+		result = formatBatchDrive("disk9", FormatOptions{Filesystem: "FAT32", Label: "GIG"})
+	})
+	if !strings.Contains(result, "FAILED") || !strings.Contains(result, "media is bad") {
+		t.Errorf("formatBatchDrive = %q, want a FAILED line with the drive's error", result)
+	}
+}
+
+func TestRunIntegrityCheckFake(t *testing.T) {
+	const testSize = 3 * 1024 * 1024
+	tests := []struct {
+		name      string
+		errorRate float64
+		wantOK    bool
+	}{
+		{"healthy", 0, true},
+		{"corrupting", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mountPoint := t.TempDir()
+			useFakeDevices(t, fakeDrive{Device: "disk9", SizeGB: 16, Filesystem: "FAT32", MountPoint: mountPoint, ErrorRate: tt.errorRate})
+
+			testFile, _, err := resolveTestFilePath("disk9", "cdjf_verify.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result IntegrityResult
+			captureOutput(t, func() {
+				result = runIntegrityCheck(testFile, testSize, false, nil)
+			})
+
+			if result.Success() != tt.wantOK {
+				t.Fatalf("Success() = %v, want %v (errors: %v)", result.Success(), tt.wantOK, result.Errors)
+			}
+			if result.BytesWritten != testSize {
+				t.Errorf("BytesWritten = %d, want %d", result.BytesWritten, testSize)
+			}
+			if tt.wantOK && result.BytesVerified != testSize {
+				t.Errorf("BytesVerified = %d, want %d", result.BytesVerified, testSize)
+			}
+		})
+	}
+}
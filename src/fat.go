@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const bootSectorReadSize = 4096
+
+type BootSector struct {
+	FilesystemType    string
+	OEMName           string
+	BytesPerSector    int
+	SectorsPerCluster int
+	ReservedSectors   int
+	FATCount          int
+	RootEntries       int
+	SectorsPerFAT     uint32
+	TotalSectors      uint64
+	RootCluster       uint32
+	VolumeID          uint32
+	Label             string
+	ClusterHeapOffset uint32
+	VolumeFlags       uint16
+	ClusterCount      uint32
+}
+
+func (b BootSector) ClusterSize() int {
+	return b.BytesPerSector * b.SectorsPerCluster
+}
+
+// DataRegionOffset returns the byte offset of cluster 2 relative to the start of the volume.
+func (b BootSector) DataRegionOffset() int64 {
+	bps := int64(b.BytesPerSector)
+	if b.FilesystemType == "exFAT" {
+		return int64(b.ClusterHeapOffset) * bps
+	}
+	rootDirSectors := (int64(b.RootEntries)*32 + bps - 1) / bps
+	return (int64(b.ReservedSectors) + int64(b.FATCount)*int64(b.SectorsPerFAT) + rootDirSectors) * bps
+}
+
+func (b BootSector) VolumeIDString() string {
+	return fmt.Sprintf("%04X-%04X", b.VolumeID>>16, b.VolumeID&0xFFFF)
+}
+
+func looksLikeBootSector(data []byte) bool {
+	if len(data) < 512 {
+		return false
+	}
+	if bytes.Equal(data[3:11], []byte("EXFAT   ")) {
+		return true
+	}
+	if data[0] != 0xEB && data[0] != 0xE9 {
+		return false
+	}
+	return bytes.HasPrefix(data[82:90], []byte("FAT32")) || bytes.HasPrefix(data[54:62], []byte("FAT1"))
+}
+
+func parseBootSector(data []byte) (BootSector, error) {
+	if len(data) < 512 || data[510] != 0x55 || data[511] != 0xAA {
+		return BootSector{}, fmt.Errorf("boot sector signature missing")
+	}
+
+	if bytes.Equal(data[3:11], []byte("EXFAT   ")) {
+		return parseExFATBootSector(data), nil
+	}
+
+	boot := BootSector{
+		OEMName:           strings.TrimSpace(string(data[3:11])),
+		BytesPerSector:    int(binary.LittleEndian.Uint16(data[11:13])),
+		SectorsPerCluster: int(data[13]),
+		ReservedSectors:   int(binary.LittleEndian.Uint16(data[14:16])),
+		FATCount:          int(data[16]),
+		RootEntries:       int(binary.LittleEndian.Uint16(data[17:19])),
+	}
+	if boot.BytesPerSector == 0 || boot.SectorsPerCluster == 0 {
+		return BootSector{}, fmt.Errorf("not a FAT boot sector")
+	}
+
+	totalSectors := uint64(binary.LittleEndian.Uint16(data[19:21]))
+	if totalSectors == 0 {
+		totalSectors = uint64(binary.LittleEndian.Uint32(data[32:36]))
+	}
+	boot.TotalSectors = totalSectors
+
+	sectorsPerFAT16 := binary.LittleEndian.Uint16(data[22:24])
+	if sectorsPerFAT16 == 0 {
+		boot.FilesystemType = "FAT32"
+		boot.SectorsPerFAT = binary.LittleEndian.Uint32(data[36:40])
+		boot.RootCluster = binary.LittleEndian.Uint32(data[44:48])
+		if data[66] == 0x29 {
+			boot.VolumeID = binary.LittleEndian.Uint32(data[67:71])
+			boot.Label = strings.TrimSpace(string(data[71:82]))
+		}
+	} else {
+		boot.FilesystemType = "FAT16"
+		boot.SectorsPerFAT = uint32(sectorsPerFAT16)
+		if data[38] == 0x29 {
+			boot.VolumeID = binary.LittleEndian.Uint32(data[39:43])
+			boot.Label = strings.TrimSpace(string(data[43:54]))
+		}
+	}
+
+	if dataStart := uint64(boot.DataRegionOffset() / int64(boot.BytesPerSector)); boot.TotalSectors > dataStart {
+		boot.ClusterCount = uint32((boot.TotalSectors - dataStart) / uint64(boot.SectorsPerCluster))
+	}
+
+	return boot, nil
+}
+
+func parseExFATBootSector(data []byte) BootSector {
+	bytesPerSector := 1 << data[108]
+	return BootSector{
+		FilesystemType:    "exFAT",
+		OEMName:           "EXFAT",
+		BytesPerSector:    bytesPerSector,
+		SectorsPerCluster: 1 << data[109],
+		ReservedSectors:   int(binary.LittleEndian.Uint32(data[80:84])),
+		FATCount:          int(data[110]),
+		SectorsPerFAT:     binary.LittleEndian.Uint32(data[84:88]),
+		TotalSectors:      binary.LittleEndian.Uint64(data[72:80]),
+		RootCluster:       binary.LittleEndian.Uint32(data[96:100]),
+		VolumeID:          binary.LittleEndian.Uint32(data[100:104]),
+		ClusterHeapOffset: binary.LittleEndian.Uint32(data[88:92]),
+		VolumeFlags:       binary.LittleEndian.Uint16(data[106:108]),
+		ClusterCount:      binary.LittleEndian.Uint32(data[92:96]),
+	}
+}
+
+func parseVolumeID(value string) (uint32, error) {
+	cleaned := strings.ReplaceAll(strings.TrimSpace(value), "-", "")
+	if len(cleaned) != 8 {
+		return 0, fmt.Errorf("invalid volume ID %q; expected XXXX-XXXX", value)
+	}
+	id, err := strconv.ParseUint(cleaned, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume ID %q; expected XXXX-XXXX", value)
+	}
+	return uint32(id), nil
+}
+
+// exfatBootChecksum computes the checksum stored in sector 11 of an exFAT boot region.
+func exfatBootChecksum(region []byte, bytesPerSector int) uint32 {
+	var checksum uint32
+	for i, b := range region[:11*bytesPerSector] {
+		if i == 106 || i == 107 || i == 112 {
+			continue
+		}
+		checksum = (checksum >> 1) | (checksum << 31)
+		checksum += uint32(b)
+	}
+	return checksum
+}
+
+func patchVolumeID(region []byte, boot BootSector, id uint32) error {
+	bps := boot.BytesPerSector
+	switch boot.FilesystemType {
+	case "FAT32":
+		binary.LittleEndian.PutUint32(region[67:71], id)
+		backup := int(binary.LittleEndian.Uint16(region[50:52]))
+		if backup > 0 && (backup+1)*bps <= len(region) {
+			binary.LittleEndian.PutUint32(region[backup*bps+67:backup*bps+71], id)
+		}
+	case "FAT16":
+		binary.LittleEndian.PutUint32(region[39:43], id)
+	case "exFAT":
+		if len(region) < 24*bps {
+			return fmt.Errorf("exFAT boot region too short")
+		}
+		for _, start := range []int{0, 12 * bps} {
+			bootRegion := region[start : start+12*bps]
+			binary.LittleEndian.PutUint32(bootRegion[100:104], id)
+			checksum := exfatBootChecksum(bootRegion, bps)
+			for i := 11 * bps; i < 12*bps; i += 4 {
+				binary.LittleEndian.PutUint32(bootRegion[i:i+4], checksum)
+			}
+		}
+	default:
+		return fmt.Errorf("setting the volume ID is not supported for %s", boot.FilesystemType)
+	}
+	return nil
+}
+
+func writeVolumeID(device string, id uint32) (err error) {
+	file, base, err := openVolumeForWrite(device)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		if releaseErr := releaseVolume(device); err == nil {
+			err = releaseErr
+		}
+	}()
+
+	head := make([]byte, bootSectorReadSize)
+	if _, err := file.ReadAt(head, base); err != nil {
+		return fmt.Errorf("read boot sector: %w", err)
+	}
+	boot, err := parseBootSector(head)
+	if err != nil {
+		return err
+	}
+
+	sectors := 16
+	if boot.FilesystemType == "exFAT" {
+		sectors = 24
+	}
+	region := make([]byte, sectors*boot.BytesPerSector)
+	if _, err := file.ReadAt(region, base); err != nil {
+		return fmt.Errorf("read boot region: %w", err)
+	}
+
+	if err := patchVolumeID(region, boot, id); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(region, base); err != nil {
+		return fmt.Errorf("write boot region: %w", err)
+	}
+	return file.Sync()
+}
+
+// firstVolumeOffset returns the byte offset of the first filesystem on the disk.
+func firstVolumeOffset(table PartitionTable) (int64, error) {
+	if table.Scheme == superfloppyScheme {
+		return 0, nil
+	}
+	if len(table.Partitions) == 0 {
+		return 0, fmt.Errorf("no partitions found")
+	}
+	return table.Partitions[0].StartOffset(table.SectorSize), nil
+}
+
+func readBootSector(device string) (BootSector, int64, error) {
+	table, err := readPartitionTable(device)
+	if err != nil {
+		return BootSector{}, 0, err
+	}
+	offset, err := firstVolumeOffset(table)
+	if err != nil {
+		return BootSector{}, 0, err
+	}
+
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return BootSector{}, 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return BootSector{}, 0, err
+	}
+	defer file.Close()
+
+	data := make([]byte, bootSectorReadSize)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return BootSector{}, 0, fmt.Errorf("read boot sector: %w", err)
+	}
+
+	boot, err := parseBootSector(data)
+	if err != nil {
+		return BootSector{}, 0, err
+	}
+	return boot, offset, nil
+}
+
+// readVolumeDirty reports whether the filesystem was not cleanly unmounted. FAT
+// keeps a clean-shutdown bit in the second FAT entry; exFAT keeps a VolumeDirty
+// flag in the boot sector.
+func readVolumeDirty(device string) (bool, error) {
+	boot, offset, err := readBootSector(device)
+	if err != nil {
+		return false, err
+	}
+	if boot.FilesystemType == "exFAT" {
+		return boot.VolumeFlags&0x0002 != 0, nil
+	}
+
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return false, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	fat := make([]byte, boot.BytesPerSector)
+	if _, err := file.ReadAt(fat, offset+int64(boot.ReservedSectors)*int64(boot.BytesPerSector)); err != nil {
+		return false, fmt.Errorf("read FAT: %w", err)
+	}
+	if boot.FilesystemType == "FAT32" {
+		return binary.LittleEndian.Uint32(fat[4:8])&0x08000000 == 0, nil
+	}
+	return binary.LittleEndian.Uint16(fat[2:4])&0x8000 == 0, nil
+}
+
+func printBootSector(boot BootSector, offset int64) {
+	fmt.Printf("Filesystem: %s\n", boot.FilesystemType)
+	fmt.Printf("Boot sector offset: %d bytes\n", offset)
+	fmt.Printf("OEM name: %s\n", boot.OEMName)
+	fmt.Printf("Bytes per sector: %d\n", boot.BytesPerSector)
+	fmt.Printf("Sectors per cluster: %d (%d KB clusters)\n", boot.SectorsPerCluster, boot.ClusterSize()/1024)
+	fmt.Printf("Reserved sectors: %d\n", boot.ReservedSectors)
+	fmt.Printf("FAT count: %d\n", boot.FATCount)
+	fmt.Printf("Sectors per FAT: %d\n", boot.SectorsPerFAT)
+	fmt.Printf("Total sectors: %d (%.2f GB)\n", boot.TotalSectors,
+		float64(boot.TotalSectors)*float64(boot.BytesPerSector)/(1024*1024*1024))
+	if boot.FilesystemType != "FAT16" {
+		fmt.Printf("Root directory cluster: %d\n", boot.RootCluster)
+	}
+	fmt.Printf("Volume ID: %s\n", boot.VolumeIDString())
+	if boot.Label != "" {
+		fmt.Printf("Label: %s\n", boot.Label)
+	} else {
+		fmt.Println("Label: (none in boot sector)")
+	}
+
+	if boot.FATCount != 2 && boot.FilesystemType != "exFAT" {
+		printWarning("Unusual FAT count; some players expect two FAT copies.")
+	}
+	if boot.BytesPerSector != 512 && boot.FilesystemType == "FAT32" {
+		printWarning("Non-512-byte sectors are not supported by older CDJ/XDJ firmware.")
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/spf13/cobra"
+)
+
+// fat32MaxClusters is the largest cluster count a FAT32 volume may have.
+const fat32MaxClusters = 0x0FFFFFF5
+
+// partitionOffset is where cdjf and the system formatters start the first
+// partition, aligned to 1 MB.
+const partitionOffset = 1024 * 1024
+
+// LibraryUsage sums up a music folder or rekordbox export.
+type LibraryUsage struct {
+	Files   int
+	Folders int
+	Bytes   int64
+	// sizes and entries keep what is needed to work out the space taken
+	// under any cluster size without walking the folder again.
+	sizes   []int64
+	entries map[string][]string
+}
+
+// scanLibrary walks a library folder and records every file and folder.
+func scanLibrary(root string) (LibraryUsage, error) {
+	usage := LibraryUsage{entries: make(map[string][]string)}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root {
+			parent := filepath.Dir(path)
+			usage.entries[parent] = append(usage.entries[parent], entry.Name())
+		}
+		if entry.IsDir() {
+			usage.Folders++
+			if _, ok := usage.entries[path]; !ok {
+				usage.entries[path] = nil
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		usage.Files++
+		usage.Bytes += info.Size()
+		usage.sizes = append(usage.sizes, info.Size())
+		return nil
+	})
+	return usage, err
+}
+
+// directoryEntryBytes is the space one name takes in a directory: on FAT a
+// short entry plus long-name entries of 13 characters each, on exFAT a file
+// entry set with name entries of 15 characters each.
+func directoryEntryBytes(name, filesystem string) int64 {
+	length := int64(len(utf16.Encode([]rune(name))))
+	if filesystem == "exFAT" {
+		return 32 * (2 + (length+14)/15)
+	}
+	return 32 * (1 + (length+12)/13)
+}
+
+// allocatedBytes is the space the library takes on a volume with the given
+// cluster size. Every file and folder takes whole clusters, so a library of
+// many small files needs far more than its byte count on large clusters.
+func (u LibraryUsage) allocatedBytes(filesystem string, cluster int64) int64 {
+	roundUp := func(n int64) int64 {
+		return (n + cluster - 1) / cluster * cluster
+	}
+	var total int64
+	for _, size := range u.sizes {
+		total += roundUp(size)
+	}
+	for _, names := range u.entries {
+		// The . and .. entries, or the exFAT volume entries in the root.
+		dirBytes := int64(64)
+		for _, name := range names {
+			dirBytes += directoryEntryBytes(name, filesystem)
+		}
+		total += roundUp(dirBytes)
+	}
+	return total
+}
+
+// defaultClusterSize is the cluster size the Windows and macOS formatters
+// pick when none is given.
+func defaultClusterSize(filesystem string, sizeBytes int64) int64 {
+	const gb = 1024 * 1024 * 1024
+	switch filesystem {
+	case "exFAT":
+		switch {
+		case sizeBytes <= 256*1024*1024:
+			return 4 * 1024
+		case sizeBytes <= 32*gb:
+			return 32 * 1024
+		default:
+			return 128 * 1024
+		}
+	case "UDF":
+		return 2048
+	default:
+		switch {
+		case sizeBytes <= 8*gb:
+			return 4 * 1024
+		case sizeBytes <= 16*gb:
+			return 8 * 1024
+		case sizeBytes <= 32*gb:
+			return 16 * 1024
+		default:
+			return 32 * 1024
+		}
+	}
+}
+
+// usableBytes estimates the space for files on a fresh volume filling the
+// drive: what is left after partition alignment, reserved sectors, the
+// allocation tables, and on exFAT the bitmap and upcase table. ok is false
+// when FAT32 would need more clusters than it allows.
+func usableBytes(sizeBytes int64, filesystem string, cluster int64) (usable int64, ok bool) {
+	space := sizeBytes - partitionOffset
+	if space <= 0 {
+		return 0, false
+	}
+	switch filesystem {
+	case "exFAT":
+		// A 1 MB aligned boot region, one FAT with four bytes and a bitmap
+		// with one bit per cluster, then the upcase table and root directory.
+		clusters := (space - partitionOffset) * 8 / (8*cluster + 33)
+		return (clusters - 2) * cluster, clusters > 2
+	case "UDF":
+		return space - partitionOffset, true
+	default:
+		// 32 reserved sectors and two FATs with four bytes per cluster,
+		// then the root directory.
+		clusters := (space - 32*512) / (cluster + 8)
+		return (clusters - 1) * cluster, clusters > 1 && clusters <= fat32MaxClusters
+	}
+}
+
+func gigabytes(n int64) float64 {
+	return float64(n) / (1024 * 1024 * 1024)
+}
+
+func fitLibrary(cmd *cobra.Command, args []string) {
+	library, device := args[0], args[1]
+	targetName, _ := cmd.Flags().GetString("target")
+	filesystemInput, _ := cmd.Flags().GetString("fs")
+	clusterSizeInput, _ := cmd.Flags().GetString("cluster-size")
+
+	if info, err := os.Stat(library); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	} else if !info.IsDir() {
+		printError("Error: %s is not a folder", library)
+		os.Exit(1)
+	}
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	target, err := lookupTarget(targetName)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	filesystem := target.Filesystem
+	if strings.TrimSpace(filesystemInput) != "" {
+		if filesystem, err = normalizeFilesystem(filesystemInput); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+	clusterSize := strings.TrimSpace(clusterSizeInput)
+	if clusterSize == "" {
+		clusterSize = target.ClusterSize
+	}
+	if clusterSize != "" {
+		if clusterSize, err = normalizeClusterSize(clusterSize); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	sizeBytes, err := getDiskSizeBytes(device)
+	if err != nil || sizeBytes <= 0 {
+		printError("Error: unable to determine the size of %s: %v", device, err)
+		os.Exit(1)
+	}
+	if limitErr := checkFAT32Capacity(gigabytes(sizeBytes), FormatOptions{Filesystem: filesystem}, runtime.GOOS); limitErr != nil {
+		fmt.Printf("%v; assuming exFAT, which cdjf format offers instead.\n", limitErr)
+		filesystem = "exFAT"
+	}
+	cluster := int64(clusterSizeBytes(clusterSize))
+	if cluster <= 0 {
+		cluster = defaultClusterSize(filesystem, sizeBytes)
+	}
+
+	usage, err := scanLibrary(library)
+	if err != nil {
+		printError("Error: unable to read %s: %v", library, err)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Fit check for %s on %s", library, device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	fmt.Printf("Library: %d files in %d folders, %.2f GB\n", usage.Files, usage.Folders, gigabytes(usage.Bytes))
+
+	needed := usage.allocatedBytes(filesystem, cluster)
+	fmt.Printf("On the drive: %.2f GB with %d KB clusters (%.2f GB lost to partly filled clusters)\n", gigabytes(needed), cluster/1024, gigabytes(needed-usage.Bytes))
+
+	usable, ok := usableBytes(sizeBytes, filesystem, cluster)
+	if !ok {
+		printError("Error: %d KB clusters are too small for %s on a %.1f GB drive", cluster/1024, filesystem, gigabytes(sizeBytes))
+		os.Exit(1)
+	}
+	fmt.Printf("Drive: %.2f GB, about %.2f GB usable as %s\n", gigabytes(sizeBytes), gigabytes(usable), filesystem)
+
+	if needed <= usable {
+		printOK("The library fits with %.2f GB to spare.", gigabytes(usable-needed))
+		return
+	}
+	fmt.Println(colorize(SeverityError, fmt.Sprintf("The library does not fit: %.2f GB short.", gigabytes(needed-usable))))
+
+	// Smaller clusters waste less on small files; suggest the largest one
+	// that makes the library fit.
+	for smaller := cluster / 2; smaller >= 4*1024; smaller /= 2 {
+		room, ok := usableBytes(sizeBytes, filesystem, smaller)
+		if ok && usage.allocatedBytes(filesystem, smaller) <= room {
+			fmt.Printf("   It fits with %d KB clusters: cdjf format --cluster-size %dK %s\n", smaller/1024, smaller/1024, device)
+			fmt.Println("   Check that your players support that cluster size first (cdjf targets).")
+			break
+		}
+	}
+	os.Exit(1)
+}
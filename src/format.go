@@ -4,36 +4,69 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+type FormatOptions struct {
+	Label       string
+	Filesystem  string
+	Scheme      string
+	ClusterSize string
+	Folders     []string
+	DocsSizeGB  float64
+	VolumeID    string
+	Payload     string
+	Alerts      CompletionAlerts
+	Verify      bool
+	// Full writes every sector instead of only the filesystem structures,
+	// so bad sectors fail the format rather than corrupting files later.
+	Full bool
+	// Trim discards the free space after formatting, for USB SSDs.
+	Trim bool
+	// PayloadOrder is payloadOrderMetadataFirst or payloadOrderFolder.
+	PayloadOrder string
+	// ClusterSizeRequested is set when --cluster-size was given, as opposed
+	// to a cluster size that came from a profile or target.
+	ClusterSizeRequested bool
+}
+
 func formatDrive(cmd *cobra.Command, args []string) {
 	skipConfirm, _ := cmd.Flags().GetBool("yes")
 	label, _ := cmd.Flags().GetString("label")
 	clusterSizeInput, _ := cmd.Flags().GetString("cluster-size")
-	profileName, _ := cmd.Flags().GetString("profile")
+	targetName, _ := cmd.Flags().GetString("target")
+	filesystemInput, _ := cmd.Flags().GetString("fs")
+	schemeInput, _ := cmd.Flags().GetString("scheme")
+	docsPartitionInput, _ := cmd.Flags().GetString("docs-partition")
+	volumeIDInput, _ := cmd.Flags().GetString("volume-id")
+	countdown, _ := cmd.Flags().GetInt("countdown")
+	skipBenchmark, _ := cmd.Flags().GetBool("skip-benchmark")
+	eraseAPFS, _ := cmd.Flags().GetBool("erase-apfs")
+	eraseBitLocker, _ := cmd.Flags().GetBool("erase-bitlocker")
+	parallelBenchmark, _ := cmd.Flags().GetBool("parallel-benchmark")
+	fullFormat, _ := cmd.Flags().GetBool("full-format")
+	trim, _ := cmd.Flags().GetBool("trim")
+	onlyIfEmpty, _ := cmd.Flags().GetBool("only-if-empty")
+	expectSizeInput, _ := cmd.Flags().GetString("expect-size")
+	expectModel, _ := cmd.Flags().GetString("expect-model")
+	benchmarkSample := int64(defaultBenchmarkMaxSample)
 
 	clusterSize := strings.TrimSpace(clusterSizeInput)
 	thresholds := defaultBenchmarkThresholds
+	payload := ""
+	payloadOrder := ""
 
-	if profileName != "" {
-		profile, err := loadProfileByName(profileName)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading profile %q: %v\n", profileName, err)
-			os.Exit(1)
-		}
-
-		displayName := profileDisplayName(profile, profileName)
-		fmt.Printf("Applying profile %q\n", displayName)
-
+	if profile, ok := profileFromFlag(cmd); ok {
 		if profile.BenchmarkThresholds != nil {
 			thresholds = mergedBenchmarkThresholds(profile.BenchmarkThresholds)
 		}
@@ -45,156 +78,706 @@ func formatDrive(cmd *cobra.Command, args []string) {
 		if clusterSize == "" && strings.TrimSpace(profile.ClusterSize) != "" {
 			clusterSize = profile.ClusterSize
 		}
+
+		if strings.TrimSpace(targetName) == "" {
+			targetName = profile.Target
+		}
+
+		payload = profile.Payload
+		payloadOrder = profile.PayloadOrder
+
+		if !cmd.Flags().Changed("skip-benchmark") {
+			skipBenchmark = profile.SkipBenchmark
+		}
+		if profile.BenchmarkSizeMB > 0 {
+			benchmarkSample = int64(profile.BenchmarkSizeMB) * 1024 * 1024
+		}
+		if !cmd.Flags().Changed("expect-size") {
+			expectSizeInput = profile.ExpectSize
+		}
+		if !cmd.Flags().Changed("expect-model") {
+			expectModel = profile.ExpectModel
+		}
+	}
+
+	expectedSize, err := parseSizeRange(expectSizeInput)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	target, err := lookupTarget(targetName)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if strings.TrimSpace(targetName) != "" {
+		fmt.Fprintf(consoleOut, "Using target %s (%s)\n", target.Name, target.Description)
+	}
+
+	if clusterSize == "" {
+		clusterSize = target.ClusterSize
 	}
 
 	if clusterSize != "" {
 		normalized, err := normalizeClusterSize(clusterSize)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			printError("Error: %v", err)
 			os.Exit(1)
 		}
 		clusterSize = normalized
 	}
 
+	filesystem := target.Filesystem
+	if strings.TrimSpace(filesystemInput) != "" {
+		normalized, err := normalizeFilesystem(filesystemInput)
+		if err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		filesystem = normalized
+	}
+
+	scheme := target.Scheme
+	if strings.TrimSpace(schemeInput) != "" {
+		normalized, err := normalizeScheme(schemeInput)
+		if err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		scheme = normalized
+	}
+
+	policy, err := loadPolicy()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if !policy.allowsFilesystem(filesystem) {
+		printError("Error: %s is not allowed by the policy in %s", filesystem, policyPath())
+		os.Exit(1)
+	}
+
+	docsSizeGB, err := parseDocsPartitionSize(docsPartitionInput)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if filesystem == "UDF" {
+		if docsSizeGB > 0 {
+			printError("Error: --docs-partition cannot be combined with UDF")
+			os.Exit(1)
+		}
+		fmt.Fprintln(consoleOut, "  EXPERIMENTAL: UDF formatting is for evaluation only.")
+		fmt.Fprintf(consoleOut, "   %s\n", filesystemCompatibilityWarning(filesystem))
+	}
+	if docsSizeGB > 0 {
+		printDualPartitionWarnings(docsSizeGB)
+	}
+
+	volumeID := strings.TrimSpace(volumeIDInput)
+	if volumeID != "" && !strings.EqualFold(volumeID, "preserve") {
+		parsed, err := parseVolumeID(volumeID)
+		if err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		volumeID = fmt.Sprintf("%04X-%04X", parsed>>16, parsed&0xFFFF)
+	}
+
+	requestedLabel := strings.TrimSpace(label)
+	label, err = normalizeLabel(label, filesystem)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if label != requestedLabel {
+		recordWarning("", warnLabelChanged, fmt.Sprintf("Label %q is written as %q, since %s labels are upper case", requestedLabel, label, filesystem))
+	}
+
+	opts := FormatOptions{
+		Label:        label,
+		Filesystem:   filesystem,
+		Scheme:       scheme,
+		ClusterSize:  clusterSize,
+		Folders:      target.Folders,
+		DocsSizeGB:   docsSizeGB,
+		VolumeID:     volumeID,
+		Payload:      payload,
+		PayloadOrder: payloadOrder,
+		Alerts:       completionAlertsFromFlags(cmd),
+		Verify:       policy.RequireVerify,
+		Full:         fullFormat,
+		Trim:         trim,
+	}
+	opts.ClusterSizeRequested = cmd.Flags().Changed("cluster-size")
+
 	var devices []string
 
 	if len(args) > 0 {
 		devices = args
 	} else {
-		fmt.Println("Available drives:")
+		fmt.Fprintln(consoleOut, "Available drives:")
 		listDrives(cmd, args)
-		fmt.Println()
-		fmt.Print("Enter device(s) to format (space-separated for multiple): ")
-		reader := bufio.NewReader(os.Stdin)
+		fmt.Fprintln(consoleOut)
+		fmt.Fprint(consoleOut, "Enter device(s) to format (space-separated for multiple): ")
+		reader := stdinReader()
 		input, _ := reader.ReadString('\n')
 		deviceStr := strings.TrimSpace(input)
 		if deviceStr == "" {
-			fmt.Fprintln(os.Stderr, "Error: No device specified")
+			printError("Error: No device specified")
 			os.Exit(1)
 		}
 		devices = strings.Fields(deviceStr)
 	}
 
 	if len(devices) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: No device specified")
+		printError("Error: No device specified")
+		os.Exit(1)
+	}
+
+	if len(devices) > 1 && opts.VolumeID != "" && !strings.EqualFold(opts.VolumeID, "preserve") {
+		printError("Error: a specific --volume-id can only be applied to one drive at a time")
 		os.Exit(1)
 	}
 
+	devices, ok := resolveFormatDisks(devices, skipConfirm)
+	if !ok {
+		fmt.Fprintln(consoleOut, "Format cancelled.")
+		return
+	}
+
+	fat32Blocked := false
+	var rawDevices []string
 	for _, device := range devices {
 		if err := validateDevice(device); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with device %s: %v\n", device, err)
+			printError("Error with device %s: %v", device, err)
 			os.Exit(1)
 		}
 
 		if err := ensureRemovableDevice(device); err != nil {
-			fmt.Fprintf(os.Stderr, "Error with device %s: %v\n", device, err)
+			printError("Error with device %s: %v", device, err)
+			os.Exit(1)
+		}
+
+		if err := checkWriteProtection(device, false); err != nil {
+			printError("Error: %v", err)
 			os.Exit(1)
 		}
 
+		if err := checkExpectedSize(device, expectedSize); err != nil {
+			printError("Error: %v", err)
+			fmt.Fprintln(consoleOut, "Nothing was formatted. Check that this is the right drive, or change --expect-size.")
+			os.Exit(1)
+		}
+
+		if err := checkExpectedModel(device, expectModel); err != nil {
+			printError("Error: %v", err)
+			fmt.Fprintln(consoleOut, "Nothing was formatted. Check that this is the right drive, or change --expect-model.")
+			os.Exit(1)
+		}
+
+		if onlyIfEmpty {
+			if err := checkDriveEmpty(device); err != nil {
+				printError("Error: %v", err)
+				fmt.Fprintln(consoleOut, "Nothing was formatted. Check that this is the right drive, or run without --only-if-empty.")
+				os.Exit(1)
+			}
+		}
+
+		if containers := apfsContainersOn(device); len(containers) > 0 {
+			printAPFSWarning(device, containers)
+			if !eraseAPFS {
+				if skipConfirm {
+					printError("Error: %s holds APFS volumes. Re-run with --erase-apfs to destroy them.", device)
+					os.Exit(1)
+				}
+				response := ask("erase-apfs", "   Destroy the APFS container and all of its volumes? (y/N): ")
+				if response != "y" && response != "yes" {
+					fmt.Fprintln(consoleOut, "Format cancelled.")
+					return
+				}
+			}
+		}
+
+		if status := bitLockerStatus(device); status.Protected {
+			printBitLockerWarning(device, status)
+			if !eraseBitLocker {
+				if skipConfirm {
+					printError("Error: %s is encrypted with BitLocker. Re-run with --erase-bitlocker to erase it.", device)
+					os.Exit(1)
+				}
+				response := ask("erase-bitlocker", "   Erase the encrypted drive? (y/N): ")
+				if response != "y" && response != "yes" {
+					fmt.Fprintln(consoleOut, "Format cancelled.")
+					return
+				}
+			}
+			// Encrypted drives cannot be mounted for a benchmark either.
+			rawDevices = append(rawDevices, device)
+		} else if isRawVolume(device) {
+			fmt.Fprintf(consoleOut, "%s has no readable filesystem (RAW); it will be repartitioned from scratch.\n", device)
+			rawDevices = append(rawDevices, device)
+		}
+
 		size := getDriveSize(device)
-		if size > 1024 {
-			fmt.Printf("  WARNING: Drive %s is %.1f GB (over 1TB)\n", device, size)
-			fmt.Println("   Large drives may not perform well on Pioneer CDJ/XDJ hardware.")
+		if target.MaxCapacityGB > 0 && size > target.MaxCapacityGB {
+			warn(device, warnCapacity, "Drive %s is %.1f GB (over the %.0f GB recommended for %s)", device, size, target.MaxCapacityGB, target.Description)
+			fmt.Fprintln(consoleOut, "   Large drives may not perform well on Pioneer CDJ/XDJ hardware.")
+		}
+
+		if limitErr := checkFAT32Capacity(size, opts, runtime.GOOS); limitErr != nil {
+			warn(device, warnFilesystem, "%s: %v", device, limitErr)
+			fat32Blocked = true
+		}
+	}
+
+	if fat32Blocked {
+		if !policy.allowsFilesystem("exFAT") {
+			printError("Error: FAT32 cannot be used on this drive and the policy in %s does not allow exFAT. Use a smaller drive.", policyPath())
+			os.Exit(1)
+		}
+		fmt.Fprintln(consoleOut, "   Switching to exFAT avoids this limit; CDJ-3000, XDJ-RX3, and OPUS-QUAD read exFAT.")
+		fmt.Fprintln(consoleOut, "   Older players such as the CDJ-2000NXS2 need FAT32 on a smaller drive.")
+		if skipConfirm {
+			printError("Error: FAT32 cannot be used on this drive. Re-run with --fs exfat or a smaller drive.")
+			os.Exit(1)
+		}
+		response := ask("use-exfat", "   Format as exFAT instead? (Y/n): ")
+		if response != "" && response != "y" && response != "yes" {
+			fmt.Fprintln(consoleOut, "Format cancelled.")
+			return
+		}
+		opts.Filesystem = "exFAT"
+		recordWarning("", warnFilesystem, "Formatted as exFAT instead of FAT32, which older players cannot read")
+	}
+
+	if !skipConfirm && !skipBenchmark && len(devices) > 1 {
+		if !confirmBatchBenchmarks(devices, benchmarkSample, thresholds, parallelBenchmark) {
+			fmt.Fprintln(consoleOut, "Format cancelled.")
+			return
 		}
 	}
 
-	if !skipConfirm && len(devices) == 1 {
-		fmt.Printf("\nBenchmarking %s to check performance...\n", devices[0])
-		result := benchmarkDrive(devices[0])
-		fmt.Println(benchmarkSummary(result, thresholds))
-		if thresholds.Prompt > 0 && result.WriteMBps > 0 && result.WriteMBps < thresholds.Prompt {
-			fmt.Print("   Do you want to proceed anyway? (Y/n): ")
-			reader := bufio.NewReader(os.Stdin)
-			response, _ := reader.ReadString('\n')
-			response = strings.ToLower(strings.TrimSpace(response))
+	if !skipBenchmark && len(rawDevices) > 0 {
+		// Benchmarks write a test file, which needs a mounted filesystem.
+		fmt.Fprintln(consoleOut, "Skipping the benchmark because a RAW or encrypted drive cannot be read; run 'cdjf verify' after formatting.")
+		skipBenchmark = true
+	}
+
+	var measured BenchmarkResult
+	if !skipConfirm && !skipBenchmark && len(devices) == 1 {
+		fmt.Fprintf(consoleOut, "\nBenchmarking %s to check performance...\n", devices[0])
+		result := benchmarkDriveLimited(devices[0], benchmarkSample, false)
+		measured = result
+		fmt.Fprintln(consoleOut, benchmarkSummary(result, thresholds))
+		recordBenchmarkWarning(devices[0], result, thresholds)
+		if thresholds.belowPrompt(result) {
+			response := ask("proceed-on-slow", "   Do you want to proceed anyway? (Y/n): ")
 			if response != "yes" && response != "y" {
-				fmt.Println("Format cancelled.")
+				fmt.Fprintln(consoleOut, "Format cancelled.")
 				return
 			}
 		}
 	}
 
+	if opts.Full {
+		printFullFormatEstimates(devices, measured)
+	}
+
 	if !skipConfirm {
-		fmt.Println()
-		fmt.Println("! WARNING !")
+		fmt.Fprintln(consoleOut)
+		fmt.Fprintln(consoleOut, colorize(SeverityError, "! WARNING !"))
 		if len(devices) == 1 {
-			fmt.Printf("This will ERASE ALL DATA on %s\n", devices[0])
+			fmt.Fprintf(consoleOut, "This will ERASE ALL DATA on %s\n", devices[0])
 		} else {
-			fmt.Printf("This will ERASE ALL DATA on %d drives: %s\n", len(devices), strings.Join(devices, ", "))
+			fmt.Fprintf(consoleOut, "This will ERASE ALL DATA on %d drives: %s\n", len(devices), strings.Join(devices, ", "))
 		}
-		fmt.Println()
-		fmt.Print("Are you sure you want to continue? (Y/n): ")
-
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.ToLower(strings.TrimSpace(response))
+		fmt.Fprintln(consoleOut)
+		response := ask("confirm-format", "Are you sure you want to continue? (Y/n): ")
 
 		if response != "yes" && response != "y" {
-			fmt.Println("Format cancelled.")
+			fmt.Fprintln(consoleOut, "Format cancelled.")
+			return
+		}
+	}
+
+	if countdown > 0 {
+		printFormatTargets(devices, opts)
+		if !runCountdown("Formatting starts", countdown) {
+			fmt.Fprintln(consoleOut, "Format cancelled.")
 			return
 		}
 	}
 
 	if len(devices) == 1 {
-		formatSingleDrive(devices[0], label, clusterSize)
+		formatSingleDrive(devices[0], opts)
 	} else {
-		fmt.Printf("\nFormatting %d drives concurrently...\n\n", len(devices))
-		formatMultipleDrives(devices, label, clusterSize)
+		fmt.Fprintf(consoleOut, "\nFormatting %d drives concurrently...\n\n", len(devices))
+		formatMultipleDrives(devices, opts)
+	}
+}
+
+// resolveFormatDisks replaces macOS partitions and volumes, such as disk4s1,
+// with the disks holding them, since only a whole disk can be erased. Each
+// replacement is confirmed because it erases every other volume on the disk;
+// with --yes it is refused instead. It reports false when the user declines.
+func resolveFormatDisks(devices []string, skipConfirm bool) ([]string, bool) {
+	var resolved []string
+	for _, device := range devices {
+		disk := physicalDiskIdentifier(device)
+		if disk != device {
+			if skipConfirm {
+				printError("Error: %s is a volume on %s, and formatting erases the whole disk. Pass %s to format it.", device, disk, disk)
+				os.Exit(1)
+			}
+			printWarning("%s is a volume on %s. Formatting erases the whole disk, including any other volumes on it.", device, disk)
+			response := ask("format-whole-disk", fmt.Sprintf("   Format %s instead? (y/N): ", disk))
+			if response != "y" && response != "yes" {
+				return nil, false
+			}
+		}
+		if !containsFold(resolved, disk) {
+			resolved = append(resolved, disk)
+		}
+	}
+	return resolved, true
+}
+
+// checkExpectedModel is the guard behind --expect-model: it fails unless the
+// vendor and model of device contain expected, ignoring case and spacing, so
+// "sandisk ultra" matches a "SanDisk Ultra USB 3.0". A drive that reports no
+// model fails too, since it cannot be shown to match.
+func checkExpectedModel(device, expected string) error {
+	want := strings.Join(strings.Fields(strings.ToLower(expected)), " ")
+	if want == "" {
+		return nil
+	}
+	model := strings.TrimSpace(getDriveModel(device))
+	if model == "" {
+		return fmt.Errorf("unable to read the model of %s to check it against the expected %q", device, expected)
+	}
+	name := model
+	if vendor := getDriveVendorName(device); vendor != "" && !strings.Contains(strings.ToLower(model), strings.ToLower(vendor)) {
+		name = vendor + " " + model
+	}
+	if !strings.Contains(strings.Join(strings.Fields(strings.ToLower(name)), " "), want) {
+		return fmt.Errorf("%s is a %s, not the expected %q", device, name, expected)
+	}
+	return nil
+}
+
+// checkDriveEmpty is the guard behind --only-if-empty: it fails unless every
+// volume on the disk behind device holds no user files. Hidden files and the folders Windows creates on its own
+// do not count, nor do empty folders. A drive with no readable filesystem is
+// empty; one that cannot be looked inside, such as an unmounted or encrypted
+// drive, is not known to be and fails.
+func checkDriveEmpty(device string) error {
+	if isRawVolume(device) {
+		return nil
 	}
+	mountPoints, err := diskMountPoints(device)
+	if err != nil {
+		return fmt.Errorf("--only-if-empty could not look inside %s: %v", device, err)
+	}
+	for _, mountPoint := range mountPoints {
+		if err := checkVolumeEmpty(device, mountPoint); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func formatSingleDrive(device, label, clusterSize string) {
+// checkVolumeEmpty fails when the volume mounted at mountPoint holds a file
+// checkDriveEmpty counts.
+func checkVolumeEmpty(device, mountPoint string) error {
+	example := ""
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if rel == "." {
+			return nil
+		}
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || (entry.IsDir() && (rel == "System Volume Information" || strings.EqualFold(rel, "$RECYCLE.BIN"))) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			example = filepath.ToSlash(rel)
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("--only-if-empty could not scan %s on %s: %v", mountPoint, device, err)
+	}
+	if example != "" {
+		return fmt.Errorf("%s is not empty (found %s on %s), and --only-if-empty only formats empty drives", device, example, mountPoint)
+	}
+	return nil
+}
+
+// confirmBatchBenchmarks benchmarks every drive of a multi-drive run, one at a
+// time or all at once, and asks before continuing when any fall below the
+// prompt threshold.
+func confirmBatchBenchmarks(devices []string, maxSample int64, thresholds BenchmarkThresholds, parallel bool) bool {
+	results := make([]BenchmarkResult, len(devices))
+	if parallel {
+		fmt.Fprintf(consoleOut, "\nBenchmarking %d drives in parallel...\n", len(devices))
+		var wg sync.WaitGroup
+		for i, device := range devices {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i] = benchmarkDriveLimited(device, maxSample, true)
+			}()
+		}
+		wg.Wait()
+	} else {
+		for i, device := range devices {
+			fmt.Fprintf(consoleOut, "\n[%s] Benchmarking to check performance...\n", device)
+			results[i] = benchmarkDriveLimited(device, maxSample, false)
+		}
+	}
+
+	fmt.Fprintln(consoleOut)
+	title := "Benchmark Summary"
+	fmt.Fprintln(consoleOut, title)
+	fmt.Fprintln(consoleOut, strings.Repeat("=", len(title)))
+	var slow []string
+	for i, device := range devices {
+		result := results[i]
+		grade := benchmarkSeverity(result, thresholds)
+		line := fmt.Sprintf("[%s] write %.2f MB/s, read %.2f MB/s - %s", device, result.WriteMBps, result.ReadMBps, grade)
+		fmt.Fprintln(consoleOut, colorize(severityOf(grade), line))
+		recordBenchmarkWarning(device, result, thresholds)
+		if thresholds.belowPrompt(result) {
+			slow = append(slow, device)
+		}
+	}
+	if len(slow) == 0 {
+		return true
+	}
+
+	fmt.Fprintf(consoleOut, "   %s write slower than %.2f MB/s or read slower than %.2f MB/s.\n", strings.Join(slow, ", "), thresholds.Prompt, thresholds.ReadPrompt)
+	response := ask("proceed-on-slow", "   Do you want to proceed anyway? (Y/n): ")
+	return response == "yes" || response == "y"
+}
+
+// fullFormatFallbackMBps is assumed for full format estimates when the drive
+// was not benchmarked. It is typical of cheap USB 2.0 sticks.
+const fullFormatFallbackMBps = 10.0
+
+// fullFormatEstimate predicts how long writing every sector of a drive takes.
+func fullFormatEstimate(sizeGB, writeMBps float64) time.Duration {
+	if writeMBps <= 0 {
+		writeMBps = fullFormatFallbackMBps
+	}
+	return time.Duration(sizeGB * 1024 / writeMBps * float64(time.Second))
+}
+
+// printFullFormatEstimates tells how long a full format will take, using the
+// benchmark result when there is one.
+func printFullFormatEstimates(devices []string, measured BenchmarkResult) {
+	fmt.Fprintln(consoleOut)
+	fmt.Fprintln(consoleOut, "Full format: every sector is written, so bad sectors are found now instead of")
+	fmt.Fprintln(consoleOut, "corrupting files at a gig. This takes much longer than a quick format:")
+	for _, device := range devices {
+		size := getDriveSize(device)
+		speed, basis := measured.WriteMBps, "measured"
+		if speed <= 0 || len(devices) > 1 {
+			speed, basis = fullFormatFallbackMBps, "assumed"
+		}
+		fmt.Fprintf(consoleOut, "  %s  %.1f GB, about %s at %.1f MB/s (%s)\n", device, size, formatDuration(fullFormatEstimate(size, speed)), speed, basis)
+	}
+}
+
+// printFormatTargets lists what is about to be erased so the countdown can be
+// stopped if the wrong drive was picked.
+func printFormatTargets(devices []string, opts FormatOptions) {
+	fmt.Fprintln(consoleOut)
+	title := "About to format"
+	fmt.Fprintln(consoleOut, title)
+	fmt.Fprintln(consoleOut, strings.Repeat("=", len(title)))
+	for _, device := range devices {
+		details := fmt.Sprintf("%.1f GB", getDriveSize(device))
+		if model := getDriveModel(device); model != "" {
+			details = model + ", " + details
+		}
+		current := "unlabeled"
+		if label := getVolumeLabel(device); label != "" {
+			current = fmt.Sprintf("%q", label)
+		}
+		fmt.Fprintf(consoleOut, "  %s  %s, currently %s -> %s %q\n", device, details, current, opts.Filesystem, opts.Label)
+	}
+	fmt.Fprintln(consoleOut)
+}
+
+func formatSingleDrive(device string, opts FormatOptions) {
 	if err := ensureRemovableDevice(device); err != nil {
-		fmt.Fprintf(os.Stderr, "Refusing to format %s: %v\n", device, err)
+		printError("Refusing to format %s: %v", device, err)
 		os.Exit(1)
 	}
-	label = getUniqueLabel(label, device)
+	opts.Label = getUniqueLabel(opts.Label, opts.Filesystem, device)
 
-	fmt.Printf("\nFormatting %s to FAT32...\n", device)
+	volumeID, err := resolveVolumeID(device, opts.VolumeID)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
 
-	switch runtime.GOOS {
-	case "darwin":
-		if err := formatMac(device, label, clusterSize); err != nil {
-			fmt.Fprintf(os.Stderr, "Error formatting drive: %v\n", err)
-			os.Exit(1)
+	hook := HookEvent{Device: device, Label: opts.Label, Filesystem: opts.Filesystem, Started: time.Now()}
+	if err := runHooks(withHook(hook, hookPreFormat)); err != nil {
+		printError("Refusing to format %s: %v", device, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(consoleOut, "\nFormatting %s to %s...\n", device, opts.Filesystem)
+
+	if err := formatDevice(device, opts); err != nil {
+		printError("Error formatting drive: %v", err)
+		opts.Alerts.Send("cdjf: format failed", fmt.Sprintf("%s: %v", device, err), true)
+		finishOperation(withHookResult(hook, hookPostFormat, err))
+		recordAudit("format", device, opts.Label, err)
+		printWarningSummary()
+		os.Exit(1)
+	}
+
+	fmt.Fprintln(consoleOut)
+	printOK("Format completed successfully!")
+	recordDriveWrites(device, "format", formatWriteEstimate(getDriveSize(device), opts.Full))
+
+	if mismatches := checkFormatResult(device, opts); len(mismatches) > 0 {
+		for _, mismatch := range mismatches {
+			warn(device, warnFormatResult, "%s", mismatch)
 		}
-	case "windows":
-		if err := formatWindows(device, label, clusterSize); err != nil {
-			fmt.Fprintf(os.Stderr, "Error formatting drive: %v\n", err)
-			os.Exit(1)
+		fmt.Fprintln(consoleOut, "   The drive may be rejected by players. Re-run the format or check it with 'cdjf check'.")
+	}
+	recordAudit("format", device, opts.Label, nil)
+
+	if opts.Trim {
+		trimAfterFormat(device)
+	}
+
+	if table, err := readPartitionTable(device); err == nil && len(table.Misaligned()) > 0 {
+		printAlignmentReport(table)
+	}
+
+	if volumeID != "" {
+		if err := applyVolumeID(device, volumeID); err != nil {
+			warn(device, warnSetup, "Unable to set volume ID: %v", err)
+		} else {
+			fmt.Fprintf(consoleOut, "Volume ID set to %s\n", volumeID)
 		}
-	default:
-		fmt.Fprintf(os.Stderr, "Unsupported operating system: %s\n", runtime.GOOS)
-		os.Exit(1)
 	}
 
-	fmt.Println()
-	fmt.Println("Format completed successfully!")
+	if len(opts.Folders) > 0 {
+		if err := createTargetFolders(device, opts.Folders); err != nil {
+			warn(device, warnSetup, "Unable to create folder layout: %v", err)
+		} else {
+			fmt.Fprintf(consoleOut, "Created folder layout: %s\n", strings.Join(opts.Folders, ", "))
+		}
+	}
+
+	if opts.Payload != "" {
+		if copied, err := copyPayload(device, opts.Payload, opts.Filesystem, opts.PayloadOrder); err != nil {
+			warn(device, warnSetup, "Unable to copy payload from %s: %v", opts.Payload, err)
+		} else {
+			fmt.Fprintf(consoleOut, "Copied %d payload files from %s\n", copied, opts.Payload)
+		}
+	}
+
+	opts.Alerts.Send("cdjf: format complete", fmt.Sprintf("%s is formatted as %s (%s).", device, opts.Filesystem, opts.Label), false)
+	finishOperation(withHookResult(hook, hookPostFormat, nil))
+
+	if opts.Verify {
+		fmt.Fprintln(consoleOut, "\nVerifying the drive...")
+		verifyDrive(verifyCmd, []string{device})
+	}
 
-	fmt.Println()
-	fmt.Print("Do you want to eject the newly formatted drive? (Y/n): ")
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.ToLower(strings.TrimSpace(response))
+	fmt.Fprintln(consoleOut)
+	response := ask("eject", "Do you want to eject the newly formatted drive? (Y/n): ")
 
 	if response == "" || response == "y" || response == "yes" {
 		if err := ejectDevice(device); err != nil {
-			fmt.Fprintf(os.Stderr, "Error ejecting drive: %v\n", err)
+			printError("Error ejecting drive: %v", err)
 		} else {
-			fmt.Println("Drive ejected successfully!")
+			printOK("Drive ejected successfully!")
+		}
+	}
+
+	fmt.Fprintln(consoleOut)
+	fmt.Fprintln(consoleOut, "Your USB drive is now ready for rekordbox.")
+	fmt.Fprintln(consoleOut, "You can now:")
+	fmt.Fprintln(consoleOut, "  1. Connect the drive to your computer with rekordbox installed")
+	fmt.Fprintln(consoleOut, "  2. Open rekordbox and add your music to the drive")
+	fmt.Fprintln(consoleOut, "  3. Safely eject the drive and use it on CDJ/XDJ players")
+	fmt.Fprintf(consoleOut, "  4. (Recommended) Run 'cdjf verify %s' to confirm the drive's health before loading music.\n", device)
+}
+
+// formatBatchDrive formats one drive of a multi-drive run and returns its
+// result line.
+func formatBatchDrive(dev string, opts FormatOptions) string {
+	if err := ensureRemovableDevice(dev); err != nil {
+		return fmt.Sprintf("[%s] FAILED: %v", dev, err)
+	}
+
+	volumeID, err := resolveVolumeID(dev, opts.VolumeID)
+	if err != nil {
+		return fmt.Sprintf("[%s] FAILED: %v", dev, err)
+	}
+
+	hook := HookEvent{Device: dev, Label: opts.Label, Filesystem: opts.Filesystem, Started: time.Now()}
+	if err := runHooks(withHook(hook, hookPreFormat)); err != nil {
+		return fmt.Sprintf("[%s] FAILED: %v", dev, err)
+	}
+
+	err = formatDevice(dev, opts)
+	recordAudit("format", dev, opts.Label, err)
+	if err != nil {
+		finishOperation(withHookResult(hook, hookPostFormat, err))
+		return fmt.Sprintf("[%s] FAILED: %v", dev, err)
+	}
+	recordDriveWrites(dev, "format", formatWriteEstimate(getDriveSize(dev), opts.Full))
+
+	if mismatches := checkFormatResult(dev, opts); len(mismatches) > 0 {
+		err := fmt.Errorf("formatted with unexpected settings: %s", strings.Join(mismatches, "; "))
+		finishOperation(withHookResult(hook, hookPostFormat, err))
+		return fmt.Sprintf("[%s] FAILED: %v", dev, err)
+	}
+	finishOperation(withHookResult(hook, hookPostFormat, nil))
+
+	if opts.Trim {
+		trimAfterFormat(dev)
+	}
+
+	if volumeID != "" {
+		if idErr := applyVolumeID(dev, volumeID); idErr != nil {
+			recordWarning(dev, warnSetup, fmt.Sprintf("Unable to set volume ID: %v", idErr))
+			return fmt.Sprintf("[%s] SUCCESS (volume ID not set: %v)", dev, idErr)
 		}
 	}
 
-	fmt.Println()
-	fmt.Println("Your USB drive is now ready for rekordbox.")
-	fmt.Println("You can now:")
-	fmt.Println("  1. Connect the drive to your computer with rekordbox installed")
-	fmt.Println("  2. Open rekordbox and add your music to the drive")
-	fmt.Println("  3. Safely eject the drive and use it on CDJ/XDJ players")
-	fmt.Printf("  4. (Recommended) Run 'cdjf verify %s' to confirm the drive's health before loading music.\n", device)
+	if folderErr := createTargetFolders(dev, opts.Folders); folderErr != nil {
+		recordWarning(dev, warnSetup, fmt.Sprintf("Unable to create folder layout: %v", folderErr))
+		return fmt.Sprintf("[%s] SUCCESS (folder layout failed: %v)", dev, folderErr)
+	}
+
+	if opts.Payload != "" {
+		if _, payloadErr := copyPayload(dev, opts.Payload, opts.Filesystem, opts.PayloadOrder); payloadErr != nil {
+			recordWarning(dev, warnSetup, fmt.Sprintf("Unable to copy payload from %s: %v", opts.Payload, payloadErr))
+			return fmt.Sprintf("[%s] SUCCESS (payload copy failed: %v)", dev, payloadErr)
+		}
+	}
+	return fmt.Sprintf("[%s] SUCCESS", dev)
 }
 
-func formatMultipleDrives(devices []string, baseLabel, clusterSize string) {
+func formatMultipleDrives(devices []string, baseOpts FormatOptions) {
 	var wg sync.WaitGroup
 	results := make(chan string, len(devices))
 
@@ -203,105 +786,235 @@ func formatMultipleDrives(devices []string, baseLabel, clusterSize string) {
 		go func(dev string, idx int) {
 			defer wg.Done()
 
-			label := baseLabel
+			opts := baseOpts
 			if idx > 0 {
-				label = fmt.Sprintf("%s%d", baseLabel, idx+1)
+				opts.Label = labelWithSuffix(baseOpts.Label, idx+1, baseOpts.Filesystem)
 			}
-			label = getUniqueLabel(label, dev)
+			opts.Label = getUniqueLabel(opts.Label, opts.Filesystem, dev)
 
-			fmt.Printf("[%s] Starting format...\n", dev)
-
-			if err := ensureRemovableDevice(dev); err != nil {
-				results <- fmt.Sprintf("[%s] FAILED: %v", dev, err)
-				return
-			}
-
-			var err error
-			switch runtime.GOOS {
-			case "darwin":
-				err = formatMac(dev, label, clusterSize)
-			case "windows":
-				err = formatWindows(dev, label, clusterSize)
-			}
-
-			if err != nil {
-				results <- fmt.Sprintf("[%s] FAILED: %v", dev, err)
-			} else {
-				results <- fmt.Sprintf("[%s] SUCCESS", dev)
-			}
+			fmt.Fprintf(consoleOut, "[%s] Starting format...\n", dev)
+			results <- formatBatchDrive(dev, opts)
 		}(device, i)
 	}
 
 	wg.Wait()
 	close(results)
 
-	fmt.Println("\n=== Format Results ===")
+	fmt.Fprintln(consoleOut, "\n=== Format Results ===")
+	failed := 0
+	var formatted []string
 	for result := range results {
-		fmt.Println(result)
+		fmt.Fprintln(consoleOut, colorize(severityOf(result), result))
+		if strings.Contains(result, "FAILED") {
+			failed++
+		} else if dev, _, ok := strings.Cut(strings.TrimPrefix(result, "["), "]"); ok {
+			formatted = append(formatted, dev)
+		}
 	}
 
-	fmt.Println()
-	fmt.Print("Do you want to eject all newly formatted drives? (Y/n): ")
-	reader := bufio.NewReader(os.Stdin)
-	response, _ := reader.ReadString('\n')
-	response = strings.ToLower(strings.TrimSpace(response))
+	if failed > 0 {
+		baseOpts.Alerts.Send("cdjf: format finished with errors", fmt.Sprintf("%d of %d drives failed to format.", failed, len(devices)), true)
+	} else {
+		baseOpts.Alerts.Send("cdjf: format complete", fmt.Sprintf("All %d drives formatted.", len(devices)), false)
+	}
+
+	if baseOpts.Verify && len(formatted) > 0 {
+		fmt.Fprintln(consoleOut, "\nVerifying the formatted drives, as required by policy...")
+		verifyDrive(verifyCmd, formatted)
+	}
+
+	fmt.Fprintln(consoleOut)
+	response := ask("eject", "Do you want to eject all newly formatted drives? (Y/n): ")
 
 	if response == "" || response == "y" || response == "yes" {
 		for _, device := range devices {
 			if err := ejectDevice(device); err != nil {
-				fmt.Printf("[%s] Error ejecting: %v\n", device, err)
+				fmt.Fprintf(consoleOut, "[%s] Error ejecting: %v\n", device, err)
 			} else {
-				fmt.Printf("[%s] Ejected successfully\n", device)
+				fmt.Fprintf(consoleOut, "[%s] Ejected successfully\n", device)
 			}
 		}
 	}
 
-	fmt.Println()
-	fmt.Println("All drives are now ready for rekordbox.")
-	fmt.Println("For extra peace of mind, run 'cdjf verify <drive>' on each drive before loading music.")
+	fmt.Fprintln(consoleOut)
+	fmt.Fprintln(consoleOut, "All drives are now ready for rekordbox.")
+	fmt.Fprintln(consoleOut, "For extra peace of mind, run 'cdjf verify <drive>' on each drive before loading music.")
+}
+
+// checkFormatResult reads the new filesystem back and reports any setting that
+// differs from what was requested. diskutil in particular can silently fall back
+// to another personality. The boot sector is preferred for the filesystem;
+// without raw access the one reported by the OS is compared instead. The label
+// comes from the OS, because format.com keeps the real label in the root
+// directory and leaves "NO NAME" in the FAT32 boot sector.
+func checkFormatResult(device string, opts FormatOptions) []string {
+	if opts.Filesystem == "UDF" {
+		return nil
+	}
+
+	var filesystem, bootLabel string
+	clusterSize := 0
+	if boot, _, err := readBootSector(device); err == nil {
+		filesystem = boot.FilesystemType
+		bootLabel = boot.Label
+		clusterSize = boot.ClusterSize()
+	} else {
+		filesystem = getDriveFilesystem(device)
+	}
+	label := getVolumeLabel(device)
+	if label == "" && bootLabel != "NO NAME" {
+		label = bootLabel
+	}
+
+	var mismatches []string
+	if filesystem != "" {
+		upper := strings.ToUpper(filesystem)
+		actual := filesystem
+		switch {
+		case strings.Contains(upper, "EXFAT"):
+			actual = "exFAT"
+		case strings.Contains(upper, "FAT32"):
+			actual = "FAT32"
+		}
+		if actual != opts.Filesystem {
+			mismatches = append(mismatches, fmt.Sprintf("expected %s but the drive reports %s", opts.Filesystem, filesystem))
+		}
+	}
+
+	if label != "" && !sameLabel(label, opts.Label, opts.Filesystem) {
+		mismatches = append(mismatches, fmt.Sprintf("expected label %q but the drive reports %q", opts.Label, label))
+	}
+
+	// Custom cluster sizes are only passed to the formatter on Windows.
+	if clusterSize > 0 && opts.ClusterSize != "" && runtime.GOOS == "windows" {
+		if expected := clusterSizeBytes(opts.ClusterSize); expected > 0 && expected != clusterSize {
+			mismatches = append(mismatches, fmt.Sprintf("expected %s clusters but the drive uses %d KB", opts.ClusterSize, clusterSize/1024))
+		}
+	}
+
+	return mismatches
+}
+
+func clusterSizeBytes(value string) int {
+	if strings.HasSuffix(value, "K") {
+		kb, err := strconv.Atoi(strings.TrimSuffix(value, "K"))
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	bytes, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return bytes
+}
+
+// resolveVolumeID returns the volume ID to write after formatting, reading the
+// current one from the drive when the option is "preserve".
+func resolveVolumeID(device, option string) (string, error) {
+	if option == "" {
+		return "", nil
+	}
+	if !strings.EqualFold(option, "preserve") {
+		return option, nil
+	}
+	boot, _, err := readBootSector(device)
+	if err != nil {
+		return "", fmt.Errorf("unable to read current volume ID to preserve: %v", err)
+	}
+	fmt.Fprintf(consoleOut, "Preserving volume ID %s\n", boot.VolumeIDString())
+	return boot.VolumeIDString(), nil
+}
+
+func applyVolumeID(device, volumeID string) error {
+	id, err := parseVolumeID(volumeID)
+	if err != nil {
+		return err
+	}
+	return writeVolumeID(device, id)
+}
+
+func checkFAT32Capacity(sizeGB float64, opts FormatOptions, goos string) error {
+	if opts.Filesystem != "FAT32" || sizeGB <= 0 {
+		return nil
+	}
+	if sizeGB > 2048 {
+		return fmt.Errorf("%.1f GB exceeds the 2 TB limit of FAT32 with 512-byte sectors", sizeGB)
+	}
+	if goos == "windows" && sizeGB > 32 {
+		return fmt.Errorf("%.1f GB exceeds the 32 GB limit of the Windows FAT32 formatter", sizeGB)
+	}
+	return nil
+}
+
+func formatDevice(device string, opts FormatOptions) error {
+	defer forgetDriveInfo()
+	return withRetry("Formatting "+device, func() error {
+		return deviceBackend.Format(device, opts)
+	})
+}
+
+func (systemBackend) Format(device string, opts FormatOptions) error {
+	switch runtime.GOOS {
+	case "darwin":
+		if opts.Full {
+			if err := zeroFillMac(device); err != nil {
+				return err
+			}
+		}
+		if opts.DocsSizeGB > 0 {
+			return partitionMac(device, opts)
+		}
+		return formatMac(device, opts)
+	case "windows":
+		// format.com only rewrites an existing volume, so RAW and BitLocker
+		// drives get a fresh partition table instead.
+		if opts.DocsSizeGB > 0 || isRawVolume(device) || bitLockerStatus(device).Protected {
+			return partitionWindows(device, opts)
+		}
+		return formatWindows(device, opts)
+	}
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 }
 
 func getExistingLabels(excludeDevice string) map[string]bool {
 	labels := make(map[string]bool)
 
+	if fake := activeFakeBackend(); fake != nil {
+		for _, device := range fake.Enumerate() {
+			if label := fake.drive(device).Label; device != excludeDevice && label != "" {
+				labels[strings.ToUpper(label)] = true
+			}
+		}
+		return labels
+	}
+
 	switch runtime.GOOS {
 	case "darwin":
-		cmd := exec.Command("diskutil", "list", "-plist")
+		cmd := execCommand("diskutil", "list", "-plist")
 		output, err := cmd.Output()
 		if err != nil {
 			return labels
 		}
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if strings.Contains(line, "VolumeName") {
+		for identifier, volumeName := range parseDiskutilVolumeNames(output) {
+			if excludeDevice != "" && (identifier == excludeDevice || strings.HasPrefix(identifier, excludeDevice+"s")) {
 				continue
 			}
+			labels[strings.ToUpper(volumeName)] = true
 		}
 	case "windows":
-		cmd := exec.Command("wmic", "logicaldisk", "get", "name,volumename")
-		output, err := cmd.Output()
+		disks, err := queryLogicalDisks("")
 		if err != nil {
 			return labels
 		}
 
-		lines := strings.Split(string(output), "\n")
-		for i, line := range lines {
-			if i == 0 || strings.TrimSpace(line) == "" {
+		for _, disk := range disks {
+			if excludeDevice != "" && strings.EqualFold(strings.TrimSuffix(disk.DeviceID, ":"), strings.TrimSuffix(excludeDevice, ":")) {
 				continue
 			}
-
-			parts := regexp.MustCompile(`\s+`).Split(strings.TrimSpace(line), 2)
-			if len(parts) >= 2 {
-				driveLetter := strings.TrimSuffix(parts[0], ":")
-				volumeName := strings.TrimSpace(parts[1])
-
-				if excludeDevice != "" && strings.HasPrefix(excludeDevice, driveLetter) {
-					continue
-				}
-
-				if volumeName != "" {
-					labels[strings.ToUpper(volumeName)] = true
-				}
+			if disk.VolumeName != "" {
+				labels[strings.ToUpper(disk.VolumeName)] = true
 			}
 		}
 	}
@@ -309,7 +1022,7 @@ func getExistingLabels(excludeDevice string) map[string]bool {
 	return labels
 }
 
-func getUniqueLabel(baseLabel, device string) string {
+func getUniqueLabel(baseLabel, filesystem, device string) string {
 	existingLabels := getExistingLabels(device)
 
 	if !existingLabels[strings.ToUpper(baseLabel)] {
@@ -317,9 +1030,10 @@ func getUniqueLabel(baseLabel, device string) string {
 	}
 
 	for i := 2; i <= 99; i++ {
-		candidate := baseLabel + strconv.Itoa(i)
+		candidate := labelWithSuffix(baseLabel, i, filesystem)
 		if !existingLabels[strings.ToUpper(candidate)] {
-			fmt.Printf("Label '%s' already exists, using '%s' instead\n", baseLabel, candidate)
+			fmt.Fprintf(consoleOut, "Label %q already exists, using %q instead\n", baseLabel, candidate)
+			recordWarning(device, warnLabelChanged, fmt.Sprintf("Label %q already exists, so %s was labeled %q", baseLabel, device, candidate))
 			return candidate
 		}
 	}
@@ -360,22 +1074,26 @@ func normalizeClusterSize(value string) (string, error) {
 	return "", fmt.Errorf("invalid cluster size %q; supported values: 512, 1K, 2K, 4K, 8K, 16K, 32K, 64K", value)
 }
 
-func formatMac(device, label, clusterSize string) error {
+func formatMac(device string, opts FormatOptions) error {
 	if err := ensureRemovableDevice(device); err != nil {
 		return err
 	}
-	if clusterSize != "" {
-		fmt.Println("Note: custom cluster size is not currently supported on macOS; using default size.")
+	if opts.Filesystem == "UDF" {
+		return formatMacUDF(device, opts)
+	}
+	if opts.ClusterSize != "" && opts.ClusterSizeRequested {
+		fmt.Fprintln(consoleOut, "Note: custom cluster size is not currently supported on macOS; using default size.")
+		recordWarning(device, warnClusterSize, fmt.Sprintf("Cluster size %s was ignored; macOS used its default", opts.ClusterSize))
 	}
-	fmt.Println("Unmounting device...")
-	unmountCmd := exec.Command("diskutil", "unmountDisk", device)
+	fmt.Fprintln(consoleOut, "Unmounting device...")
+	unmountCmd := execCommand("diskutil", "unmountDisk", device)
 	if output, err := unmountCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
 	}
 
-	fmt.Println("Creating FAT32 filesystem...")
+	fmt.Fprintf(consoleOut, "Creating %s filesystem...\n", opts.Filesystem)
 
-	formatCmd := exec.Command("diskutil", "eraseDisk", "FAT32", label, "MBR", device)
+	formatCmd := execCommand("diskutil", "eraseDisk", diskutilPersonality(opts.Filesystem), opts.Label, opts.Scheme, device)
 	stdout, err := formatCmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("diskutil stdout: %v", err)
@@ -430,23 +1148,40 @@ func formatMac(device, label, clusterSize string) error {
 	}
 
 	progress.Finish()
-	return nil
+	// The erase replaced the partitions and volumes the cache describes.
+	forgetDriveInfo()
+	return alignMacPartition(device, opts)
 }
 
-func formatWindows(device, label, clusterSize string) error {
+func formatWindows(device string, opts FormatOptions) error {
 	if err := ensureRemovableDevice(device); err != nil {
 		return err
 	}
 	driveLetter := strings.TrimSuffix(device, ":")
+	if opts.Scheme != "" && opts.Scheme != "MBR" {
+		fmt.Fprintf(consoleOut, "Note: partition scheme %s cannot be applied by a volume format on Windows; keeping the existing partition table.\n", opts.Scheme)
+	}
 
-	fmt.Println("Creating FAT32 filesystem...")
+	fmt.Fprintf(consoleOut, "Creating %s filesystem...\n", opts.Filesystem)
 
-	args := []string{driveLetter + ":", "/FS:FAT32", "/V:" + label, "/Q", "/Y"}
-	if clusterSize != "" {
-		args = append(args, "/A:"+clusterSize)
+	// Without /Q, format writes and checks every sector.
+	args := []string{driveLetter + ":", "/FS:" + opts.Filesystem, "/V:" + opts.Label, "/Y"}
+	if !opts.Full {
+		args = append(args, "/Q")
 	}
+	if opts.Filesystem == "UDF" {
+		args = append(args, "/R:2.01")
+	} else if opts.ClusterSize != "" {
+		args = append(args, "/A:"+opts.ClusterSize)
+	}
+
+	currentLabel := getVolumeLabel(device)
 
-	cmd := exec.Command("format", args...)
+	cmd := execCommand("format", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("format stdin: %v", err)
+	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("format stdout: %v", err)
@@ -459,10 +1194,34 @@ func formatWindows(device, label, clusterSize string) error {
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("format command failed to start: %v", err)
 	}
+	defer stdin.Close()
 
 	progress := NewProgressBar("Format", 100)
 	defer progress.Stop()
 
+	var failureMu sync.Mutex
+	var failureReason string
+	recordFailure := func(line string) {
+		if reason := windowsFormatFailure(line); reason != "" {
+			failureMu.Lock()
+			failureReason = reason
+			failureMu.Unlock()
+		}
+	}
+
+	answerPrompt := func(partial string) bool {
+		answer, ok := windowsFormatPromptAnswer(partial, currentLabel)
+		if !ok {
+			return false
+		}
+		printCommandOutput(partial)
+		if _, err := io.WriteString(stdin, answer); err != nil {
+			recordFailure("unable to answer prompt: " + err.Error())
+		}
+		return true
+	}
+	outputHandler := windowsFormatOutputHandler(progress)
+
 	var wg sync.WaitGroup
 	var readErr error
 	var mu sync.Mutex
@@ -479,13 +1238,17 @@ func formatWindows(device, label, clusterSize string) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		captureErr(streamCommandOutput(stdout, windowsFormatOutputHandler(progress)))
+		captureErr(streamCommandOutputWithPrompts(stdout, func(line string) {
+			recordFailure(line)
+			outputHandler(line)
+		}, answerPrompt))
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		captureErr(streamCommandOutput(stderr, func(line string) {
+			recordFailure(line)
 			printProgressMessage(line)
 		}))
 	}()
@@ -497,6 +1260,9 @@ func formatWindows(device, label, clusterSize string) error {
 		return fmt.Errorf("format command output error: %v", readErr)
 	}
 	if waitErr != nil {
+		if failureReason != "" {
+			return fmt.Errorf("format command failed: %s", failureReason)
+		}
 		return fmt.Errorf("format command failed: %v", waitErr)
 	}
 
@@ -504,7 +1270,78 @@ func formatWindows(device, label, clusterSize string) error {
 	return nil
 }
 
+// zeroFillMac writes zeros over the whole disk before a full format. diskutil
+// reports an I/O error if any sector cannot be written.
+func zeroFillMac(device string) error {
+	fmt.Fprintln(consoleOut, "Writing zeros to every sector...")
+	cmd := execCommand("diskutil", "secureErase", "0", device)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("diskutil stdout: %v", err)
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("diskutil failed to start: %v", err)
+	}
+
+	progress := NewProgressBar("Zero-fill", 100)
+	defer progress.Stop()
+	var lines []string
+	readErr := streamCommandOutput(stdout, func(line string) {
+		// Progress arrives as "[ / 0%..10%..20%.. ] 25%"; the last number is current.
+		if matches := percentRegex.FindAllStringSubmatch(line, -1); len(matches) > 0 {
+			if percent, err := strconv.Atoi(matches[len(matches)-1][1]); err == nil {
+				progress.Set(int64(percent))
+			}
+		}
+		lines = append(lines, line)
+		printCommandOutput(line)
+	})
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("zero-fill failed, the drive may have bad sectors: %v\nOutput: %s", err, strings.Join(lines, "\n"))
+	}
+	if readErr != nil {
+		return fmt.Errorf("diskutil output error: %v", readErr)
+	}
+	progress.Finish()
+	return nil
+}
+
+func formatMacUDF(device string, opts FormatOptions) error {
+	fmt.Fprintln(consoleOut, "Unmounting device...")
+	unmountCmd := execCommand("diskutil", "unmountDisk", device)
+	if output, err := unmountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+	}
+
+	fmt.Fprintln(consoleOut, "Creating UDF filesystem (experimental)...")
+	cmd := execCommand("newfs_udf", "-r", "2.01", "-v", opts.Label, "/dev/r"+device)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("newfs_udf failed: %v\nOutput: %s", err, output)
+	}
+
+	mountCmd := execCommand("diskutil", "mountDisk", device)
+	if output, err := mountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to mount after format: %v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+func diskutilPersonality(filesystem string) string {
+	if filesystem == "exFAT" {
+		return "ExFAT"
+	}
+	return "FAT32"
+}
+
 func streamCommandOutput(r io.Reader, handle func(string)) error {
+	return streamCommandOutputWithPrompts(r, handle, nil)
+}
+
+// streamCommandOutputWithPrompts behaves like streamCommandOutput but also offers
+// each partial line to prompt, so interactive questions that are not followed by
+// a newline can be answered. When prompt returns true the partial line is consumed.
+func streamCommandOutputWithPrompts(r io.Reader, handle func(string), prompt func(string) bool) error {
 	reader := bufio.NewReader(r)
 	var buf strings.Builder
 
@@ -535,32 +1372,71 @@ func streamCommandOutput(r io.Reader, handle func(string)) error {
 		}
 
 		buf.WriteByte(b)
+		if prompt != nil && (b == '?' || b == ':' || b == '.' || b == ' ') {
+			if prompt(strings.TrimSpace(buf.String())) {
+				buf.Reset()
+			}
+		}
+	}
+}
+
+// windowsFormatPromptAnswer returns the input to send when format.exe stops to ask a question.
+func windowsFormatPromptAnswer(partial, currentLabel string) (string, bool) {
+	lower := strings.ToLower(partial)
+	switch {
+	case strings.Contains(lower, "enter current volume label for drive") && strings.HasSuffix(lower, ":"):
+		return currentLabel + "\r\n", true
+	case strings.Contains(lower, "press enter when ready"):
+		return "\r\n", true
+	case strings.Contains(lower, "proceed with format (y/n)?"):
+		return "Y\r\n", true
+	case strings.Contains(lower, "(11 characters, enter for none)?"):
+		return "\r\n", true
 	}
+	return "", false
+}
+
+// windowsFormatFailure extracts a human readable reason from format.exe error output.
+func windowsFormatFailure(line string) string {
+	lower := strings.ToLower(line)
+	failures := []string{
+		"access is denied",
+		"incorrect volume label",
+		"volume is too big",
+		"invalid media",
+		"write protected",
+		"cannot open volume for direct access",
+		"format failed",
+		"insufficient disk space",
+	}
+	for _, failure := range failures {
+		if strings.Contains(lower, failure) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
 }
 
 func printProgressMessage(line string) {
 	if line == "" {
 		return
 	}
-	clearWidth := len(line) + 32
-	if clearWidth < 80 {
-		clearWidth = 80
-	}
-	fmt.Printf("\r%s\r%s\n", strings.Repeat(" ", clearWidth), line)
+	terminal.overwrite(line)
 }
 
 func macFormatOutputHandler(pb *ProgressBar) func(string) {
 	steps := []struct {
 		pattern  string
 		progress int64
+		summary  string
 	}{
-		{"started erase", 5},
-		{"unmounting", 15},
-		{"creating the partition map", 35},
-		{"waiting for partitions", 55},
-		{"formatting", 75},
-		{"initialization complete", 90},
-		{"finished", 100},
+		{"started erase", 5, "Starting erase"},
+		{"unmounting", 15, "Unmounting the drive"},
+		{"creating the partition map", 35, "Creating the partition map"},
+		{"waiting for partitions", 55, "Waiting for partitions"},
+		{"formatting", 75, "Formatting the volume"},
+		{"initialization complete", 90, "Initialization complete"},
+		{"finished", 100, "Erase finished"},
 	}
 
 	var last int64
@@ -572,11 +1448,19 @@ func macFormatOutputHandler(pb *ProgressBar) func(string) {
 				if step.progress > last {
 					pb.Set(step.progress)
 					last = step.progress
+					if verbosity == verbositySteps {
+						printProgressMessage(step.summary)
+					}
 				}
 				break
 			}
 		}
-		printProgressMessage(line)
+		// diskutil reports some failures on stdout, so those show at every level.
+		if strings.Contains(lower, "error") {
+			printProgressMessage(line)
+			return
+		}
+		printCommandOutput(line)
 	}
 }
 
@@ -593,6 +1477,7 @@ func windowsFormatOutputHandler(pb *ProgressBar) func(string) {
 				}
 				pb.Set(progress)
 			}
+			printCommandOutput(line)
 			return
 		}
 
@@ -600,9 +1485,7 @@ func windowsFormatOutputHandler(pb *ProgressBar) func(string) {
 		if strings.Contains(lower, "format complete") && last < 100 {
 			last = 100
 			pb.Set(100)
-			return
 		}
-
-		printProgressMessage(line)
+		printCommandStep(line)
 	}
 }
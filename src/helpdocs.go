@@ -0,0 +1,198 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+//go:embed help/*.txt
+var helpTopicFiles embed.FS
+
+// helpTopics are the extra guides shown by 'cdjf help <topic>'. They ship in
+// the binary so they work without internet access.
+var helpTopics = []struct {
+	Name  string
+	Short string
+	File  string
+}{
+	{"fat32", "FAT32 file and drive size limits", "help/fat32.txt"},
+	{"cluster-sizes", "Choosing a cluster size", "help/cluster-sizes.txt"},
+	{"players", "Which filesystem each player reads", "help/players.txt"},
+}
+
+// helpTopicCommands builds a command per help topic. Commands without a Run
+// function are listed by cobra under "Additional help topics".
+func helpTopicCommands() []*cobra.Command {
+	commands := make([]*cobra.Command, 0, len(helpTopics))
+	for _, topic := range helpTopics {
+		text, err := helpTopicFiles.ReadFile(topic.File)
+		if err != nil {
+			panic(err)
+		}
+		commands = append(commands, &cobra.Command{
+			Use:   topic.Name,
+			Short: topic.Short,
+			Long:  strings.TrimRight(string(text), "\n"),
+		})
+	}
+	return commands
+}
+
+// manPageName returns the file name for a command's man page, e.g.
+// cdjf-profile-save.1, or cdjf-fat32.7 for a help topic.
+func manPageName(cmd *cobra.Command) string {
+	return manPageTitle(cmd) + "." + manSection(cmd)
+}
+
+func manPageTitle(cmd *cobra.Command) string {
+	parts := strings.Fields(cmd.CommandPath())
+	parts[0] = "cdjf"
+	return strings.Join(parts, "-")
+}
+
+func manSection(cmd *cobra.Command) string {
+	if cmd.IsAdditionalHelpTopicCommand() {
+		return "7"
+	}
+	return "1"
+}
+
+// roffEscape escapes text for use in a man page.
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = `\&` + line
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeManPage renders one command in man(7) format.
+func writeManPage(cmd *cobra.Command, date string) string {
+	var b strings.Builder
+	name := manPageTitle(cmd)
+	fmt.Fprintf(&b, ".TH %q %s %q \"cdjf %s\" \"cdjf Manual\"\n", strings.ToUpper(name), manSection(cmd), date, version)
+
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s \\- %s\n", roffEscape(name), roffEscape(cmd.Short))
+
+	if !cmd.IsAdditionalHelpTopicCommand() {
+		b.WriteString(".SH SYNOPSIS\n")
+		fmt.Fprintf(&b, ".B %s\n", roffEscape(strings.Replace(cmd.UseLine(), "CDJF", "cdjf", 1)))
+	}
+
+	description := cmd.Long
+	if description == "" {
+		description = cmd.Short
+	}
+	b.WriteString(".SH DESCRIPTION\n.nf\n")
+	b.WriteString(roffEscape(strings.ReplaceAll(description, "\t", "    ")))
+	b.WriteString("\n.fi\n")
+
+	writeManFlags(&b, "OPTIONS", cmd.NonInheritedFlags())
+	writeManFlags(&b, "GLOBAL OPTIONS", cmd.InheritedFlags())
+
+	var related []string
+	if cmd.HasParent() {
+		related = append(related, manReference(cmd.Parent()))
+	}
+	for _, child := range cmd.Commands() {
+		if child.IsAvailableCommand() || child.IsAdditionalHelpTopicCommand() {
+			related = append(related, manReference(child))
+		}
+	}
+	if len(related) > 0 {
+		b.WriteString(".SH SEE ALSO\n")
+		b.WriteString(strings.Join(related, ",\n"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func manReference(cmd *cobra.Command) string {
+	return fmt.Sprintf(".BR %s (%s)", roffEscape(manPageTitle(cmd)), manSection(cmd))
+}
+
+func writeManFlags(b *strings.Builder, title string, flags *pflag.FlagSet) {
+	if !flags.HasAvailableFlags() {
+		return
+	}
+	fmt.Fprintf(b, ".SH %s\n", title)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
+		name := "\\-\\-" + roffEscape(flag.Name)
+		if flag.Shorthand != "" {
+			name = "\\-" + flag.Shorthand + ", " + name
+		}
+		if flag.Value.Type() != "bool" {
+			name += " " + flag.Value.Type()
+		}
+		usage := flag.Usage
+		if flag.DefValue != "" && flag.DefValue != "false" && flag.DefValue != "[]" && flag.DefValue != "0" {
+			usage += fmt.Sprintf(" (default %s)", flag.DefValue)
+		}
+		fmt.Fprintf(b, ".TP\n.B %s\n%s\n", name, roffEscape(usage))
+	})
+}
+
+// generateManPages writes a man page for every command and help topic into
+// the man1 and man7 folders under dir.
+func generateManPages(root *cobra.Command, dir string) (int, error) {
+	date := time.Now().Format("January 2006")
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		var seconds int64
+		if _, err := fmt.Sscan(epoch, &seconds); err == nil {
+			date = time.Unix(seconds, 0).UTC().Format("January 2006")
+		}
+	}
+
+	written := 0
+	var walk func(cmd *cobra.Command) error
+	walk = func(cmd *cobra.Command) error {
+		if !cmd.IsAvailableCommand() && !cmd.IsAdditionalHelpTopicCommand() && cmd != root {
+			return nil
+		}
+		sectionDir := filepath.Join(dir, "man"+manSection(cmd))
+		if err := os.MkdirAll(sectionDir, 0o755); err != nil {
+			return err
+		}
+		path := filepath.Join(sectionDir, manPageName(cmd))
+		if err := os.WriteFile(path, []byte(writeManPage(cmd, date)), 0o644); err != nil {
+			return err
+		}
+		written++
+		for _, child := range cmd.Commands() {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return written, walk(root)
+}
+
+func generateManCommand(cmd *cobra.Command, args []string) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	count, err := generateManPages(cmd.Root(), dir)
+	if err != nil {
+		printError("Error writing man pages: %v", err)
+		os.Exit(1)
+	}
+	printOK("Wrote %d man pages to %s", count, dir)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	hookPreFormat  = "pre-format"
+	hookPostFormat = "post-format"
+	hookPostVerify = "post-verify"
+
+	hookResultSuccess = "success"
+	hookResultFailure = "failure"
+)
+
+// hookEnvPrefix starts the environment variables hooks get. It is kept apart
+// from the CDJF_* flag variables, so a hook that runs cdjf itself doesn't
+// pick up the drive's label or device as flags.
+const hookEnvPrefix = envPrefix + "HOOK_"
+
+// HookEvent describes the drive a hook runs for. Its fields reach the hook
+// scripts as CDJF_HOOK_* environment variables.
+type HookEvent struct {
+	Hook       string
+	Device     string
+	Label      string
+	Filesystem string
+	Result     string
+	Error      string
+	Extra      map[string]string
+	// Started is when the operation began, for webhook durations.
+	Started time.Time
+}
+
+func withHook(event HookEvent, hook string) HookEvent {
+	event.Hook = hook
+	return event
+}
+
+// withHookResult sets the hook and the outcome of the operation it follows.
+func withHookResult(event HookEvent, hook string, err error) HookEvent {
+	event.Hook = hook
+	event.Result = hookResultSuccess
+	if err != nil {
+		event.Result = hookResultFailure
+		event.Error = err.Error()
+	}
+	return event
+}
+
+func (e HookEvent) environment() []string {
+	env := []string{
+		hookEnvPrefix + "NAME=" + e.Hook,
+		hookEnvPrefix + "DEVICE=" + e.Device,
+		hookEnvPrefix + "LABEL=" + e.Label,
+		hookEnvPrefix + "FILESYSTEM=" + e.Filesystem,
+		fmt.Sprintf("%sSIZE_GB=%.2f", hookEnvPrefix, getDriveSize(e.Device)),
+		hookEnvPrefix + "RESULT=" + e.Result,
+		hookEnvPrefix + "ERROR=" + e.Error,
+	}
+	keys := make([]string, 0, len(e.Extra))
+	for key := range e.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, hookEnvPrefix+strings.ToUpper(key)+"="+e.Extra[key])
+	}
+	return env
+}
+
+// runHooks runs the commands configured for event.Hook in order and stops at
+// the first one that fails.
+func runHooks(event HookEvent) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for _, command := range config.Hooks[event.Hook] {
+		fmt.Fprintf(consoleOut, "[%s] Running %s hook: %s\n", event.Device, event.Hook, command)
+		cmd := hookCommand(command)
+		cmd.Env = append(os.Environ(), event.environment()...)
+		// Hooks run while other drives draw progress bars, so their output
+		// goes through the console a line at a time, marked with the hook.
+		prefix := fmt.Sprintf("[%s %s] ", event.Device, event.Hook)
+		stdout := &linePrefixWriter{out: consoleOut, prefix: prefix}
+		stderr := &linePrefixWriter{out: consoleErr, prefix: prefix}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		stdout.Flush()
+		stderr.Flush()
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %v", event.Hook, command, err)
+		}
+	}
+	return nil
+}
+
+// finishOperation runs the post-operation hooks and webhooks, reporting
+// failures as warnings since the operation itself has already finished.
+func finishOperation(event HookEvent) {
+	if err := runHooks(event); err != nil {
+		printWarning("[%s] %v", event.Device, err)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return
+	}
+	sendWebhooks(config.Webhooks, newWebhookPayload(event))
+}
+
+func hookCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return execCommand("cmd", "/C", command)
+	}
+	return execCommand("sh", "-c", command)
+}
@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	imageChunkSize  = 1024 * 1024
+	imageSectorSize = 512
+)
+
+// countingReader tracks how many bytes have been read from the underlying
+// file so progress can be shown for compressed images.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// imageDestination is one drive being flashed by image write.
+type imageDestination struct {
+	device  string
+	file    *os.File
+	release func() error
+	err     error
+}
+
+func imageCreate(cmd *cobra.Command, args []string) {
+	device, imagePath := args[0], args[1]
+	full, _ := cmd.Flags().GetBool("full")
+	compressValue, _ := cmd.Flags().GetString("compress")
+	encrypt, _ := cmd.Flags().GetBool("encrypt")
+
+	compression, err := imageCompression(compressValue, imagePath)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	passphrase := ""
+	if encrypt {
+		if passphrase, err = readPassphrase(true); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	source, size, release, err := openDiskForRead(device)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	defer release()
+
+	out, err := os.Create(imagePath)
+	if err != nil {
+		printError("Error creating %s: %v", imagePath, err)
+		os.Exit(1)
+	}
+
+	// Data is compressed before it is encrypted; layers are closed innermost first.
+	var layers []io.Closer
+	var sink io.Writer = out
+	if encrypt {
+		encrypter, err := newEncryptWriter(out, passphrase)
+		if err != nil {
+			out.Close()
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		layers = append(layers, encrypter)
+		sink = encrypter
+	}
+	writer, err := newCompressWriter(sink, compression)
+	if err != nil {
+		out.Close()
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	layers = append([]io.Closer{writer}, layers...)
+
+	extents := []Extent{{Offset: 0, Length: size}}
+	if !full {
+		if used, err := sparseImageExtents(device, source, size); err != nil {
+			fmt.Fprintf(consoleOut, "Copying every sector: %v\n", err)
+		} else {
+			extents = used
+			fmt.Fprintf(consoleOut, "Copying only allocated clusters: %.2f GB of %.2f GB in use.\n",
+				float64(extentsLength(used))/(1024*1024*1024), float64(size)/(1024*1024*1024))
+			if err := writeSparseHeader(writer, size, extents); err != nil {
+				out.Close()
+				printError("Error writing image: %v", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	fmt.Fprintf(consoleOut, "Capturing %s (%.2f GB) to %s...\n", device, float64(size)/(1024*1024*1024), imagePath)
+	hasher := sha256.New()
+	progress := NewProgressBar("Image", extentsLength(extents))
+	buf := make([]byte, imageChunkSize)
+	var copied int64
+	for _, extent := range extents {
+		for pos := int64(0); pos < extent.Length; {
+			toRead := int64(len(buf))
+			if extent.Length-pos < toRead {
+				toRead = extent.Length - pos
+			}
+			n, readErr := source.ReadAt(buf[:toRead], extent.Offset+pos)
+			if n > 0 {
+				if _, err := writer.Write(buf[:n]); err != nil {
+					progress.Stop()
+					out.Close()
+					printError("Error writing image: %v", err)
+					os.Exit(1)
+				}
+				hasher.Write(buf[:n])
+				pos += int64(n)
+				copied += int64(n)
+				progress.Add(int64(n))
+			}
+			if readErr != nil {
+				progress.Stop()
+				out.Close()
+				printError("Error reading %s at offset %d: %v", device, extent.Offset+pos, readErr)
+				os.Exit(1)
+			}
+		}
+	}
+	progress.Finish()
+
+	for _, layer := range layers {
+		if err := layer.Close(); err != nil {
+			out.Close()
+			printError("Error writing image: %v", err)
+			os.Exit(1)
+		}
+	}
+	if err := out.Close(); err != nil {
+		printError("Error writing image: %v", err)
+		os.Exit(1)
+	}
+
+	printOK("Image saved to %s", imagePath)
+	fmt.Fprintf(consoleOut, "Captured %.2f GB, SHA-256 %s\n", float64(copied)/(1024*1024*1024), hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// openDiskForRead opens a whole drive for a raw copy. On macOS the disk is
+// unmounted first so the filesystem can't change while it is being read; the
+// release function closes the device and remounts it.
+func openDiskForRead(device string) (*os.File, int64, func(), error) {
+	size, err := getDiskSizeBytes(device)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	// A fake drive's image is a plain file with nothing to unmount.
+	unmount := runtime.GOOS == "darwin" && activeFakeBackend() == nil
+	if unmount {
+		disk := wholeDiskIdentifier(device)
+		if output, err := execCommand("diskutil", "unmountDisk", disk).CombinedOutput(); err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+		}
+		forgetDriveInfo()
+	}
+
+	source, err := os.Open(path)
+	if err != nil {
+		if unmount {
+			releaseVolume(device)
+		}
+		if os.IsPermission(err) {
+			return nil, 0, nil, fmt.Errorf("reading %s requires administrator privileges", path)
+		}
+		return nil, 0, nil, fmt.Errorf("unable to open %s: %v", path, err)
+	}
+
+	release := func() {
+		source.Close()
+		if unmount {
+			releaseVolume(device)
+		}
+	}
+	return source, size, release, nil
+}
+
+// sparseImageExtents reads the first volume's allocation map so only used
+// clusters are captured.
+func sparseImageExtents(device string, source *os.File, size int64) ([]Extent, error) {
+	boot, base, err := readBootSector(device)
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized filesystem (%v)", err)
+	}
+	return usedExtents(source, base, boot, size)
+}
+
+// imageSource is an opened image with its compression and encryption layers
+// removed.
+type imageSource struct {
+	io.Reader
+	counter *countingReader
+	size    int64
+	// raw is set when the image bytes map one to one onto the drive.
+	raw     bool
+	closers []func() error
+}
+
+func (s *imageSource) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openImage opens a raw, compressed, or encrypted image. The counter reports
+// progress through the file on disk.
+func openImage(path string) (*imageSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	counter := &countingReader{r: file}
+	source := &imageSource{counter: counter, size: info.Size(), raw: true, closers: []func() error{file.Close}}
+	buffered := bufio.NewReaderSize(counter, imageChunkSize)
+
+	if magic, _ := buffered.Peek(len(encryptedImageMagic)); bytes.Equal(magic, encryptedImageMagic) {
+		fmt.Fprintf(consoleOut, "%s is encrypted.\n", path)
+		passphrase, err := readPassphrase(false)
+		if err != nil {
+			source.Close()
+			return nil, err
+		}
+		decrypter, err := newDecryptReader(buffered, passphrase)
+		if err != nil {
+			source.Close()
+			return nil, err
+		}
+		buffered = bufio.NewReaderSize(decrypter, imageChunkSize)
+		source.raw = false
+	}
+
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			source.Close()
+			return nil, fmt.Errorf("read compressed image: %w", err)
+		}
+		source.Reader = gz
+		source.raw = false
+		source.closers = append(source.closers, gz.Close)
+	case bytes.Equal(magic, zstdMagic):
+		cmd := execCommand("zstd", "-d", "-q", "-c")
+		cmd.Stdin = buffered
+		cmd.Stderr = os.Stderr
+		zstd, err := startZstd(cmd)
+		if err != nil {
+			source.Close()
+			return nil, err
+		}
+		source.Reader = zstd
+		source.raw = false
+		source.closers = append(source.closers, zstd.Close)
+	default:
+		source.Reader = buffered
+	}
+	return source, nil
+}
+
+func imageWrite(cmd *cobra.Command, args []string) {
+	imagePath, devices := args[0], args[1:]
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+	noVerify, _ := cmd.Flags().GetBool("no-verify")
+
+	image, err := openImage(imagePath)
+	if err != nil {
+		printError("Error opening image: %v", err)
+		os.Exit(1)
+	}
+	defer image.Close()
+
+	reader := bufio.NewReaderSize(image, imageChunkSize)
+	var extents []Extent
+	var requiredSize int64
+	if image.raw {
+		requiredSize = image.size
+	}
+	if magic, _ := reader.Peek(len(sparseImageMagic)); bytes.Equal(magic, sparseImageMagic) {
+		size := int64(-1)
+		if image.raw {
+			size = image.size
+		}
+		if _, extents, err = readSparseHeader(reader, size); err != nil {
+			printError("Error opening image: %v", err)
+			os.Exit(1)
+		}
+		requiredSize = 0
+		if n := len(extents); n > 0 {
+			requiredSize = extents[n-1].Offset + extents[n-1].Length
+		}
+	}
+
+	for _, device := range devices {
+		if err := validateDevice(device); err != nil {
+			printError("Error with device %s: %v", device, err)
+			os.Exit(1)
+		}
+		if err := ensureRemovableDevice(device); err != nil {
+			printError("Error with device %s: %v", device, err)
+			os.Exit(1)
+		}
+		if err := checkWriteProtection(device, false); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		warnIfBehindHub(device)
+		if requiredSize > 0 {
+			if diskSize, err := getDiskSizeBytes(device); err == nil && diskSize < requiredSize {
+				printError("Error: %s (%.2f GB) is smaller than the image (%.2f GB)", device,
+					float64(diskSize)/(1024*1024*1024), float64(requiredSize)/(1024*1024*1024))
+				os.Exit(1)
+			}
+		}
+	}
+
+	if !skipConfirm {
+		fmt.Fprintln(consoleOut)
+		fmt.Fprintln(consoleOut, colorize(SeverityError, "! WARNING !"))
+		fmt.Fprintf(consoleOut, "This will ERASE ALL DATA on %s and replace it with %s\n", strings.Join(devices, ", "), imagePath)
+		response := ask("confirm-image-write", "Are you sure you want to continue? (yes/no): ")
+		if response != "yes" && response != "y" {
+			fmt.Fprintln(consoleOut, "Image write cancelled.")
+			return
+		}
+	}
+
+	var destinations []*imageDestination
+	for _, device := range devices {
+		file, release, err := openDiskForWrite(device)
+		dest := &imageDestination{device: device, file: file, release: release, err: err}
+		if err != nil {
+			printError("[%s] Error: %v", device, err)
+		}
+		destinations = append(destinations, dest)
+	}
+	defer func() {
+		for _, dest := range destinations {
+			if dest.file != nil {
+				dest.file.Close()
+			}
+			if dest.release != nil {
+				dest.release()
+			}
+		}
+	}()
+
+	fmt.Fprintf(consoleOut, "\nWriting %s to %d drive(s)...\n", imagePath, len(devices))
+	hasher := sha256.New()
+	written, err := fanOutImage(reader, extents, image.counter, image.size, destinations, hasher)
+	if err != nil {
+		printError("Error reading image: %v", err)
+		os.Exit(1)
+	}
+	digest := hasher.Sum(nil)
+
+	if !noVerify {
+		fmt.Fprintln(consoleOut, "Verifying written data...")
+		if extents == nil {
+			extents = []Extent{{Offset: 0, Length: written}}
+		}
+		verifyImageDestinations(destinations, extents, digest)
+	}
+
+	fmt.Fprintln(consoleOut, "\n=== Image Write Results ===")
+	failed := 0
+	for _, dest := range destinations {
+		result := fmt.Sprintf("[%s] SUCCESS", dest.device)
+		if dest.err != nil {
+			result = fmt.Sprintf("[%s] FAILED: %v", dest.device, dest.err)
+			failed++
+		} else if noVerify {
+			result += " (not verified)"
+		}
+		fmt.Fprintln(consoleOut, colorize(severityOf(result), result))
+		if dest.file != nil {
+			recordAudit("image-write", dest.device, imagePath, dest.err)
+			recordDriveWrites(dest.device, "image-write", written)
+		}
+	}
+	fmt.Fprintf(consoleOut, "Image: %.2f GB, SHA-256 %s\n", float64(written)/(1024*1024*1024), hex.EncodeToString(digest))
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// fanOutImage reads the image once and writes each chunk to every healthy
+// destination concurrently. A destination that fails is dropped; the others
+// carry on. Raw images have no extents and are written from offset 0 to EOF.
+func fanOutImage(image io.Reader, extents []Extent, counter *countingReader, fileSize int64, destinations []*imageDestination, hasher hash.Hash) (int64, error) {
+	progress := NewProgressBar("Write", fileSize)
+	defer progress.Stop()
+
+	streaming := extents == nil
+	if streaming {
+		extents = []Extent{{Offset: 0, Length: -1}}
+	}
+
+	buf := make([]byte, imageChunkSize)
+	var total int64
+	for _, extent := range extents {
+		for pos := int64(0); streaming || pos < extent.Length; {
+			want := buf
+			if !streaming && extent.Length-pos < int64(len(buf)) {
+				want = buf[:extent.Length-pos]
+			}
+			n, readErr := io.ReadFull(image, want)
+			if n > 0 {
+				hasher.Write(buf[:n])
+
+				// Raw disks only accept whole sectors; pad a short final chunk.
+				chunk := buf[:n]
+				if rem := n % imageSectorSize; rem != 0 {
+					padded := make([]byte, n+imageSectorSize-rem)
+					copy(padded, chunk)
+					chunk = padded
+				}
+
+				offset := extent.Offset + pos
+				var wg sync.WaitGroup
+				for _, dest := range destinations {
+					if dest.err != nil {
+						continue
+					}
+					wg.Add(1)
+					go func(dest *imageDestination) {
+						defer wg.Done()
+						if _, err := dest.file.WriteAt(chunk, offset); err != nil {
+							dest.err = fmt.Errorf("write at offset %d: %w", offset, err)
+						}
+					}(dest)
+				}
+				wg.Wait()
+
+				pos += int64(n)
+				total += int64(n)
+				progress.Set(counter.n)
+			}
+			if streaming && (readErr == io.EOF || readErr == io.ErrUnexpectedEOF) {
+				break
+			}
+			if readErr != nil {
+				return total, readErr
+			}
+		}
+	}
+	progress.Finish()
+
+	for _, dest := range destinations {
+		if dest.err == nil {
+			if err := dest.file.Sync(); err != nil {
+				dest.err = fmt.Errorf("flush: %w", err)
+			}
+		}
+	}
+	return total, nil
+}
+
+// verifyImageDestinations reads the written extents of each drive back and
+// compares their SHA-256 with the image's.
+func verifyImageDestinations(destinations []*imageDestination, extents []Extent, digest []byte) {
+	size := extentsLength(extents)
+	var total int64
+	for _, dest := range destinations {
+		if dest.err == nil {
+			total += size
+		}
+	}
+	progress := NewProgressBar("Verify", total)
+	defer progress.Stop()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, dest := range destinations {
+		if dest.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(dest *imageDestination) {
+			defer wg.Done()
+			hasher := sha256.New()
+			buf := make([]byte, imageChunkSize)
+			for _, extent := range extents {
+				for pos := int64(0); pos < extent.Length; {
+					remaining := extent.Length - pos
+					toRead := int64(len(buf))
+					if remaining < toRead {
+						// Read whole sectors and hash only the image's bytes.
+						toRead = (remaining + imageSectorSize - 1) / imageSectorSize * imageSectorSize
+					}
+					n, err := dest.file.ReadAt(buf[:toRead], extent.Offset+pos)
+					if int64(n) > remaining {
+						n = int(remaining)
+					}
+					hasher.Write(buf[:n])
+					pos += int64(n)
+					mu.Lock()
+					progress.Add(int64(n))
+					mu.Unlock()
+					if err != nil && pos < extent.Length {
+						dest.err = fmt.Errorf("read back at offset %d: %w", extent.Offset+pos, err)
+						return
+					}
+				}
+			}
+			if !bytes.Equal(hasher.Sum(nil), digest) {
+				dest.err = fmt.Errorf("verification failed: data on the drive does not match the image")
+			}
+		}(dest)
+	}
+	wg.Wait()
+	progress.Finish()
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	imageCompressNone = "none"
+	imageCompressGzip = "gzip"
+	imageCompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// encryptedImageMagic starts images sealed with a passphrase. It is
+	// followed by the key derivation parameters and a series of AES-256-GCM
+	// chunks, so tampering or truncation is caught before a drive is touched.
+	encryptedImageMagic = []byte("CDJFENC1")
+)
+
+const (
+	imageKeyIterations   = 600000
+	imageSaltSize        = 16
+	imageNoncePrefixSize = 4
+	imageCryptChunkSize  = 64 * 1024
+	imageFinalChunkFlag  = 1 << 31
+
+	// An image header naming an iteration count outside these bounds is
+	// refused, so a crafted file can neither weaken the key nor stall the
+	// read for hours deriving it.
+	imageMinKeyIterations = 100000
+	imageMaxKeyIterations = 10000000
+)
+
+// imageCompression picks the compression for a new image from the --compress
+// flag, inferring it from the file name when set to auto.
+func imageCompression(value, path string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "auto":
+		lower := strings.ToLower(path)
+		switch {
+		case strings.HasSuffix(lower, ".gz"):
+			return imageCompressGzip, nil
+		case strings.HasSuffix(lower, ".zst"):
+			return imageCompressZstd, nil
+		}
+		return imageCompressNone, nil
+	case imageCompressNone:
+		return imageCompressNone, nil
+	case imageCompressGzip:
+		return imageCompressGzip, nil
+	case imageCompressZstd:
+		return imageCompressZstd, nil
+	}
+	return "", fmt.Errorf("invalid --compress value %q; use auto, none, gzip, or zstd", value)
+}
+
+// newCompressWriter wraps w with the chosen compression. zstd is delegated to
+// the zstd command-line tool.
+func newCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case imageCompressGzip:
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	case imageCompressZstd:
+		cmd := execCommand("zstd", "-q", "-c", "-T0")
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		return startZstd(cmd)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// zstdProcess is a running zstd command. Writes go to its stdin; Close waits
+// for it to flush its output.
+type zstdProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	io.Reader
+}
+
+func startZstd(cmd *exec.Cmd) (*zstdProcess, error) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return nil, fmt.Errorf("zstd images require the zstd command-line tool (https://facebook.github.io/zstd/)")
+	}
+	process := &zstdProcess{cmd: cmd}
+	var err error
+	if cmd.Stdin == nil {
+		if process.stdin, err = cmd.StdinPipe(); err != nil {
+			return nil, err
+		}
+	}
+	if cmd.Stdout == nil {
+		if process.Reader, err = cmd.StdoutPipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start zstd: %w", err)
+	}
+	return process, nil
+}
+
+func (z *zstdProcess) Write(p []byte) (int, error) {
+	return z.stdin.Write(p)
+}
+
+func (z *zstdProcess) Close() error {
+	if z.stdin != nil {
+		z.stdin.Close()
+	}
+	if err := z.cmd.Wait(); err != nil {
+		return fmt.Errorf("zstd: %w", err)
+	}
+	return nil
+}
+
+// readPassphrase prompts for the image passphrase without echoing it. When
+// confirm is set it is asked for twice. Piped input is read as a single line.
+func readPassphrase(confirm bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if err == nil {
+				err = errors.New("empty passphrase")
+			}
+			return "", fmt.Errorf("read passphrase: %w", err)
+		}
+		return line, nil
+	}
+
+	fmt.Print("Image passphrase: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if len(first) == 0 {
+		return "", errors.New("passphrase cannot be empty")
+	}
+	if confirm {
+		fmt.Print("Confirm passphrase: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("read passphrase: %w", err)
+		}
+		if !bytes.Equal(first, second) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return string(first), nil
+}
+
+func imageCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce combines the image's random prefix with the chunk counter.
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, 0, imageNoncePrefixSize+8)
+	nonce = append(nonce, prefix...)
+	return binary.BigEndian.AppendUint64(nonce, counter)
+}
+
+// encryptWriter seals everything written to it in fixed-size chunks. Close
+// must be called to write the final chunk.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, imageSaltSize)
+	prefix := make([]byte, imageNoncePrefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	aead, err := imageCipher(passphrase, salt, imageKeyIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{}, encryptedImageMagic...)
+	header = binary.LittleEndian.AppendUint32(header, imageKeyIterations)
+	header = append(header, salt...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, imageCryptChunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		// Hold back a full chunk until more data arrives so the last chunk
+		// written is always the one marked final.
+		if len(e.buf) == cap(e.buf) && len(p) > 0 {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	length := uint32(len(e.buf) + e.aead.Overhead())
+	if final {
+		length |= imageFinalChunkFlag
+	}
+	header := binary.LittleEndian.AppendUint32(nil, length)
+	sealed := e.aead.Seal(header, chunkNonce(e.prefix, e.counter), e.buf, header)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader opens the chunks written by encryptWriter.
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	header := make([]byte, len(encryptedImageMagic)+4+imageSaltSize+imageNoncePrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read encryption header: %w", err)
+	}
+	if !bytes.Equal(header[:len(encryptedImageMagic)], encryptedImageMagic) {
+		return nil, errors.New("not an encrypted image")
+	}
+	rest := header[len(encryptedImageMagic):]
+	iterations := int(binary.LittleEndian.Uint32(rest))
+	if iterations < imageMinKeyIterations || iterations > imageMaxKeyIterations {
+		return nil, fmt.Errorf("encryption header asks for %d key iterations; expected %d to %d, so the image is damaged or was not written by cdjf", iterations, imageMinKeyIterations, imageMaxKeyIterations)
+	}
+	salt := rest[4 : 4+imageSaltSize]
+	prefix := append([]byte{}, rest[4+imageSaltSize:]...)
+
+	aead, err := imageCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead, prefix: prefix}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return fmt.Errorf("encrypted image is truncated: %w", err)
+	}
+	length := binary.LittleEndian.Uint32(header)
+	final := length&imageFinalChunkFlag != 0
+	length &^= imageFinalChunkFlag
+	if length < uint32(d.aead.Overhead()) || length > imageCryptChunkSize+uint32(d.aead.Overhead()) {
+		return errors.New("encrypted image is corrupt")
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("encrypted image is truncated: %w", err)
+	}
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.prefix, d.counter), sealed, header)
+	if err != nil {
+		if d.counter == 0 {
+			return errors.New("wrong passphrase or corrupt image")
+		}
+		return fmt.Errorf("encrypted image is corrupt at chunk %d", d.counter)
+	}
+	d.counter++
+	d.plain = plain
+	d.done = final
+	return nil
+}
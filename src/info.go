@@ -3,10 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -14,42 +11,81 @@ import (
 
 func showDriveInfo(cmd *cobra.Command, args []string) {
 	device := args[0]
+	thresholds := thresholdsFromFlag(cmd)
 
 	if err := validateDevice(device); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 
 	if err := ensureRemovableDevice(device); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 
 	infoTitle := fmt.Sprintf("Drive Information for %s", device)
 	fmt.Println(infoTitle)
 	fmt.Println(strings.Repeat("=", len(infoTitle)))
+	if issues := knownDriveIssues(device, getDriveModel(device)); len(issues) > 0 {
+		printKnownDriveIssues(device, issues)
+		fmt.Println()
+	}
 
-	switch runtime.GOOS {
-	case "darwin":
+	switch {
+	case activeFakeBackend() != nil:
+		showBackendDriveInfo(device)
+	case runtime.GOOS == "darwin":
 		showMacDriveInfo(device)
-	case "windows":
+	case runtime.GOOS == "windows":
 		showWindowsDriveInfo(device)
 	}
 
+	if warning := filesystemCompatibilityWarning(getDriveFilesystem(device)); warning != "" {
+		fmt.Println()
+		printWarning("%s", warning)
+	}
+
+	fmt.Println()
+	partTitle := "Partition Table:"
+	fmt.Println(partTitle)
+	fmt.Println(strings.Repeat("-", len(partTitle)))
+	if table, err := readPartitionTable(device); err != nil {
+		fmt.Printf("Unavailable: %v\n", err)
+	} else {
+		printPartitionTable(table)
+		printAlignmentReport(table)
+	}
+
+	fmt.Println()
+	printDriveWear(device)
+
 	fmt.Println()
 	perfTitle := "Performance Test:"
 	fmt.Println(perfTitle)
 	fmt.Println(strings.Repeat("-", len(perfTitle)))
 	fmt.Println("Running benchmark...")
 	result := benchmarkDrive(device)
-	fmt.Println(benchmarkSummary(result, defaultBenchmarkThresholds))
+	fmt.Println(benchmarkSummary(result, thresholds))
+}
+
+// showBackendDriveInfo prints what the device backend knows about a drive.
+func showBackendDriveInfo(device string) {
+	info := deviceBackend.Info(device)
+	fmt.Printf("Model: %s\n", getDriveModel(device))
+	fmt.Printf("Serial: %s\n", getDriveSerial(device))
+	fmt.Printf("Volume Name: %s\n", info.Label)
+	fmt.Printf("File System: %s\n", info.Filesystem)
+	fmt.Printf("Size: %.2f GB\n", info.SizeGB)
+	fmt.Printf("Free Space: %.2f GB\n", info.FreeGB)
+	if mountPoint, err := getDeviceMountPoint(device); err == nil {
+		fmt.Printf("Mount Point: %s\n", mountPoint)
+	}
 }
 
 func showMacDriveInfo(device string) {
-	cmd := exec.Command("diskutil", "info", device)
-	output, err := cmd.Output()
+	output, err := macDiskInfo(device)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting drive info: %v\n", err)
+		printError("Error getting drive info: %v", err)
 		return
 	}
 
@@ -76,51 +112,23 @@ func showMacDriveInfo(device string) {
 }
 
 func showWindowsDriveInfo(device string) {
-	driveLetter := strings.TrimSuffix(device, ":")
-	cmd := exec.Command("wmic", "logicaldisk", "where", fmt.Sprintf("name='%s:'", driveLetter),
-		"get", "description,filesystem,freespace,size,volumename,drivetype")
-	output, err := cmd.Output()
+	disk, err := windowsLogicalDisk(device)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting drive info: %v\n", err)
+		printError("Error getting drive info: %v", err)
 		return
 	}
 
-	lines := strings.Split(string(output), "\n")
-	if len(lines) >= 2 {
-		headers := strings.Fields(lines[0])
-		values := regexp.MustCompile(`\s+`).Split(strings.TrimSpace(lines[1]), -1)
-
-		for i, header := range headers {
-			if i < len(values) {
-				value := values[i]
-
-				if header == "Size" || header == "FreeSpace" {
-					if size, err := strconv.ParseFloat(value, 64); err == nil {
-						sizeGB := size / (1024 * 1024 * 1024)
-						value = fmt.Sprintf("%.2f GB", sizeGB)
-					}
-				}
-
-				if header == "DriveType" {
-					switch value {
-					case "2":
-						value = "Removable"
-					case "3":
-						value = "Fixed/Local"
-					case "4":
-						value = "Network"
-					case "5":
-						value = "CD-ROM"
-					}
-				}
-
-				fmt.Printf("%-20s: %s\n", header, value)
-			}
-		}
-	}
+	fmt.Printf("%-20s: %s\n", "Description", disk.Description)
+	fmt.Printf("%-20s: %s\n", "DriveType", driveTypeLabel(disk.DriveType))
+	fmt.Printf("%-20s: %s\n", "FileSystem", disk.FileSystem)
+	fmt.Printf("%-20s: %.2f GB\n", "FreeSpace", float64(disk.FreeSpace)/(1024*1024*1024))
+	fmt.Printf("%-20s: %.2f GB\n", "Size", float64(disk.Size)/(1024*1024*1024))
+	fmt.Printf("%-20s: %s\n", "VolumeName", disk.VolumeName)
+	fmt.Printf("%-20s: %s\n", "VolumeSerialNumber", disk.VolumeSerialNumber)
 
 	if isSystemDrive(device) {
-		fmt.Println("\n  WARNING: This appears to be a SYSTEM DRIVE")
+		fmt.Println()
+		printWarning("This appears to be a SYSTEM DRIVE")
 		fmt.Println("  Formatting this drive is NOT RECOMMENDED")
 	}
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typicalFlashCycles is the program/erase endurance assumed for wear
+// estimates. Cheap USB sticks use TLC or QLC flash rated for a few hundred
+// to a thousand cycles, before write amplification.
+const typicalFlashCycles = 500
+
+// DriveRecord is what cdjf remembers about one drive across runs.
+type DriveRecord struct {
+	Model     string    `json:"model,omitempty"`
+	SizeGB    float64   `json:"size_gb,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// BytesWritten counts everything cdjf has written to the drive: format
+	// metadata, benchmark and verify test data, and images.
+	BytesWritten int64 `json:"bytes_written"`
+	// Writes counts operations by name, such as format or verify.
+	Writes map[string]int `json:"writes,omitempty"`
+	// WriteMBps and ReadMBps are the speeds from the drive's last benchmark.
+	WriteMBps     float64   `json:"write_mbps,omitempty"`
+	ReadMBps      float64   `json:"read_mbps,omitempty"`
+	BenchmarkedAt time.Time `json:"benchmarked_at,omitzero"`
+	// Checks holds the latest result of each check, keyed by command name.
+	Checks map[string]DriveCheck `json:"checks,omitempty"`
+	// Seal is the manifest saved by cdjf seal.
+	Seal *DriveSeal `json:"seal,omitempty"`
+}
+
+// DriveCheck is the outcome of a check such as verify or preflight.
+type DriveCheck struct {
+	Time time.Time `json:"time"`
+	OK   bool      `json:"ok"`
+}
+
+// inventoryFile is inventory.json, keyed by drive serial number.
+type inventoryFile struct {
+	Drives map[string]DriveRecord `json:"drives"`
+}
+
+// inventoryMu serializes updates from drives formatted or benchmarked at once.
+var inventoryMu sync.Mutex
+
+func inventoryPath() (string, error) {
+	return configFilePath("inventory.json")
+}
+
+func loadInventory() (inventoryFile, error) {
+	inventory := inventoryFile{Drives: make(map[string]DriveRecord)}
+	path, err := inventoryPath()
+	if err != nil {
+		return inventory, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return inventory, nil
+	}
+	if err != nil {
+		return inventory, err
+	}
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return inventory, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if inventory.Drives == nil {
+		inventory.Drives = make(map[string]DriveRecord)
+	}
+	return inventory, nil
+}
+
+func saveInventory(inventory inventoryFile) error {
+	path, err := inventoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// updateDriveRecord applies update to the drive's inventory record. Drives
+// without a serial number cannot be told apart between runs and are not
+// tracked. Failures never stop the operation.
+func updateDriveRecord(device string, update func(record *DriveRecord)) {
+	serial := strings.TrimSpace(getDriveSerial(device))
+	if serial == "" {
+		return
+	}
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+
+	inventory, err := loadInventory()
+	if err != nil {
+		printWarning("[%s] Unable to update drive inventory: %v", device, err)
+		return
+	}
+	now := time.Now()
+	record, ok := inventory.Drives[serial]
+	if !ok {
+		record.FirstSeen = now
+	}
+	record.LastSeen = now
+	update(&record)
+	inventory.Drives[serial] = record
+
+	if err := saveInventory(inventory); err != nil {
+		printWarning("[%s] Unable to update drive inventory: %v", device, err)
+	}
+}
+
+// recordDriveWrites adds bytes written by an operation to the drive's
+// inventory record.
+func recordDriveWrites(device, operation string, bytes int64) {
+	if bytes < 0 {
+		return
+	}
+	updateDriveRecord(device, func(record *DriveRecord) {
+		if model := getDriveModel(device); model != "" {
+			record.Model = model
+		}
+		if size := getDriveSize(device); size > 0 {
+			record.SizeGB = size
+		}
+		record.BytesWritten += bytes
+		if record.Writes == nil {
+			record.Writes = make(map[string]int)
+		}
+		record.Writes[operation]++
+	})
+}
+
+// recordDriveSpeed keeps a drive's latest benchmark speeds in its inventory
+// record, so drives can be compared without benchmarking them again.
+func recordDriveSpeed(device string, result BenchmarkResult) {
+	if result.WriteMBps <= 0 {
+		return
+	}
+	updateDriveRecord(device, func(record *DriveRecord) {
+		record.WriteMBps = result.WriteMBps
+		record.ReadMBps = result.ReadMBps
+		record.BenchmarkedAt = time.Now()
+	})
+}
+
+// recordDriveCheck keeps the outcome of the latest check of one kind, such as
+// verify or preflight, for cdjf list.
+func recordDriveCheck(device, check string, ok bool) {
+	updateDriveRecord(device, func(record *DriveRecord) {
+		if record.Checks == nil {
+			record.Checks = make(map[string]DriveCheck)
+		}
+		record.Checks[check] = DriveCheck{Time: time.Now(), OK: ok}
+	})
+}
+
+// driveRecord returns the inventory record of a connected drive.
+func driveRecord(device string) (DriveRecord, bool) {
+	serial := strings.TrimSpace(getDriveSerial(device))
+	if serial == "" {
+		return DriveRecord{}, false
+	}
+	inventory, err := loadInventory()
+	if err != nil {
+		return DriveRecord{}, false
+	}
+	record, ok := inventory.Drives[serial]
+	return record, ok
+}
+
+// auditActionNames describe audit log operations for cdjf list.
+var auditActionNames = map[string]string{
+	"format":      "formatted",
+	"image-write": "imaged",
+	"receive":     "received",
+}
+
+// checkOutcomeNames describe each check's outcome for cdjf list, passed and
+// failed.
+var checkOutcomeNames = map[string][2]string{
+	"verify":      {"verified OK", "verify FAILED"},
+	"preflight":   {"preflight passed", "preflight FAILED"},
+	"verify-seal": {"seal intact", "seal BROKEN"},
+}
+
+// driveActivity sums up when a drive was last prepared and checked, such as
+// "formatted 3 days ago, verified OK 2 days ago". Preparations come from the
+// audit log, which lists them oldest first, and checks from the inventory. A
+// check from before the last preparation says nothing about the drive as it
+// is now and is left out.
+func driveActivity(serial string, record DriveRecord, audit []AuditEntry, now time.Time) string {
+	var parts []string
+	var prepared time.Time
+	for i := len(audit) - 1; i >= 0; i-- {
+		entry := audit[i]
+		if strings.TrimSpace(entry.Serial) != serial {
+			continue
+		}
+		name, ok := auditActionNames[entry.Operation]
+		if !ok {
+			name = entry.Operation
+		}
+		if entry.Outcome != auditOutcomeSuccess {
+			name = entry.Operation + " FAILED"
+		}
+		parts = append(parts, name+" "+timeAgo(now.Sub(entry.Time)))
+		prepared = entry.Time
+		break
+	}
+
+	var latest DriveCheck
+	latestName := ""
+	for check, result := range record.Checks {
+		if latestName != "" && !result.Time.After(latest.Time) {
+			continue
+		}
+		names, ok := checkOutcomeNames[check]
+		if !ok {
+			names = [2]string{check + " passed", check + " FAILED"}
+		}
+		latest, latestName = result, names[1]
+		if result.OK {
+			latestName = names[0]
+		}
+	}
+	switch {
+	case latestName != "" && latest.Time.After(prepared):
+		parts = append(parts, latestName+" "+timeAgo(now.Sub(latest.Time)))
+	case !prepared.IsZero():
+		parts = append(parts, "not checked since")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timeAgo describes how long ago something happened.
+func timeAgo(elapsed time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return plural(int(elapsed/time.Minute), "minute")
+	case elapsed < 24*time.Hour:
+		return plural(int(elapsed/time.Hour), "hour")
+	case elapsed < 48*time.Hour:
+		return "yesterday"
+	}
+	return plural(int(elapsed/(24*time.Hour)), "day")
+}
+
+// formatWriteEstimate approximates what a format writes. A full format writes
+// the whole drive; a quick format writes the reserved region and two copies
+// of a FAT with four bytes per 32 KB cluster. exFAT and UDF write less, so
+// this errs on the high side.
+func formatWriteEstimate(sizeGB float64, full bool) int64 {
+	if full {
+		return int64(sizeGB * 1024 * 1024 * 1024)
+	}
+	const reserved = 1024 * 1024
+	clusters := int64(sizeGB * 1024 * 1024 * 1024 / (32 * 1024))
+	return reserved + 2*4*clusters
+}
+
+// driveWear describes a record's writes as full-drive writes and the share of
+// a typical flash endurance they use up.
+func driveWear(record DriveRecord) (driveWrites, percent float64) {
+	if record.SizeGB <= 0 {
+		return 0, 0
+	}
+	driveWrites = float64(record.BytesWritten) / (record.SizeGB * 1024 * 1024 * 1024)
+	return driveWrites, driveWrites / typicalFlashCycles * 100
+}
+
+// printDriveWear shows what cdjf has written to a drive over time.
+func printDriveWear(device string) {
+	title := "Wear:"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+	record, ok := driveRecord(device)
+	if !ok {
+		if strings.TrimSpace(getDriveSerial(device)) == "" {
+			fmt.Println("Not tracked: the drive reports no serial number.")
+		} else {
+			fmt.Println("cdjf has not written to this drive yet.")
+		}
+		return
+	}
+
+	fmt.Printf("Written by cdjf: %.2f GB since %s\n", float64(record.BytesWritten)/(1024*1024*1024), record.FirstSeen.Local().Format("2006-01-02"))
+	if len(record.Writes) > 0 {
+		var parts []string
+		for _, operation := range []string{"format", "benchmark", "verify", "image-write", "receive", "zerofree", "defrag"} {
+			if count := record.Writes[operation]; count > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", count, operation))
+			}
+		}
+		fmt.Printf("Operations: %s\n", strings.Join(parts, ", "))
+	}
+	if driveWrites, percent := driveWear(record); driveWrites > 0 {
+		fmt.Printf("Estimated wear: %.2f full-drive writes, about %.1f%% of a typical %d-cycle flash endurance\n", driveWrites, percent, typicalFlashCycles)
+		if percent >= 50 {
+			printWarning("This drive has seen heavy use; slow benchmarks and verify errors are expected as flash wears out.")
+		}
+	}
+	fmt.Println("   Only cdjf's own writes are counted; rekordbox exports and copied music add more.")
+}
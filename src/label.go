@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	// fatLabelMaxLength is the longest label the FAT32 boot sector holds.
+	fatLabelMaxLength = 11
+	// exfatLabelMaxLength is the longest exFAT label, in UTF-16 code units.
+	exfatLabelMaxLength = 15
+	// udfLabelMaxLength is the longest UDF label newfs_udf and format accept.
+	udfLabelMaxLength = 30
+)
+
+// labelForbiddenChars cannot appear in FAT32 or exFAT volume labels.
+const labelForbiddenChars = `*?.,;:/\|+=<>[]"`
+
+// LabelRules describes what a filesystem can store as its volume label.
+type LabelRules struct {
+	// MaxLength is measured in bytes when ASCIIOnly is set and in UTF-16
+	// code units otherwise.
+	MaxLength int
+	// ASCIIOnly labels are stored in the computer's code page, so players
+	// show anything outside ASCII as garbage.
+	ASCIIOnly bool
+	// CasePreserving filesystems keep the label exactly as typed; the others
+	// store it in upper case.
+	CasePreserving bool
+	Forbidden      string
+}
+
+var labelRulesByFilesystem = map[string]LabelRules{
+	"FAT32": {MaxLength: fatLabelMaxLength, ASCIIOnly: true, Forbidden: labelForbiddenChars},
+	"exFAT": {MaxLength: exfatLabelMaxLength, CasePreserving: true, Forbidden: labelForbiddenChars},
+	"UDF":   {MaxLength: udfLabelMaxLength, CasePreserving: true},
+}
+
+// labelRules returns the label rules of filesystem, falling back to the
+// strictest set, FAT32's, for filesystems cdjf does not format.
+func labelRules(filesystem string) LabelRules {
+	if rules, ok := labelRulesByFilesystem[filesystem]; ok {
+		return rules
+	}
+	return labelRulesByFilesystem["FAT32"]
+}
+
+// labelLength measures a label the way filesystem stores it.
+func labelLength(label, filesystem string) int {
+	if labelRules(filesystem).ASCIIOnly {
+		return len(label)
+	}
+	return len(utf16.Encode([]rune(label)))
+}
+
+func labelMaxLength(filesystem string) int {
+	return labelRules(filesystem).MaxLength
+}
+
+// normalizeLabel checks that label can be stored on filesystem and returns it
+// as the drive will report it. Spaces inside a label are kept, and so is the
+// case of letters on filesystems that preserve it.
+func normalizeLabel(label, filesystem string) (string, error) {
+	rules := labelRules(filesystem)
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return "", fmt.Errorf("the volume label cannot be empty")
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("volume label %q contains a control character", label)
+		}
+		if strings.ContainsRune(rules.Forbidden, r) {
+			return "", fmt.Errorf("volume label %q contains %q; avoid %s", label, r, rules.Forbidden)
+		}
+		if rules.ASCIIOnly && r > unicode.MaxASCII {
+			return "", fmt.Errorf("%s labels can only use plain ASCII letters, so %q cannot be stored; use --fs exFAT for accented or non-Latin labels", filesystem, label)
+		}
+	}
+	if !rules.CasePreserving {
+		label = strings.ToUpper(label)
+	}
+	if length := labelLength(label, filesystem); length > rules.MaxLength {
+		return "", fmt.Errorf("volume label %q is %d characters; %s allows at most %d", label, length, filesystem, rules.MaxLength)
+	}
+	return label, nil
+}
+
+// sameLabel reports whether a label read back from the drive matches the one
+// requested, ignoring case only where filesystem does not store it.
+func sameLabel(actual, requested, filesystem string) bool {
+	if labelRules(filesystem).CasePreserving {
+		return actual == requested
+	}
+	return strings.EqualFold(actual, requested)
+}
+
+// labelWithSuffix appends a number to label, shortening label first so the
+// result still fits filesystem's limit.
+func labelWithSuffix(label string, number int, filesystem string) string {
+	suffix := strconv.Itoa(number)
+	runes := []rune(label)
+	for len(runes) > 0 && labelLength(string(runes)+suffix, filesystem) > labelMaxLength(filesystem) {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimRight(string(runes), " ") + suffix
+}
@@ -3,86 +3,486 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// listConcurrency bounds how many drives cdjf list queries at once.
+const listConcurrency = 4
+
+// listRow is one drive in cdjf list.
+type listRow struct {
+	DriveInfo
+	Model string
+	// FreeKnown is false when the drive's free space could not be read, as
+	// with an unmounted drive.
+	FreeKnown bool
+	// WriteMBps is the write speed from the drive's last benchmark, or 0 when
+	// it has never been benchmarked.
+	WriteMBps float64
+	// Activity sums up the last time cdjf prepared and checked the drive.
+	Activity string
+	Issues   []KnownDrive
+}
+
+// listHistory is what cdjf list knows about drives from earlier runs.
+type listHistory struct {
+	inventory inventoryFile
+	audit     []AuditEntry
+}
+
+func loadListHistory() listHistory {
+	var history listHistory
+	history.inventory, _ = loadInventory()
+	history.audit, _ = readAuditLog()
+	return history
+}
+
+// listOptions filter and order cdjf list.
+type listOptions struct {
+	All        bool
+	MinSizeGB  float64
+	Filesystem string
+	Sort       string
+	Compact    bool
+	Timeout    time.Duration
+}
+
+// matches reports whether a drive passes the filters.
+func (o listOptions) matches(row listRow) bool {
+	if !o.All && (row.IsSystem || row.Type != "Removable") {
+		return false
+	}
+	if o.MinSizeGB > 0 && row.SizeGB < o.MinSizeGB {
+		return false
+	}
+	if o.Filesystem != "" && !strings.Contains(strings.ToUpper(row.Filesystem), strings.ToUpper(o.Filesystem)) {
+		return false
+	}
+	return true
+}
+
+// filtered reports whether any option beyond the defaults was given.
+func (o listOptions) filtered() bool {
+	return o.All || o.MinSizeGB > 0 || o.Filesystem != "" || o.Sort != "" || o.Compact
+}
+
+func normalizeListSort(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "device":
+		return "device", nil
+	case "size":
+		return "size", nil
+	case "label":
+		return "label", nil
+	case "speed":
+		return "speed", nil
+	}
+	return "", fmt.Errorf("invalid --sort value %q; use device, size, label, or speed", value)
+}
+
+// sortListRows orders drives by device name or label, or largest or fastest
+// first. Drives that have never been benchmarked sort after the rest.
+func sortListRows(rows []listRow, by string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch by {
+		case "size":
+			if a.SizeGB != b.SizeGB {
+				return a.SizeGB > b.SizeGB
+			}
+		case "label":
+			if !strings.EqualFold(a.Label, b.Label) {
+				return strings.ToLower(a.Label) < strings.ToLower(b.Label)
+			}
+		case "speed":
+			if a.WriteMBps != b.WriteMBps {
+				return a.WriteMBps > b.WriteMBps
+			}
+		}
+		return a.Device < b.Device
+	})
+}
+
+// streamDriveRows queries drives on a bounded pool of goroutines and passes
+// each one to emit as soon as its query finishes, so one slow card reader does
+// not hold up the rest. query runs off the main goroutine and reports false to
+// leave a drive out; emit runs on the calling goroutine. A drive that takes
+// longer than timeout (0 for no limit) is reported and skipped, and its slot
+// goes to the next drive. It returns the number of drives emitted or skipped.
+func streamDriveRows(devices []string, timeout time.Duration, query func(device string) (listRow, bool), emit func(listRow)) int {
+	type result struct {
+		device   string
+		row      listRow
+		ok       bool
+		timedOut bool
+	}
+	results := make(chan result)
+	slots := make(chan struct{}, listConcurrency)
+	for _, device := range devices {
+		go func() {
+			slots <- struct{}{}
+			done := make(chan result, 1)
+			go func() {
+				row, ok := query(device)
+				done <- result{device: device, row: row, ok: ok}
+			}()
+			var expired <-chan time.Time
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				expired = timer.C
+			}
+			select {
+			case r := <-done:
+				<-slots
+				results <- r
+			case <-expired:
+				<-slots
+				results <- result{device: device, timedOut: true}
+			}
+		}()
+	}
+
+	shown := 0
+	for range devices {
+		r := <-results
+		switch {
+		case r.timedOut:
+			printWarning("%s did not answer within %s; skipped", r.device, timeout)
+			shown++
+		case r.ok:
+			emit(r.row)
+			shown++
+		}
+	}
+	return shown
+}
+
+// listTable prints drives as they are found, or all at once when sorted.
+type listTable struct {
+	opts   listOptions
+	speeds bool
+	rows   []listRow
+	// marked is set once a compact row has been marked with "!".
+	marked bool
+}
+
+func (t *listTable) header() {
+	switch {
+	case t.opts.Compact:
+		fmt.Printf("%-10s %8s  %-6s %-12s %s\n", "DEVICE", "SIZE", "FS", "LABEL", "LAST ACTION")
+	case t.speeds:
+		fmt.Printf("%-10s %-10s %-14s %9s %9s %10s   %-12s %s\n", "DEVICE", "TYPE", "FS", "SIZE", "FREE", "WRITE", "LABEL", "MODEL")
+	default:
+		fmt.Printf("%-10s %-10s %-14s %9s %9s   %-12s %s\n", "DEVICE", "TYPE", "FS", "SIZE", "FREE", "LABEL", "MODEL")
+	}
+}
+
+func (t *listTable) add(row listRow) {
+	if t.opts.Sort != "" {
+		t.rows = append(t.rows, row)
+		return
+	}
+	t.print(row)
+}
+
+// flush prints the rows held back for sorting.
+func (t *listTable) flush() {
+	sortListRows(t.rows, t.opts.Sort)
+	for _, row := range t.rows {
+		t.print(row)
+	}
+	t.rows = nil
+}
+
+func (t *listTable) print(row listRow) {
+	if t.opts.Compact {
+		// Compact rows mark trouble instead of explaining it on extra lines.
+		marker := ""
+		if row.IsSystem || len(row.Issues) > 0 {
+			marker = "!"
+			t.marked = true
+		}
+		fmt.Printf("%-10s %6.1fGB  %-6s %-12s %s\n", row.Device+marker, row.SizeGB, shortFilesystem(row.Filesystem), row.Label, row.Activity)
+		return
+	}
+
+	free := "-"
+	if row.FreeKnown {
+		free = fmt.Sprintf("%.1fGB", row.FreeGB)
+	}
+	model := row.Model
+	if row.IsSystem {
+		model += " [SYSTEM]"
+	}
+	if t.speeds {
+		speed := "-"
+		if row.WriteMBps > 0 {
+			speed = fmt.Sprintf("%.1fMB/s", row.WriteMBps)
+		}
+		fmt.Printf("%-10s %-10s %-14s %7.1fGB %9s %10s   %-12s %s\n", row.Device, row.Type, row.Filesystem, row.SizeGB, free, speed, row.Label, model)
+	} else {
+		fmt.Printf("%-10s %-10s %-14s %7.1fGB %9s   %-12s %s\n", row.Device, row.Type, row.Filesystem, row.SizeGB, free, row.Label, model)
+	}
+	if row.MountPoint != "" {
+		fmt.Printf("%-10s mounted at %s\n", "", row.MountPoint)
+	}
+	if row.Activity != "" {
+		fmt.Printf("%-10s %s\n", "", row.Activity)
+	}
+	if row.SizeGB > 1024 && row.Type == "Removable" {
+		fmt.Println("  " + colorize(SeverityWarn, "  WARNING: Drive over 1TB - may not perform well on Pioneer hardware"))
+	}
+	printKnownDriveIssues(row.Device, row.Issues)
+}
+
+// shortFilesystem shortens names such as "MS-DOS FAT32" for the compact table.
+func shortFilesystem(filesystem string) string {
+	upper := strings.ToUpper(filesystem)
+	switch {
+	case strings.Contains(upper, "FAT32"):
+		return "FAT32"
+	case strings.Contains(upper, "FAT16"):
+		return "FAT16"
+	case strings.Contains(upper, "EXFAT"):
+		return "exFAT"
+	case filesystem == "":
+		return "-"
+	}
+	return strings.Fields(filesystem)[0]
+}
+
+// finishListRow fills in what every platform looks up the same way.
+func finishListRow(row listRow, history listHistory) listRow {
+	row.Issues = knownDriveIssues(row.Device, row.Model)
+	if serial := strings.TrimSpace(getDriveSerial(row.Device)); serial != "" {
+		record := history.inventory.Drives[serial]
+		row.WriteMBps = record.WriteMBps
+		row.Activity = driveActivity(serial, record, history.audit, time.Now())
+	}
+	return row
+}
+
 func listDrives(cmd *cobra.Command, args []string) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	all, _ := cmd.Flags().GetBool("all")
+	removableOnly, _ := cmd.Flags().GetBool("removable-only")
+	minSizeValue, _ := cmd.Flags().GetString("min-size")
+	fsValue, _ := cmd.Flags().GetString("fs")
+	sortValue, _ := cmd.Flags().GetString("sort")
+	compact, _ := cmd.Flags().GetBool("compact")
+
+	opts := listOptions{All: all || !removableOnly, Compact: compact, Timeout: timeout}
+	if strings.TrimSpace(minSizeValue) != "" {
+		opts.MinSizeGB = parseSizeToGB(strings.ToUpper(strings.TrimSpace(minSizeValue)))
+		if opts.MinSizeGB <= 0 {
+			printError("Error: invalid --min-size value %q; use a value such as 16GB", minSizeValue)
+			os.Exit(1)
+		}
+	}
+	if strings.TrimSpace(fsValue) != "" {
+		// Known names are spelled as the formatter spells them; anything else,
+		// such as NTFS or RAW, is matched as given.
+		opts.Filesystem = strings.TrimSpace(fsValue)
+		if normalized, err := normalizeFilesystem(fsValue); err == nil {
+			opts.Filesystem = normalized
+		}
+	}
+	var err error
+	if opts.Sort, err = normalizeListSort(sortValue); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("Available drives:")
 	fmt.Println()
 
+	if fake := activeFakeBackend(); fake != nil {
+		fmt.Printf("Using fake devices from %s\n\n", fake.path)
+		listBackendDrives(fake, opts)
+		return
+	}
+
 	switch runtime.GOOS {
 	case "darwin":
-		listMacDrives()
+		listMacDrives(opts)
 	case "windows":
-		listWindowsDrives()
+		listWindowsDrives(opts)
 	default:
-		fmt.Fprintf(os.Stderr, "Unsupported operating system: %s\n", runtime.GOOS)
+		printError("Unsupported operating system: %s", runtime.GOOS)
 		os.Exit(1)
 	}
 }
 
-func listMacDrives() {
-	listCmd := exec.Command("diskutil", "list")
-	basicOutput, _ := listCmd.Output()
-
-	fmt.Println(string(basicOutput))
-
-	fmt.Println()
-	detailTitle := "Detailed drive information:"
-	fmt.Println(detailTitle)
-	fmt.Println(strings.Repeat("-", len(detailTitle)))
+// printListRows queries and prints drives, and reports when none matched.
+func printListRows(devices []string, opts listOptions, query func(device string) (listRow, bool)) {
+	table := &listTable{opts: opts, speeds: opts.Sort == "speed"}
+	table.header()
+	history := loadListHistory()
+	shown := streamDriveRows(devices, opts.Timeout, func(device string) (listRow, bool) {
+		row, ok := query(device)
+		if !ok || !opts.matches(row) {
+			return listRow{}, false
+		}
+		return finishListRow(row, history), true
+	}, table.add)
+	table.flush()
+
+	switch {
+	case shown == 0 && opts.filtered():
+		fmt.Println("No drives match the filters...")
+	case shown == 0:
+		fmt.Println("No removable drives found...")
+	}
+	if table.marked {
+		fmt.Println("! system drive or known issue; see 'cdjf info <device>'")
+	}
+}
 
-	infoCmd := exec.Command("diskutil", "list", "external", "physical")
-	externalOutput, err := infoCmd.Output()
-	if err == nil {
-		lines := strings.Split(string(externalOutput), "\n")
-		for _, line := range lines {
+func listMacDrives(opts listOptions) {
+	args := []string{"list", "external", "physical"}
+	if opts.All {
+		args = []string{"list", "physical"}
+	}
+	var diskIDs []string
+	if output, err := execCommand("diskutil", args...).Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
 			if strings.Contains(line, "/dev/disk") {
-				diskID := extractDiskID(line)
-				if diskID != "" {
-					showMacDriveDetails(diskID)
+				if diskID := extractDiskID(line); diskID != "" {
+					diskIDs = append(diskIDs, diskID)
 				}
 			}
 		}
 	}
 
-	fmt.Println("\nTo format a drive, use: cdjf format diskX")
-}
+	if !opts.filtered() {
+		printMacDiskTrees(diskIDs)
 
-func extractDiskID(line string) string {
-	matches := diskIDRegex.FindStringSubmatch(line)
-	if len(matches) > 1 {
-		return matches[1]
+		fmt.Println()
+		detailTitle := "Detailed drive information:"
+		fmt.Println(detailTitle)
+		fmt.Println(strings.Repeat("-", len(detailTitle)))
 	}
-	return ""
+	printListRows(diskIDs, opts, macDriveRow)
+
+	fmt.Println("\nTo format a drive, use: cdjf format diskX")
 }
 
-func showMacDriveDetails(diskID string) {
-	cmd := exec.Command("diskutil", "info", diskID)
-	output, err := cmd.Output()
+// macDriveRow queries one disk for cdjf list.
+func macDriveRow(diskID string) (listRow, bool) {
+	output, err := macDiskInfo(diskID)
 	if err != nil {
-		return
+		return listRow{}, false
 	}
-
 	info := parseMacDiskInfo(output)
 	if info.Type == "" {
-		return
+		return listRow{}, false
 	}
 
-	systemWarning := ""
+	// parseMacDiskInfo reports the media name as the type.
+	row := listRow{DriveInfo: info, Model: info.Type}
+	row.Device = diskID
+	row.Type = "Removable"
 	if info.IsSystem {
-		systemWarning = " [SYSTEM]"
+		row.Type = "Internal"
+	}
+	// A whole disk has no free space or mount point of its own; those come
+	// from its first volume, as with the other drive queries.
+	volume := info
+	if volumeID := macVolumeIdentifier(diskID); volumeID != diskID {
+		if output, err := macDiskInfo(volumeID); err == nil {
+			volume = parseMacDiskInfo(output)
+		}
+	}
+	if row.Label == "" {
+		row.Label = volume.Label
+	}
+	if row.Filesystem == "" {
+		row.Filesystem = volume.Filesystem
 	}
+	row.FreeGB = volume.FreeGB
+	row.MountPoint = volume.MountPoint
+	row.FreeKnown = volume.MountPoint != "" || volume.FreeGB > 0
+	return row, true
+}
+
+// listBackendDrives prints the drives reported by the device backend, for
+// backends without a native listing such as the fake one.
+func listBackendDrives(fake *fakeBackend, opts listOptions) {
+	devices := deviceBackend.Enumerate()
+	if opts.All {
+		devices = fake.allDevices()
+	}
+	printListRows(devices, opts, func(device string) (listRow, bool) {
+		return listRow{DriveInfo: deviceBackend.Info(device), Model: getDriveModel(device), FreeKnown: true}, true
+	})
 
-	fmt.Printf("%-20s %-10s %-10s %8.1f GB%s\n",
-		info.Type, diskID, info.Filesystem, info.SizeGB, systemWarning)
+	fmt.Println()
+	fmt.Println("To format a drive, use: cdjf format <device>")
 }
 
+func listWindowsDrives(opts listOptions) {
+	disks, err := queryLogicalDisks("")
+	if err != nil {
+		printError("Error listing drives: %v", err)
+		return
+	}
+
+	byID := make(map[string]LogicalDisk)
+	var deviceIDs []string
+	for _, disk := range disks {
+		if disk.DriveType != "2" && !opts.All {
+			continue
+		}
+		byID[disk.DeviceID] = disk
+		deviceIDs = append(deviceIDs, disk.DeviceID)
+	}
+
+	printListRows(deviceIDs, opts, func(deviceID string) (listRow, bool) {
+		disk := byID[deviceID]
+		row := listRow{
+			DriveInfo: DriveInfo{
+				Device:     deviceID,
+				Label:      disk.VolumeName,
+				Filesystem: disk.FileSystem,
+				SizeGB:     float64(disk.Size) / (1024 * 1024 * 1024),
+				FreeGB:     float64(disk.FreeSpace) / (1024 * 1024 * 1024),
+				Type:       driveTypeLabel(disk.DriveType),
+			},
+			FreeKnown: true,
+		}
+		if row.Filesystem == "" || strings.EqualFold(row.Filesystem, "RAW") {
+			// RAW volumes report no size, but can still be formatted.
+			row.Filesystem = "RAW"
+			row.SizeGB = getDriveSize(deviceID)
+			row.FreeKnown = false
+		}
+		if row.SizeGB <= 0 {
+			return listRow{}, false
+		}
+		row.Model = getDriveModel(deviceID)
+		return row, true
+	})
+
+	fmt.Println()
+	fmt.Println("To format a drive, use: cdjf format X:")
+	fmt.Println("For multiple drives: cdjf format F: G: H:")
+}
+
+func extractDiskID(line string) string {
+	matches := diskIDRegex.FindStringSubmatch(line)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
 func parseMacDiskInfo(output []byte) DriveInfo {
 	info := DriveInfo{}
 	lines := strings.Split(string(output), "\n")
@@ -110,6 +510,21 @@ func parseMacDiskInfo(output []byte) DriveInfo {
 			if len(parts) == 2 {
 				info.Label = strings.TrimSpace(parts[1])
 			}
+		} else if strings.Contains(line, "Volume Free Space:") || strings.Contains(line, "Container Free Space:") {
+			// APFS volumes share their container's free space.
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 {
+				info.FreeGB = parseSizeToGB(strings.TrimSpace(parts[1]))
+			}
+		} else if strings.Contains(line, "Mount Point:") {
+			parts := strings.SplitN(line, ":", 2)
+			mountPoint := ""
+			if len(parts) == 2 {
+				mountPoint = strings.TrimSpace(parts[1])
+			}
+			if !strings.EqualFold(mountPoint, "Not mounted") && !strings.EqualFold(mountPoint, "Not applicable") {
+				info.MountPoint = mountPoint
+			}
 		} else if strings.Contains(line, "Internal:") && strings.Contains(line, "Yes") {
 			info.IsSystem = true
 		}
@@ -118,80 +533,167 @@ func parseMacDiskInfo(output []byte) DriveInfo {
 	return info
 }
 
-func listWindowsDrives() {
-	cmd := exec.Command("wmic", "logicaldisk", "get", "DeviceID,DriveType,FileSystem,FreeSpace,Size,VolumeName", "/format:csv")
-	output, err := cmd.Output()
+// parseDiskutilVolumeNames reads 'diskutil list -plist' and maps each disk,
+// partition, and APFS volume identifier to its volume name.
+func parseDiskutilVolumeNames(output []byte) map[string]string {
+	names := make(map[string]string)
+	root, err := parsePlist(output)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing drives: %v\n", err)
-		return
+		return names
+	}
+	top, _ := root.(map[string]any)
+	disks, _ := top["AllDisksAndPartitions"].([]any)
+	for _, disk := range disks {
+		fields, _ := disk.(map[string]any)
+		partitions, _ := fields["Partitions"].([]any)
+		volumes, _ := fields["APFSVolumes"].([]any)
+		entries := append(append([]any{disk}, partitions...), volumes...)
+		for _, entry := range entries {
+			entryFields, _ := entry.(map[string]any)
+			identifier, _ := entryFields["DeviceIdentifier"].(string)
+			name, _ := entryFields["VolumeName"].(string)
+			if identifier != "" && strings.TrimSpace(name) != "" {
+				names[identifier] = name
+			}
+		}
 	}
+	return names
+}
 
-	lines := strings.Split(string(output), "\n")
+// DiskNode is a disk, partition, APFS container, or volume in the macOS disk
+// tree cdjf list prints.
+type DiskNode struct {
+	Device string
+	Size   int64
+	// Content is the partition scheme or type diskutil reports, such as
+	// FDisk_partition_scheme or DOS_FAT_32.
+	Content    string
+	Label      string
+	MountPoint string
+	Children   []*DiskNode
+}
 
-	foundRemovable := false
+// parseDiskTree reads 'diskutil list -plist' into one tree per physical disk.
+// diskutil lists each APFS container as a disk of its own; it is moved under
+// the partition that stores it, so a volume can be traced to its drive.
+func parseDiskTree(output []byte) []*DiskNode {
+	root, err := parsePlist(output)
+	if err != nil {
+		return nil
+	}
+	top, _ := root.(map[string]any)
+	disks, _ := top["AllDisksAndPartitions"].([]any)
+
+	nodes := make(map[string]*DiskNode)
+	newNode := func(fields map[string]any) *DiskNode {
+		node := &DiskNode{}
+		node.Device, _ = fields["DeviceIdentifier"].(string)
+		node.Size, _ = fields["Size"].(int64)
+		node.Content, _ = fields["Content"].(string)
+		node.Label, _ = fields["VolumeName"].(string)
+		node.MountPoint, _ = fields["MountPoint"].(string)
+		nodes[node.Device] = node
+		return node
+	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "Node,") {
+	var wholeDisks []*DiskNode
+	stores := make(map[string][]string)
+	for _, disk := range disks {
+		fields, ok := disk.(map[string]any)
+		if !ok {
 			continue
 		}
-
-		parts := strings.Split(line, ",")
-		if len(parts) < 6 {
-			continue
+		node := newNode(fields)
+		for _, key := range []string{"Partitions", "APFSVolumes"} {
+			children, _ := fields[key].([]any)
+			for _, child := range children {
+				if childFields, ok := child.(map[string]any); ok {
+					childNode := newNode(childFields)
+					if key == "APFSVolumes" && childNode.Content == "" {
+						childNode.Content = "APFS volume"
+					}
+					node.Children = append(node.Children, childNode)
+				}
+			}
 		}
-
-		deviceID := strings.TrimSpace(parts[1])
-		driveType := strings.TrimSpace(parts[2])
-		filesystem := strings.TrimSpace(parts[3])
-		freeStr := strings.TrimSpace(parts[4])
-		sizeStr := strings.TrimSpace(parts[5])
-		label := ""
-		if len(parts) > 6 {
-			label = strings.TrimSpace(parts[6])
+		physicalStores, _ := fields["APFSPhysicalStores"].([]any)
+		for _, store := range physicalStores {
+			if storeFields, ok := store.(map[string]any); ok {
+				if id, _ := storeFields["DeviceIdentifier"].(string); id != "" {
+					stores[node.Device] = append(stores[node.Device], id)
+				}
+			}
 		}
+		wholeDisks = append(wholeDisks, node)
+	}
 
-		if driveType != "2" {
-			continue
+	var trees []*DiskNode
+	for _, disk := range wholeDisks {
+		attached := false
+		for _, id := range stores[disk.Device] {
+			if store, ok := nodes[id]; ok {
+				store.Children = append(store.Children, disk)
+				attached = true
+			}
 		}
-
-		sizeGB := bytesToGB(sizeStr)
-		freeGB := bytesToGB(freeStr)
-
-		if sizeGB <= 0 {
-			continue
+		if len(stores[disk.Device]) > 0 && disk.Content == "" {
+			disk.Content = "APFS container"
 		}
-
-		typeLabel := driveTypeLabel(driveType)
-
-		fmt.Printf("%-12s %-6s %-10s %9.1fGB %9.1fGB   %-20s\n",
-			typeLabel, deviceID, filesystem, sizeGB, freeGB, label)
-		foundRemovable = true
-
-		if sizeGB > 1024 && driveType == "2" {
-			fmt.Println("    WARNING: Drive over 1TB - may not perform well on Pioneer hardware")
+		if !attached {
+			trees = append(trees, disk)
 		}
 	}
+	return trees
+}
 
-	if !foundRemovable {
-		fmt.Println("No removable drives found...")
+// printMacDiskTrees prints the given physical disks with their partitions and
+// volumes indented below them. When diskutil's property list cannot be read,
+// its plain listing is printed instead.
+func printMacDiskTrees(diskIDs []string) {
+	output, err := execCommand("diskutil", "list", "-plist").Output()
+	var trees []*DiskNode
+	if err == nil {
+		trees = parseDiskTree(output)
+	}
+	if len(trees) == 0 {
+		basicOutput, _ := execCommand("diskutil", "list").Output()
+		fmt.Println(string(basicOutput))
+		return
 	}
 
-	fmt.Println()
-	fmt.Println("To format a drive, use: cdjf format X:")
-	fmt.Println("For multiple drives: cdjf format F: G: H:")
+	title := "Disks and volumes:"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+	fmt.Printf("%-16s %10s  %-24s %-12s %s\n", "DISK", "SIZE", "TYPE", "NAME", "MOUNT POINT")
+	shown := 0
+	for _, tree := range trees {
+		for _, id := range diskIDs {
+			if tree.Device == id {
+				printDiskNode(tree, 0)
+				shown++
+				break
+			}
+		}
+	}
+	if shown == 0 {
+		fmt.Println("No drives found.")
+	}
 }
 
-func bytesToGB(value string) float64 {
-	value = strings.TrimSpace(value)
-	if value == "" {
-		return 0
+func printDiskNode(node *DiskNode, depth int) {
+	name := node.Device
+	if depth > 0 {
+		name = strings.Repeat("   ", depth-1) + "└─ " + name
 	}
-	bytes, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		return 0
+	mountPoint := node.MountPoint
+	if mountPoint == "" && depth > 0 && len(node.Children) == 0 {
+		mountPoint = "not mounted"
+	}
+	line := fmt.Sprintf("%-16s %10s  %-24s %-12s %s", name, formatByteSize(node.Size), node.Content, node.Label, mountPoint)
+	fmt.Println(strings.TrimRight(line, " "))
+	for _, child := range node.Children {
+		printDiskNode(child, depth+1)
 	}
-	return bytes / (1024 * 1024 * 1024)
 }
 
 func driveTypeLabel(code string) string {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+func macVolumeIdentifier(device string) string {
+	if wholeDiskRegex.MatchString(device) {
+		return device + "s1"
+	}
+	return device
+}
+
+func setDriveReadOnly(device string, readOnly bool) error {
+	defer forgetDriveInfo()
+	if fake := activeFakeBackend(); fake != nil {
+		return fake.setLocked(device, readOnly)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		volume := macVolumeIdentifier(device)
+		unmountCmd := execCommand("diskutil", "unmount", volume)
+		if output, err := unmountCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to unmount %s: %v\nOutput: %s", volume, err, output)
+		}
+
+		args := []string{"mount"}
+		if readOnly {
+			args = append(args, "readOnly")
+		}
+		args = append(args, volume)
+		mountCmd := execCommand("diskutil", args...)
+		if output, err := mountCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remount %s: %v\nOutput: %s", volume, err, output)
+		}
+		return nil
+
+	case "windows":
+		driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+		diskNumber, err := windowsDiskNumber(driveLetter)
+		if err != nil {
+			return err
+		}
+
+		value := "$false"
+		if readOnly {
+			value = "$true"
+		}
+		psCmd := fmt.Sprintf("Set-Disk -Number %d -IsReadOnly %s", diskNumber, value)
+		cmd := execCommand("powershell", "-NoProfile", "-Command", psCmd)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Set-Disk failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// lockForInspection makes a drive read-only while an inspection command runs,
+// so the inspection cannot change the stick by accident, and returns a function
+// that makes it writable again. Drives that are already read-only are left as
+// they are. When the lock cannot be set, the inspection goes ahead with a
+// warning. Ctrl+C also restores the drive before exiting.
+func lockForInspection(device string) func() {
+	if checkWriteProtection(device, true) != nil {
+		return func() {}
+	}
+	if err := setDriveReadOnly(device, true); err != nil {
+		printWarning("Unable to make %s read-only for inspection: %v", device, err)
+		return func() {}
+	}
+	fmt.Printf("%s is read-only until the inspection finishes.\n", device)
+
+	var once sync.Once
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	unlock := func() {
+		once.Do(func() {
+			signal.Stop(interrupted)
+			if err := setDriveReadOnly(device, false); err != nil {
+				printError("Error: unable to make %s writable again: %v\nRun 'cdjf unlock %s' to retry.", device, err, device)
+			}
+		})
+	}
+	go func() {
+		<-interrupted
+		fmt.Println()
+		unlock()
+		os.Exit(130)
+	}()
+	return unlock
+}
+
+func lockDrive(cmd *cobra.Command, args []string) {
+	changeDriveLock(args[0], true)
+}
+
+func unlockDrive(cmd *cobra.Command, args []string) {
+	changeDriveLock(args[0], false)
+}
+
+func changeDriveLock(device string, readOnly bool) {
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	action := "Unlocking"
+	if readOnly {
+		action = "Locking"
+	}
+	fmt.Printf("%s %s...\n", action, device)
+
+	if err := setDriveReadOnly(device, readOnly); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if !readOnly {
+		fmt.Println("Drive is writable again.")
+		return
+	}
+
+	fmt.Println("Drive is now read-only.")
+	fmt.Println()
+	fmt.Println("Note: this is a software lock and only lasts on this computer.")
+	if runtime.GOOS == "darwin" {
+		fmt.Println("  The volume returns to read/write the next time it is mounted.")
+	} else {
+		fmt.Println("  Windows keeps the read-only attribute until 'cdjf unlock' is run.")
+	}
+	fmt.Println("For protection that travels with the stick, use a drive with a hardware")
+	fmt.Println("write-protect switch (common on SD card adapters and some USB sticks).")
+}
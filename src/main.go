@@ -1,13 +1,26 @@
 package main
 
-import (
-	"fmt"
-	"os"
-)
+import "os"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == transcriptShimArg {
+		os.Exit(runTranscriptShim(os.Args[2:]))
+	}
+
+	if err := initDeviceBackend(); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	args, err := expandAlias(os.Args[1:])
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	rootCmd.SetArgs(args)
+
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 }
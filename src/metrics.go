@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	jobDurationBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600}
+	writeSpeedBuckets  = []float64{1, 2, 5, 10, 20, 40, 80, 160}
+)
+
+// histogram is a cumulative Prometheus-style histogram.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	separator := ""
+	if labels != "" {
+		separator = ","
+	}
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, separator, strconv.FormatFloat(bound, 'f', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, separator, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// serverMetrics aggregates the outcome of jobs run by serve and daemon.
+type serverMetrics struct {
+	mu          sync.Mutex
+	jobs        map[string]uint64
+	drives      map[string]uint64
+	durations   map[string]*histogram
+	writeSpeeds map[string]*histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		jobs:        make(map[string]uint64),
+		drives:      make(map[string]uint64),
+		durations:   make(map[string]*histogram),
+		writeSpeeds: make(map[string]*histogram),
+	}
+}
+
+// recordJob counts a finished job, the result for each of its drives, and
+// any write speeds it reported, keyed by the drive's model.
+func (m *serverMetrics) recordJob(job Job, models map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobs[metricLabels("command", job.Command, "result", job.State)]++
+	if job.Finished != nil {
+		duration, ok := m.durations[job.Command]
+		if !ok {
+			duration = newHistogram(jobDurationBuckets)
+			m.durations[job.Command] = duration
+		}
+		duration.observe(job.Finished.Sub(job.Started).Seconds())
+	}
+
+	for _, device := range job.Devices {
+		result := jobSucceeded
+		if jobDeviceFailed(job, device) {
+			result = jobFailed
+		}
+		m.drives[metricLabels("operation", job.Command, "result", result)]++
+	}
+
+	for _, line := range job.Output {
+		matches := writeSpeedLineRegex.FindStringSubmatch(line)
+		if len(matches) != 3 {
+			continue
+		}
+		device := matches[1]
+		if device == "" && len(job.Devices) == 1 {
+			device = job.Devices[0]
+		}
+		speed, err := strconv.ParseFloat(matches[2], 64)
+		if err != nil || speed <= 0 {
+			continue
+		}
+		model := models[device]
+		if model == "" {
+			model = "unknown"
+		}
+		histogram, ok := m.writeSpeeds[model]
+		if !ok {
+			histogram = newHistogram(writeSpeedBuckets)
+			m.writeSpeeds[model] = histogram
+		}
+		histogram.observe(speed)
+	}
+}
+
+// jobDeviceFailed reports whether a drive failed within a job. Multi-drive
+// runs report each drive on lines prefixed with [device].
+func jobDeviceFailed(job Job, device string) bool {
+	if job.State == jobFailed && len(job.Devices) == 1 {
+		return true
+	}
+	prefix := "[" + device + "]"
+	for _, line := range job.Output {
+		if strings.HasPrefix(line, prefix) && (strings.Contains(line, "FAILED") || strings.Contains(line, "Error")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *serverMetrics) write(w io.Writer, running int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP cdjf_jobs_running Jobs currently running.")
+	fmt.Fprintln(w, "# TYPE cdjf_jobs_running gauge")
+	fmt.Fprintf(w, "cdjf_jobs_running %d\n", running)
+
+	fmt.Fprintln(w, "# HELP cdjf_jobs_total Finished jobs by command and result.")
+	fmt.Fprintln(w, "# TYPE cdjf_jobs_total counter")
+	writeCounters(w, "cdjf_jobs_total", m.jobs)
+
+	fmt.Fprintln(w, "# HELP cdjf_drives_total Drives formatted or verified, by result.")
+	fmt.Fprintln(w, "# TYPE cdjf_drives_total counter")
+	writeCounters(w, "cdjf_drives_total", m.drives)
+
+	fmt.Fprintln(w, "# HELP cdjf_job_duration_seconds Time taken by finished jobs.")
+	fmt.Fprintln(w, "# TYPE cdjf_job_duration_seconds histogram")
+	for _, command := range sortedKeys(m.durations) {
+		m.durations[command].write(w, "cdjf_job_duration_seconds", metricLabels("command", command))
+	}
+
+	fmt.Fprintln(w, "# HELP cdjf_write_speed_mbps Measured write speed by device model.")
+	fmt.Fprintln(w, "# TYPE cdjf_write_speed_mbps histogram")
+	for _, model := range sortedKeys(m.writeSpeeds) {
+		m.writeSpeeds[model].write(w, "cdjf_write_speed_mbps", metricLabels("model", model))
+	}
+}
+
+func writeCounters(w io.Writer, name string, counters map[string]uint64) {
+	for _, labels := range sortedKeys(counters) {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels, counters[labels])
+	}
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricLabels formats name/value pairs as a Prometheus label set.
+func metricLabels(pairs ...string) string {
+	var labels []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(pairs[i+1])
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], value))
+	}
+	return strings.Join(labels, ",")
+}
+
+// handleMetrics serves the metrics in the Prometheus text format.
+func (s *apiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	running := 0
+	for _, job := range s.listJobs() {
+		if job.State == jobRunning {
+			running++
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w, running)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Format versions of the files cdjf writes. Bump one when a change would
+// make older files load incorrectly, and register a migration from the
+// previous version. Files without a "version" field are version 1.
+const (
+	configSchemaVersion  = 1
+	profileSchemaVersion = 1
+)
+
+// schemaMigration upgrades a decoded file by one format version, editing the
+// document in place.
+type schemaMigration func(doc map[string]any) error
+
+// configMigrations and profileMigrations are keyed by the version they
+// upgrade from, e.g. the entry for 1 turns a version 1 file into version 2.
+var (
+	configMigrations  = map[int]schemaMigration{}
+	profileMigrations = map[int]schemaMigration{}
+)
+
+// schemaVersion reads the "version" field of a decoded file.
+func schemaVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+	number, ok := raw.(float64)
+	if !ok || number < 1 || number != math.Trunc(number) {
+		return 0, fmt.Errorf("\"version\" must be a whole number, not %v", raw)
+	}
+	return int(number), nil
+}
+
+// migrateConfigData upgrades the contents of an older config or profiles file
+// to the current format. The original is kept next to it as <file>.v<N>.bak
+// before the upgraded file is written. Files that cannot be written, such as
+// a read-only shared profiles file, are upgraded in memory only.
+func migrateConfigData(path string, data []byte, current int, migrations map[int]schemaMigration) ([]byte, error) {
+	var doc map[string]any
+	if json.Unmarshal(data, &doc) != nil || doc == nil {
+		// Leave syntax errors to decodeConfigJSON, which reports them by line.
+		return data, nil
+	}
+
+	version, err := schemaVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	if version > current {
+		return nil, fmt.Errorf("%s was written by a newer cdjf (format version %d, this version understands %d); upgrade cdjf", path, version, current)
+	}
+	if version == current {
+		return data, nil
+	}
+
+	for from := version; from < current; from++ {
+		migrate, ok := migrations[from]
+		if !ok {
+			return nil, fmt.Errorf("unable to upgrade %s: no migration from format version %d", path, from)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, fmt.Errorf("unable to upgrade %s from format version %d: %w", path, from, err)
+		}
+	}
+	doc["version"] = current
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	migrated = append(migrated, '\n')
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, 0o600); err != nil {
+		printWarning("Unable to back up %s (%v); using the upgraded settings without saving them.", path, err)
+		return migrated, nil
+	}
+	if err := os.WriteFile(path, migrated, 0o600); err != nil {
+		printWarning("Unable to save the upgraded %s (%v); using the upgraded settings without saving them.", path, err)
+		return migrated, nil
+	}
+	printWarning("Upgraded %s to format version %d. The previous file was saved as %s.", path, current, backup)
+	return migrated, nil
+}
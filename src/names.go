@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultMaxNameLength is the longest file name, in characters, that all
+// current Pioneer players show and load reliably. Older firmware cuts longer
+// names off in the browser or fails to load the track.
+const defaultMaxNameLength = 128
+
+// maxPathLength is the longest path the players accept, counted from the
+// volume root.
+const maxPathLength = 240
+
+// NameProblem is a file or folder name that some players mishandle.
+type NameProblem struct {
+	// Path is relative to the volume root.
+	Path    string
+	Reasons []string
+	// Rename is the suggested replacement for the last path element, or ""
+	// when renaming cannot fix the problem, as with a path that is too long
+	// because of its folders.
+	Rename string
+}
+
+// nameCharProblem describes a character some firmware mishandles, or returns
+// "" for a safe one.
+func nameCharProblem(r rune) string {
+	switch {
+	case r > 0xFFFF:
+		return "emoji or other characters outside the Basic Multilingual Plane"
+	case unicode.IsControl(r):
+		return "control characters"
+	case unicode.Is(unicode.Mn, r):
+		// macOS stores accented letters as a base letter plus a combining
+		// accent, which players show as two characters or as boxes.
+		return "decomposed accents (combining marks)"
+	case r == utf8.RuneError:
+		return "invalid UTF-8"
+	}
+	return ""
+}
+
+// nameProblems lists what is wrong with one name.
+func nameProblems(name, rel string, maxName int) []string {
+	var reasons []string
+	if length := utf8.RuneCountInString(name); length > maxName {
+		reasons = append(reasons, fmt.Sprintf("name is %d characters (limit %d)", length, maxName))
+	}
+	if length := utf8.RuneCountInString(rel); length > maxPathLength {
+		reasons = append(reasons, fmt.Sprintf("path is %d characters (limit %d)", length, maxPathLength))
+	}
+	seen := make(map[string]bool)
+	for _, r := range name {
+		if problem := nameCharProblem(r); problem != "" && !seen[problem] {
+			seen[problem] = true
+			reasons = append(reasons, "contains "+problem)
+		}
+	}
+	if strings.TrimRight(name, ". ") != name || strings.TrimLeft(name, " ") != name {
+		reasons = append(reasons, "starts or ends with a space or dot")
+	}
+	return reasons
+}
+
+// safeName rewrites a name so it passes nameProblems: accents are dropped
+// from decomposed letters, other problem characters become underscores, and
+// the base name is shortened to keep the extension.
+func safeName(name string, maxName int) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case nameCharProblem(r) != "":
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	cleaned := strings.TrimRight(strings.TrimLeft(b.String(), " "), ". ")
+	ext := filepath.Ext(cleaned)
+	base := strings.TrimRight(strings.TrimSuffix(cleaned, ext), ". ")
+	if utf8.RuneCountInString(ext) > 8 {
+		base, ext = cleaned, ""
+	}
+	if room := maxName - utf8.RuneCountInString(ext); utf8.RuneCountInString(base) > room {
+		base = strings.TrimRight(string([]rune(base)[:max(room, 1)]), ". ")
+	}
+	if base == "" {
+		base = "_"
+	}
+	return base + ext
+}
+
+// uniqueName adds " (2)", " (3)", and so on before the extension until the
+// name is not taken, ignoring case.
+func uniqueName(name string, taken map[string]bool, maxName int) string {
+	if !taken[strings.ToLower(name)] {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		trimmed := []rune(base)
+		if room := maxName - len(suffix) - utf8.RuneCountInString(ext); len(trimmed) > room {
+			trimmed = trimmed[:max(room, 1)]
+		}
+		candidate := string(trimmed) + suffix + ext
+		if !taken[strings.ToLower(candidate)] {
+			return candidate
+		}
+	}
+}
+
+// scanNames walks a mounted volume and reports problem names, including names
+// in one folder that differ only by case. The PIONEER folder is left alone:
+// rekordbox owns those names.
+func scanNames(mountPoint string, maxName int) ([]NameProblem, error) {
+	var problems []NameProblem
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if rel != "." && containsFold(payloadMetadataFolders, strings.Split(filepath.ToSlash(rel), "/")[0]) {
+			return filepath.SkipDir
+		}
+
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		taken := make(map[string]bool)
+		byFold := make(map[string][]string)
+		for _, child := range children {
+			taken[strings.ToLower(child.Name())] = true
+			byFold[strings.ToLower(child.Name())] = append(byFold[strings.ToLower(child.Name())], child.Name())
+		}
+
+		for _, child := range children {
+			name := child.Name()
+			childRel := filepath.ToSlash(filepath.Join(rel, name))
+			if strings.HasPrefix(name, ".") || (rel == "." && (containsFold(payloadMetadataFolders, name) || name == "System Volume Information")) {
+				continue
+			}
+			reasons := nameProblems(name, childRel, maxName)
+			if group := byFold[strings.ToLower(name)]; len(group) > 1 && group[0] != name {
+				reasons = append(reasons, fmt.Sprintf("differs from %q only by case", group[0]))
+			}
+			if len(reasons) == 0 {
+				continue
+			}
+			rename := safeName(name, maxName)
+			if !strings.EqualFold(rename, name) || len(byFold[strings.ToLower(name)]) > 1 {
+				rename = uniqueName(rename, taken, maxName)
+			}
+			if rename == name {
+				rename = ""
+			}
+			taken[strings.ToLower(rename)] = true
+			problems = append(problems, NameProblem{Path: childRel, Reasons: reasons, Rename: rename})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// renameProblems renames every problem file, deepest paths first so folder
+// renames do not invalidate the paths below them, and returns the old and
+// new paths of each rename that succeeded.
+func renameProblems(mountPoint string, problems []NameProblem) ([][2]string, []string) {
+	sorted := append([]NameProblem(nil), problems...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(sorted[i].Path, "/") > strings.Count(sorted[j].Path, "/")
+	})
+	var renamed [][2]string
+	var failures []string
+	for _, problem := range sorted {
+		if problem.Rename == "" {
+			continue
+		}
+		oldPath := filepath.Join(mountPoint, filepath.FromSlash(problem.Path))
+		newPath := filepath.Join(filepath.Dir(oldPath), problem.Rename)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", problem.Path, err))
+			continue
+		}
+		newRel := filepath.ToSlash(filepath.Join(filepath.Dir(filepath.FromSlash(problem.Path)), problem.Rename))
+		renamed = append(renamed, [2]string{problem.Path, newRel})
+	}
+	// Paths below a renamed folder still use its old name; renames are in
+	// deepest-first order, so applying them in turn fixes every level.
+	for i := range renamed {
+		for _, folder := range renamed {
+			if strings.HasPrefix(renamed[i][1], folder[0]+"/") {
+				renamed[i][1] = folder[1] + strings.TrimPrefix(renamed[i][1], folder[0])
+			}
+		}
+	}
+	return renamed, failures
+}
+
+// writeRenameMap saves the renames as CSV in the current folder so playlists
+// and libraries can be pointed at the new names.
+func writeRenameMap(device string, renamed [][2]string) (string, error) {
+	path := fmt.Sprintf("cdjf-renames-%s-%s.csv", sanitizeDeviceName(device), time.Now().Format("20060102-150405"))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"old_path", "new_path"})
+	for _, pair := range renamed {
+		writer.Write(pair[:])
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// checkNames reports problem names on a drive and, with fix, offers to
+// rename them.
+func checkNames(device string, maxName int, fix bool) {
+	fmt.Println()
+	title := "File Names:"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		return
+	}
+	problems, err := scanNames(mountPoint, maxName)
+	if err != nil {
+		printError("Error scanning file names: %v", err)
+		return
+	}
+	if len(problems) == 0 {
+		printOK("All file names are safe for players.")
+		return
+	}
+
+	warn(device, warnFilesystem, "%d file name(s) may not work on all players", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem.Path)
+		for _, reason := range problem.Reasons {
+			fmt.Printf("      %s\n", reason)
+		}
+		if problem.Rename == "" {
+			fmt.Println("      -> shorten the folder names above it by hand")
+		} else {
+			fmt.Printf("      -> %s\n", problem.Rename)
+		}
+	}
+	if !fix {
+		fmt.Println("Run with --fix-names to rename them as shown.")
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("Renamed files no longer match a rekordbox export or playlist that points at")
+	fmt.Println("them. Rename them in your library as well, or export to the drive again.")
+	response := ask("rename-files", "Rename these files? (y/N): ")
+	if response != "y" && response != "yes" {
+		fmt.Println("Nothing was renamed.")
+		return
+	}
+
+	renamed, failures := renameProblems(mountPoint, problems)
+	for _, failure := range failures {
+		printError("Unable to rename %s", failure)
+	}
+	if len(renamed) == 0 {
+		return
+	}
+	printOK("Renamed %d of %d files.", len(renamed), len(problems))
+	if path, err := writeRenameMap(device, renamed); err != nil {
+		printWarning("Unable to save the list of renames: %v", err)
+	} else {
+		fmt.Printf("Old and new names saved to %s\n", path)
+	}
+}
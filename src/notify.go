@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// sendNotification shows a native desktop notification.
+func sendNotification(title, message string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		if output, err := execCommand("osascript", "-e", script).CombinedOutput(); err != nil {
+			return fmt.Errorf("osascript failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+
+	case "windows":
+		psScript := fmt.Sprintf(`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode(%s)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode(%s)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('cdjf').Show($toast)`,
+			powerShellString(title), powerShellString(message))
+		cmd := execCommand("powershell", "-NoProfile", "-Command", psScript)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("toast notification failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+func appleScriptString(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return `"` + escaped + `"`
+}
+
+func powerShellString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// playSystemSound plays a short built-in sound, a different one on failure.
+func playSystemSound(failed bool) error {
+	switch runtime.GOOS {
+	case "darwin":
+		sound := "/System/Library/Sounds/Glass.aiff"
+		if failed {
+			sound = "/System/Library/Sounds/Basso.aiff"
+		}
+		return execCommand("afplay", sound).Run()
+
+	case "windows":
+		sound := "tada.wav"
+		if failed {
+			sound = "Windows Critical Stop.wav"
+		}
+		psCmd := fmt.Sprintf("(New-Object Media.SoundPlayer (Join-Path $env:WINDIR 'Media\\%s')).PlaySync()", sound)
+		return execCommand("powershell", "-NoProfile", "-Command", psCmd).Run()
+	}
+
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+// CompletionAlerts selects how the user is told that a long operation ended.
+type CompletionAlerts struct {
+	Notify bool
+	Bell   bool
+	Sound  bool
+}
+
+func completionAlertsFromFlags(cmd *cobra.Command) CompletionAlerts {
+	notify, _ := cmd.Flags().GetBool("notify")
+	bell, _ := cmd.Flags().GetBool("bell")
+	sound, _ := cmd.Flags().GetBool("sound")
+	return CompletionAlerts{Notify: notify, Bell: bell, Sound: sound}
+}
+
+// Send raises the selected alerts for a finished operation. Failures to alert
+// are reported but never fatal.
+func (a CompletionAlerts) Send(title, message string, failed bool) {
+	if a.Bell {
+		fmt.Print("\a")
+	}
+	if a.Sound {
+		if err := playSystemSound(failed); err != nil {
+			printWarning("Unable to play sound: %v", err)
+		}
+	}
+	if a.Notify {
+		if err := sendNotification(title, message); err != nil {
+			printWarning("Unable to send notification: %v", err)
+		}
+	}
+}
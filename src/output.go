@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityOK
+	SeverityWarn
+	SeverityError
+)
+
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[1;31m"
+	ansiYellow = "\033[33m"
+	ansiGreen  = "\033[32m"
+)
+
+var colorOutput = false
+
+// console serializes terminal output. Multi-drive formats and verifies print
+// from one goroutine per drive while progress bars redraw their line in
+// place, so every write takes the lock, and a progress line left on screen is
+// ended before anything else is printed below it.
+type console struct {
+	mu sync.Mutex
+	// midLine is set while a progress line drawn with a carriage return and no
+	// newline is on screen.
+	midLine bool
+}
+
+var terminal console
+
+// consoleOut and consoleErr are stdout and stderr through the console. Code
+// that may run alongside other drives' work prints through them.
+var (
+	consoleOut io.Writer = consoleWriter{os.Stdout}
+	consoleErr io.Writer = consoleWriter{os.Stderr}
+)
+
+type consoleWriter struct {
+	file *os.File
+}
+
+func (w consoleWriter) Write(p []byte) (int, error) {
+	terminal.mu.Lock()
+	defer terminal.mu.Unlock()
+	terminal.endLine()
+	return w.file.Write(p)
+}
+
+// linePrefixWriter passes output on one whole line at a time with a prefix,
+// so output from a child process, such as a hook, can go through the console
+// without splitting a line printed for another drive.
+type linePrefixWriter struct {
+	out     io.Writer
+	prefix  string
+	pending []byte
+}
+
+func (w *linePrefixWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		line := bytes.TrimSuffix(w.pending[:end], []byte("\r"))
+		if _, err := fmt.Fprintf(w.out, "%s%s\n", w.prefix, line); err != nil {
+			return 0, err
+		}
+		w.pending = w.pending[end+1:]
+	}
+}
+
+// Flush passes on a last line that did not end with a newline.
+func (w *linePrefixWriter) Flush() {
+	if len(w.pending) > 0 {
+		fmt.Fprintf(w.out, "%s%s\n", w.prefix, w.pending)
+		w.pending = nil
+	}
+}
+
+// endLine moves below a progress line on screen. The lock must be held.
+func (c *console) endLine() {
+	if c.midLine {
+		os.Stdout.Write([]byte("\n"))
+		c.midLine = false
+	}
+}
+
+// redraw replaces the line under the cursor with line, leaving the cursor at
+// its end so it can be drawn again.
+func (c *console) redraw(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(os.Stdout, "\r%s", line)
+	c.midLine = true
+}
+
+// finishLine ends a progress line on screen, if any.
+func (c *console) finishLine() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endLine()
+}
+
+// overwrite prints line in place of a progress line on screen.
+func (c *console) overwrite(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clearWidth := terminalWidth() - 1
+	if clearWidth < 1 {
+		clearWidth = 1
+	}
+	fmt.Fprintf(os.Stdout, "\r%s\r%s\n", strings.Repeat(" ", clearWidth), line)
+	c.midLine = false
+}
+
+// Verbosity levels for the output of external commands such as diskutil and
+// format, chosen with -v and -vv.
+const (
+	// verbosityQuiet shows only the progress bar and errors.
+	verbosityQuiet = iota
+	// verbositySteps adds a line for each step the command reaches.
+	verbositySteps
+	// verbosityRaw streams every line the command prints and echoes each
+	// command cdjf runs.
+	verbosityRaw
+)
+
+var verbosity = verbosityQuiet
+
+// configureColor decides whether output is colored. Color is disabled by
+// --no-color, the NO_COLOR environment variable, or when stdout is not a terminal.
+func configureColor(noColor bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" || !isTerminal(os.Stdout) {
+		colorOutput = false
+		return
+	}
+	colorOutput = enableVirtualTerminal()
+}
+
+func colorize(severity Severity, text string) string {
+	if !colorOutput {
+		return text
+	}
+	switch severity {
+	case SeverityOK:
+		return ansiGreen + text + ansiReset
+	case SeverityWarn:
+		return ansiYellow + text + ansiReset
+	case SeverityError:
+		return ansiRed + text + ansiReset
+	}
+	return text
+}
+
+func printWarning(format string, args ...any) {
+	fmt.Fprintln(consoleOut, "  "+colorize(SeverityWarn, "WARNING: "+fmt.Sprintf(format, args...)))
+}
+
+func printError(format string, args ...any) {
+	fmt.Fprintln(consoleErr, colorize(SeverityError, fmt.Sprintf(format, args...)))
+}
+
+func printOK(format string, args ...any) {
+	fmt.Fprintln(consoleOut, colorize(SeverityOK, fmt.Sprintf(format, args...)))
+}
+
+// severityOf guesses the severity of a status line from its wording.
+func severityOf(line string) Severity {
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.Contains(upper, "FAIL") || strings.Contains(upper, "ERROR"):
+		return SeverityError
+	case strings.Contains(upper, "WARNING"):
+		return SeverityWarn
+	case strings.Contains(upper, "SUCCESS") || strings.Contains(upper, "PASS") || strings.Contains(upper, " OK"):
+		return SeverityOK
+	}
+	return SeverityInfo
+}
+
+// printCommandStep shows a summarized step of an external command at -v and
+// above.
+func printCommandStep(line string) {
+	if verbosity >= verbositySteps {
+		printProgressMessage(line)
+	}
+}
+
+// printCommandOutput shows a raw line of external command output at -vv.
+func printCommandOutput(line string) {
+	if verbosity >= verbosityRaw {
+		printProgressMessage(line)
+	}
+}
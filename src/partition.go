@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const docsPartitionLabel = "DOCS"
+
+func parseDocsPartitionSize(value string) (float64, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return 0, nil
+	}
+	sizeGB := parseSizeToGB(strings.ToUpper(trimmed))
+	if sizeGB <= 0 {
+		return 0, fmt.Errorf("invalid documents partition size %q; use a value such as 512MB or 2GB", value)
+	}
+	return sizeGB, nil
+}
+
+func printDualPartitionWarnings(docsSizeGB float64) {
+	fmt.Fprintf(consoleOut, "  NOTE: A second %.1f GB %s partition will be created after the music partition.\n", docsSizeGB, docsPartitionLabel)
+	fmt.Fprintln(consoleOut, "   CDJ/XDJ players only read the first partition; keep all rekordbox content there.")
+	fmt.Fprintln(consoleOut, "   Some older players and mixers refuse drives with more than one partition.")
+}
+
+func partitionMac(device string, opts FormatOptions) error {
+	if err := ensureRemovableDevice(device); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(consoleOut, "Unmounting device...")
+	unmountCmd := execCommand("diskutil", "unmountDisk", device)
+	if output, err := unmountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+	}
+
+	docsSize := fmt.Sprintf("%dM", int64(opts.DocsSizeGB*1024))
+	fmt.Fprintf(consoleOut, "Creating %s music partition and %s documents partition...\n", opts.Filesystem, docsSize)
+
+	cmd := execCommand("diskutil", "partitionDisk", device, "2", opts.Scheme,
+		diskutilPersonality(opts.Filesystem), opts.Label, "R",
+		"FAT32", docsPartitionLabel, docsSize)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("diskutil partitionDisk failed: %v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// alignMacPartition moves the partition diskutil eraseDisk created to a 1 MiB
+// boundary. diskutil picks its own start sector and has no alignment option,
+// so a single MBR partition that is not aligned is written again with fdisk,
+// keeping its end, and the filesystem is created again on it. GPT layouts
+// keep diskutil's offsets, since macOS has no scriptable GPT editor.
+func alignMacPartition(device string, opts FormatOptions) error {
+	table, err := readPartitionTable(device)
+	if err != nil {
+		printWarning("Unable to check the partition alignment of %s: %v", device, err)
+		return nil
+	}
+	if table.Scheme != "MBR" || len(table.Partitions) != 1 {
+		return nil
+	}
+	// MBR entries count logical blocks, which are not always 512 bytes.
+	blockSize, err := getDiskBlockSize(device)
+	if err != nil {
+		printWarning("Unable to check the partition alignment of %s: %v", device, err)
+		return nil
+	}
+	table.SectorSize = blockSize
+	if len(table.Misaligned()) == 0 {
+		return nil
+	}
+	part := table.Partitions[0]
+	start := uint64(partitionAlignment / table.SectorSize)
+	end := part.StartLBA + part.Sectors
+	if end <= start {
+		return fmt.Errorf("partition on %s is too small to align to 1 MiB", device)
+	}
+
+	typeID := 0x0C
+	newfs := []string{"newfs_msdos", "-F", "32", "-v", opts.Label}
+	if opts.Filesystem == "exFAT" {
+		typeID = 0x07
+		newfs = []string{"newfs_exfat", "-v", opts.Label}
+	}
+
+	fmt.Fprintf(consoleOut, "Moving the partition from sector %d to %d (1 MiB aligned)...\n", part.StartLBA, start)
+	unmountCmd := execCommand("diskutil", "unmountDisk", device)
+	if output, err := unmountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+	}
+	fdiskCmd := execCommand("fdisk", "-y", "-r", "/dev/r"+device)
+	fdiskCmd.Stdin = strings.NewReader(fmt.Sprintf("%d,%d,%02X,*\n", start, end-start, typeID))
+	if output, err := fdiskCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("fdisk failed: %v\nOutput: %s", err, output)
+	}
+	newfsCmd := execCommand(newfs[0], append(newfs[1:], "/dev/r"+device+"s1")...)
+	if output, err := newfsCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v\nOutput: %s", newfs[0], err, output)
+	}
+	mountCmd := execCommand("diskutil", "mountDisk", device)
+	if output, err := mountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to mount after aligning: %v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+func partitionWindows(device string, opts FormatOptions) error {
+	if err := ensureRemovableDevice(device); err != nil {
+		return err
+	}
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+
+	diskNumber, err := windowsDiskNumber(driveLetter)
+	if err != nil {
+		return err
+	}
+
+	diskSizeBytes, err := windowsDiskSize(diskNumber)
+	if err != nil {
+		return err
+	}
+
+	docsMB := int64(opts.DocsSizeGB * 1024)
+	musicMB := diskSizeBytes/(1024*1024) - docsMB - 1
+	if docsMB > 0 && musicMB <= 0 {
+		return fmt.Errorf("documents partition (%d MB) does not fit on a %.1f GB disk", docsMB, float64(diskSizeBytes)/(1024*1024*1024))
+	}
+
+	fsName := strings.ToLower(opts.Filesystem)
+	unit := ""
+	if opts.ClusterSize != "" {
+		unit = " unit=" + opts.ClusterSize
+	}
+
+	scheme := "mbr"
+	if opts.Scheme == "GPT" {
+		scheme = "gpt"
+	}
+
+	// Without a documents partition the music partition fills the disk,
+	// which is how RAW drives are rebuilt from scratch.
+	createMusic := "create partition primary align=1024"
+	if docsMB > 0 {
+		createMusic = fmt.Sprintf("create partition primary size=%d align=1024", musicMB)
+	}
+	// A format without "quick" writes and checks every sector.
+	quick := " quick"
+	if opts.Full {
+		quick = ""
+	}
+	lines := []string{
+		fmt.Sprintf("select disk %d", diskNumber),
+		"clean",
+		"convert " + scheme,
+		createMusic,
+		fmt.Sprintf("format fs=%s%s label=\"%s\"%s", fsName, quick, opts.Label, unit),
+		fmt.Sprintf("assign letter=%s", driveLetter),
+	}
+	if docsMB > 0 {
+		lines = append(lines,
+			"create partition primary align=1024",
+			fmt.Sprintf("format fs=fat32 quick label=\"%s\"", docsPartitionLabel),
+			"assign")
+	}
+	script := strings.Join(append(lines, "exit"), "\r\n")
+
+	scriptFile, err := os.CreateTemp("", "cdjf-diskpart-*.txt")
+	if err != nil {
+		return fmt.Errorf("create diskpart script: %v", err)
+	}
+	defer os.Remove(scriptFile.Name())
+
+	if _, err := scriptFile.WriteString(script); err != nil {
+		scriptFile.Close()
+		return fmt.Errorf("write diskpart script: %v", err)
+	}
+	if err := scriptFile.Close(); err != nil {
+		return fmt.Errorf("write diskpart script: %v", err)
+	}
+
+	if docsMB > 0 {
+		fmt.Fprintf(consoleOut, "Creating %s music partition (%d MB) and %d MB documents partition...\n", opts.Filesystem, musicMB, docsMB)
+	} else {
+		fmt.Fprintf(consoleOut, "Repartitioning and creating a %s partition across the whole disk...\n", opts.Filesystem)
+	}
+	cmd := execCommand("diskpart", "/s", scriptFile.Name())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("diskpart failed: %v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+func windowsDiskNumber(driveLetter string) (int, error) {
+	return cachedDriveInfo("disk number "+strings.ToUpper(driveLetter), func() (int, error) {
+		return queryWindowsDiskNumber(driveLetter)
+	})
+}
+
+func queryWindowsDiskNumber(driveLetter string) (int, error) {
+	psCmd := fmt.Sprintf("(Get-Partition -DriveLetter %s).DiskNumber", driveLetter)
+	output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+	if err != nil {
+		return 0, fmt.Errorf("unable to resolve disk number for %s: %v", driveLetter, err)
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected disk number %q for %s", strings.TrimSpace(string(output)), driveLetter)
+	}
+	return number, nil
+}
+
+func windowsDiskSize(diskNumber int) (int64, error) {
+	psCmd := fmt.Sprintf("(Get-Disk -Number %d).Size", diskNumber)
+	output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read size of disk %d: %v", diskNumber, err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size %q for disk %d", strings.TrimSpace(string(output)), diskNumber)
+	}
+	return size, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const (
+	partitionTableReadSize = 64 * 1024
+	partitionAlignment     = 1024 * 1024
+	superfloppyScheme      = "None"
+)
+
+type PartitionEntry struct {
+	Index    int
+	Type     string
+	StartLBA uint64
+	Sectors  uint64
+}
+
+type PartitionTable struct {
+	Scheme     string
+	SectorSize int
+	Partitions []PartitionEntry
+}
+
+func (p PartitionEntry) StartOffset(sectorSize int) int64 {
+	return int64(p.StartLBA) * int64(sectorSize)
+}
+
+func (t PartitionTable) Misaligned() []PartitionEntry {
+	var misaligned []PartitionEntry
+	for _, part := range t.Partitions {
+		if part.StartOffset(t.SectorSize)%partitionAlignment != 0 {
+			misaligned = append(misaligned, part)
+		}
+	}
+	return misaligned
+}
+
+func rawDevicePath(device string) (string, error) {
+	if fake := activeFakeBackend(); fake != nil {
+		if image := fake.drive(device).Image; image != "" {
+			return image, nil
+		}
+		return "", fmt.Errorf("raw disk access is not available for fake drive %s", device)
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return "/dev/r" + wholeDiskIdentifier(device), nil
+	case "windows":
+		driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+		diskNumber, err := windowsDiskNumber(driveLetter)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`\\.\PhysicalDrive%d`, diskNumber), nil
+	}
+	return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+func wholeDiskIdentifier(device string) string {
+	if match := wholeDiskPrefixRegex.FindString(device); match != "" {
+		return match
+	}
+	return device
+}
+
+// physicalDiskIdentifier returns the physical disk holding a macOS partition
+// or volume such as disk4s1. An APFS volume's whole disk is its container,
+// which diskutil presents as a disk of its own, so that is followed to the
+// partition storing it. Other systems and fake drives get device back.
+func physicalDiskIdentifier(device string) string {
+	if runtime.GOOS != "darwin" || activeFakeBackend() != nil {
+		return device
+	}
+	disk := wholeDiskIdentifier(device)
+	output, err := macDiskInfo(disk)
+	if err != nil {
+		return disk
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "APFS Physical Store:") {
+			if store := strings.TrimSpace(strings.TrimPrefix(line, "APFS Physical Store:")); store != "" {
+				return wholeDiskIdentifier(store)
+			}
+		}
+	}
+	return disk
+}
+
+func readPartitionTable(device string) (PartitionTable, error) {
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return PartitionTable{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return PartitionTable{}, fmt.Errorf("reading %s requires administrator privileges", path)
+		}
+		return PartitionTable{}, err
+	}
+	defer file.Close()
+
+	data := make([]byte, partitionTableReadSize)
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return PartitionTable{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	return parsePartitionTable(data[:n])
+}
+
+func parsePartitionTable(data []byte) (PartitionTable, error) {
+	if len(data) < 512 || data[510] != 0x55 || data[511] != 0xAA {
+		return PartitionTable{}, fmt.Errorf("no partition table found")
+	}
+
+	for _, sectorSize := range []int{512, 4096} {
+		if len(data) >= sectorSize+92 && bytes.Equal(data[sectorSize:sectorSize+8], []byte("EFI PART")) {
+			return parseGPT(data, sectorSize)
+		}
+	}
+
+	if looksLikeBootSector(data) {
+		return PartitionTable{Scheme: superfloppyScheme, SectorSize: 512}, nil
+	}
+
+	return parseMBR(data), nil
+}
+
+func parseMBR(data []byte) PartitionTable {
+	table := PartitionTable{Scheme: "MBR", SectorSize: 512}
+	for i := 0; i < 4; i++ {
+		entry := data[446+i*16 : 446+(i+1)*16]
+		partType := entry[4]
+		start := binary.LittleEndian.Uint32(entry[8:12])
+		sectors := binary.LittleEndian.Uint32(entry[12:16])
+		if partType == 0 || sectors == 0 {
+			continue
+		}
+		table.Partitions = append(table.Partitions, PartitionEntry{
+			Index:    i + 1,
+			Type:     fmt.Sprintf("0x%02X", partType),
+			StartLBA: uint64(start),
+			Sectors:  uint64(sectors),
+		})
+	}
+	return table
+}
+
+func parseGPT(data []byte, sectorSize int) (PartitionTable, error) {
+	table := PartitionTable{Scheme: "GPT", SectorSize: sectorSize}
+	header := data[sectorSize:]
+
+	entryLBA := binary.LittleEndian.Uint64(header[72:80])
+	entryCount := binary.LittleEndian.Uint32(header[80:84])
+	entrySize := binary.LittleEndian.Uint32(header[84:88])
+	if entrySize < 128 {
+		return PartitionTable{}, fmt.Errorf("invalid GPT entry size %d", entrySize)
+	}
+
+	offset := entryLBA * uint64(sectorSize)
+	for i := uint32(0); i < entryCount; i++ {
+		start := offset + uint64(i)*uint64(entrySize)
+		end := start + uint64(entrySize)
+		if end > uint64(len(data)) {
+			break
+		}
+		entry := data[start:end]
+
+		typeGUID := entry[0:16]
+		if bytes.Equal(typeGUID, make([]byte, 16)) {
+			continue
+		}
+		firstLBA := binary.LittleEndian.Uint64(entry[32:40])
+		lastLBA := binary.LittleEndian.Uint64(entry[40:48])
+		if lastLBA < firstLBA {
+			continue
+		}
+
+		table.Partitions = append(table.Partitions, PartitionEntry{
+			Index:    int(i) + 1,
+			Type:     formatGUID(typeGUID),
+			StartLBA: firstLBA,
+			Sectors:  lastLBA - firstLBA + 1,
+		})
+	}
+	return table, nil
+}
+
+var mbrPartitionTypes = map[string]string{
+	"0x01": "FAT12",
+	"0x04": "FAT16",
+	"0x06": "FAT16",
+	"0x07": "NTFS/exFAT",
+	"0x0B": "FAT32",
+	"0x0C": "FAT32 (LBA)",
+	"0x0E": "FAT16 (LBA)",
+	"0x0F": "Extended",
+	"0x83": "Linux",
+	"0xAF": "HFS+",
+	"0xEE": "GPT protective",
+	"0xEF": "EFI System",
+}
+
+var gptPartitionTypes = map[string]string{
+	"EBD0A0A2-B9E5-4433-87C0-68B6B72699C7": "Microsoft basic data",
+	"E3C9E316-0B5C-4DB8-817D-F92DF00215AE": "Microsoft reserved",
+	"C12A7328-F81F-11D2-BA4B-00A0C93EC93B": "EFI System",
+	"48465300-0000-11AA-AA11-00306543ECAC": "HFS+",
+	"7C3457EF-0000-11AA-AA11-00306543ECAC": "APFS",
+	"0FC63DAF-8483-4772-8E79-3D69D8477DE4": "Linux filesystem",
+}
+
+func (p PartitionEntry) TypeName() string {
+	if name, ok := mbrPartitionTypes[p.Type]; ok {
+		return name
+	}
+	if name, ok := gptPartitionTypes[p.Type]; ok {
+		return name
+	}
+	return "Unknown (" + p.Type + ")"
+}
+
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16])
+}
+
+func printPartitionTable(table PartitionTable) {
+	fmt.Printf("Scheme: %s\n", table.Scheme)
+	fmt.Printf("Partitions: %d\n", len(table.Partitions))
+	for _, part := range table.Partitions {
+		sizeGB := float64(part.Sectors) * float64(table.SectorSize) / (1024 * 1024 * 1024)
+		fmt.Printf("  #%d %-22s start %12d bytes %10.2f GB\n",
+			part.Index, part.TypeName(), part.StartOffset(table.SectorSize), sizeGB)
+	}
+
+	if table.Scheme == "GPT" {
+		printWarning("GPT partition tables are not recognized by older CDJ/XDJ firmware; MBR is safest.")
+	}
+	if len(table.Partitions) > 1 {
+		fmt.Println("  NOTE: Players only read the first partition; keep rekordbox content there.")
+	}
+	if table.Scheme == superfloppyScheme {
+		printWarning("The filesystem starts at sector 0 without a partition table; some players will not mount it.")
+	} else if len(table.Partitions) == 0 {
+		printWarning("No partitions found; the drive will not show up on players.")
+	}
+}
+
+func printAlignmentReport(table PartitionTable) {
+	misaligned := table.Misaligned()
+	if len(misaligned) == 0 {
+		fmt.Println("Partition alignment: OK (all partitions start on a 1 MiB boundary)")
+		return
+	}
+	for _, part := range misaligned {
+		printWarning("Partition %d starts at byte %d, which is not 1 MiB aligned.",
+			part.Index, part.StartOffset(table.SectorSize))
+	}
+	fmt.Println("   Misaligned partitions slow down flash writes. Reformat the drive to fix this.")
+}
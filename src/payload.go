@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fat32MaxFileSize is the largest file a FAT32 volume can hold.
+const fat32MaxFileSize = 1<<32 - 1
+
+// payloadSkipNames are OS metadata files that should not be seeded onto
+// drives.
+var payloadSkipNames = map[string]bool{
+	".ds_store":   true,
+	"thumbs.db":   true,
+	"desktop.ini": true,
+}
+
+// Payload copy orders.
+const (
+	// payloadOrderMetadataFirst copies player metadata, then other small
+	// files, then audio. A fresh FAT or exFAT volume hands out clusters from
+	// the start, so the export database, ANLZ analysis files, and artwork end
+	// up together in the early, fast region of the flash where players browse.
+	payloadOrderMetadataFirst = "metadata-first"
+	// payloadOrderFolder copies files in the order the folder is walked.
+	payloadOrderFolder = "folder"
+)
+
+// payloadMetadataFolders hold the databases, analysis files, and artwork that
+// players read while browsing.
+var payloadMetadataFolders = []string{"PIONEER", "Engine Library"}
+
+// payloadAudioExtensions are the audio files copied last.
+var payloadAudioExtensions = map[string]bool{
+	".mp3":  true,
+	".wav":  true,
+	".aif":  true,
+	".aiff": true,
+	".flac": true,
+	".m4a":  true,
+	".alac": true,
+	".ogg":  true,
+}
+
+func normalizePayloadOrder(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", payloadOrderMetadataFirst:
+		return payloadOrderMetadataFirst, nil
+	case payloadOrderFolder:
+		return payloadOrderFolder, nil
+	}
+	return "", fmt.Errorf("invalid payload order %q; use %s or %s", value, payloadOrderMetadataFirst, payloadOrderFolder)
+}
+
+// payloadCopyRank sorts metadata before other files and audio last.
+func payloadCopyRank(rel string) int {
+	top := strings.Split(filepath.ToSlash(rel), "/")[0]
+	if containsFold(payloadMetadataFolders, top) {
+		return 0
+	}
+	if payloadAudioExtensions[strings.ToLower(filepath.Ext(rel))] {
+		return 2
+	}
+	return 1
+}
+
+// copyPayload copies the contents of a profile's payload folder onto a freshly
+// formatted drive in the given order and returns the number of files copied.
+// Folders are all created before any file is copied.
+func copyPayload(device, dir, filesystem, order string) (int, error) {
+	defer forgetDriveInfo()
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return 0, fmt.Errorf("%s is not a folder", dir)
+	}
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		return 0, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if payloadSkipNames[strings.ToLower(entry.Name())] {
+			return nil
+		}
+		dest := filepath.Join(mountPoint, rel)
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(dest, 0o755)
+		case !entry.Type().IsRegular():
+			// Symlinks and devices have no meaning on a FAT drive.
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if filesystem == "FAT32" && info.Size() > fat32MaxFileSize {
+			return fmt.Errorf("%s is larger than the 4 GB FAT32 file limit", rel)
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if order != payloadOrderFolder {
+		sort.SliceStable(files, func(i, j int) bool {
+			return payloadCopyRank(files[i]) < payloadCopyRank(files[j])
+		})
+	}
+	copied := 0
+	for _, rel := range files {
+		if err := copyPayloadFile(filepath.Join(dir, rel), filepath.Join(mountPoint, rel)); err != nil {
+			return copied, fmt.Errorf("copy %s: %w", rel, err)
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+func copyPayloadFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
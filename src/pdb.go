@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// export.pdb is a DeviceSQL database: a header listing the tables, then
+// fixed-size pages. Each table is a chain of pages whose rows are located
+// through an index at the end of the page, in groups of 16.
+const (
+	pdbTableTracks  = 0
+	pdbPageHeapPos  = 0x28
+	pdbRowGroupSize = 0x24
+	// pdbTrackStrings is where a track row's 21 string offsets start; the
+	// last of them is the file path.
+	pdbTrackStrings    = 0x5e
+	pdbTrackPathString = 20
+)
+
+// pdbString decodes a DeviceSQL string: short ASCII, long ASCII, or long
+// UTF-16LE.
+func pdbString(page []byte, pos int) (string, error) {
+	if pos >= len(page) {
+		return "", fmt.Errorf("string outside page")
+	}
+	kind := page[pos]
+	if kind == 0x40 || kind == 0x90 {
+		if pos+4 > len(page) {
+			return "", fmt.Errorf("string outside page")
+		}
+		length := int(binary.LittleEndian.Uint16(page[pos+1 : pos+3]))
+		if length < 4 || pos+length > len(page) {
+			return "", fmt.Errorf("invalid string length %d", length)
+		}
+		body := page[pos+4 : pos+length]
+		if kind == 0x40 {
+			return string(body), nil
+		}
+		units := make([]uint16, len(body)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(body[2*i:])
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	if kind&1 == 0 {
+		return "", fmt.Errorf("unknown string kind 0x%02x", kind)
+	}
+	length := int(kind >> 1)
+	if length < 1 || pos+length > len(page) {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
+	return string(page[pos+1 : pos+length]), nil
+}
+
+// pdbPageTrackPaths returns the file paths of the track rows on one data
+// page and the number of rows that could not be read.
+func pdbPageTrackPaths(page []byte) ([]string, int) {
+	rows := int(page[0x18])
+	if large := int(binary.LittleEndian.Uint16(page[0x22:0x24])); large > rows && large != 0x1fff {
+		rows = large
+	}
+	var paths []string
+	skipped := 0
+	for group := 0; group*16 < rows; group++ {
+		base := len(page) - group*pdbRowGroupSize
+		if base-4-2*16 < pdbPageHeapPos {
+			break
+		}
+		present := binary.LittleEndian.Uint16(page[base-4 : base-2])
+		for i := 0; i < 16; i++ {
+			if present&(1<<i) == 0 {
+				continue
+			}
+			row := pdbPageHeapPos + int(binary.LittleEndian.Uint16(page[base-6-2*i:]))
+			offsetPos := row + pdbTrackStrings + 2*pdbTrackPathString
+			if offsetPos+2 > len(page) {
+				skipped++
+				continue
+			}
+			path, err := pdbString(page, row+int(binary.LittleEndian.Uint16(page[offsetPos:offsetPos+2])))
+			if err != nil || path == "" {
+				skipped++
+				continue
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, skipped
+}
+
+// readExportTrackPaths lists the file path of every track in a rekordbox
+// export.pdb, along with the number of track rows that could not be read.
+func readExportTrackPaths(path string) ([]string, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(data) < 0x1c {
+		return nil, 0, fmt.Errorf("not a rekordbox database")
+	}
+	pageSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	tables := int(binary.LittleEndian.Uint32(data[8:12]))
+	if pageSize < 512 || pageSize > 65536 || tables == 0 || 0x1c+tables*16 > len(data) {
+		return nil, 0, fmt.Errorf("not a rekordbox database")
+	}
+
+	first, last, found := uint32(0), uint32(0), false
+	for i := 0; i < tables; i++ {
+		entry := data[0x1c+i*16:]
+		if binary.LittleEndian.Uint32(entry[0:4]) == pdbTableTracks {
+			first = binary.LittleEndian.Uint32(entry[8:12])
+			last = binary.LittleEndian.Uint32(entry[12:16])
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, 0, fmt.Errorf("no tracks table")
+	}
+
+	var paths []string
+	skipped := 0
+	visited := make(map[uint32]bool)
+	for index := first; !visited[index]; {
+		visited[index] = true
+		start := int64(index) * int64(pageSize)
+		if start+int64(pageSize) > int64(len(data)) {
+			return nil, 0, fmt.Errorf("page %d is past the end of the file", index)
+		}
+		page := data[start : start+int64(pageSize)]
+		// Index pages have flag 0x40 set; only data pages hold rows.
+		if binary.LittleEndian.Uint32(page[8:12]) == pdbTableTracks && page[0x1b]&0x40 == 0 {
+			pagePaths, pageSkipped := pdbPageTrackPaths(page)
+			paths = append(paths, pagePaths...)
+			skipped += pageSkipped
+		}
+		if index == last {
+			break
+		}
+		index = binary.LittleEndian.Uint32(page[12:16])
+	}
+	return paths, skipped, nil
+}
+
+// checkExport cross-references the tracks in a rekordbox export with the files
+// on the drive. Drives without an export are skipped.
+func checkExport(device string) {
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		return
+	}
+	exportPath := filepath.Join(mountPoint, "PIONEER", "rekordbox", "export.pdb")
+	if _, err := os.Stat(exportPath); err != nil {
+		return
+	}
+
+	fmt.Println()
+	title := "Rekordbox Export:"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+
+	tracks, skipped, err := readExportTrackPaths(exportPath)
+	if err != nil {
+		printError("Error reading export.pdb: %v", err)
+		return
+	}
+
+	// FAT and exFAT ignore case, so paths are matched without it.
+	files := make(map[string]bool)
+	audio := make(map[string]string)
+	audioBytes := make(map[string]int64)
+	err = filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if entry.IsDir() {
+			if rel != "." && (strings.HasPrefix(entry.Name(), ".") || containsFold(payloadMetadataFolders, strings.Split(filepath.ToSlash(rel), "/")[0])) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		key := strings.ToLower(filepath.ToSlash(rel))
+		files[key] = true
+		if !strings.HasPrefix(entry.Name(), ".") && payloadAudioExtensions[strings.ToLower(filepath.Ext(path))] {
+			audio[key] = filepath.ToSlash(rel)
+			if info, err := entry.Info(); err == nil {
+				audioBytes[key] = info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		printError("Error scanning %s: %v", mountPoint, err)
+		return
+	}
+
+	referenced := make(map[string]bool)
+	var missing []string
+	for _, track := range tracks {
+		rel := strings.TrimPrefix(track, "/")
+		key := strings.ToLower(rel)
+		if referenced[key] {
+			continue
+		}
+		referenced[key] = true
+		if !files[key] {
+			missing = append(missing, rel)
+		}
+	}
+	var unreferenced []string
+	var unreferencedBytes int64
+	for key, rel := range audio {
+		if !referenced[key] {
+			unreferenced = append(unreferenced, rel)
+			unreferencedBytes += audioBytes[key]
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unreferenced)
+
+	fmt.Printf("%d tracks in export.pdb, %d audio files on the drive\n", len(referenced), len(audio))
+	if skipped > 0 {
+		printWarning("%d track entries in export.pdb could not be read", skipped)
+	}
+	if len(missing) == 0 {
+		printOK("Every track in the export is on the drive.")
+	} else {
+		warn(device, warnFilesystem, "%d track(s) in the export are missing from the drive; players list them but cannot play them", len(missing))
+		printPathList(missing, 10)
+	}
+	if len(unreferenced) > 0 {
+		fmt.Printf("%d audio file(s) (%s) are not in the export, so players will not list them:\n", len(unreferenced), formatByteSize(unreferencedBytes))
+		printPathList(unreferenced, 10)
+	}
+	if len(missing) > 0 || len(unreferenced) > 0 {
+		fmt.Println("Export the drive again from rekordbox to bring the two back in step.")
+	}
+}
+
+// printPathList prints up to limit paths, indented.
+func printPathList(paths []string, limit int) {
+	for i, path := range paths {
+		if i == limit {
+			fmt.Printf("  ...and %d more\n", len(paths)-i)
+			return
+		}
+		fmt.Printf("  %s\n", path)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Policy holds the system-wide rules an administrator can set for every user
+// of the machine. Unlike config.json it lives outside the user's own folder.
+type Policy struct {
+	RequireVerify        bool     `json:"require_verify,omitempty"`
+	ForbiddenFilesystems []string `json:"forbidden_filesystems,omitempty"`
+	AllowedVendorIDs     []string `json:"allowed_vendor_ids,omitempty"`
+}
+
+func policyPath() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "/Library/Application Support/cdjf/policy.json"
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return filepath.Join(programData, "cdjf", "policy.json")
+	}
+	return "/etc/cdjf/policy.json"
+}
+
+// loadPolicy reads the policy file. A missing file means no restrictions; an
+// unreadable or invalid one is an error so a broken policy never fails open.
+func loadPolicy() (Policy, error) {
+	var policy Policy
+	path := policyPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, fmt.Errorf("unable to read policy file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	// A misspelled filesystem would otherwise forbid nothing.
+	for _, forbidden := range policy.ForbiddenFilesystems {
+		if _, err := normalizeFilesystem(forbidden); err != nil {
+			return policy, fmt.Errorf("invalid policy file %s: forbidden_filesystems: %w", path, err)
+		}
+	}
+	return policy, nil
+}
+
+// allowsFilesystem reports whether the policy permits creating filesystem.
+func (p Policy) allowsFilesystem(filesystem string) bool {
+	for _, forbidden := range p.ForbiddenFilesystems {
+		if normalized, _ := normalizeFilesystem(forbidden); normalized == filesystem {
+			return false
+		}
+	}
+	return true
+}
+
+// checkVendorPolicy refuses drives whose USB vendor is not allowed by policy.
+func checkVendorPolicy(device string) error {
+	policy, err := loadPolicy()
+	if err != nil {
+		return err
+	}
+	if len(policy.AllowedVendorIDs) == 0 {
+		return nil
+	}
+
+	vendorID := getDriveVendorID(device)
+	if vendorID == "" {
+		return fmt.Errorf("unable to read the USB vendor ID of %s, and the policy in %s only allows approved vendors", device, policyPath())
+	}
+	for _, allowed := range policy.AllowedVendorIDs {
+		allowed = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(allowed)), "0x")
+		if allowed == vendorID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s (USB vendor %s) is not an approved vendor in %s. Operation blocked by policy", device, vendorID, policyPath())
+}
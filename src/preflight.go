@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	preflightPass = "PASS"
+	preflightWarn = "WARN"
+	preflightFail = "FAIL"
+	preflightSkip = "SKIP"
+)
+
+// PreflightCheck is the outcome of one preflight test.
+type PreflightCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+func preflightDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	minFreeValue, _ := cmd.Flags().GetString("min-free")
+	reportValue, _ := cmd.Flags().GetString("report")
+	targetValue, _ := cmd.Flags().GetString("target")
+	profile, hasProfile := profileFromFlag(cmd)
+	thresholds := mergedBenchmarkThresholds(profile.BenchmarkThresholds)
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	reportFormat, err := normalizeReportFormat(reportValue)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if strings.TrimSpace(targetValue) == "" && hasProfile {
+		targetValue = profile.Target
+	}
+	target, err := lookupTarget(targetValue)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if len(profile.Scripts) > 0 {
+		target.Scripts = profile.Scripts
+		target.ScriptAdvice = ""
+	}
+
+	minFreeGB := 0.0
+	if strings.TrimSpace(minFreeValue) != "" {
+		minFreeGB = parseSizeToGB(strings.ToUpper(strings.TrimSpace(minFreeValue)))
+		if minFreeGB <= 0 {
+			printError("Error: invalid --min-free value %q; use a value such as 500MB or 2GB", minFreeValue)
+			os.Exit(1)
+		}
+	}
+
+	title := fmt.Sprintf("Preflight for %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+
+	checks, benchmark := runPreflightChecks(device, minFreeGB, thresholds, target)
+
+	fmt.Println()
+	printPreflightChecks(checks)
+	failures := preflightFailures(checks)
+	recordDriveCheck(device, "preflight", len(failures) == 0)
+
+	if reportFormat != "" {
+		report := newGigReport("preflight", "Preflight Report", device)
+		report.Checks = checks
+		report.Benchmark = benchmark
+		report.Passed = len(failures) == 0
+		if path, err := writeGigReport(report, reportFormat); err != nil {
+			printWarning("Unable to write report: %v", err)
+		} else {
+			fmt.Printf("\nReport saved to %s\n", path)
+		}
+	}
+
+	fmt.Println()
+	if len(failures) == 0 {
+		printOK("PREFLIGHT PASSED: %s is ready for the gig.", device)
+		return
+	}
+
+	fmt.Println(colorize(SeverityError, fmt.Sprintf("PREFLIGHT FAILED: %d problem(s) found on %s", len(failures), device)))
+	for _, failure := range failures {
+		fmt.Printf("  - %s\n", failure)
+	}
+	os.Exit(1)
+}
+
+func runPreflightChecks(device string, minFreeGB float64, thresholds BenchmarkThresholds, target Target) ([]PreflightCheck, BenchmarkResult) {
+	checks := []PreflightCheck{
+		preflightFilesystem(device),
+		preflightPartitions(device),
+		preflightDirtyBit(device),
+		preflightExport(device),
+		preflightScripts(device, target),
+		preflightFreeSpace(device, minFreeGB),
+		preflightKnownDrive(device),
+	}
+	fmt.Println("Running quick benchmark...")
+	speedCheck, benchmark := preflightBenchmark(device, thresholds)
+	return append(checks, speedCheck), benchmark
+}
+
+func printPreflightChecks(checks []PreflightCheck) {
+	for _, check := range checks {
+		line := fmt.Sprintf("[%s] %-12s %s", check.Status, check.Name, check.Detail)
+		switch check.Status {
+		case preflightPass:
+			fmt.Println(colorize(SeverityOK, line))
+		case preflightWarn:
+			fmt.Println(colorize(SeverityWarn, line))
+		case preflightFail:
+			fmt.Println(colorize(SeverityError, line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+func preflightFailures(checks []PreflightCheck) []string {
+	var failures []string
+	for _, check := range checks {
+		if check.Status == preflightFail {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.Name, check.Detail))
+		}
+	}
+	return failures
+}
+
+func preflightFilesystem(device string) PreflightCheck {
+	check := PreflightCheck{Name: "Filesystem"}
+	filesystem := getDriveFilesystem(device)
+	upper := strings.ToUpper(filesystem)
+	switch {
+	case filesystem == "" || strings.EqualFold(filesystem, "RAW"):
+		check.Status = preflightFail
+		check.Detail = "no readable filesystem (RAW); rebuild the drive with 'cdjf format'"
+	case filesystemCompatibilityWarning(filesystem) != "":
+		check.Status = preflightFail
+		check.Detail = filesystemCompatibilityWarning(filesystem)
+	case strings.Contains(upper, "FAT"):
+		check.Status = preflightPass
+		check.Detail = filesystem
+	default:
+		check.Status = preflightFail
+		check.Detail = fmt.Sprintf("%s is not readable by CDJ/XDJ players; use FAT32 or exFAT", filesystem)
+	}
+	return check
+}
+
+func preflightPartitions(device string) PreflightCheck {
+	check := PreflightCheck{Name: "Partitions"}
+	table, err := readPartitionTable(device)
+	if err != nil {
+		check.Status = preflightSkip
+		check.Detail = fmt.Sprintf("unable to read partition table (%v)", err)
+		return check
+	}
+
+	switch {
+	case table.Scheme != superfloppyScheme && len(table.Partitions) == 0:
+		check.Status = preflightFail
+		check.Detail = "no partitions found"
+	case table.Scheme == "GPT":
+		check.Status = preflightWarn
+		check.Detail = "GPT is not recognized by older players; MBR is safest"
+	case table.Scheme == superfloppyScheme:
+		check.Status = preflightWarn
+		check.Detail = "no partition table; some players will not mount the drive"
+	case len(table.Misaligned()) > 0:
+		check.Status = preflightWarn
+		check.Detail = "partitions are not 1 MiB aligned"
+	case len(table.Partitions) > 1:
+		check.Status = preflightWarn
+		check.Detail = fmt.Sprintf("%d partitions; players only read the first", len(table.Partitions))
+	default:
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("%s, %d partition", table.Scheme, len(table.Partitions))
+	}
+	return check
+}
+
+// dirtyBitSettleDelay is how long preflight waits before reading the dirty bit
+// of a mounted volume a second time.
+var dirtyBitSettleDelay = 5 * time.Second
+
+// preflightDirtyBit reads the dirty bit through a read-only open of the raw
+// device, so the volume stays mounted. macOS and Windows also set the bit
+// while they have writes to the volume outstanding and clear it once those
+// are flushed, so a mounted volume that reads dirty is read again after a
+// pause before the check fails.
+func preflightDirtyBit(device string) PreflightCheck {
+	check := PreflightCheck{Name: "Dirty bit"}
+	dirty, err := readVolumeDirty(device)
+	if err == nil && dirty {
+		if _, mountErr := getVolumeMountPoint(device); mountErr == nil {
+			time.Sleep(dirtyBitSettleDelay)
+			dirty, err = readVolumeDirty(device)
+		}
+	}
+	switch {
+	case err != nil:
+		check.Status = preflightSkip
+		check.Detail = fmt.Sprintf("unable to read filesystem (%v)", err)
+	case dirty:
+		check.Status = preflightFail
+		check.Detail = "volume was not ejected cleanly; repair it with Disk Utility First Aid (macOS) or chkdsk /f (Windows)"
+	default:
+		check.Status = preflightPass
+		check.Detail = "volume is clean"
+	}
+	return check
+}
+
+func preflightExport(device string) PreflightCheck {
+	check := PreflightCheck{Name: "Export"}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		check.Status = preflightFail
+		check.Detail = err.Error()
+		return check
+	}
+
+	exportPath := filepath.Join(mountPoint, "PIONEER", "rekordbox", "export.pdb")
+	info, err := os.Stat(exportPath)
+	switch {
+	case err != nil:
+		check.Status = preflightFail
+		check.Detail = "PIONEER/rekordbox/export.pdb not found; export your playlists from rekordbox"
+	case info.Size() == 0:
+		check.Status = preflightFail
+		check.Detail = "export.pdb is empty; re-export from rekordbox"
+	default:
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("export.pdb found (%.1f MB)", float64(info.Size())/(1024*1024))
+	}
+	return check
+}
+
+func preflightFreeSpace(device string, minFreeGB float64) PreflightCheck {
+	check := PreflightCheck{Name: "Free space"}
+	freeGB, ok := getDriveFreeSpace(device)
+	switch {
+	case !ok:
+		check.Status = preflightSkip
+		check.Detail = "unable to determine free space"
+	case freeGB < minFreeGB:
+		check.Status = preflightFail
+		check.Detail = fmt.Sprintf("%.2f GB free (at least %.2f GB required for history and recordings)", freeGB, minFreeGB)
+	default:
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("%.2f GB free", freeGB)
+	}
+	return check
+}
+
+func preflightKnownDrive(device string) PreflightCheck {
+	check := PreflightCheck{Name: "Known issues"}
+	model := getDriveModel(device)
+	issues := knownDriveIssues(device, model)
+	check.Status = preflightPass
+	check.Detail = "not in the known drive database"
+	for _, issue := range issues {
+		check.Detail = issue.Issue
+		if issue.Severity == knownDriveBad {
+			check.Status = preflightFail
+			break
+		}
+		check.Status = preflightWarn
+	}
+	return check
+}
+
+func preflightBenchmark(device string, thresholds BenchmarkThresholds) (PreflightCheck, BenchmarkResult) {
+	check := PreflightCheck{Name: "Speed"}
+	result := benchmarkDrive(device)
+	writeGrade, readGrade := writeRating(result, thresholds), readRating(result, thresholds)
+	switch {
+	case result.WriteMBps <= 0:
+		check.Status = preflightSkip
+		check.Detail = "unable to benchmark drive"
+	case writeGrade == "extremely slow" || readGrade == "extremely slow":
+		check.Status = preflightFail
+		check.Detail = fmt.Sprintf("write %.2f MB/s, read %.2f MB/s; the drive is too slow to trust", result.WriteMBps, result.ReadMBps)
+	case writeGrade != "" || readGrade != "":
+		check.Status = preflightWarn
+		check.Detail = fmt.Sprintf("write %.2f MB/s, read %.2f MB/s; slower than recommended", result.WriteMBps, result.ReadMBps)
+	default:
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("write %.2f MB/s, read %.2f MB/s", result.WriteMBps, result.ReadMBps)
+	}
+	return check, result
+}
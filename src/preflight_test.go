@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFAT32Image writes a superfloppy FAT32 image with just enough of a boot
+// sector and first FAT for the boot sector and dirty bit to be read.
+func writeFAT32Image(t *testing.T, dirty bool) string {
+	t.Helper()
+	const (
+		bytesPerSector  = 512
+		reservedSectors = 32
+	)
+	image := make([]byte, 64*1024)
+	copy(image[0:3], []byte{0xEB, 0x58, 0x90})
+	copy(image[3:11], "MSDOS5.0")
+	binary.LittleEndian.PutUint16(image[11:13], bytesPerSector)
+	image[13] = 8
+	binary.LittleEndian.PutUint16(image[14:16], reservedSectors)
+	image[16] = 2
+	image[21] = 0xF8
+	binary.LittleEndian.PutUint32(image[32:36], uint32(len(image)/bytesPerSector))
+	binary.LittleEndian.PutUint32(image[36:40], 1)
+	binary.LittleEndian.PutUint32(image[44:48], 2)
+	image[66] = 0x29
+	copy(image[71:82], "CDJ        ")
+	copy(image[82:90], "FAT32   ")
+	image[510], image[511] = 0x55, 0xAA
+
+	fat := image[reservedSectors*bytesPerSector:]
+	binary.LittleEndian.PutUint32(fat[0:4], 0x0FFFFFF8)
+	entry := uint32(0x0FFFFFFF)
+	if dirty {
+		entry &^= 0x08000000
+	}
+	binary.LittleEndian.PutUint32(fat[4:8], entry)
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPreflightDirtyBit(t *testing.T) {
+	previous := dirtyBitSettleDelay
+	dirtyBitSettleDelay = 0
+	t.Cleanup(func() { dirtyBitSettleDelay = previous })
+
+	tests := []struct {
+		name  string
+		image bool
+		dirty bool
+		want  string
+	}{
+		{"clean", true, false, preflightPass},
+		{"dirty", true, true, preflightFail},
+		{"no raw access", false, false, preflightSkip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drive := fakeDrive{Device: "disk9", SizeGB: 16, Filesystem: "FAT32", MountPoint: t.TempDir()}
+			if tt.image {
+				drive.Image = writeFAT32Image(t, tt.dirty)
+			}
+			useFakeDevices(t, drive)
+
+			check := preflightDirtyBit("disk9")
+			if check.Status != tt.want {
+				t.Errorf("status = %s (%s), want %s", check.Status, check.Detail, tt.want)
+			}
+		})
+	}
+}
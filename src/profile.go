@@ -16,13 +16,28 @@ type Profile struct {
 	Name                string               `json:"name,omitempty"`
 	Label               string               `json:"label,omitempty"`
 	ClusterSize         string               `json:"cluster_size,omitempty"`
+	Target              string               `json:"target,omitempty"`
+	VerifySizeMB        int                  `json:"verify_size_mb,omitempty"`
+	Payload             string               `json:"payload,omitempty"`
+	PayloadOrder        string               `json:"payload_order,omitempty"`
+	Scripts             []string             `json:"scripts,omitempty"`
+	ExpectSize          string               `json:"expect_size,omitempty"`
+	ExpectModel         string               `json:"expect_model,omitempty"`
+	SkipBenchmark       bool                 `json:"skip_benchmark,omitempty"`
+	BenchmarkSizeMB     int                  `json:"benchmark_size_mb,omitempty"`
 	BenchmarkThresholds *BenchmarkThresholds `json:"benchmark_thresholds,omitempty"`
 }
 
 type profileStore struct {
+	// Version is the file's format version, see profileSchemaVersion.
+	Version  int                `json:"version,omitempty"`
 	Profiles map[string]Profile `json:"profiles"`
 }
 
+// sharedProfilePath is set from --profile-path and points at a profiles file
+// (or a folder holding profiles.json) shared by a whole crew.
+var sharedProfilePath string
+
 func profileDisplayName(profile Profile, fallback string) string {
 	name := strings.TrimSpace(profile.Name)
 	if name != "" {
@@ -56,6 +71,18 @@ func mergedBenchmarkThresholds(custom *BenchmarkThresholds) BenchmarkThresholds
 	if custom.Prompt > 0 {
 		thresholds.Prompt = custom.Prompt
 	}
+	if custom.ReadExtremelySlow > 0 {
+		thresholds.ReadExtremelySlow = custom.ReadExtremelySlow
+	}
+	if custom.ReadVerySlow > 0 {
+		thresholds.ReadVerySlow = custom.ReadVerySlow
+	}
+	if custom.ReadSlightlySlow > 0 {
+		thresholds.ReadSlightlySlow = custom.ReadSlightlySlow
+	}
+	if custom.ReadPrompt > 0 {
+		thresholds.ReadPrompt = custom.ReadPrompt
+	}
 	return thresholds
 }
 
@@ -72,10 +99,19 @@ func validateBenchmarkThresholds(t BenchmarkThresholds) error {
 	if t.Prompt <= 0 {
 		return fmt.Errorf("prompt threshold must be greater than zero")
 	}
+	if t.ReadExtremelySlow <= 0 || t.ReadVerySlow <= 0 || t.ReadSlightlySlow <= 0 || t.ReadPrompt <= 0 {
+		return fmt.Errorf("read thresholds must be greater than zero")
+	}
+	if t.ReadExtremelySlow > t.ReadVerySlow {
+		return fmt.Errorf("read extremely slow threshold must be less than or equal to read very slow threshold")
+	}
+	if t.ReadVerySlow > t.ReadSlightlySlow {
+		return fmt.Errorf("read very slow threshold must be less than or equal to read slightly slow threshold")
+	}
 	return nil
 }
 
-func profileConfigPath() (string, error) {
+func configFilePath(name string) (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil || configDir == "" {
 		home, homeErr := os.UserHomeDir()
@@ -89,7 +125,11 @@ func profileConfigPath() (string, error) {
 	} else {
 		configDir = filepath.Join(configDir, "cdjf")
 	}
-	return filepath.Join(configDir, "profiles.json"), nil
+	return filepath.Join(configDir, name), nil
+}
+
+func profileConfigPath() (string, error) {
+	return configFilePath("profiles.json")
 }
 
 func loadProfileStore() (profileStore, error) {
@@ -97,7 +137,10 @@ func loadProfileStore() (profileStore, error) {
 	if err != nil {
 		return profileStore{}, err
 	}
+	return readProfileStore(path)
+}
 
+func readProfileStore(path string) (profileStore, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -106,10 +149,15 @@ func loadProfileStore() (profileStore, error) {
 		return profileStore{}, err
 	}
 
-	var store profileStore
-	if err := json.Unmarshal(data, &store); err != nil {
+	data, err = migrateConfigData(path, data, profileSchemaVersion, profileMigrations)
+	if err != nil {
 		return profileStore{}, err
 	}
+
+	var store profileStore
+	if err := decodeConfigJSON(data, &store, false); err != nil {
+		return profileStore{}, fmt.Errorf("invalid profiles file %s: %w", path, err)
+	}
 	if store.Profiles == nil {
 		store.Profiles = make(map[string]Profile)
 	}
@@ -124,6 +172,7 @@ func saveProfileStore(store profileStore) error {
 	if store.Profiles == nil {
 		store.Profiles = make(map[string]Profile)
 	}
+	store.Version = profileSchemaVersion
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
@@ -134,36 +183,123 @@ func saveProfileStore(store profileStore) error {
 	return os.WriteFile(path, data, 0o600)
 }
 
+// sharedProfileStorePath returns the shared profiles file named by
+// --profile-path or CDJF_PROFILE_PATH, or "" when none is configured.
+func sharedProfileStorePath() string {
+	path := strings.TrimSpace(sharedProfilePath)
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("CDJF_PROFILE_PATH"))
+	}
+	if path == "" {
+		return ""
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, "profiles.json")
+	}
+	return path
+}
+
+// loadAllProfiles merges the shared profiles with the user's own. A personal
+// profile with the same name takes precedence. The returned set names the
+// profiles that came from the shared store.
+func loadAllProfiles() (map[string]Profile, map[string]bool, error) {
+	store, err := loadProfileStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	path := sharedProfileStorePath()
+	if path == "" {
+		return store.Profiles, nil, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		// A network share may be offline while touring; fall back to the
+		// personal profiles rather than stopping.
+		printWarning("Shared profiles unavailable at %s; using personal profiles only", path)
+		return store.Profiles, nil, nil
+	}
+	shared, err := readProfileStore(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("shared profiles %s: %w", path, err)
+	}
+
+	profiles := make(map[string]Profile, len(shared.Profiles)+len(store.Profiles))
+	fromShared := make(map[string]bool, len(shared.Profiles))
+	for key, profile := range shared.Profiles {
+		key = strings.ToLower(strings.TrimSpace(key))
+		profiles[key] = profile
+		fromShared[key] = true
+	}
+	for key, profile := range store.Profiles {
+		profiles[key] = profile
+		delete(fromShared, key)
+	}
+	return profiles, fromShared, nil
+}
+
+// profileFromFlag loads the profile named by a command's --profile flag and
+// reports whether one was given.
+func profileFromFlag(cmd *cobra.Command) (Profile, bool) {
+	name, _ := cmd.Flags().GetString("profile")
+	if strings.TrimSpace(name) == "" {
+		return Profile{}, false
+	}
+	profile, err := loadProfileByName(name)
+	if err != nil {
+		printError("Error loading profile %q: %v", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Applying profile %q\n", profileDisplayName(profile, name))
+	return profile, true
+}
+
+// thresholdsFromFlag returns the benchmark thresholds of the profile named by
+// --profile, or the defaults.
+func thresholdsFromFlag(cmd *cobra.Command) BenchmarkThresholds {
+	profile, ok := profileFromFlag(cmd)
+	if !ok {
+		return defaultBenchmarkThresholds
+	}
+	return mergedBenchmarkThresholds(profile.BenchmarkThresholds)
+}
+
 func loadProfileByName(name string) (Profile, error) {
+	profile, _, err := findProfile(name)
+	return profile, err
+}
+
+// findProfile looks a profile up in the merged stores and reports whether it
+// came from the shared store.
+func findProfile(name string) (Profile, bool, error) {
 	key, err := profileMapKey(name)
 	if err != nil {
-		return Profile{}, err
+		return Profile{}, false, err
 	}
-	store, err := loadProfileStore()
+	profiles, shared, err := loadAllProfiles()
 	if err != nil {
-		return Profile{}, err
+		return Profile{}, false, err
 	}
-	profile, ok := store.Profiles[key]
+	profile, ok := profiles[key]
 	if !ok {
-		return Profile{}, fmt.Errorf("profile %q not found", strings.TrimSpace(name))
+		return Profile{}, false, fmt.Errorf("profile %q not found", strings.TrimSpace(name))
 	}
 	if strings.TrimSpace(profile.Name) == "" {
 		profile.Name = strings.TrimSpace(name)
 	}
-	return profile, nil
+	return profile, shared[key], nil
 }
 
 func profileSave(cmd *cobra.Command, args []string) {
 	name := args[0]
 	key, err := profileMapKey(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 
 	store, err := loadProfileStore()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
+		printError("Error loading profiles: %v", err)
 		os.Exit(1)
 	}
 
@@ -172,14 +308,28 @@ func profileSave(cmd *cobra.Command, args []string) {
 
 	labelChanged := cmd.Flags().Changed("label")
 	clusterChanged := cmd.Flags().Changed("cluster-size")
+	targetChanged := cmd.Flags().Changed("target")
+	verifySizeChanged := cmd.Flags().Changed("verify-size")
+	payloadChanged := cmd.Flags().Changed("payload")
+	payloadOrderChanged := cmd.Flags().Changed("payload-order")
+	scriptsChanged := cmd.Flags().Changed("scripts")
+	expectSizeChanged := cmd.Flags().Changed("expect-size")
+	expectModelChanged := cmd.Flags().Changed("expect-model")
+	skipBenchChanged := cmd.Flags().Changed("skip-benchmark")
+	benchSizeChanged := cmd.Flags().Changed("benchmark-size")
 	extChanged := cmd.Flags().Changed("extremely-slow")
 	veryChanged := cmd.Flags().Changed("very-slow")
 	slightChanged := cmd.Flags().Changed("slightly-slow")
 	promptChanged := cmd.Flags().Changed("prompt")
+	readFlags := []string{"read-extremely-slow", "read-very-slow", "read-slightly-slow", "read-prompt"}
+	readChanged := false
+	for _, flag := range readFlags {
+		readChanged = readChanged || cmd.Flags().Changed(flag)
+	}
 	resetBench, _ := cmd.Flags().GetBool("reset-benchmarks")
 
-	if !labelChanged && !clusterChanged && !extChanged && !veryChanged && !slightChanged && !promptChanged && !resetBench {
-		fmt.Fprintln(os.Stderr, "Specify at least one option to save (e.g. --label, --cluster-size, or a threshold flag).")
+	if !labelChanged && !clusterChanged && !targetChanged && !verifySizeChanged && !payloadChanged && !payloadOrderChanged && !scriptsChanged && !expectSizeChanged && !expectModelChanged && !skipBenchChanged && !benchSizeChanged && !extChanged && !veryChanged && !slightChanged && !promptChanged && !readChanged && !resetBench {
+		printError("Specify at least one option to save (e.g. --label, --cluster-size, or a threshold flag).")
 		os.Exit(1)
 	}
 
@@ -195,16 +345,117 @@ func profileSave(cmd *cobra.Command, args []string) {
 		value, _ := cmd.Flags().GetString("cluster-size")
 		normalized, normErr := normalizeClusterSize(value)
 		if normErr != nil {
-			fmt.Fprintf(os.Stderr, "Invalid cluster size: %v\n", normErr)
+			printError("Invalid cluster size: %v", normErr)
 			os.Exit(1)
 		}
 		profile.ClusterSize = normalized
 		changed = true
 	}
 
+	if targetChanged {
+		value, _ := cmd.Flags().GetString("target")
+		value = strings.TrimSpace(value)
+		if value != "" {
+			target, targetErr := lookupTarget(value)
+			if targetErr != nil {
+				printError("Invalid target: %v", targetErr)
+				os.Exit(1)
+			}
+			value = target.Name
+		}
+		profile.Target = value
+		changed = true
+	}
+
+	if verifySizeChanged {
+		value, _ := cmd.Flags().GetInt("verify-size")
+		if value < 0 {
+			printError("--verify-size cannot be negative.")
+			os.Exit(1)
+		}
+		profile.VerifySizeMB = value
+		changed = true
+	}
+
+	if skipBenchChanged {
+		profile.SkipBenchmark, _ = cmd.Flags().GetBool("skip-benchmark")
+		changed = true
+	}
+
+	if benchSizeChanged {
+		value, _ := cmd.Flags().GetInt("benchmark-size")
+		if value < 0 {
+			printError("--benchmark-size cannot be negative.")
+			os.Exit(1)
+		}
+		profile.BenchmarkSizeMB = value
+		changed = true
+	}
+
+	if payloadChanged {
+		value, _ := cmd.Flags().GetString("payload")
+		value = strings.TrimSpace(value)
+		if value != "" {
+			abs, absErr := filepath.Abs(value)
+			if absErr != nil {
+				printError("Invalid payload folder: %v", absErr)
+				os.Exit(1)
+			}
+			if info, statErr := os.Stat(abs); statErr != nil || !info.IsDir() {
+				printError("Payload must be an existing folder: %s", abs)
+				os.Exit(1)
+			}
+			value = abs
+		}
+		profile.Payload = value
+		changed = true
+	}
+
+	if payloadOrderChanged {
+		value, _ := cmd.Flags().GetString("payload-order")
+		order, err := normalizePayloadOrder(value)
+		if err != nil {
+			printError("%v", err)
+			os.Exit(1)
+		}
+		// The default is not stored, so profiles stay unchanged for older versions.
+		if order == payloadOrderMetadataFirst {
+			order = ""
+		}
+		profile.PayloadOrder = order
+		changed = true
+	}
+
+	if scriptsChanged {
+		values, _ := cmd.Flags().GetStringSlice("scripts")
+		scripts, err := normalizeScripts(values)
+		if err != nil {
+			printError("%v", err)
+			os.Exit(1)
+		}
+		profile.Scripts = scripts
+		changed = true
+	}
+
+	if expectSizeChanged {
+		value, _ := cmd.Flags().GetString("expect-size")
+		if _, err := parseSizeRange(value); err != nil {
+			printError("%v", err)
+			os.Exit(1)
+		}
+		profile.ExpectSize = strings.TrimSpace(value)
+		changed = true
+	}
+
+	if expectModelChanged {
+		value, _ := cmd.Flags().GetString("expect-model")
+		profile.ExpectModel = strings.Join(strings.Fields(value), " ")
+		changed = true
+	}
+
 	if resetBench {
-		if extChanged || veryChanged || slightChanged || promptChanged {
-			fmt.Fprintln(os.Stderr, "Cannot adjust benchmark thresholds while --reset-benchmarks is provided.")
+		if extChanged || veryChanged || slightChanged || promptChanged || readChanged {
+			printError("Cannot adjust benchmark thresholds while --reset-benchmarks is provided.")
 			os.Exit(1)
 		}
 		if profile.BenchmarkThresholds != nil {
@@ -218,7 +469,7 @@ func profileSave(cmd *cobra.Command, args []string) {
 		if extChanged {
 			value, _ := cmd.Flags().GetFloat64("extremely-slow")
 			if value <= 0 {
-				fmt.Fprintln(os.Stderr, "--extremely-slow must be greater than zero.")
+				printError("--extremely-slow must be greater than zero.")
 				os.Exit(1)
 			}
 			thresholds.ExtremelySlow = value
@@ -227,7 +478,7 @@ func profileSave(cmd *cobra.Command, args []string) {
 		if veryChanged {
 			value, _ := cmd.Flags().GetFloat64("very-slow")
 			if value <= 0 {
-				fmt.Fprintln(os.Stderr, "--very-slow must be greater than zero.")
+				printError("--very-slow must be greater than zero.")
 				os.Exit(1)
 			}
 			thresholds.VerySlow = value
@@ -236,7 +487,7 @@ func profileSave(cmd *cobra.Command, args []string) {
 		if slightChanged {
 			value, _ := cmd.Flags().GetFloat64("slightly-slow")
 			if value <= 0 {
-				fmt.Fprintln(os.Stderr, "--slightly-slow must be greater than zero.")
+				printError("--slightly-slow must be greater than zero.")
 				os.Exit(1)
 			}
 			thresholds.SlightlySlow = value
@@ -245,24 +496,32 @@ func profileSave(cmd *cobra.Command, args []string) {
 		if promptChanged {
 			value, _ := cmd.Flags().GetFloat64("prompt")
 			if value <= 0 {
-				fmt.Fprintln(os.Stderr, "--prompt must be greater than zero.")
+				printError("--prompt must be greater than zero.")
 				os.Exit(1)
 			}
 			thresholds.Prompt = value
 			thresholdChanged = true
 		}
+		readValues := []*float64{&thresholds.ReadExtremelySlow, &thresholds.ReadVerySlow, &thresholds.ReadSlightlySlow, &thresholds.ReadPrompt}
+		for i, flag := range readFlags {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			value, _ := cmd.Flags().GetFloat64(flag)
+			if value <= 0 {
+				printError("--%s must be greater than zero.", flag)
+				os.Exit(1)
+			}
+			*readValues[i] = value
+			thresholdChanged = true
+		}
 
 		if thresholdChanged {
 			if err := validateBenchmarkThresholds(thresholds); err != nil {
-				fmt.Fprintf(os.Stderr, "Invalid benchmark thresholds: %v\n", err)
+				printError("Invalid benchmark thresholds: %v", err)
 				os.Exit(1)
 			}
-			profile.BenchmarkThresholds = &BenchmarkThresholds{
-				ExtremelySlow: thresholds.ExtremelySlow,
-				VerySlow:      thresholds.VerySlow,
-				SlightlySlow:  thresholds.SlightlySlow,
-				Prompt:        thresholds.Prompt,
-			}
+			profile.BenchmarkThresholds = &thresholds
 			changed = true
 		}
 	}
@@ -274,7 +533,7 @@ func profileSave(cmd *cobra.Command, args []string) {
 
 	store.Profiles[key] = profile
 	if err := saveProfileStore(store); err != nil {
-		fmt.Fprintf(os.Stderr, "Error saving profile: %v\n", err)
+		printError("Error saving profile: %v", err)
 		os.Exit(1)
 	}
 
@@ -282,20 +541,24 @@ func profileSave(cmd *cobra.Command, args []string) {
 }
 
 func profileList(cmd *cobra.Command, args []string) {
-	store, err := loadProfileStore()
+	profiles, shared, err := loadAllProfiles()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
+		printError("Error loading profiles: %v", err)
 		os.Exit(1)
 	}
 
-	if len(store.Profiles) == 0 {
+	if len(profiles) == 0 {
 		fmt.Println("No profiles saved yet.")
 		return
 	}
 
-	names := make([]string, 0, len(store.Profiles))
-	for key, profile := range store.Profiles {
-		names = append(names, profileDisplayName(profile, key))
+	names := make([]string, 0, len(profiles))
+	for key, profile := range profiles {
+		name := profileDisplayName(profile, key)
+		if shared[key] {
+			name += " (shared)"
+		}
+		names = append(names, name)
 	}
 	sort.Strings(names)
 
@@ -307,14 +570,17 @@ func profileList(cmd *cobra.Command, args []string) {
 
 func profileShow(cmd *cobra.Command, args []string) {
 	name := args[0]
-	profile, err := loadProfileByName(name)
+	profile, shared, err := findProfile(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 
 	display := profileDisplayName(profile, name)
 	fmt.Printf("Profile %q\n", display)
+	if shared {
+		fmt.Printf("Source: %s (shared)\n", sharedProfileStorePath())
+	}
 
 	if strings.TrimSpace(profile.Label) != "" {
 		fmt.Printf("Label: %s\n", profile.Label)
@@ -328,6 +594,53 @@ func profileShow(cmd *cobra.Command, args []string) {
 		fmt.Println("Cluster size: (default)")
 	}
 
+	if strings.TrimSpace(profile.Target) != "" {
+		fmt.Printf("Target: %s\n", profile.Target)
+	} else {
+		fmt.Println("Target: (default)")
+	}
+
+	if len(profile.Scripts) > 0 {
+		fmt.Printf("Scripts: %s\n", strings.Join(profile.Scripts, ", "))
+	} else {
+		fmt.Println("Scripts: (target default)")
+	}
+
+	if expected, err := parseSizeRange(profile.ExpectSize); err == nil && !expected.IsZero() {
+		fmt.Printf("Expected size: %s\n", expected)
+	} else {
+		fmt.Println("Expected size: (any)")
+	}
+
+	if profile.ExpectModel != "" {
+		fmt.Printf("Expected model: %s\n", profile.ExpectModel)
+	} else {
+		fmt.Println("Expected model: (any)")
+	}
+
+	if profile.VerifySizeMB > 0 {
+		fmt.Printf("Verify size: %d MB\n", profile.VerifySizeMB)
+	} else {
+		fmt.Println("Verify size: (default)")
+	}
+
+	switch {
+	case profile.SkipBenchmark:
+		fmt.Println("Pre-format benchmark: skipped")
+	case profile.BenchmarkSizeMB > 0:
+		fmt.Printf("Pre-format benchmark: up to %d MB\n", profile.BenchmarkSizeMB)
+	default:
+		fmt.Println("Pre-format benchmark: (default)")
+	}
+
+	if strings.TrimSpace(profile.Payload) != "" {
+		fmt.Printf("Payload: %s\n", profile.Payload)
+		order, _ := normalizePayloadOrder(profile.PayloadOrder)
+		fmt.Printf("Payload order: %s\n", order)
+	} else {
+		fmt.Println("Payload: (none)")
+	}
+
 	thresholds := mergedBenchmarkThresholds(profile.BenchmarkThresholds)
 	if profile.BenchmarkThresholds == nil {
 		fmt.Println("Benchmark thresholds: default")
@@ -338,31 +651,39 @@ func profileShow(cmd *cobra.Command, args []string) {
 	fmt.Printf("  Very slow: %.2f MB/s\n", thresholds.VerySlow)
 	fmt.Printf("  Slightly slow: %.2f MB/s\n", thresholds.SlightlySlow)
 	fmt.Printf("  Prompt: %.2f MB/s\n", thresholds.Prompt)
+	fmt.Printf("  Read extremely slow: %.2f MB/s\n", thresholds.ReadExtremelySlow)
+	fmt.Printf("  Read very slow: %.2f MB/s\n", thresholds.ReadVerySlow)
+	fmt.Printf("  Read slightly slow: %.2f MB/s\n", thresholds.ReadSlightlySlow)
+	fmt.Printf("  Read prompt: %.2f MB/s\n", thresholds.ReadPrompt)
 }
 
 func profileDelete(cmd *cobra.Command, args []string) {
 	name := args[0]
 	key, err := profileMapKey(name)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printError("Error: %v", err)
 		os.Exit(1)
 	}
 
 	store, err := loadProfileStore()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
+		printError("Error loading profiles: %v", err)
 		os.Exit(1)
 	}
 
 	profile, exists := store.Profiles[key]
 	if !exists {
-		fmt.Fprintf(os.Stderr, "Profile %q not found.\n", strings.TrimSpace(name))
+		if _, shared, err := loadAllProfiles(); err == nil && shared[key] {
+			printError("Profile %q is shared from %s and can only be changed there.", strings.TrimSpace(name), sharedProfileStorePath())
+			os.Exit(1)
+		}
+		printError("Profile %q not found.", strings.TrimSpace(name))
 		os.Exit(1)
 	}
 
 	delete(store.Profiles, key)
 	if err := saveProfileStore(store); err != nil {
-		fmt.Fprintf(os.Stderr, "Error deleting profile: %v\n", err)
+		printError("Error deleting profile: %v", err)
 		os.Exit(1)
 	}
 
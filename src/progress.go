@@ -2,36 +2,175 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	progressFilledGlyph   = "="
+	progressUnfilledGlyph = "-"
+	progressMaxBarWidth   = 30
+	progressMinBarWidth   = 10
+	// progressSuffixWidth covers the label, brackets, percentage, speed, and ETA.
+	progressSuffixWidth = 48
+)
+
+// stallTimeout is how long a progress bar may go without progress before the
+// drive is reported as stalled; zero turns the watchdog off. It is set from
+// --stall-timeout.
+var stallTimeout = 30 * time.Second
+
 // ProgressBar renders a simple textual progress indicator with speed + ETA metrics.
 type ProgressBar struct {
-	label      string
-	total      int64
-	current    int64
-	start      time.Time
-	width      int
-	lastRender time.Time
-	completed  bool
+	mu          sync.Mutex
+	label       string
+	total       int64
+	current     int64
+	start       time.Time
+	lastRender  time.Time
+	lastLine    string
+	lastPercent int
+	interactive bool
+	completed   bool
+
+	// lastProgress is when current last grew, and stallWarnings counts the
+	// stall warnings printed since then.
+	lastProgress  time.Time
+	stallWarnings int
+	done          chan struct{}
 }
 
 func NewProgressBar(label string, total int64) *ProgressBar {
 	pb := &ProgressBar{
-		label: label,
-		total: total,
-		start: time.Now(),
-		width: 30,
+		label:       label,
+		total:       total,
+		start:       time.Now(),
+		lastPercent: -1,
+		interactive: isTerminal(os.Stdout),
+		done:        make(chan struct{}),
 	}
+	pb.lastProgress = pb.start
 	pb.render(true)
+	if stallTimeout > 0 {
+		go pb.watch(stallTimeout)
+	}
 	return pb
 }
 
+// watch warns while the bar makes no progress for longer than timeout, since
+// a dying stick can hang a write or read forever without returning an error.
+func (pb *ProgressBar) watch(timeout time.Duration) {
+	interval := timeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pb.done:
+			return
+		case <-ticker.C:
+		}
+
+		pb.mu.Lock()
+		stalled := time.Since(pb.lastProgress)
+		// A full bar is waiting on a flush or a final check, not the drive.
+		waiting := pb.total > 0 && pb.current >= pb.total
+		if !pb.completed && !waiting && stalled >= timeout*time.Duration(pb.stallWarnings+1) {
+			pb.stallWarnings++
+			pb.breakLine()
+			printWarning("%s appears stalled: no progress for %s.", pb.label, stalled.Round(time.Second))
+			if pb.stallWarnings == 1 {
+				recordWarning("", warnStall, fmt.Sprintf("%s stalled for at least %s", pb.label, stalled.Round(time.Second)))
+				fmt.Fprintln(consoleOut, "   The drive may be failing. Press Ctrl+C to abort, or keep waiting in case it recovers.")
+			}
+			pb.render(true)
+		}
+		pb.mu.Unlock()
+	}
+}
+
+// progressed records that current grew, reporting recovery from a stall.
+func (pb *ProgressBar) progressed() {
+	if pb.stallWarnings > 0 {
+		pb.breakLine()
+		fmt.Fprintf(consoleOut, "   %s resumed after %s without progress.\n", pb.label, time.Since(pb.lastProgress).Round(time.Second))
+		pb.stallWarnings = 0
+	}
+	pb.lastProgress = time.Now()
+}
+
+// breakLine ends the progress line being drawn so a message can be printed
+// below it; the next render starts a fresh line.
+func (pb *ProgressBar) breakLine() {
+	if pb.interactive && pb.lastLine != "" {
+		terminal.finishLine()
+		pb.lastLine = ""
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBarWidth sizes the bar so the whole progress line fits the terminal.
+func progressBarWidth(columns int) int {
+	width := columns - progressSuffixWidth
+	if width > progressMaxBarWidth {
+		width = progressMaxBarWidth
+	}
+	if width < progressMinBarWidth {
+		width = progressMinBarWidth
+	}
+	return width
+}
+
+// renderBar draws the bar body for a completion fraction between 0 and 1.
+func renderBar(fraction float64, width int) string {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * float64(width))
+	if filled > width {
+		filled = width
+	}
+	return strings.Repeat(progressFilledGlyph, filled) + strings.Repeat(progressUnfilledGlyph, width-filled)
+}
+
+// progressStep is the percentage shown without a terminal: the completion
+// fraction rounded down to a 10% step.
+func progressStep(fraction float64) int {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return int(fraction*10) * 10
+}
+
 func (pb *ProgressBar) Add(n int64) {
-	if pb == nil || pb.completed {
+	if pb == nil {
 		return
 	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.completed {
+		return
+	}
+	if n > 0 {
+		pb.progressed()
+	}
 	pb.current += n
 	if pb.total > 0 && pb.current > pb.total {
 		pb.current = pb.total
@@ -40,9 +179,17 @@ func (pb *ProgressBar) Add(n int64) {
 }
 
 func (pb *ProgressBar) Set(n int64) {
-	if pb == nil || pb.completed {
+	if pb == nil {
 		return
 	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.completed {
+		return
+	}
+	if n > pb.current {
+		pb.progressed()
+	}
 	pb.current = n
 	if pb.total > 0 {
 		if pb.current < 0 {
@@ -56,28 +203,49 @@ func (pb *ProgressBar) Set(n int64) {
 }
 
 func (pb *ProgressBar) Finish() {
-	if pb == nil || pb.completed {
+	if pb == nil {
+		return
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.completed {
 		return
 	}
 	if pb.total > 0 && pb.current < pb.total {
 		pb.current = pb.total
 	}
 	pb.render(true)
-	fmt.Print("\n")
-	pb.completed = true
+	pb.end()
 }
 
 func (pb *ProgressBar) Stop() {
-	if pb == nil || pb.completed {
+	if pb == nil {
+		return
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.completed {
 		return
 	}
 	pb.render(true)
-	fmt.Print("\n")
+	pb.end()
+}
+
+func (pb *ProgressBar) end() {
+	if pb.interactive {
+		terminal.finishLine()
+	}
 	pb.completed = true
+	close(pb.done)
 }
 
 func (pb *ProgressBar) UpdateTotal(total int64) {
-	if pb == nil || pb.completed || total <= 0 {
+	if pb == nil {
+		return
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.completed || total <= 0 {
 		return
 	}
 	pb.total = total
@@ -96,7 +264,6 @@ func (pb *ProgressBar) render(force bool) {
 	if !force && !pb.lastRender.IsZero() && now.Sub(pb.lastRender) < 100*time.Millisecond {
 		return
 	}
-	pb.lastRender = now
 
 	percent := 0.0
 	if pb.total > 0 {
@@ -106,16 +273,6 @@ func (pb *ProgressBar) render(force bool) {
 		}
 	}
 
-	filled := int(percent * float64(pb.width))
-	if filled > pb.width {
-		filled = pb.width
-	}
-
-	bar := strings.Repeat("=", filled)
-	if filled < pb.width {
-		bar += strings.Repeat("=", pb.width-filled)
-	}
-
 	speedMB := 0.0
 	eta := "ETA --:--"
 
@@ -133,7 +290,37 @@ func (pb *ProgressBar) render(force bool) {
 		}
 	}
 
-	fmt.Printf("\r%-10s [%s] %6.2f%% %6.2f MB/s %s", pb.label, bar, percent*100, speedMB, eta)
+	if !pb.interactive {
+		// Without a terminal, carriage returns pile up in logs; print a plain
+		// line at each 10% step instead.
+		step := progressStep(percent)
+		if step == pb.lastPercent {
+			return
+		}
+		pb.lastPercent = step
+		pb.lastRender = now
+		fmt.Fprintf(consoleOut, "%s: %d%% (%.2f MB/s)\n", pb.label, step, speedMB)
+		return
+	}
+
+	columns := terminalWidth()
+	bar := renderBar(percent, progressBarWidth(columns))
+	line := fmt.Sprintf("%-10s [%s] %6.2f%% %6.2f MB/s %s", pb.label, bar, percent*100, speedMB, eta)
+	if len(line) >= columns {
+		line = line[:columns-1]
+	}
+	if line == pb.lastLine {
+		return
+	}
+
+	// Pad over any leftover characters from a longer line drawn before a resize.
+	padding := ""
+	if len(pb.lastLine) > len(line) && len(pb.lastLine) < columns {
+		padding = strings.Repeat(" ", len(pb.lastLine)-len(line))
+	}
+	pb.lastLine = line
+	pb.lastRender = now
+	terminal.redraw(line + padding)
 }
 
 func formatDuration(d time.Duration) string {
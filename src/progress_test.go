@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProgressBarWidth(t *testing.T) {
+	tests := []struct {
+		columns int
+		want    int
+	}{
+		{0, progressMinBarWidth},
+		{20, progressMinBarWidth},
+		{progressSuffixWidth + progressMinBarWidth - 1, progressMinBarWidth},
+		{progressSuffixWidth + progressMinBarWidth, progressMinBarWidth},
+		{progressSuffixWidth + 20, 20},
+		{progressSuffixWidth + progressMaxBarWidth, progressMaxBarWidth},
+		{80, progressMaxBarWidth},
+		{300, progressMaxBarWidth},
+	}
+	for _, tt := range tests {
+		if got := progressBarWidth(tt.columns); got != tt.want {
+			t.Errorf("progressBarWidth(%d) = %d, want %d", tt.columns, got, tt.want)
+		}
+	}
+}
+
+func TestRenderBar(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		width    int
+		want     string
+	}{
+		{0, 10, "----------"},
+		{0.05, 10, "----------"},
+		{0.1, 10, "=---------"},
+		{0.5, 10, "=====-----"},
+		{0.99, 10, "=========-"},
+		{1, 10, "=========="},
+		{-0.5, 10, "----------"},
+		{1.5, 10, "=========="},
+		{0.5, 1, "-"},
+		{1, 1, "="},
+		{0.5, 0, ""},
+		{0.25, 30, strings.Repeat("=", 7) + strings.Repeat("-", 23)},
+	}
+	for _, tt := range tests {
+		got := renderBar(tt.fraction, tt.width)
+		if got != tt.want {
+			t.Errorf("renderBar(%v, %d) = %q, want %q", tt.fraction, tt.width, got, tt.want)
+		}
+		if len(got) != tt.width {
+			t.Errorf("renderBar(%v, %d) is %d wide", tt.fraction, tt.width, len(got))
+		}
+	}
+}
+
+func TestRenderBarFitsTerminal(t *testing.T) {
+	for _, columns := range []int{10, 40, 58, 80, 120, 300} {
+		width := progressBarWidth(columns)
+		if got := len(renderBar(0.5, width)); got != width {
+			t.Errorf("%d columns: bar is %d wide, want %d", columns, got, width)
+		}
+	}
+}
+
+func TestProgressStep(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		want     int
+	}{
+		{0, 0},
+		{0.05, 0},
+		{0.0999, 0},
+		{0.1, 10},
+		{0.15, 10},
+		{0.5, 50},
+		{0.8999, 80},
+		{0.9, 90},
+		{0.999, 90},
+		{1, 100},
+		{-1, 0},
+		{2, 100},
+	}
+	for _, tt := range tests {
+		if got := progressStep(tt.fraction); got != tt.want {
+			t.Errorf("progressStep(%v) = %d, want %d", tt.fraction, got, tt.want)
+		}
+	}
+}
+
+func TestProgressStepsAreTenPercentApart(t *testing.T) {
+	var steps []int
+	last := -1
+	for i := 0; i <= 1000; i++ {
+		if step := progressStep(float64(i) / 1000); step != last {
+			steps = append(steps, step)
+			last = step
+		}
+	}
+	want := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	if len(steps) != len(want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Fatalf("steps = %v, want %v", steps, want)
+		}
+	}
+}
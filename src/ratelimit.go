@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RateLimiter is a token bucket that caps IO throughput in bytes per second.
+// A nil *RateLimiter does not limit anything.
+type RateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(bytesPerSecond float64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	// Allow a quarter second of burst so 1 MB chunks flow smoothly at low rates.
+	burst := bytesPerSecond / 4
+	return &RateLimiter{rate: bytesPerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until n bytes may be transferred.
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / l.rate * float64(time.Second)))
+	}
+}
+
+// parseRateLimit parses values such as 20MB/s, 500KB/s, or 1.5GB/s into bytes per second.
+func parseRateLimit(value string) (float64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	if trimmed == "" {
+		return 0, nil
+	}
+	trimmed = strings.TrimSuffix(trimmed, "/S")
+	trimmed = strings.TrimSuffix(trimmed, "PS")
+
+	rate, err := parseByteSize(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit %q; use a value such as 20MB/s", value)
+	}
+	return float64(rate), nil
+}
@@ -0,0 +1,92 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openVolumeForWrite unmounts the disk and opens the raw device positioned at
+// the first filesystem so its reserved sectors can be rewritten.
+func openVolumeForWrite(device string) (*os.File, int64, error) {
+	if activeFakeBackend() != nil {
+		return nil, 0, fmt.Errorf("raw writes are not available for fake drive %s", device)
+	}
+	defer forgetDriveInfo()
+	table, err := readPartitionTable(device)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset, err := firstVolumeOffset(table)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	disk := wholeDiskIdentifier(device)
+	unmountCmd := execCommand("diskutil", "unmountDisk", disk)
+	if output, err := unmountCmd.CombinedOutput(); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+	}
+
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, 0, fmt.Errorf("writing %s requires administrator privileges (try sudo)", path)
+		}
+		return nil, 0, err
+	}
+	return file, offset, nil
+}
+
+func releaseVolume(device string) error {
+	defer forgetDriveInfo()
+	mountCmd := execCommand("diskutil", "mountDisk", wholeDiskIdentifier(device))
+	if output, err := mountCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remount: %v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// openDiskForWrite unmounts every volume on the disk and opens the whole raw
+// device for writing. The release function remounts the disk.
+func openDiskForWrite(device string) (*os.File, func() error, error) {
+	if activeFakeBackend() != nil {
+		return nil, nil, fmt.Errorf("raw writes are not available for fake drive %s", device)
+	}
+	defer forgetDriveInfo()
+	path, err := rawDevicePath(device)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disk := wholeDiskIdentifier(device)
+	unmountCmd := execCommand("diskutil", "unmountDisk", disk)
+	if output, err := unmountCmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmount: %v\nOutput: %s", err, output)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, nil, fmt.Errorf("writing %s requires administrator privileges (try sudo)", path)
+		}
+		return nil, nil, err
+	}
+
+	release := func() error {
+		return releaseVolume(device)
+	}
+	return file, release, nil
+}
+
+func ejectVolume(device string) error {
+	return fmt.Errorf("volume eject is only implemented on Windows")
+}
+
+func volumeWriteProtected(device string) (bool, error) {
+	return false, nil
+}
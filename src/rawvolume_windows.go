@@ -0,0 +1,184 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	fsctlLockVolume          = 0x00090018
+	fsctlDismountVolume      = 0x00090020
+	ioctlStorageMediaRemoval = 0x002D4804
+	ioctlStorageEjectMedia   = 0x002D4808
+	ioctlDiskIsWritable      = 0x00070024
+
+	ejectLockAttempts = 10
+	ejectLockDelay    = 500 * time.Millisecond
+)
+
+// lockVolume opens the volume handle for a drive letter and locks and
+// dismounts it. Windows keeps other writers out for as long as it stays open.
+func lockVolume(device string) (windows.Handle, error) {
+	defer forgetDriveInfo()
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+	path, err := windows.UTF16PtrFromString(fmt.Sprintf(`\\.\%s:`, driveLetter))
+	if err != nil {
+		return 0, err
+	}
+
+	handle, err := windows.CreateFile(path,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("open volume %s: %w", device, err)
+	}
+
+	var returned uint32
+	if err := windows.DeviceIoControl(handle, fsctlLockVolume, nil, 0, nil, 0, &returned, nil); err != nil {
+		windows.CloseHandle(handle)
+		return 0, fmt.Errorf("lock volume %s (close any programs using the drive): %w", device, err)
+	}
+	if err := windows.DeviceIoControl(handle, fsctlDismountVolume, nil, 0, nil, 0, &returned, nil); err != nil {
+		windows.CloseHandle(handle)
+		return 0, fmt.Errorf("dismount volume %s: %w", device, err)
+	}
+	return handle, nil
+}
+
+// openVolumeForWrite locks and dismounts the volume so Windows allows writes
+// to the filesystem's reserved sectors.
+func openVolumeForWrite(device string) (*os.File, int64, error) {
+	if activeFakeBackend() != nil {
+		return nil, 0, fmt.Errorf("raw writes are not available for fake drive %s", device)
+	}
+	handle, err := lockVolume(device)
+	if err != nil {
+		return nil, 0, err
+	}
+	return os.NewFile(uintptr(handle), device), 0, nil
+}
+
+func releaseVolume(device string) error {
+	forgetDriveInfo()
+	return nil
+}
+
+// openDiskForWrite opens the physical disk behind a drive letter for raw
+// writes. The volume stays locked until the returned release function runs.
+func openDiskForWrite(device string) (*os.File, func() error, error) {
+	if activeFakeBackend() != nil {
+		return nil, nil, fmt.Errorf("raw writes are not available for fake drive %s", device)
+	}
+	diskPath, err := rawDevicePath(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	path, err := windows.UTF16PtrFromString(diskPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	volume, err := lockVolume(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	handle, err := windows.CreateFile(path,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		windows.CloseHandle(volume)
+		return nil, nil, fmt.Errorf("open %s: %w", diskPath, err)
+	}
+
+	release := func() error {
+		forgetDriveInfo()
+		return windows.CloseHandle(volume)
+	}
+	return os.NewFile(uintptr(handle), diskPath), release, nil
+}
+
+// ejectVolume locks, dismounts, and ejects a drive letter through its volume
+// handle. Locking is retried because Explorer and antivirus scanners often hold
+// the volume open for a moment after a copy finishes.
+func ejectVolume(device string) error {
+	defer forgetDriveInfo()
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+	volume := driveLetter + ":"
+	path, err := windows.UTF16PtrFromString(fmt.Sprintf(`\\.\%s:`, driveLetter))
+	if err != nil {
+		return err
+	}
+
+	handle, err := windows.CreateFile(path,
+		windows.GENERIC_READ|windows.GENERIC_WRITE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return fmt.Errorf("open volume %s: %w", volume, err)
+	}
+	defer windows.CloseHandle(handle)
+
+	var returned uint32
+	var lockErr error
+	for attempt := 1; attempt <= ejectLockAttempts; attempt++ {
+		lockErr = windows.DeviceIoControl(handle, fsctlLockVolume, nil, 0, nil, 0, &returned, nil)
+		if lockErr == nil {
+			break
+		}
+		if attempt < ejectLockAttempts {
+			time.Sleep(ejectLockDelay)
+		}
+	}
+	if lockErr != nil {
+		if lockErr == windows.ERROR_ACCESS_DENIED || lockErr == windows.ERROR_SHARING_VIOLATION {
+			return fmt.Errorf("drive %s is in use; close any Explorer windows or programs with files open on it (see 'cdjf busy %s') and try again", volume, volume)
+		}
+		return fmt.Errorf("lock volume %s: %w", volume, lockErr)
+	}
+
+	if err := windows.DeviceIoControl(handle, fsctlDismountVolume, nil, 0, nil, 0, &returned, nil); err != nil {
+		return fmt.Errorf("dismount volume %s: %w", volume, err)
+	}
+
+	// Clear any media-removal lock left by another program; failure is not fatal.
+	preventRemoval := byte(0)
+	windows.DeviceIoControl(handle, ioctlStorageMediaRemoval, &preventRemoval, 1, nil, 0, &returned, nil)
+
+	if err := windows.DeviceIoControl(handle, ioctlStorageEjectMedia, nil, 0, nil, 0, &returned, nil); err != nil {
+		return fmt.Errorf("eject %s: %w", volume, err)
+	}
+	return nil
+}
+
+// volumeWriteProtected asks the disk driver whether the media accepts writes,
+// which catches SD cards with the lock switch engaged.
+func volumeWriteProtected(device string) (bool, error) {
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+	path, err := windows.UTF16PtrFromString(fmt.Sprintf(`\\.\%s:`, driveLetter))
+	if err != nil {
+		return false, err
+	}
+
+	handle, err := windows.CreateFile(path, 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer windows.CloseHandle(handle)
+
+	var returned uint32
+	err = windows.DeviceIoControl(handle, ioctlDiskIsWritable, nil, 0, nil, 0, &returned, nil)
+	if err == windows.ERROR_WRITE_PROTECT {
+		return true, nil
+	}
+	return false, err
+}
@@ -3,6 +3,14 @@ package main
 import "regexp"
 
 var (
-	diskIDRegex = regexp.MustCompile(`/dev/(disk\d+)`)
-	sizeRegex   = regexp.MustCompile(`([\d.]+)\s*(GB|MB|TB|Bytes)`)
+	diskIDRegex          = regexp.MustCompile(`/dev/(disk\d+)`)
+	sizeRegex            = regexp.MustCompile(`([\d.]+)\s*(GB|MB|TB|Bytes)`)
+	wholeDiskRegex       = regexp.MustCompile(`^disk\d+$`)
+	wholeDiskPrefixRegex = regexp.MustCompile(`^disk\d+`)
+	aliasNameRegex       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	usbVendorIDRegex     = regexp.MustCompile(`(?i)(?:0x|VID_)([0-9a-f]{4})`)
+	byteCountRegex       = regexp.MustCompile(`\((\d+) Bytes\)`)
+	progressLineRegex    = regexp.MustCompile(`^(\S[^:]*): (\d+)% \(([\d.]+) MB/s\)$`)
+	writeSpeedLineRegex  = regexp.MustCompile(`^(?:\[(\S+)\] )?\s*Write [Ss]peed: ([\d.]+) MB/s`)
+	percentRegex         = regexp.MustCompile(`(\d+)%`)
 )
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// GigReport is a shareable record of the checks run against a drive.
+type GigReport struct {
+	Kind      string
+	Title     string
+	Device    string
+	Label     string
+	Volume    string
+	Size      string
+	Host      string
+	Generated time.Time
+	Checks    []PreflightCheck
+	Benchmark BenchmarkResult
+	Passed    bool
+}
+
+func normalizeReportFormat(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "html":
+		return "html", nil
+	case "pdf":
+		return "pdf", nil
+	}
+	return "", fmt.Errorf("invalid report format %q; supported values: html, pdf", value)
+}
+
+// newGigReport collects the identifying details of a drive for a report.
+func newGigReport(kind, title, device string) GigReport {
+	report := GigReport{
+		Kind:      kind,
+		Title:     title,
+		Device:    device,
+		Label:     getVolumeLabel(device),
+		Volume:    "unavailable",
+		Size:      fmt.Sprintf("%.1f GB", getDriveSize(device)),
+		Generated: time.Now(),
+	}
+	if boot, _, err := readBootSector(device); err == nil {
+		report.Volume = fmt.Sprintf("%s %s", boot.FilesystemType, boot.VolumeIDString())
+	} else if filesystem := getDriveFilesystem(device); filesystem != "" {
+		report.Volume = filesystem
+	}
+	if host, err := os.Hostname(); err == nil {
+		report.Host = host
+	}
+	return report
+}
+
+func (r GigReport) Result() string {
+	if r.Passed {
+		return preflightPass
+	}
+	return preflightFail
+}
+
+func writeGigReport(report GigReport, format string) (string, error) {
+	fileName := fmt.Sprintf("cdjf-%s-%s-%s.%s", report.Kind, sanitizeDeviceName(report.Device), report.Generated.Format("20060102-150405"), format)
+
+	var data []byte
+	var err error
+	switch format {
+	case "html":
+		data, err = renderReportHTML(report)
+	case "pdf":
+		data = renderReportPDF(report)
+	default:
+		err = fmt.Errorf("unsupported report format %q", format)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(fileName, data, 0o644); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - {{.Device}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 48em; color: #222; }
+h1 { margin-bottom: 0.2em; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; }
+th, td { text-align: left; padding: 0.4em 0.6em; border-bottom: 1px solid #ddd; }
+.PASS { color: #1a7f37; font-weight: bold; }
+.WARN { color: #9a6700; font-weight: bold; }
+.FAIL { color: #cf222e; font-weight: bold; }
+.SKIP { color: #666; }
+.result { font-size: 1.4em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="result">Result: <span class="{{.Result}}">{{.Result}}</span></p>
+<table>
+<tr><th>Device</th><td>{{.Device}}</td></tr>
+<tr><th>Label</th><td>{{.Label}}</td></tr>
+<tr><th>Volume</th><td>{{.Volume}}</td></tr>
+<tr><th>Size</th><td>{{.Size}}</td></tr>
+<tr><th>Checked on</th><td>{{.Host}}</td></tr>
+<tr><th>Date</th><td>{{.Generated.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+</table>
+<h2>Checks</h2>
+<table>
+<tr><th>Check</th><th>Status</th><th>Details</th></tr>
+{{range .Checks}}<tr><td>{{.Name}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+<h2>Benchmark</h2>
+<table>
+<tr><th>Write speed</th><td>{{printf "%.2f" .Benchmark.WriteMBps}} MB/s</td></tr>
+<tr><th>Read speed</th><td>{{printf "%.2f" .Benchmark.ReadMBps}} MB/s</td></tr>
+</table>
+<p><small>Generated by cdjf</small></p>
+</body>
+</html>
+`))
+
+func renderReportHTML(report GigReport) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportHTMLTemplate.Execute(&buf, report); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func reportTextLines(report GigReport) []string {
+	lines := []string{
+		report.Title,
+		"",
+		"Result: " + report.Result(),
+		"",
+		"Device: " + report.Device,
+		"Label: " + report.Label,
+		"Volume: " + report.Volume,
+		"Size: " + report.Size,
+		"Checked on: " + report.Host,
+		"Date: " + report.Generated.Format("2006-01-02 15:04:05 MST"),
+		"",
+		"Checks",
+	}
+	for _, check := range report.Checks {
+		lines = append(lines, fmt.Sprintf("  [%s] %s: %s", check.Status, check.Name, check.Detail))
+	}
+	lines = append(lines,
+		"",
+		"Benchmark",
+		fmt.Sprintf("  Write speed: %.2f MB/s", report.Benchmark.WriteMBps),
+		fmt.Sprintf("  Read speed: %.2f MB/s", report.Benchmark.ReadMBps),
+		"",
+		"Generated by cdjf",
+	)
+	return lines
+}
+
+// renderReportPDF writes a plain text PDF using the built-in Helvetica font so
+// no PDF library is needed.
+func renderReportPDF(report GigReport) []byte {
+	const (
+		linesPerPage = 52
+		wrapAt       = 90
+	)
+
+	var wrapped []string
+	for _, line := range reportTextLines(report) {
+		for len(line) > wrapAt {
+			cut := strings.LastIndex(line[:wrapAt], " ")
+			if cut <= 0 {
+				cut = wrapAt
+			}
+			wrapped = append(wrapped, line[:cut])
+			line = "      " + strings.TrimLeft(line[cut:], " ")
+		}
+		wrapped = append(wrapped, line)
+	}
+
+	var pages [][]string
+	for start := 0; start < len(wrapped); start += linesPerPage {
+		end := start + linesPerPage
+		if end > len(wrapped) {
+			end = len(wrapped)
+		}
+		pages = append(pages, wrapped[start:end])
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and content stream per page.
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		content.WriteString("BT\n/F1 11 Tf\n14 TL\n50 800 Td\n")
+		for j, line := range page {
+			size := 11
+			if i == 0 && j == 0 {
+				size = 16
+			}
+			fmt.Fprintf(&content, "/F1 %d Tf\n(%s) Tj\nT*\n", size, escapePDFText(line))
+		}
+		content.WriteString("ET\n")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func escapePDFText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	rescueChunkSize   = 4 * 1024 * 1024
+	rescueMaxCarveLen = 200 * 1024 * 1024
+)
+
+var rescueAudioExtensions = map[string]bool{
+	"MP3": true, "WAV": true, "AIF": true, "AIFF": true, "FLA": true, "FLAC": true, "M4A": true, "AAC": true,
+}
+
+// RescueCandidate is a file found on a quick-formatted volume, either from a
+// surviving directory entry or by carving an audio signature.
+type RescueCandidate struct {
+	Name   string
+	Offset int64
+	Size   int64
+	Source string
+}
+
+type rescueScanner struct {
+	file       *os.File
+	base       int64
+	boot       BootSector
+	dataOffset int64
+	volumeSize int64
+}
+
+func (s rescueScanner) clusterOffset(cluster uint32) int64 {
+	return s.base + s.dataOffset + int64(cluster-2)*int64(s.boot.ClusterSize())
+}
+
+func rescueDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	outputDir, _ := cmd.Flags().GetString("output")
+	listOnly, _ := cmd.Flags().GetBool("list")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if outputDir == "" {
+		outputDir = fmt.Sprintf("cdjf-rescue-%s-%s", sanitizeDeviceName(device), time.Now().Format("20060102-150405"))
+	}
+	if !listOnly {
+		if err := ensureRescueOutputOffDevice(device, outputDir); err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	boot, base, err := readBootSector(device)
+	if err != nil {
+		printError("Error reading filesystem: %v", err)
+		os.Exit(1)
+	}
+
+	path, err := rawDevicePath(device)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		printError("Error opening %s: %v", path, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	scanner := rescueScanner{
+		file:       file,
+		base:       base,
+		boot:       boot,
+		dataOffset: boot.DataRegionOffset(),
+		volumeSize: int64(boot.TotalSectors) * int64(boot.BytesPerSector),
+	}
+
+	fmt.Printf("Scanning %s (%s, %d KB clusters) for recoverable audio...\n", device, boot.FilesystemType, boot.ClusterSize()/1024)
+	fmt.Println("The drive is only read; nothing is written to it.")
+
+	candidates, err := scanner.scan()
+	if err != nil {
+		printError("Error scanning drive: %v", err)
+		os.Exit(1)
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("No recoverable audio files were found.")
+		return
+	}
+
+	fmt.Printf("\nFound %d candidate file(s):\n", len(candidates))
+	for _, c := range candidates {
+		fmt.Printf("  %-40s %10.1f MB  (%s)\n", c.Name, float64(c.Size)/(1024*1024), c.Source)
+	}
+
+	if listOnly {
+		return
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		printError("Error creating %s: %v", outputDir, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\nExtracting to %s...\n", outputDir)
+	recovered := 0
+	for _, c := range candidates {
+		if err := scanner.extract(c, outputDir); err != nil {
+			printError("  %s: %v", c.Name, err)
+			continue
+		}
+		recovered++
+	}
+
+	fmt.Printf("\nRecovered %d of %d file(s) into %s\n", recovered, len(candidates), outputDir)
+	fmt.Println("Carved files may be truncated or contain trailing data; check them before relying on them.")
+}
+
+func ensureRescueOutputOffDevice(device, outputDir string) error {
+	mountPoint, err := getDeviceMountPoint(device)
+	if err != nil {
+		return nil
+	}
+	absOutput, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	absMount, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.ToLower(absOutput), strings.ToLower(absMount)) {
+		return fmt.Errorf("output directory %s is on the drive being rescued; choose a folder on another drive", absOutput)
+	}
+	return nil
+}
+
+func (s rescueScanner) scan() ([]RescueCandidate, error) {
+	clusterSize := int64(s.boot.ClusterSize())
+	if clusterSize <= 0 {
+		return nil, fmt.Errorf("invalid cluster size")
+	}
+
+	dataLength := s.volumeSize - s.dataOffset
+	if dataLength <= 0 {
+		return nil, fmt.Errorf("volume has no data region")
+	}
+
+	progress := NewProgressBar("Scan", dataLength)
+	defer progress.Stop()
+
+	var fromEntries []RescueCandidate
+	var hits []RescueCandidate
+	chunk := make([]byte, rescueChunkSize-rescueChunkSize%clusterSize)
+
+	for pos := int64(0); pos < dataLength; pos += int64(len(chunk)) {
+		n, err := s.file.ReadAt(chunk, s.base+s.dataOffset+pos)
+		if n == 0 && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		for off := int64(0); off+clusterSize <= int64(n); off += clusterSize {
+			cluster := chunk[off : off+clusterSize]
+			absolute := s.base + s.dataOffset + pos + off
+
+			if s.boot.FilesystemType != "exFAT" && isFATDirectoryCluster(cluster) {
+				fromEntries = append(fromEntries, s.directoryCandidates(cluster)...)
+				continue
+			}
+			if name, size, ok := detectAudioSignature(cluster); ok {
+				hits = append(hits, RescueCandidate{Name: name, Offset: absolute, Size: size, Source: "carved"})
+			}
+		}
+		progress.Add(int64(n))
+	}
+	progress.Finish()
+
+	return mergeRescueCandidates(fromEntries, hits, s.base+s.volumeSize), nil
+}
+
+func isFATDirectoryCluster(cluster []byte) bool {
+	if len(cluster) < 64 {
+		return false
+	}
+	dot := cluster[0:32]
+	dotdot := cluster[32:64]
+	return bytes.Equal(dot[0:11], []byte(".          ")) && dot[11]&0x10 != 0 &&
+		bytes.Equal(dotdot[0:11], []byte("..         ")) && dotdot[11]&0x10 != 0
+}
+
+func (s rescueScanner) directoryCandidates(cluster []byte) []RescueCandidate {
+	var candidates []RescueCandidate
+	for i := 64; i+32 <= len(cluster); i += 32 {
+		entry := cluster[i : i+32]
+		if entry[0] == 0x00 {
+			break
+		}
+		attr := entry[11]
+		if entry[0] == 0xE5 || attr == 0x0F || attr&0x18 != 0 {
+			continue
+		}
+
+		base := sanitizeShortName(bytes.TrimRight(entry[0:8], " "))
+		ext := sanitizeShortName(bytes.TrimRight(entry[8:11], " "))
+		if base == "" || !rescueAudioExtensions[ext] {
+			continue
+		}
+		name := base + "." + ext
+		if filepath.Base(name) != name {
+			continue
+		}
+
+		startCluster := uint32(binary.LittleEndian.Uint16(entry[20:22]))<<16 | uint32(binary.LittleEndian.Uint16(entry[26:28]))
+		size := int64(binary.LittleEndian.Uint32(entry[28:32]))
+		if startCluster < 2 || size == 0 {
+			continue
+		}
+
+		offset := s.clusterOffset(startCluster)
+		if offset+size > s.base+s.volumeSize {
+			continue
+		}
+
+		candidates = append(candidates, RescueCandidate{
+			Name:   name,
+			Offset: offset,
+			Size:   size,
+			Source: "directory entry",
+		})
+	}
+	return candidates
+}
+
+// fatShortNameSymbols are the bytes an 8.3 name may hold besides upper-case
+// letters and digits.
+const fatShortNameSymbols = "!#$%&'()-@^_`{}~"
+
+// sanitizeShortName turns the raw bytes of an 8.3 name into a file name that
+// is safe to create. Entries on a damaged drive can hold anything, including
+// path separators and dots, so every byte outside the 8.3 set becomes "_".
+// That includes code page characters, whose encoding is unknown.
+func sanitizeShortName(raw []byte) string {
+	name := make([]byte, len(raw))
+	for i, b := range raw {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= '0' && b <= '9', strings.IndexByte(fatShortNameSymbols, b) >= 0:
+			name[i] = b
+		default:
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// detectAudioSignature reports an audio file starting at the beginning of the
+// cluster. A size of zero means the length is unknown and must be carved.
+func detectAudioSignature(data []byte) (string, int64, bool) {
+	if len(data) < 12 {
+		return "", 0, false
+	}
+	switch {
+	case bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "wav", int64(binary.LittleEndian.Uint32(data[4:8])) + 8, true
+	case bytes.Equal(data[0:4], []byte("FORM")) && (bytes.Equal(data[8:12], []byte("AIFF")) || bytes.Equal(data[8:12], []byte("AIFC"))):
+		return "aiff", int64(binary.BigEndian.Uint32(data[4:8])) + 8, true
+	case bytes.Equal(data[0:4], []byte("fLaC")):
+		return "flac", 0, true
+	case bytes.Equal(data[0:3], []byte("ID3")) && data[3] >= 2 && data[3] <= 4:
+		return "mp3", 0, true
+	}
+	return "", 0, false
+}
+
+func mergeRescueCandidates(fromEntries, hits []RescueCandidate, volumeEnd int64) []RescueCandidate {
+	covered := func(offset int64) bool {
+		for _, c := range fromEntries {
+			if offset >= c.Offset && offset < c.Offset+c.Size {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidates := append([]RescueCandidate{}, fromEntries...)
+	var carved []RescueCandidate
+	for i, hit := range hits {
+		if covered(hit.Offset) {
+			continue
+		}
+		limit := volumeEnd
+		if i+1 < len(hits) {
+			limit = hits[i+1].Offset
+		}
+		if hit.Size <= 0 || hit.Offset+hit.Size > volumeEnd {
+			hit.Size = limit - hit.Offset
+		}
+		if hit.Size > rescueMaxCarveLen {
+			hit.Size = rescueMaxCarveLen
+		}
+		hit.Name = fmt.Sprintf("carved-%04d.%s", len(carved)+1, hit.Name)
+		carved = append(carved, hit)
+	}
+	return append(candidates, carved...)
+}
+
+func (s rescueScanner) extract(c RescueCandidate, outputDir string) error {
+	target := filepath.Join(outputDir, c.Name)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		ext := filepath.Ext(c.Name)
+		target = filepath.Join(outputDir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(c.Name, ext), i, ext))
+	}
+	if rel, err := filepath.Rel(outputDir, target); err != nil || rel != filepath.Base(target) {
+		return fmt.Errorf("refusing to write %q outside %s", c.Name, outputDir)
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	// Raw devices only accept whole-sector reads, so copy in aligned blocks and
+	// trim the final write to the file size.
+	buf := make([]byte, 1024*1024)
+	var copied int64
+	for copied < c.Size {
+		n, readErr := s.file.ReadAt(buf, c.Offset+copied)
+		remaining := c.Size - copied
+		if int64(n) > remaining {
+			n = int(remaining)
+		}
+		if n > 0 {
+			if _, err := out.Write(buf[:n]); err != nil {
+				out.Close()
+				return err
+			}
+			copied += int64(n)
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			out.Close()
+			return readErr
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how cdjf repeats a drive operation that failed with a
+// transient USB error. Cheap sticks often drop off the bus for a moment and
+// come back, and the second attempt then succeeds.
+type RetryPolicy struct {
+	// Retries is how many times an operation is repeated after the first
+	// attempt.
+	Retries int
+	// Backoff is the wait before the first retry; it doubles after each one.
+	Backoff time.Duration
+}
+
+// retryPolicy is set from --usb-retries and --usb-retry-backoff.
+var retryPolicy = RetryPolicy{Retries: 2, Backoff: 2 * time.Second}
+
+// transientErrorMarkers appear in the messages of errors a USB reset causes,
+// whether they come from the system or from diskutil and format.com.
+var transientErrorMarkers = []string{
+	"input/output error",
+	"i/o error",
+	"i/o device error",
+	"device not configured",
+	"device is not ready",
+	"device not ready",
+	"resource busy",
+	"timed out",
+	"semaphore timeout",
+	"device is not connected",
+	"couldn't unmount",
+	"could not unmount",
+	"could not be unmounted",
+}
+
+// hardErrorMarkers rule out a retry even when a transient marker is present.
+var hardErrorMarkers = []string{
+	"write-protected",
+	"write protected",
+	"permission denied",
+	"access is denied",
+	"no space left",
+	"not enough space",
+}
+
+// isTransientUSBError reports whether err looks like the drive dropped off the
+// bus or stalled rather than a failure that will happen again.
+func isTransientUSBError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, marker := range hardErrorMarkers {
+		if strings.Contains(message, marker) {
+			return false
+		}
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		switch runtime.GOOS {
+		case "windows":
+			// ERROR_NOT_READY, ERROR_GEN_FAILURE, ERROR_SEM_TIMEOUT,
+			// ERROR_IO_DEVICE, and ERROR_DEVICE_NOT_CONNECTED.
+			switch errno {
+			case 21, 31, 121, 1117, 1167:
+				return true
+			}
+		default:
+			switch errno {
+			case syscall.EIO, syscall.EBUSY, syscall.ENXIO, syscall.ETIMEDOUT:
+				return true
+			}
+		}
+	}
+
+	for _, marker := range transientErrorMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs op and repeats it under retryPolicy while it fails with a
+// transient USB error, logging each retry. action names the operation in
+// those messages, e.g. "Formatting disk4".
+func withRetry(action string, op func() error) error {
+	delay := retryPolicy.Backoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= retryPolicy.Retries || !isTransientUSBError(err) {
+			return err
+		}
+		warn("", warnRetry, "%s failed with what looks like a USB reset: %v", action, err)
+		fmt.Fprintf(consoleOut, "   Retrying in %s (retry %d of %d)...\n", delay, attempt+1, retryPolicy.Retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	scheduleLaunchdLabel = "com.cdjf.schedule-verify"
+	scheduleTaskName     = `cdjf\verify`
+	schedulePollMinutes  = 30
+)
+
+// ScheduleConfig is the periodic verification job registered with the OS scheduler.
+type ScheduleConfig struct {
+	Every       string               `json:"every"`
+	Drives      []string             `json:"drives,omitempty"`
+	MinFree     string               `json:"min_free,omitempty"`
+	LastChecked map[string]time.Time `json:"last_checked,omitempty"`
+}
+
+func parseScheduleInterval(value string) (time.Duration, error) {
+	trimmed := strings.ToLower(strings.TrimSpace(value))
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if strings.HasSuffix(trimmed, suffix) {
+			count, err := strconv.Atoi(strings.TrimSuffix(trimmed, suffix))
+			if err != nil || count <= 0 {
+				break
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	if interval, err := time.ParseDuration(trimmed); err == nil && interval >= time.Hour {
+		return interval, nil
+	}
+	return 0, fmt.Errorf("invalid interval %q; use a value such as 12h, 30d, or 2w (minimum 1h)", value)
+}
+
+func scheduleConfigPath() (string, error) {
+	return configFilePath("schedule.json")
+}
+
+func loadScheduleConfig() (ScheduleConfig, error) {
+	path, err := scheduleConfigPath()
+	if err != nil {
+		return ScheduleConfig{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScheduleConfig{}, err
+	}
+	var config ScheduleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ScheduleConfig{}, err
+	}
+	if config.LastChecked == nil {
+		config.LastChecked = make(map[string]time.Time)
+	}
+	return config, nil
+}
+
+func saveScheduleConfig(config ScheduleConfig) error {
+	path, err := scheduleConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func scheduleVerify(cmd *cobra.Command, args []string) {
+	every, _ := cmd.Flags().GetString("every")
+	drives, _ := cmd.Flags().GetStringSlice("drive")
+	minFree, _ := cmd.Flags().GetString("min-free")
+
+	if _, err := parseScheduleInterval(every); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	config := ScheduleConfig{Every: every, Drives: drives, MinFree: minFree}
+	if existing, err := loadScheduleConfig(); err == nil {
+		config.LastChecked = existing.LastChecked
+	}
+	if err := saveScheduleConfig(config); err != nil {
+		printError("Error saving schedule: %v", err)
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		printError("Error: unable to locate the cdjf executable: %v", err)
+		os.Exit(1)
+	}
+
+	if err := installScheduler(executable); err != nil {
+		printError("Error registering scheduled job: %v", err)
+		os.Exit(1)
+	}
+
+	printOK("Scheduled verification every %s.", every)
+	if len(drives) > 0 {
+		fmt.Printf("Drives: %s\n", strings.Join(drives, ", "))
+	} else {
+		fmt.Println("Drives: any connected drive with a rekordbox export")
+	}
+	if runtime.GOOS == "darwin" {
+		fmt.Println("The check runs when a drive is mounted and every 30 minutes while one is connected.")
+	} else {
+		fmt.Printf("The check runs every %d minutes and verifies drives that are due.\n", schedulePollMinutes)
+	}
+	fmt.Println("You'll get a desktop notification when a drive fails. Remove the job with 'cdjf schedule remove'.")
+}
+
+func scheduleRemove(cmd *cobra.Command, args []string) {
+	if err := removeScheduler(); err != nil {
+		printError("Error removing scheduled job: %v", err)
+		os.Exit(1)
+	}
+	if path, err := scheduleConfigPath(); err == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			printWarning("Unable to delete %s: %v", path, err)
+		}
+	}
+	printOK("Scheduled verification removed.")
+}
+
+// scheduleRun is invoked by the OS scheduler. It checks each connected drive
+// that is due and raises a notification for any that fail.
+func scheduleRun(cmd *cobra.Command, args []string) {
+	config, err := loadScheduleConfig()
+	if err != nil {
+		printError("Error loading schedule: %v", err)
+		os.Exit(1)
+	}
+	interval, err := parseScheduleInterval(config.Every)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	minFreeGB := 0.0
+	if config.MinFree != "" {
+		minFreeGB = parseSizeToGB(strings.ToUpper(config.MinFree))
+	}
+
+	now := time.Now()
+	for _, device := range removableDevices() {
+		key, ok := scheduledDriveKey(device, config.Drives)
+		if !ok {
+			continue
+		}
+		if last, seen := config.LastChecked[key]; seen && now.Sub(last) < interval {
+			continue
+		}
+
+		fmt.Printf("[%s] %s: running scheduled preflight (%s)\n", now.Format(time.RFC3339), device, key)
+		checks, _ := runPreflightChecks(device, minFreeGB, defaultBenchmarkThresholds, defaultTarget)
+		printPreflightChecks(checks)
+
+		failures := preflightFailures(checks)
+		recordDriveCheck(device, "preflight", len(failures) == 0)
+		if len(failures) > 0 {
+			title := fmt.Sprintf("cdjf: %s failed its check", key)
+			if notifyErr := sendNotification(title, strings.Join(failures, "; ")); notifyErr != nil {
+				printWarning("Unable to send notification: %v", notifyErr)
+			}
+		}
+		config.LastChecked[key] = now
+	}
+
+	if err := saveScheduleConfig(config); err != nil {
+		printError("Error saving schedule: %v", err)
+		os.Exit(1)
+	}
+}
+
+// scheduledDriveKey identifies a drive by its volume label and reports whether
+// it should be checked. With no drives configured, any drive holding a
+// rekordbox export is checked.
+func scheduledDriveKey(device string, drives []string) (string, bool) {
+	label := getVolumeLabel(device)
+	if len(drives) > 0 {
+		for _, drive := range drives {
+			if strings.EqualFold(drive, label) {
+				return label, true
+			}
+		}
+		return "", false
+	}
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(mountPoint, "PIONEER", "rekordbox", "export.pdb")); err != nil {
+		return "", false
+	}
+	if label == "" {
+		label = device
+	}
+	return label, true
+}
+
+// removableDevices lists the removable drives currently connected.
+func removableDevices() []string {
+	return deviceBackend.Enumerate()
+}
+
+func (systemBackend) Enumerate() []string {
+	var devices []string
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := execCommand("diskutil", "list", "external", "physical").Output()
+		if err != nil {
+			return nil
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			if strings.Contains(line, "/dev/disk") {
+				if diskID := extractDiskID(line); diskID != "" {
+					devices = append(devices, diskID)
+				}
+			}
+		}
+
+	case "windows":
+		disks, err := queryLogicalDisks("DriveType=2")
+		if err != nil {
+			return nil
+		}
+		for _, disk := range disks {
+			devices = append(devices, disk.DeviceID)
+		}
+	}
+	return devices
+}
+
+func launchAgentPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", scheduleLaunchdLabel+".plist"), nil
+}
+
+func xmlEscape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+func installScheduler(executable string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		path, err := launchAgentPath()
+		if err != nil {
+			return err
+		}
+		home, _ := os.UserHomeDir()
+		logPath := filepath.Join(home, "Library", "Logs", "cdjf-schedule.log")
+
+		plist := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>schedule</string>
+		<string>run</string>
+		<string>--no-color</string>
+	</array>
+	<key>StartOnMount</key>
+	<true/>
+	<key>StartInterval</key>
+	<integer>%d</integer>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, scheduleLaunchdLabel, xmlEscape(executable), schedulePollMinutes*60, xmlEscape(logPath), xmlEscape(logPath))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(plist), 0o644); err != nil {
+			return err
+		}
+
+		execCommand("launchctl", "unload", path).Run()
+		if output, err := execCommand("launchctl", "load", "-w", path).CombinedOutput(); err != nil {
+			return fmt.Errorf("launchctl load failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+
+	case "windows":
+		taskCommand := fmt.Sprintf(`"%s" schedule run --no-color`, executable)
+		cmd := execCommand("schtasks", "/Create", "/TN", scheduleTaskName, "/TR", taskCommand,
+			"/SC", "MINUTE", "/MO", strconv.Itoa(schedulePollMinutes), "/F")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("schtasks failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
+
+func removeScheduler() error {
+	switch runtime.GOOS {
+	case "darwin":
+		path, err := launchAgentPath()
+		if err != nil {
+			return err
+		}
+		execCommand("launchctl", "unload", "-w", path).Run()
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+
+	case "windows":
+		cmd := execCommand("schtasks", "/Delete", "/TN", scheduleTaskName, "/F")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("schtasks failed: %v\nOutput: %s", err, output)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// normalizeScripts checks script names against Unicode's (Latin, Cyrillic,
+// Han, and so on), ignoring case, and returns them spelled as Unicode does.
+func normalizeScripts(values []string) ([]string, error) {
+	var scripts []string
+	for _, value := range values {
+		trimmed := strings.TrimSpace(value)
+		if trimmed == "" {
+			continue
+		}
+		found := ""
+		for name := range unicode.Scripts {
+			if strings.EqualFold(name, trimmed) {
+				found = name
+				break
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("unknown script %q; use Unicode script names such as Latin, Cyrillic, Greek, Han, Hiragana, Katakana, or Hangul", value)
+		}
+		scripts = append(scripts, found)
+	}
+	return scripts, nil
+}
+
+// scriptChecker finds characters outside a set of scripts. Digits,
+// punctuation, and combining accents belong to no script and always pass.
+type scriptChecker struct {
+	allowed []*unicode.RangeTable
+	cache   map[rune]string
+}
+
+func newScriptChecker(scripts []string) *scriptChecker {
+	checker := &scriptChecker{
+		allowed: []*unicode.RangeTable{unicode.Common, unicode.Inherited},
+		cache:   make(map[rune]string),
+	}
+	for _, name := range scripts {
+		if table, ok := unicode.Scripts[name]; ok {
+			checker.allowed = append(checker.allowed, table)
+		}
+	}
+	return checker
+}
+
+// script returns the script of r, or "" when r is allowed.
+func (c *scriptChecker) script(r rune) string {
+	if name, ok := c.cache[r]; ok {
+		return name
+	}
+	name := ""
+	if !unicode.In(r, c.allowed...) {
+		name = "other"
+		for script, table := range unicode.Scripts {
+			if unicode.Is(table, r) {
+				name = script
+				break
+			}
+		}
+	}
+	c.cache[r] = name
+	return name
+}
+
+// unsupported lists the scripts in s that are not allowed.
+func (c *scriptChecker) unsupported(s string) []string {
+	var found []string
+	for _, r := range s {
+		if name := c.script(r); name != "" && !containsFold(found, name) {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// preflightScripts looks for a volume label and file names the target's
+// firmware cannot show. Older players have fonts for a few scripts only and
+// show anything else as blanks or boxes, so such tracks are hard to find on
+// the player. The PIONEER folder only holds names rekordbox generates.
+func preflightScripts(device string, target Target) PreflightCheck {
+	check := PreflightCheck{Name: "Names"}
+	if len(target.Scripts) == 0 {
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("%s shows all scripts", target.Description)
+		return check
+	}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		check.Status = preflightSkip
+		check.Detail = fmt.Sprintf("unable to find the mount point (%v)", err)
+		return check
+	}
+
+	checker := newScriptChecker(target.Scripts)
+	counts := make(map[string]int)
+	var examples []string
+	note := func(name string) {
+		scripts := checker.unsupported(name)
+		for _, script := range scripts {
+			counts[script]++
+		}
+		if len(scripts) > 0 {
+			examples = append(examples, name)
+		}
+	}
+	if label := getVolumeLabel(device); label != "" {
+		note(label)
+	}
+	err = filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if rel == "." {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") || containsFold(payloadMetadataFolders, strings.Split(filepath.ToSlash(rel), "/")[0]) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		note(entry.Name())
+		return nil
+	})
+	if err != nil {
+		check.Status = preflightSkip
+		check.Detail = fmt.Sprintf("unable to scan file names (%v)", err)
+		return check
+	}
+
+	if len(examples) == 0 {
+		check.Status = preflightPass
+		check.Detail = fmt.Sprintf("all names use scripts the %s shows (%s)", target.Description, strings.Join(target.Scripts, ", "))
+		return check
+	}
+	var scripts []string
+	for script := range counts {
+		scripts = append(scripts, script)
+	}
+	sort.Slice(scripts, func(i, j int) bool {
+		if counts[scripts[i]] != counts[scripts[j]] {
+			return counts[scripts[i]] > counts[scripts[j]]
+		}
+		return scripts[i] < scripts[j]
+	})
+	check.Status = preflightWarn
+	check.Detail = fmt.Sprintf("%d name(s) use %s, e.g. %q; %s", len(examples), strings.Join(scripts, ", "), examples[0], target.scriptAdvice())
+	return check
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// SealEntry is one file in a drive seal.
+type SealEntry struct {
+	// Path is relative to the volume root.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// DriveSeal is a manifest of every file on a drive at the time it was sealed.
+type DriveSeal struct {
+	SealedAt time.Time   `json:"sealed_at"`
+	Files    []SealEntry `json:"files"`
+	// Signature is an HMAC-SHA256 of the drive's serial number and the fields
+	// above, under a key kept in the cdjf config folder, so the manifest cannot
+	// be edited to match a changed drive without that key.
+	Signature string `json:"signature"`
+}
+
+// sealKey loads the key seals are signed with, creating it on first use when
+// create is set.
+func sealKey(create bool) ([]byte, error) {
+	path, err := configFilePath("seal.key")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !errors.Is(err, os.ErrNotExist) || !create {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signSeal computes the signature of a seal for the drive with serial.
+func signSeal(key []byte, serial string, seal DriveSeal) (string, error) {
+	payload, err := json.Marshal(struct {
+		Serial   string      `json:"serial"`
+		SealedAt time.Time   `json:"sealed_at"`
+		Files    []SealEntry `json:"files"`
+	}{serial, seal.SealedAt, seal.Files})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// scanSealEntries hashes every file on a mounted volume. Hidden files and
+// System Volume Information are skipped, since operating systems create and
+// update them on their own whenever a drive is mounted.
+func scanSealEntries(mountPoint string) ([]SealEntry, error) {
+	var entries []SealEntry
+	var paths []string
+	var total int64
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		if rel != "." && (strings.HasPrefix(entry.Name(), ".") || (entry.IsDir() && rel == "System Volume Information")) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, SealEntry{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UTC()})
+		paths = append(paths, path)
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	progress := NewProgressBar("Hash", total)
+	defer progress.Stop()
+	for i := range entries {
+		hash, err := hashFile(paths[i], entries[i].Size, false, progress)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].SHA256 = hash
+	}
+	progress.Finish()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// sealSerial returns the serial number a drive's seal is stored under.
+func sealSerial(device string) (string, error) {
+	serial := strings.TrimSpace(getDriveSerial(device))
+	if serial == "" {
+		return "", fmt.Errorf("%s reports no serial number, so a seal could not be matched to it later", device)
+	}
+	return serial, nil
+}
+
+func sealDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	serial, err := sealSerial(device)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		os.Exit(1)
+	}
+	key, err := sealKey(true)
+	if err != nil {
+		printError("Error: unable to load the seal key: %v", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Sealing %s...\n", device)
+	entries, err := scanSealEntries(mountPoint)
+	if err != nil {
+		printError("Error scanning %s: %v", mountPoint, err)
+		os.Exit(1)
+	}
+	seal := DriveSeal{SealedAt: time.Now().UTC().Truncate(time.Second), Files: entries}
+	if seal.Signature, err = signSeal(key, serial, seal); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	inventory, err := loadInventory()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	record, ok := inventory.Drives[serial]
+	if !ok {
+		record.FirstSeen = seal.SealedAt
+	}
+	if record.Seal != nil {
+		fmt.Printf("Replacing the seal from %s.\n", record.Seal.SealedAt.Local().Format("2006-01-02 15:04"))
+	}
+	record.LastSeen = time.Now()
+	if model := getDriveModel(device); model != "" {
+		record.Model = model
+	}
+	record.Seal = &seal
+	inventory.Drives[serial] = record
+	if err := saveInventory(inventory); err != nil {
+		printError("Error: unable to save the seal: %v", err)
+		os.Exit(1)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	printOK("Sealed %d files (%s) on %s.", len(entries), formatByteSize(total), device)
+	fmt.Printf("Run 'cdjf verify-seal %s' before the gig to confirm nothing has changed.\n", device)
+}
+
+func verifyDriveSeal(cmd *cobra.Command, args []string) {
+	device := args[0]
+	noLock, _ := cmd.Flags().GetBool("no-lock")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	serial, err := sealSerial(device)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	record, ok := driveRecord(device)
+	if !ok || record.Seal == nil {
+		printError("Error: %s has not been sealed on this computer. Run 'cdjf seal %s' first.", device, device)
+		os.Exit(1)
+	}
+	seal := *record.Seal
+	key, err := sealKey(false)
+	if err != nil {
+		printError("Error: unable to load the seal key: %v", err)
+		os.Exit(1)
+	}
+	if expected, err := signSeal(key, serial, seal); err != nil || !hmac.Equal([]byte(expected), []byte(seal.Signature)) {
+		printError("Error: the seal of %s does not match its signature; the inventory has been edited since sealing.", device)
+		os.Exit(1)
+	}
+
+	title := fmt.Sprintf("Seal check for %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	fmt.Printf("Sealed: %s (%d files)\n", seal.SealedAt.Local().Format("2006-01-02 15:04"), len(seal.Files))
+
+	unlock := func() {}
+	if !noLock {
+		unlock = lockForInspection(device)
+	}
+	defer unlock()
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		unlock()
+		os.Exit(1)
+	}
+	current, err := scanSealEntries(mountPoint)
+	if err != nil {
+		printError("Error scanning %s: %v", mountPoint, err)
+		unlock()
+		os.Exit(1)
+	}
+
+	sealed := make(map[string]SealEntry, len(seal.Files))
+	for _, entry := range seal.Files {
+		sealed[entry.Path] = entry
+	}
+	var added, removed, changed, touched []string
+	for _, entry := range current {
+		before, ok := sealed[entry.Path]
+		delete(sealed, entry.Path)
+		switch {
+		case !ok:
+			added = append(added, entry.Path)
+		case before.SHA256 != entry.SHA256 || before.Size != entry.Size:
+			changed = append(changed, entry.Path)
+		case !before.ModTime.Equal(entry.ModTime):
+			touched = append(touched, entry.Path)
+		}
+	}
+	for path := range sealed {
+		removed = append(removed, path)
+	}
+	sort.Strings(removed)
+
+	fmt.Println()
+	recordDriveCheck(device, "verify-seal", len(added)+len(removed)+len(changed) == 0)
+	if len(added)+len(removed)+len(changed) == 0 {
+		printOK("No files have been added, removed, or changed since the drive was sealed.")
+		if len(touched) > 0 {
+			fmt.Printf("%d file(s) have new modification times but the same content.\n", len(touched))
+		}
+		return
+	}
+	for _, group := range []struct {
+		name  string
+		paths []string
+	}{{"Added", added}, {"Removed", removed}, {"Changed", changed}} {
+		if len(group.paths) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", group.name, len(group.paths))
+		printPathList(group.paths, 20)
+	}
+	if len(touched) > 0 {
+		fmt.Printf("%d other file(s) have new modification times but the same content.\n", len(touched))
+	}
+	warn(device, warnFilesystem, "%s has changed since it was sealed", device)
+	unlock()
+	os.Exit(1)
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// streamTokenTTL is how long a stream token can be used to open a job's
+// event stream. Browsers can't set headers on an EventSource, so the stream
+// takes a token in its URL, where it may end up in logs.
+const streamTokenTTL = time.Minute
+
+// finishedJobTTL is how long a finished job, with its output, stays
+// available through the API.
+const finishedJobTTL = time.Hour
+
+// jobFlags lists the options each API job accepts, mapped onto the CLI flags
+// of the command it runs.
+var jobFlags = map[string][]string{
+	"format": {"label", "profile", "cluster-size", "target", "fs", "scheme", "docs-partition", "volume-id"},
+	"verify": {"size", "profile", "limit", "resume", "confirm-over"},
+}
+
+// JobRequest starts a format or verify run through the API.
+type JobRequest struct {
+	Command string            `json:"command"`
+	Devices []string          `json:"devices"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// JobProgress is the latest progress line reported by a job.
+type JobProgress struct {
+	Stage   string  `json:"stage"`
+	Percent int     `json:"percent"`
+	MBps    float64 `json:"mbps"`
+}
+
+// Job describes a format or verify run started through the API.
+type Job struct {
+	ID       string       `json:"id"`
+	Command  string       `json:"command"`
+	Devices  []string     `json:"devices"`
+	State    string       `json:"state"`
+	ExitCode int          `json:"exit_code"`
+	Started  time.Time    `json:"started"`
+	Finished *time.Time   `json:"finished,omitempty"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	Output   []string     `json:"output"`
+}
+
+// apiJob is a running or finished job. Its output is kept so clients that
+// connect late can replay it.
+type apiJob struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	Job
+}
+
+// jobEvent is one server-sent event for a job.
+type jobEvent struct {
+	name string
+	data any
+}
+
+// apiServer holds the jobs started by cdjf serve.
+type apiServer struct {
+	token      string
+	executable string
+
+	// jobStarted, when set, is called for every new job.
+	jobStarted func(*apiJob)
+	metrics    *serverMetrics
+
+	mu   sync.Mutex
+	jobs map[string]*apiJob
+	// streamTokens are the unused stream tokens, by token.
+	streamTokens map[string]streamToken
+}
+
+// streamToken lets one request open the event stream of one job.
+type streamToken struct {
+	jobID   string
+	expires time.Time
+}
+
+// StreamToken is the response to a stream token request.
+type StreamToken struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+func serveAPI(cmd *cobra.Command, args []string) {
+	listen, _ := cmd.Flags().GetString("listen")
+	token, _ := cmd.Flags().GetString("token")
+	tlsCert, _ := cmd.Flags().GetString("tls-cert")
+	tlsKey, _ := cmd.Flags().GetString("tls-key")
+
+	if (tlsCert == "") != (tlsKey == "") {
+		printError("Error: --tls-cert and --tls-key must be given together")
+		os.Exit(1)
+	}
+	if tlsCert == "" && !isLoopbackAddress(listen) {
+		printError("Error: %s is reachable from other machines, and the API can erase drives; pass --tls-cert and --tls-key to serve it over HTTPS, or listen on 127.0.0.1", listen)
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		printError("Error: unable to locate the cdjf executable: %v", err)
+		os.Exit(1)
+	}
+
+	generated := false
+	if strings.TrimSpace(token) == "" {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			printError("Error: unable to generate a token: %v", err)
+			os.Exit(1)
+		}
+		token = hex.EncodeToString(secret)
+		generated = true
+	}
+
+	server := &apiServer{token: token, executable: executable, jobs: make(map[string]*apiJob), metrics: newServerMetrics()}
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           server.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	scheme := "http"
+	if tlsCert != "" {
+		scheme = "https"
+	}
+	fmt.Printf("CDJF API listening on %s://%s\n", scheme, listen)
+	if generated {
+		fmt.Printf("Token: %s\n", token)
+	}
+	fmt.Println("Send it as 'Authorization: Bearer <token>'. Press Ctrl+C to stop.")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+
+	if tlsCert != "" {
+		err = httpServer.ListenAndServeTLS(tlsCert, tlsKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// isLoopbackAddress reports whether a listen address only accepts connections
+// from this machine. An empty host listens on every interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/drives", s.handleListDrives)
+	mux.HandleFunc("GET /api/drives/{device}", s.handleDriveInfo)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("POST /api/jobs", s.handleStartJob)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleJob)
+	mux.HandleFunc("POST /api/jobs/{id}/stream-token", s.handleStreamToken)
+	// Metrics name drive models and job counts, so scrapers send the token too.
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+
+	root := http.NewServeMux()
+	root.HandleFunc("GET /api/jobs/{id}/events", s.handleJobEvents)
+	root.Handle("/", s.authenticate(mux))
+	return root
+}
+
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether a request carries the API token in its
+// Authorization header. The token is never read from the URL.
+func (s *apiServer) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handleStreamToken issues a single-use token that opens the job's event
+// stream for streamTokenTTL, for clients that can't send headers there.
+func (s *apiServer) handleStreamToken(w http.ResponseWriter, r *http.Request) {
+	job := s.job(r.PathValue("id"))
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	issued := StreamToken{Token: hex.EncodeToString(secret), Expires: time.Now().Add(streamTokenTTL)}
+
+	s.mu.Lock()
+	for token, stream := range s.streamTokens {
+		if time.Now().After(stream.expires) {
+			delete(s.streamTokens, token)
+		}
+	}
+	if s.streamTokens == nil {
+		s.streamTokens = make(map[string]streamToken)
+	}
+	s.streamTokens[issued.Token] = streamToken{jobID: job.ID, expires: issued.Expires}
+	s.mu.Unlock()
+
+	writeAPIJSON(w, http.StatusCreated, issued)
+}
+
+// useStreamToken spends a stream token, reporting whether it was issued for
+// the job and has not expired.
+func (s *apiServer) useStreamToken(token, jobID string) bool {
+	if token == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream, ok := s.streamTokens[token]
+	if !ok {
+		return false
+	}
+	delete(s.streamTokens, token)
+	return stream.jobID == jobID && time.Now().Before(stream.expires)
+}
+
+func (s *apiServer) handleListDrives(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, listDriveInfo())
+}
+
+func (s *apiServer) handleDriveInfo(w http.ResponseWriter, r *http.Request) {
+	details, err := driveDetails(r.PathValue("device"))
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, details)
+}
+
+func (s *apiServer) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeAPIJSON(w, http.StatusOK, s.listJobs())
+}
+
+func (s *apiServer) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	var request JobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	job, err := s.startJob(request)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusAccepted, job.snapshot(false))
+}
+
+func (s *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	job := s.job(r.PathValue("id"))
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, job.snapshot(true))
+}
+
+// handleJobEvents streams a job's output, progress, and final state as
+// server-sent events, replaying everything printed so far first. It takes
+// the API token in the Authorization header, or a stream token for this job
+// as ?stream_token=.
+func (s *apiServer) handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) && !s.useStreamToken(r.URL.Query().Get("stream_token"), r.PathValue("id")) {
+		writeAPIError(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+	job := s.job(r.PathValue("id"))
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sent := 0
+	for {
+		events, changed, done := job.eventsSince(&sent)
+		for _, event := range events {
+			data, _ := json.Marshal(event.data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+		}
+		flusher.Flush()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *apiServer) job(id string) *apiJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneJobs()
+	return s.jobs[id]
+}
+
+// pruneJobs drops jobs that finished more than finishedJobTTL ago, so a
+// long-running server doesn't keep every job's output. Callers hold s.mu.
+func (s *apiServer) pruneJobs() {
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := job.Finished != nil && time.Since(*job.Finished) > finishedJobTTL
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// apiError is a request failure and the HTTP status it maps to.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+// DriveDetails is the detailed view of one drive.
+type DriveDetails struct {
+	DriveInfo
+	Warning    string          `json:"warning,omitempty"`
+	Partitions *PartitionTable `json:"partitions,omitempty"`
+}
+
+func listDriveInfo() []DriveInfo {
+	drives := []DriveInfo{}
+	for _, device := range removableDevices() {
+		drives = append(drives, collectDriveInfo(device))
+	}
+	return drives
+}
+
+func driveDetails(device string) (DriveDetails, error) {
+	if err := validateDevice(device); err != nil {
+		return DriveDetails{}, &apiError{http.StatusBadRequest, err.Error()}
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		return DriveDetails{}, &apiError{http.StatusForbidden, err.Error()}
+	}
+
+	details := DriveDetails{DriveInfo: collectDriveInfo(device)}
+	details.Warning = filesystemCompatibilityWarning(details.Filesystem)
+	if table, err := readPartitionTable(device); err == nil {
+		details.Partitions = &table
+	}
+	return details, nil
+}
+
+func (s *apiServer) listJobs() []Job {
+	s.mu.Lock()
+	s.pruneJobs()
+	jobs := make([]*apiJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+
+	snapshots := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		snapshots = append(snapshots, job.snapshot(false))
+	}
+	return snapshots
+}
+
+// startJob validates a request and runs it in the background.
+func (s *apiServer) startJob(request JobRequest) (*apiJob, error) {
+	args, err := jobArguments(request)
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, err.Error()}
+	}
+	for _, device := range request.Devices {
+		if err := validateDevice(device); err != nil {
+			return nil, &apiError{http.StatusBadRequest, fmt.Sprintf("%s: %v", device, err)}
+		}
+		if err := ensureRemovableDevice(device); err != nil {
+			return nil, &apiError{http.StatusForbidden, err.Error()}
+		}
+	}
+
+	models := make(map[string]string)
+	for _, device := range request.Devices {
+		models[device] = getDriveModel(device)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneJobs()
+	for _, job := range s.jobs {
+		if busy := job.busyDevice(request.Devices); busy != "" {
+			return nil, &apiError{http.StatusConflict, fmt.Sprintf("%s is in use by job %s", busy, job.ID)}
+		}
+	}
+	job := &apiJob{
+		changed: make(chan struct{}),
+		Job: Job{
+			ID:      newJobID(),
+			Command: request.Command,
+			Devices: request.Devices,
+			State:   jobRunning,
+			Started: time.Now(),
+		},
+	}
+	s.jobs[job.ID] = job
+
+	go func() {
+		job.run(s.executable, args)
+		s.metrics.recordJob(job.snapshot(true), models)
+	}()
+	if s.jobStarted != nil {
+		go s.jobStarted(job)
+	}
+	return job, nil
+}
+
+// jobArguments turns an API request into cdjf command-line arguments.
+func jobArguments(request JobRequest) ([]string, error) {
+	allowed, ok := jobFlags[request.Command]
+	if !ok {
+		return nil, fmt.Errorf("unsupported command %q; use format or verify", request.Command)
+	}
+	if len(request.Devices) == 0 {
+		return nil, errors.New("at least one device is required")
+	}
+
+	args := append([]string{request.Command}, request.Devices...)
+	args = append(args, "--yes", "--no-color")
+	names := make([]string, 0, len(request.Options))
+	for name := range request.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !containsString(allowed, name) {
+			return nil, fmt.Errorf("option %q is not supported for %s", name, request.Command)
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", name, request.Options[name]))
+	}
+	return args, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// run executes the job as a cdjf subprocess and records its output.
+func (j *apiJob) run(executable string, args []string) {
+	cmd := execCommand(executable, args...)
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Start()
+	if err == nil {
+		go func() {
+			cmd.Wait()
+			writer.Close()
+		}()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			j.appendOutput(scanner.Text())
+		}
+		io.Copy(io.Discard, reader)
+	} else {
+		j.appendOutput(fmt.Sprintf("Error: unable to start cdjf: %v", err))
+	}
+
+	j.mu.Lock()
+	finished := time.Now()
+	j.Finished = &finished
+	j.ExitCode = -1
+	if cmd.ProcessState != nil {
+		j.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	j.State = jobFailed
+	if j.ExitCode == 0 {
+		j.State = jobSucceeded
+	}
+	j.notify()
+	j.mu.Unlock()
+}
+
+func (j *apiJob) appendOutput(line string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Output = append(j.Output, line)
+	if progress := parseJobProgress(line); progress != nil {
+		j.Progress = progress
+	}
+	j.notify()
+}
+
+// notify wakes every event stream waiting on the job. Callers hold j.mu.
+func (j *apiJob) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// eventsSince returns the events after the first *sent output lines, the
+// channel that is closed on the next change, and whether the job has ended.
+func (j *apiJob) eventsSince(sent *int) ([]jobEvent, <-chan struct{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var events []jobEvent
+	for _, line := range j.Output[*sent:] {
+		events = append(events, jobEvent{name: "output", data: line})
+		if progress := parseJobProgress(line); progress != nil {
+			events = append(events, jobEvent{name: "progress", data: progress})
+		}
+	}
+	*sent = len(j.Output)
+
+	done := j.State != jobRunning
+	if done {
+		events = append(events, jobEvent{name: "done", data: map[string]any{"state": j.State, "exit_code": j.ExitCode}})
+	}
+	return events, j.changed, done
+}
+
+func (j *apiJob) snapshot(withOutput bool) Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	copied := Job{
+		ID:       j.ID,
+		Command:  j.Command,
+		Devices:  j.Devices,
+		State:    j.State,
+		ExitCode: j.ExitCode,
+		Started:  j.Started,
+		Finished: j.Finished,
+		Progress: j.Progress,
+		Output:   []string{},
+	}
+	if withOutput {
+		copied.Output = append(copied.Output, j.Output...)
+	}
+	return copied
+}
+
+// parseJobProgress reads the plain progress lines cdjf prints when its output
+// is not a terminal, such as "Write: 40% (12.50 MB/s)".
+func parseJobProgress(line string) *JobProgress {
+	matches := progressLineRegex.FindStringSubmatch(line)
+	if len(matches) != 4 {
+		return nil
+	}
+	percent, _ := strconv.Atoi(matches[2])
+	mbps, _ := strconv.ParseFloat(matches[3], 64)
+	return &JobProgress{Stage: matches[1], Percent: percent, MBps: mbps}
+}
+
+// busyDevice returns the first of devices that this job is still working on.
+func (j *apiJob) busyDevice(devices []string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.State != jobRunning {
+		return ""
+	}
+	for _, device := range devices {
+		for _, used := range j.Devices {
+			if strings.EqualFold(device, used) {
+				return device
+			}
+		}
+	}
+	return ""
+}
+
+func newJobID() string {
+	id := make([]byte, 6)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// collectDriveInfo gathers the fields shown by cdjf list for one drive.
+func collectDriveInfo(device string) DriveInfo {
+	return deviceBackend.Info(device)
+}
+
+func (systemBackend) Info(device string) DriveInfo {
+	info := DriveInfo{
+		Device:     device,
+		Label:      getVolumeLabel(device),
+		Filesystem: getDriveFilesystem(device),
+		SizeGB:     getDriveSize(device),
+		Type:       "Removable",
+		IsSystem:   isSystemDrive(device),
+	}
+	info.FreeGB, _ = getDriveFreeSpace(device)
+	return info
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// writeAPIFailure reports err with its API status, or 500 for unexpected errors.
+func writeAPIFailure(w http.ResponseWriter, err error) {
+	var failure *apiError
+	if errors.As(err, &failure) {
+		writeAPIError(w, failure.status, failure.message)
+		return
+	}
+	writeAPIError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// simulatedBlockSize is the unit the error rate of a simulated drive applies
+// to: each block read back has that chance of coming back corrupted.
+const simulatedBlockSize = 1024 * 1024
+
+// parseSimulateSpec turns a --simulate value such as
+// "size=64GB,write=4MB/s,read=20MB/s,errors=0.001" into a fake drive.
+func parseSimulateSpec(spec string, index int) (fakeDrive, error) {
+	name := fmt.Sprintf("sim%d", index)
+	drive := fakeDrive{
+		Device:     name,
+		Model:      "Simulated Drive",
+		Serial:     fmt.Sprintf("SIM%04d", index),
+		SizeGB:     16,
+		Filesystem: "FAT32",
+		Label:      strings.ToUpper(name),
+		MountPoint: name,
+	}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return drive, fmt.Errorf("invalid --simulate field %q; use key=value", field)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "size":
+			size := parseSizeToGB(strings.ToUpper(value))
+			if size <= 0 {
+				return drive, fmt.Errorf("invalid --simulate size %q; use a value such as 64GB", value)
+			}
+			drive.SizeGB = size
+		case "write", "read":
+			rate, err := parseRateLimit(value)
+			if err != nil || rate <= 0 {
+				return drive, fmt.Errorf("invalid --simulate %s speed %q; use a value such as 20MB/s", key, value)
+			}
+			if key == "write" {
+				drive.WriteMBps = rate / (1024 * 1024)
+			} else {
+				drive.ReadMBps = rate / (1024 * 1024)
+			}
+		case "errors":
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return drive, fmt.Errorf("invalid --simulate error rate %q; use a fraction from 0 to 1", value)
+			}
+			drive.ErrorRate = rate
+		case "fs", "filesystem":
+			drive.Filesystem = value
+		case "label":
+			drive.Label = value
+		case "model":
+			drive.Model = value
+		default:
+			return drive, fmt.Errorf("unknown --simulate field %q (use size, write, read, errors, fs, label, or model)", key)
+		}
+	}
+	return drive, nil
+}
+
+// newSimulatedBackend builds a fake backend holding one drive per --simulate
+// value. The drives live in a scratch folder that is recreated on every run.
+func newSimulatedBackend(specs []string) (*fakeBackend, error) {
+	var file fakeDevicesFile
+	for i, spec := range specs {
+		drive, err := parseSimulateSpec(spec, i+1)
+		if err != nil {
+			return nil, err
+		}
+		file.Drives = append(file.Drives, drive)
+	}
+
+	dir := filepath.Join(os.TempDir(), "cdjf-simulate")
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("unable to reset simulated drives: %w", err)
+	}
+	for _, drive := range file.Drives {
+		if err := os.MkdirAll(filepath.Join(dir, drive.MountPoint), 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create simulated drive: %w", err)
+		}
+	}
+	fake := &fakeBackend{path: filepath.Join(dir, "devices.json")}
+	if err := fake.save(file); err != nil {
+		return nil, fmt.Errorf("unable to create simulated drives: %w", err)
+	}
+	return fake, nil
+}
+
+// startSimulation swaps in simulated drives when --simulate was given.
+func startSimulation(specs []string) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	fake, err := newSimulatedBackend(specs)
+	if err != nil {
+		return err
+	}
+	deviceBackend = fake
+	return nil
+}
+
+// driveSimulation slows down and corrupts the file I/O that benchmarks and
+// verify passes do on a fake drive. A nil *driveSimulation does nothing.
+type driveSimulation struct {
+	write     *RateLimiter
+	read      *RateLimiter
+	errorRate float64
+}
+
+// simulationFor returns the simulation for the fake drive whose mount point
+// holds path, or nil when path is on a real drive or the drive runs at full
+// speed without errors.
+func simulationFor(path string) *driveSimulation {
+	fake := activeFakeBackend()
+	if fake == nil {
+		return nil
+	}
+	for _, device := range fake.Enumerate() {
+		drive := fake.drive(device)
+		if drive.MountPoint == "" || (drive.WriteMBps <= 0 && drive.ReadMBps <= 0 && drive.ErrorRate <= 0) {
+			continue
+		}
+		if rel, err := filepath.Rel(drive.MountPoint, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return &driveSimulation{
+				write:     simulatedLimiter(drive.WriteMBps),
+				read:      simulatedLimiter(drive.ReadMBps),
+				errorRate: drive.ErrorRate,
+			}
+		}
+	}
+	return nil
+}
+
+// simulatedLimiter paces I/O at mbps without the burst a --limit allows, so
+// short benchmarks measure the configured speed.
+func simulatedLimiter(mbps float64) *RateLimiter {
+	if mbps <= 0 {
+		return nil
+	}
+	rate := mbps * 1024 * 1024
+	return &RateLimiter{rate: rate, burst: simulatedBlockSize, last: time.Now()}
+}
+
+// wrote holds a write of n bytes to the drive's write speed.
+func (s *driveSimulation) wrote(n int) {
+	if s == nil {
+		return
+	}
+	s.write.Wait(n)
+}
+
+// readBack holds a read to the drive's read speed and corrupts each block of
+// buf with the drive's error rate.
+func (s *driveSimulation) readBack(buf []byte) {
+	if s == nil {
+		return
+	}
+	s.read.Wait(len(buf))
+	if s.errorRate <= 0 {
+		return
+	}
+	for start := 0; start < len(buf); start += simulatedBlockSize {
+		if rand.Float64() < s.errorRate {
+			end := min(start+simulatedBlockSize, len(buf))
+			buf[start+rand.IntN(end-start)] ^= 0xFF
+		}
+	}
+}
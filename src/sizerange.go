@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SizeRange is the capacity a drive is expected to have, in GB. A zero bound
+// is open, so a range can be just a minimum or just a maximum.
+type SizeRange struct {
+	MinGB float64
+	MaxGB float64
+}
+
+// parseSizeRange reads bounds such as "57GB..60GB", "57GB..", or "..60GB".
+// An empty value is no range at all.
+func parseSizeRange(value string) (SizeRange, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return SizeRange{}, nil
+	}
+	invalid := fmt.Errorf("invalid size range %q; use MIN..MAX such as 57GB..60GB, or leave one side open as in 57GB.. or ..60GB", value)
+	low, high, ok := strings.Cut(trimmed, "..")
+	if !ok {
+		return SizeRange{}, invalid
+	}
+	var r SizeRange
+	if low = strings.TrimSpace(low); low != "" {
+		if r.MinGB = parseSizeToGB(strings.ToUpper(low)); r.MinGB <= 0 {
+			return SizeRange{}, invalid
+		}
+	}
+	if high = strings.TrimSpace(high); high != "" {
+		if r.MaxGB = parseSizeToGB(strings.ToUpper(high)); r.MaxGB <= 0 {
+			return SizeRange{}, invalid
+		}
+	}
+	if r.MinGB == 0 && r.MaxGB == 0 {
+		return SizeRange{}, invalid
+	}
+	if r.MaxGB > 0 && r.MinGB > r.MaxGB {
+		return SizeRange{}, fmt.Errorf("invalid size range %q; the minimum is larger than the maximum", value)
+	}
+	return r, nil
+}
+
+func (r SizeRange) IsZero() bool {
+	return r.MinGB == 0 && r.MaxGB == 0
+}
+
+func (r SizeRange) Contains(sizeGB float64) bool {
+	return sizeGB >= r.MinGB && (r.MaxGB == 0 || sizeGB <= r.MaxGB)
+}
+
+func (r SizeRange) String() string {
+	switch {
+	case r.MaxGB == 0:
+		return fmt.Sprintf("at least %g GB", r.MinGB)
+	case r.MinGB == 0:
+		return fmt.Sprintf("at most %g GB", r.MaxGB)
+	}
+	return fmt.Sprintf("%g-%g GB", r.MinGB, r.MaxGB)
+}
+
+// checkExpectedSize fails when device's capacity is outside expected, such as
+// a backup SSD plugged into a duplicator loaded with 64 GB sticks. A drive
+// whose size cannot be read fails too, since it cannot be shown to fit.
+func checkExpectedSize(device string, expected SizeRange) error {
+	if expected.IsZero() {
+		return nil
+	}
+	size := getDriveSize(device)
+	if size <= 0 {
+		return fmt.Errorf("unable to read the size of %s to check it against the expected %s", device, expected)
+	}
+	if !expected.Contains(size) {
+		return fmt.Errorf("%s is %.1f GB, outside the expected %s", device, size, expected)
+	}
+	return nil
+}
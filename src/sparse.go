@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// sparseImageMagic starts images that hold only the allocated regions of a drive.
+var sparseImageMagic = []byte("CDJFSPRS")
+
+const sparseImageVersion = 1
+
+// Extent is a byte range of a disk.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+func extentsLength(extents []Extent) int64 {
+	var total int64
+	for _, extent := range extents {
+		total += extent.Length
+	}
+	return total
+}
+
+// addExtent appends a range, merging it with the previous one when they touch.
+func addExtent(extents []Extent, offset, length int64) []Extent {
+	if length <= 0 {
+		return extents
+	}
+	if n := len(extents); n > 0 && extents[n-1].Offset+extents[n-1].Length == offset {
+		extents[n-1].Length += length
+		return extents
+	}
+	return append(extents, Extent{Offset: offset, Length: length})
+}
+
+// writeSparseHeader writes the magic, disk size, and extent table. The extent
+// data follows in table order.
+func writeSparseHeader(w io.Writer, diskSize int64, extents []Extent) error {
+	header := make([]byte, 0, 24+16*len(extents))
+	header = append(header, sparseImageMagic...)
+	header = binary.LittleEndian.AppendUint32(header, sparseImageVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(extents)))
+	header = binary.LittleEndian.AppendUint64(header, uint64(diskSize))
+	for _, extent := range extents {
+		header = binary.LittleEndian.AppendUint64(header, uint64(extent.Offset))
+		header = binary.LittleEndian.AppendUint64(header, uint64(extent.Length))
+	}
+	_, err := w.Write(header)
+	return err
+}
+
+// readSparseHeader reads the header written by writeSparseHeader. size is the
+// length of the image file, or -1 when it is compressed or encrypted and the
+// length of the data is not known up front. The extent table is checked
+// before any of it is trusted: extents must be in order, must not overlap,
+// must lie within the disk, and must fit in the file along with their data.
+func readSparseHeader(r io.Reader, size int64) (int64, []Extent, error) {
+	fixed := make([]byte, 24)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return 0, nil, fmt.Errorf("read sparse image header: %w", err)
+	}
+	if !bytes.Equal(fixed[0:8], sparseImageMagic) {
+		return 0, nil, fmt.Errorf("not a sparse cdjf image")
+	}
+	if version := binary.LittleEndian.Uint32(fixed[8:12]); version != sparseImageVersion {
+		return 0, nil, fmt.Errorf("unsupported sparse image version %d", version)
+	}
+	count := binary.LittleEndian.Uint32(fixed[12:16])
+	diskSize := int64(binary.LittleEndian.Uint64(fixed[16:24]))
+
+	if diskSize < 0 {
+		return 0, nil, fmt.Errorf("sparse image header gives an invalid disk size")
+	}
+	remaining := size - int64(len(fixed))
+	if size >= 0 && int64(count) > remaining/16 {
+		return 0, nil, fmt.Errorf("sparse image header lists %d extents, more than the %d-byte file can hold", count, size)
+	}
+
+	// The table is read an entry at a time so a header from a stream of
+	// unknown length cannot make us allocate more than the stream holds.
+	var extents []Extent
+	var end, data int64
+	entry := make([]byte, 16)
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return 0, nil, fmt.Errorf("read sparse image extents: %w", err)
+		}
+		extent := Extent{
+			Offset: int64(binary.LittleEndian.Uint64(entry[0:8])),
+			Length: int64(binary.LittleEndian.Uint64(entry[8:16])),
+		}
+		if extent.Offset < end || extent.Length <= 0 || extent.Length > diskSize-extent.Offset {
+			return 0, nil, fmt.Errorf("sparse image extent %d (offset %d, length %d) is out of order, overlaps another, or lies outside the %d-byte disk", i, extent.Offset, extent.Length, diskSize)
+		}
+		end = extent.Offset + extent.Length
+		data += extent.Length
+		extents = append(extents, extent)
+	}
+	if size >= 0 && data > remaining-16*int64(count) {
+		return 0, nil, fmt.Errorf("sparse image extents hold %d bytes, but the file is only %d bytes; the image is truncated", data, size)
+	}
+	return diskSize, extents, nil
+}
+
+// usedExtents lists the parts of a disk that hold data: everything before the
+// first volume's cluster heap, each allocated cluster, and everything after the
+// volume (other partitions and backup partition tables).
+func usedExtents(file *os.File, base int64, boot BootSector, diskSize int64) ([]Extent, error) {
+	clusterSize := int64(boot.ClusterSize())
+	heapStart := base + boot.DataRegionOffset()
+	if clusterSize <= 0 || boot.ClusterCount == 0 {
+		return nil, fmt.Errorf("invalid cluster layout")
+	}
+
+	extents := addExtent(nil, 0, heapStart)
+	mark := func(cluster uint32, used bool) {
+		if used {
+			extents = addExtent(extents, heapStart+int64(cluster-2)*clusterSize, clusterSize)
+		}
+	}
+
+	switch boot.FilesystemType {
+	case "FAT32", "FAT16":
+		if err := walkFATAllocation(file, base, boot, mark); err != nil {
+			return nil, err
+		}
+	case "exFAT":
+		bitmap, err := readExFATBitmap(file, base, boot)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < boot.ClusterCount; i++ {
+			mark(i+2, int(i/8) < len(bitmap) && bitmap[i/8]&(1<<(i%8)) != 0)
+		}
+	default:
+		return nil, fmt.Errorf("sparse imaging is not supported for %s", boot.FilesystemType)
+	}
+
+	volumeEnd := base + int64(boot.TotalSectors)*int64(boot.BytesPerSector)
+	if volumeEnd < diskSize {
+		extents = addExtent(extents, volumeEnd, diskSize-volumeEnd)
+	}
+	return extents, nil
+}
+
+// walkFATAllocation reads the first FAT in chunks and reports each data
+// cluster as used when its entry is non-zero.
+func walkFATAllocation(file *os.File, base int64, boot BootSector, mark func(uint32, bool)) error {
+	entrySize := int64(4)
+	if boot.FilesystemType == "FAT16" {
+		entrySize = 2
+	}
+	fatStart := base + int64(boot.ReservedSectors)*int64(boot.BytesPerSector)
+	lastCluster := int64(boot.ClusterCount) + 1
+
+	buf := make([]byte, 1024*1024)
+	for first := int64(0); first <= lastCluster; first += int64(len(buf)) / entrySize {
+		n, err := file.ReadAt(buf, fatStart+first*entrySize)
+		if n == 0 && err != nil {
+			return fmt.Errorf("read FAT: %w", err)
+		}
+		for i := int64(0); i+entrySize <= int64(n); i += entrySize {
+			cluster := first + i/entrySize
+			if cluster < 2 {
+				continue
+			}
+			if cluster > lastCluster {
+				return nil
+			}
+			var entry uint32
+			if entrySize == 4 {
+				entry = binary.LittleEndian.Uint32(buf[i:]) & 0x0FFFFFFF
+			} else {
+				entry = uint32(binary.LittleEndian.Uint16(buf[i:]))
+			}
+			mark(uint32(cluster), entry != 0)
+		}
+	}
+	return nil
+}
+
+// readExFATChain reads up to limit bytes of a cluster chain by following the FAT.
+func readExFATChain(file *os.File, base int64, boot BootSector, first uint32, limit int64) ([]byte, error) {
+	clusterSize := int64(boot.ClusterSize())
+	fatStart := base + int64(boot.ReservedSectors)*int64(boot.BytesPerSector)
+	heapStart := base + boot.DataRegionOffset()
+
+	var data []byte
+	entry := make([]byte, 4)
+	cluster := first
+	for visited := uint32(0); cluster >= 2 && cluster < 0xFFFFFFF7 && int64(len(data)) < limit; visited++ {
+		if visited > boot.ClusterCount {
+			return nil, fmt.Errorf("cluster chain loops")
+		}
+		buf := make([]byte, clusterSize)
+		if _, err := file.ReadAt(buf, heapStart+int64(cluster-2)*clusterSize); err != nil {
+			return nil, fmt.Errorf("read cluster %d: %w", cluster, err)
+		}
+		data = append(data, buf...)
+
+		if _, err := file.ReadAt(entry, fatStart+int64(cluster)*4); err != nil {
+			return nil, fmt.Errorf("read FAT: %w", err)
+		}
+		cluster = binary.LittleEndian.Uint32(entry)
+	}
+	if int64(len(data)) > limit {
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+// readExFATBitmap finds the allocation bitmap entry in the root directory and
+// returns the bitmap, one bit per cluster starting at cluster 2.
+func readExFATBitmap(file *os.File, base int64, boot BootSector) ([]byte, error) {
+	rootLimit := int64(boot.ClusterSize()) * 64
+	root, err := readExFATChain(file, base, boot, boot.RootCluster, rootLimit)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+32 <= len(root); i += 32 {
+		entry := root[i : i+32]
+		if entry[0] == 0x00 {
+			break
+		}
+		if entry[0] != 0x81 {
+			continue
+		}
+		first := binary.LittleEndian.Uint32(entry[20:24])
+		length := int64(binary.LittleEndian.Uint64(entry[24:32]))
+		return readExFATChain(file, base, boot, first, length)
+	}
+	return nil, fmt.Errorf("exFAT allocation bitmap not found")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Target describes the filesystem layout a specific player generation expects.
+type Target struct {
+	Name          string
+	Description   string
+	Filesystem    string
+	Scheme        string
+	ClusterSize   string
+	MaxCapacityGB float64
+	Folders       []string
+	// Scripts are the Unicode scripts the firmware has fonts for, checked by
+	// preflight against labels and file names. Empty means all scripts.
+	Scripts []string
+	// ScriptAdvice tells the DJ what to do about names in other scripts.
+	ScriptAdvice string
+}
+
+// scriptAdvice returns the target's advice for names it cannot show.
+func (t Target) scriptAdvice() string {
+	if t.ScriptAdvice != "" {
+		return t.ScriptAdvice
+	}
+	return fmt.Sprintf("the %s shows only %s text, so transliterate these names in your library", t.Description, strings.Join(t.Scripts, ", "))
+}
+
+var builtinTargets = map[string]Target{
+	"cdj2000nxs2": {
+		Name:          "cdj2000nxs2",
+		Description:   "Pioneer CDJ-2000NXS2",
+		Filesystem:    "FAT32",
+		Scheme:        "MBR",
+		ClusterSize:   "32K",
+		MaxCapacityGB: 1024,
+		Scripts:       []string{"Latin", "Han", "Hiragana", "Katakana"},
+		ScriptAdvice:  "the CDJ-2000NXS2 has Latin and Japanese fonts only and shows other scripts as blanks; transliterate these names in your library, or play them from a CDJ-3000",
+	},
+	"cdj3000": {
+		Name:          "cdj3000",
+		Description:   "Pioneer CDJ-3000",
+		Filesystem:    "exFAT",
+		Scheme:        "MBR",
+		ClusterSize:   "64K",
+		MaxCapacityGB: 2048,
+	},
+	"xdj-rx3": {
+		Name:          "xdj-rx3",
+		Description:   "Pioneer XDJ-RX3",
+		Filesystem:    "FAT32",
+		Scheme:        "MBR",
+		ClusterSize:   "32K",
+		MaxCapacityGB: 1024,
+	},
+	"opus-quad": {
+		Name:          "opus-quad",
+		Description:   "Pioneer OPUS-QUAD",
+		Filesystem:    "exFAT",
+		Scheme:        "MBR",
+		ClusterSize:   "64K",
+		MaxCapacityGB: 2048,
+	},
+	"engine": {
+		Name:          "engine",
+		Description:   "Denon Engine DJ",
+		Filesystem:    "exFAT",
+		Scheme:        "MBR",
+		MaxCapacityGB: 2048,
+		Folders: []string{
+			"Engine Library",
+			"Engine Library/Database2",
+			"Engine Library/Music",
+		},
+	},
+	"serato": {
+		Name:          "serato",
+		Description:   "Serato DJ",
+		Filesystem:    "FAT32",
+		Scheme:        "MBR",
+		ClusterSize:   "32K",
+		MaxCapacityGB: 2048,
+		Folders: []string{
+			"_Serato_",
+			"_Serato_/Subcrates",
+		},
+	},
+	"traktor": {
+		Name:          "traktor",
+		Description:   "Native Instruments Traktor",
+		Filesystem:    "exFAT",
+		Scheme:        "MBR",
+		MaxCapacityGB: 2048,
+	},
+}
+
+var defaultTarget = Target{
+	Name:          "rekordbox",
+	Description:   "Generic rekordbox USB",
+	Filesystem:    "FAT32",
+	Scheme:        "MBR",
+	MaxCapacityGB: 1024,
+	Scripts:       []string{"Latin"},
+	ScriptAdvice:  "older players such as the CDJ-2000 and CDJ-900 show only Latin letters and leave other scripts blank; transliterate these names in your library, or pass --target for newer players",
+}
+
+func lookupTarget(name string) (Target, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		return defaultTarget, nil
+	}
+	target, ok := builtinTargets[key]
+	if !ok {
+		return Target{}, fmt.Errorf("unknown target %q; run 'cdjf targets' to see supported players", name)
+	}
+	return target, nil
+}
+
+func sortedTargetNames() []string {
+	names := make([]string, 0, len(builtinTargets))
+	for name := range builtinTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func normalizeFilesystem(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "fat32", "msdos", "ms-dos":
+		return "FAT32", nil
+	case "exfat":
+		return "exFAT", nil
+	case "udf":
+		return "UDF", nil
+	}
+	return "", fmt.Errorf("invalid filesystem %q; supported values: fat32, exfat, udf (experimental)", value)
+}
+
+func filesystemCompatibilityWarning(filesystem string) string {
+	upper := strings.ToUpper(strings.TrimSpace(filesystem))
+	switch {
+	case upper == "":
+		return ""
+	case strings.Contains(upper, "UDF"):
+		return "UDF is experimental: rekordbox and Pioneer CDJ/XDJ players do not officially support it."
+	case strings.Contains(upper, "NTFS"):
+		return "NTFS is not readable by Pioneer CDJ/XDJ players."
+	case strings.Contains(upper, "APFS"):
+		return "APFS is not readable by Pioneer CDJ/XDJ players."
+	}
+	return ""
+}
+
+func normalizeScheme(value string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "MBR":
+		return "MBR", nil
+	case "GPT":
+		return "GPT", nil
+	}
+	return "", fmt.Errorf("invalid partition scheme %q; supported values: mbr, gpt", value)
+}
+
+func createTargetFolders(device string, folders []string) error {
+	if len(folders) == 0 {
+		return nil
+	}
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range folders {
+		path := filepath.Join(mountPoint, filepath.FromSlash(folder))
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", folder, err)
+		}
+	}
+	return nil
+}
+
+func listTargets(cmd *cobra.Command, args []string) {
+	fmt.Println("Supported targets:")
+	fmt.Println()
+	fmt.Printf("%-14s %-26s %-8s %-7s %-8s %s\n", "NAME", "DESCRIPTION", "FS", "SCHEME", "CLUSTER", "MAX SIZE")
+	for _, name := range sortedTargetNames() {
+		target := builtinTargets[name]
+		cluster := target.ClusterSize
+		if cluster == "" {
+			cluster = "default"
+		}
+		fmt.Printf("%-14s %-26s %-8s %-7s %-8s %.0f GB\n",
+			target.Name, target.Description, target.Filesystem, target.Scheme, cluster, target.MaxCapacityGB)
+		if len(target.Folders) > 0 {
+			fmt.Printf("%-14s creates: %s\n", "", strings.Join(target.Folders, ", "))
+		}
+		if len(target.Scripts) > 0 {
+			fmt.Printf("%-14s shows: %s text only\n", "", strings.Join(target.Scripts, ", "))
+		}
+	}
+	fmt.Println()
+	fmt.Println("Use a target with: cdjf format --target <name> <device>")
+	fmt.Println("Override individual settings with --fs, --scheme, or --cluster-size.")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var (
+	cachedTerminalWidth atomic.Int64
+	terminalWatchOnce   sync.Once
+)
+
+// userInput is where prompt answers come from. A --record or --replay
+// session swaps it out before any prompt is shown.
+var userInput io.Reader = os.Stdin
+
+var (
+	sharedStdinReader *bufio.Reader
+	stdinReaderOnce   sync.Once
+)
+
+// stdinReader returns the one buffered reader every prompt shares, so input
+// typed ahead for a later prompt is not swallowed by an earlier one.
+func stdinReader() *bufio.Reader {
+	stdinReaderOnce.Do(func() {
+		sharedStdinReader = bufio.NewReader(userInput)
+	})
+	return sharedStdinReader
+}
+
+// terminalWidth returns the current width of stdout in columns. The value is
+// refreshed whenever the terminal is resized.
+func terminalWidth() int {
+	terminalWatchOnce.Do(func() {
+		refreshTerminalWidth()
+		watchTerminalResize(refreshTerminalWidth)
+	})
+	return int(cachedTerminalWidth.Load())
+}
+
+func refreshTerminalWidth() {
+	width := 0
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		width = w
+	} else if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		width = cols
+	} else {
+		width = 80
+	}
+	cachedTerminalWidth.Store(int64(width))
+}
+
+// runCountdown counts down before a destructive operation starts. Any key
+// cancels it when stdin is a terminal; otherwise only Ctrl+C does. It reports
+// whether the countdown ran to completion.
+func runCountdown(action string, seconds int) bool {
+	interactive := term.IsTerminal(int(os.Stdout.Fd()))
+	wait := func(timeout time.Duration) bool {
+		time.Sleep(timeout)
+		return false
+	}
+	hint := "press Ctrl+C to cancel"
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if listen, stop, err := startKeyListener(); err == nil {
+			defer stop()
+			wait = listen
+			hint = "press any key to cancel"
+		}
+	}
+
+	for remaining := seconds; remaining > 0; remaining-- {
+		if interactive {
+			fmt.Printf("\r%s in %ds (%s)...  ", action, remaining, hint)
+		} else if remaining == seconds {
+			fmt.Printf("%s in %ds (%s)...\n", action, remaining, hint)
+		}
+		if wait(time.Second) {
+			if interactive {
+				fmt.Print("\r\n")
+			}
+			return false
+		}
+	}
+	if interactive {
+		fmt.Print("\r\n")
+	}
+	return true
+}
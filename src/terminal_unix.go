@@ -0,0 +1,48 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+func watchTerminalResize(onResize func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		for range signals {
+			onResize()
+		}
+	}()
+}
+
+func enableVirtualTerminal() bool {
+	return true
+}
+
+// startKeyListener switches the terminal on stdin to raw mode so single key
+// presses can be seen without Enter. stop restores the terminal.
+func startKeyListener() (wait func(time.Duration) bool, stop func(), err error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	wait = func(timeout time.Duration) bool {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(timeout.Milliseconds()))
+		if err != nil || n == 0 {
+			return false
+		}
+		buf := make([]byte, 16)
+		read, _ := unix.Read(fd, buf)
+		return read > 0
+	}
+	return wait, func() { term.Restore(fd, state) }, nil
+}
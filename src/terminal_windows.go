@@ -0,0 +1,79 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procReadConsoleInput = windows.NewLazySystemDLL("kernel32.dll").NewProc("ReadConsoleInputW")
+
+const keyEvent = 0x0001
+
+// inputRecord mirrors the console INPUT_RECORD structure. For key events the
+// first four bytes of the event are the bKeyDown flag.
+type inputRecord struct {
+	eventType uint16
+	_         uint16
+	event     [16]byte
+}
+
+// Windows consoles have no resize signal, so poll the size while running.
+func watchTerminalResize(onResize func()) {
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for range ticker.C {
+			onResize()
+		}
+	}()
+}
+
+// enableVirtualTerminal turns on ANSI escape handling for the console.
+func enableVirtualTerminal() bool {
+	handle := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
+
+// startKeyListener watches the console input buffer for key presses, which
+// are reported without waiting for Enter.
+func startKeyListener() (wait func(time.Duration) bool, stop func(), err error) {
+	handle := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return nil, nil, err
+	}
+	wait = func(timeout time.Duration) bool {
+		deadline := time.Now().Add(timeout)
+		for {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false
+			}
+			event, err := windows.WaitForSingleObject(handle, uint32(remaining.Milliseconds()))
+			if err != nil || event != windows.WAIT_OBJECT_0 {
+				return false
+			}
+			// Focus, mouse, and key-up events also wake the wait; only a key
+			// going down counts.
+			var record inputRecord
+			var read uint32
+			ok, _, _ := procReadConsoleInput.Call(uintptr(handle), uintptr(unsafe.Pointer(&record)), 1, uintptr(unsafe.Pointer(&read)))
+			if ok != 0 && read == 1 && record.eventType == keyEvent && record.event[0] != 0 {
+				return true
+			}
+		}
+	}
+	return wait, func() {}, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FAT stores modification times in local time with two-second resolution,
+// from 1980 to 2107.
+var (
+	fatEarliestTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.Local)
+	fatLatestTime   = time.Date(2107, 12, 31, 23, 59, 58, 0, time.Local)
+)
+
+// TimestampProblem is a file whose modification time a FAT drive cannot hold
+// as is, or that makes no sense.
+type TimestampProblem struct {
+	// Path is relative to the volume root.
+	Path   string
+	Reason string
+	Old    time.Time
+	New    time.Time
+}
+
+// normalizeFATTime rounds a time down to the two-second steps FAT stores and
+// clamps it to the range FAT can hold and to now. shift moves it first, for a
+// drive written on a computer set to another time zone.
+func normalizeFATTime(t time.Time, shift time.Duration, now time.Time) (time.Time, string) {
+	reason := ""
+	t = t.Add(shift).Local()
+	if shift != 0 {
+		reason = fmt.Sprintf("shifted by %s", shift)
+	}
+	switch {
+	case t.After(now):
+		t, reason = now, "in the future"
+	case t.Before(fatEarliestTime):
+		t, reason = fatEarliestTime, "before 1980, which FAT cannot store"
+	case t.After(fatLatestTime):
+		t, reason = fatLatestTime, "after 2107, which FAT cannot store"
+	}
+	rounded := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()-t.Second()%2, 0, time.Local)
+	if reason == "" && !rounded.Equal(t) {
+		reason = "finer than FAT's two-second resolution"
+	}
+	return rounded, reason
+}
+
+// scanTimestamps lists the files whose modification times change when
+// normalized. The PIONEER folder is left alone: rekordbox owns those files.
+func scanTimestamps(mountPoint string, shift time.Duration) ([]TimestampProblem, error) {
+	var problems []TimestampProblem
+	now := time.Now()
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(mountPoint, path)
+		name := entry.Name()
+		if rel != "." && (strings.HasPrefix(name, ".") || containsFold(payloadMetadataFolders, strings.Split(filepath.ToSlash(rel), "/")[0])) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		normalized, reason := normalizeFATTime(info.ModTime(), shift, now)
+		if reason != "" {
+			problems = append(problems, TimestampProblem{Path: filepath.ToSlash(rel), Reason: reason, Old: info.ModTime(), New: normalized})
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// checkTimestamps reports modification times that sync tools may see as
+// changes after a cross-platform copy and, with fix, offers to normalize them.
+func checkTimestamps(device string, shift time.Duration, fix bool) {
+	fmt.Println()
+	title := "Timestamps:"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("-", len(title)))
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		return
+	}
+	problems, err := scanTimestamps(mountPoint, shift)
+	if err != nil {
+		printError("Error scanning timestamps: %v", err)
+		return
+	}
+	if len(problems) == 0 {
+		printOK("All modification times are already in FAT form.")
+		return
+	}
+
+	counts := make(map[string]int)
+	var reasons []string
+	for _, problem := range problems {
+		if counts[problem.Reason] == 0 {
+			reasons = append(reasons, problem.Reason)
+		}
+		counts[problem.Reason]++
+	}
+	fmt.Printf("%d file(s) have modification times that need normalizing:\n", len(problems))
+	for _, reason := range reasons {
+		fmt.Printf("  %5d %s\n", counts[reason], reason)
+	}
+	for i, problem := range problems {
+		if i == 5 {
+			fmt.Printf("  ...and %d more\n", len(problems)-i)
+			break
+		}
+		fmt.Printf("  %s: %s -> %s\n", problem.Path, problem.Old.Local().Format("2006-01-02 15:04:05.000"), problem.New.Format("2006-01-02 15:04:05"))
+	}
+	if !fix {
+		fmt.Println("Run with --fix-times to normalize them.")
+		return
+	}
+
+	response := ask("normalize-times", "Normalize these modification times? (y/N): ")
+	if response != "y" && response != "yes" {
+		fmt.Println("Nothing was changed.")
+		return
+	}
+	fixed := 0
+	for _, problem := range problems {
+		path := filepath.Join(mountPoint, filepath.FromSlash(problem.Path))
+		if err := os.Chtimes(path, problem.New, problem.New); err != nil {
+			printError("Unable to set the time of %s: %v", problem.Path, err)
+			continue
+		}
+		fixed++
+	}
+	printOK("Normalized the modification times of %d of %d files.", fixed, len(problems))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transcriptShimArg marks a cdjf process started to run one external command
+// on behalf of a recording or replaying session.
+const transcriptShimArg = "__transcript-exec"
+
+const (
+	transcriptRecord = "record"
+	transcriptReplay = "replay"
+
+	transcriptSession = "session"
+	transcriptCommand = "command"
+	transcriptInput   = "input"
+)
+
+// TranscriptEntry is one line of a --record transcript.
+type TranscriptEntry struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Session header.
+	OS      string   `json:"os,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Args    []string `json:"args,omitempty"`
+
+	// External command and what it printed.
+	Command  []string `json:"command,omitempty"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exit_code,omitempty"`
+
+	// Text typed at a prompt.
+	Input string `json:"input,omitempty"`
+}
+
+// transcript is the session being recorded or replayed, if any.
+var transcript struct {
+	mode string
+	path string
+	self string
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// startTranscript begins recording to recordPath or replaying from
+// replayPath. External commands are then run through a copy of cdjf that
+// records or replays them, and prompt answers are read through the session.
+func startTranscript(recordPath, replayPath string) error {
+	if recordPath == "" && replayPath == "" {
+		return nil
+	}
+	if recordPath != "" && replayPath != "" {
+		return errors.New("--record and --replay cannot be used together")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to locate the cdjf executable: %w", err)
+	}
+	transcript.self = self
+	transcript.seen = make(map[string]int)
+
+	if recordPath != "" {
+		transcript.mode, transcript.path = transcriptRecord, recordPath
+		if err := os.WriteFile(recordPath, nil, 0o600); err != nil {
+			return fmt.Errorf("unable to create transcript: %w", err)
+		}
+		header := TranscriptEntry{Type: transcriptSession, OS: runtime.GOOS, Version: version, Args: os.Args[1:]}
+		if err := appendTranscript(recordPath, header); err != nil {
+			return err
+		}
+		userInput = &recordingReader{source: os.Stdin, path: recordPath}
+		return nil
+	}
+
+	transcript.mode, transcript.path = transcriptReplay, replayPath
+	entries, err := readTranscript(replayPath)
+	if err != nil {
+		return err
+	}
+	var inputs strings.Builder
+	for _, entry := range entries {
+		switch entry.Type {
+		case transcriptSession:
+			if entry.OS != runtime.GOOS {
+				return fmt.Errorf("%s was recorded on %s; replay it on %s", replayPath, entry.OS, entry.OS)
+			}
+			fmt.Printf("Replaying %s (cdjf %s: cdjf %s)\n\n", replayPath, entry.Version, strings.Join(entry.Args, " "))
+		case transcriptInput:
+			inputs.WriteString(entry.Input)
+		}
+	}
+	userInput = strings.NewReader(inputs.String())
+	return nil
+}
+
+// execCommand is exec.Command, except that during a --record or --replay
+// session the command runs through the transcript shim. At -vv the command
+// line is echoed to stderr.
+func execCommand(name string, args ...string) *exec.Cmd {
+	if verbosity >= verbosityRaw {
+		fmt.Fprintf(os.Stderr, "+ %s\n", strings.Join(append([]string{name}, args...), " "))
+	}
+	if transcript.mode == "" {
+		return exec.Command(name, args...)
+	}
+	command := append([]string{name}, args...)
+	key := strings.Join(command, "\x00")
+	transcript.mu.Lock()
+	occurrence := transcript.seen[key]
+	transcript.seen[key]++
+	transcript.mu.Unlock()
+
+	shimArgs := []string{transcriptShimArg, transcript.mode, transcript.path, strconv.Itoa(occurrence)}
+	return exec.Command(transcript.self, append(shimArgs, command...)...)
+}
+
+// runTranscriptShim runs or replays one external command and returns the
+// exit code to leave with. Arguments are mode, transcript path, occurrence,
+// then the command line.
+func runTranscriptShim(args []string) int {
+	if len(args) < 4 {
+		fmt.Fprintln(os.Stderr, "cdjf: invalid transcript command")
+		return 2
+	}
+	mode, path, command := args[0], args[1], args[3:]
+	occurrence, _ := strconv.Atoi(args[2])
+
+	if mode == transcriptReplay {
+		entries, err := readTranscript(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cdjf replay: %v\n", err)
+			return 127
+		}
+		for _, entry := range entries {
+			if entry.Type != transcriptCommand || !sameCommand(entry.Command, command) {
+				continue
+			}
+			if occurrence > 0 {
+				occurrence--
+				continue
+			}
+			os.Stdout.WriteString(entry.Stdout)
+			os.Stderr.WriteString(entry.Stderr)
+			return entry.ExitCode
+		}
+		fmt.Fprintf(os.Stderr, "cdjf replay: no recorded output for %q\n", strings.Join(command, " "))
+		return 127
+	}
+
+	var stdout, stderr bytes.Buffer
+	child := exec.Command(command[0], command[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	child.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	exitCode := 0
+	if err := child.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+			stderr.WriteString(err.Error() + "\n")
+			exitCode = 127
+		}
+	}
+	entry := TranscriptEntry{Type: transcriptCommand, Command: command, Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode}
+	if err := appendTranscript(path, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "cdjf record: %v\n", err)
+	}
+	return exitCode
+}
+
+func sameCommand(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// appendTranscript adds one entry to the transcript. Commands may finish
+// concurrently, so each entry is written with a single append.
+func appendTranscript(path string, entry TranscriptEntry) error {
+	entry.Time = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func readTranscript(path string) ([]TranscriptEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read transcript: %w", err)
+	}
+	defer file.Close()
+
+	var entries []TranscriptEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// recordingReader passes prompt answers through while adding them to the
+// transcript.
+type recordingReader struct {
+	source io.Reader
+	path   string
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		appendTranscript(r.path, TranscriptEntry{Type: transcriptInput, Input: string(p[:n])})
+	}
+	return n, err
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	transferProtocolVersion = 3
+	transferIdleTimeout     = time.Minute
+	transferRetryDelay      = 5 * time.Second
+	transferCheckpointEvery = 64 * 1024 * 1024
+	transferMaxFrameSize    = 16 * 1024 * 1024
+)
+
+// TransferHello is the first message a receiver sends after connecting.
+type TransferHello struct {
+	// Secret is the one-time secret cdjf send printed, proving the receiver
+	// is the machine it was meant for.
+	Secret string `json:"secret"`
+}
+
+// TransferOffer is sent by cdjf send once a receiver has given the secret.
+type TransferOffer struct {
+	Version  int      `json:"version"`
+	ID       string   `json:"id"`
+	Device   string   `json:"device"`
+	Label    string   `json:"label"`
+	DiskSize int64    `json:"disk_size"`
+	Extents  []Extent `json:"extents"`
+}
+
+// TransferRequest tells the sender where the receiver wants the stream to start.
+type TransferRequest struct {
+	Resume int64 `json:"resume"`
+}
+
+// errTransferSecret is returned when a receiver does not send the secret.
+var errTransferSecret = errors.New("the receiver did not send the right secret")
+
+// TransferResult is the receiver's verdict once the drive has been written.
+type TransferResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// TransferCheckpoint records how much of a transfer has been written to a
+// drive so an interrupted receive can pick up where it stopped.
+type TransferCheckpoint struct {
+	ID        string    `json:"id"`
+	Done      int64     `json:"done"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func sendDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	listen, _ := cmd.Flags().GetString("listen")
+	full, _ := cmd.Flags().GetBool("full")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	label := getVolumeLabel(device)
+	source, size, release, err := openDiskForRead(device)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	defer release()
+
+	extents := []Extent{{Offset: 0, Length: size}}
+	if !full {
+		if used, err := sparseImageExtents(device, source, size); err != nil {
+			fmt.Printf("Sending every sector: %v\n", err)
+		} else {
+			extents = used
+		}
+	}
+	offer := TransferOffer{
+		Version:  transferProtocolVersion,
+		ID:       transferID(size, extents),
+		Device:   device,
+		Label:    label,
+		DiskSize: size,
+		Extents:  extents,
+	}
+
+	certificate, fingerprint, err := newTransferCertificate()
+	if err != nil {
+		printError("Error: unable to create TLS certificate: %v", err)
+		os.Exit(1)
+	}
+	secret, err := newTransferSecret()
+	if err != nil {
+		printError("Error: unable to create the transfer secret: %v", err)
+		os.Exit(1)
+	}
+	listener, err := tls.Listen("tcp", listen, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS13,
+	})
+	if err != nil {
+		printError("Error: unable to listen on %s: %v", listen, err)
+		os.Exit(1)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	fmt.Printf("Sending %s (%.2f GB to transfer)\n", device, float64(extentsLength(extents))/(1024*1024*1024))
+	fmt.Println("On the receiving machine run:")
+	for _, address := range localAddresses() {
+		fmt.Printf("  cdjf receive <device> --from %s --fingerprint %s\n", net.JoinHostPort(address, port), fingerprint)
+	}
+	fmt.Printf("and enter this one-time secret when it asks: %s\n", secret)
+	fmt.Println("Waiting for the receiver to connect... (Ctrl+C to stop)")
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			printError("Error: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nReceiver connected from %s\n", conn.RemoteAddr())
+		result, err := serveTransfer(conn, source, offer, secret)
+		conn.Close()
+		if errors.Is(err, errTransferSecret) {
+			printWarning("Rejected %s: %v", conn.RemoteAddr(), err)
+			fmt.Println("Waiting for the receiver to connect...")
+			continue
+		}
+		if err != nil {
+			printError("Transfer interrupted: %v", err)
+			fmt.Println("Waiting for the receiver to reconnect and resume...")
+			continue
+		}
+		if !result.OK {
+			printError("Receiver reported a failure: %s", result.Error)
+			os.Exit(1)
+		}
+		printOK("Transfer complete; the receiver verified the drive.")
+		return
+	}
+}
+
+// serveTransfer streams the offered extents to one receiver, starting at the
+// position it asks for. A receiver that does not send the secret first is
+// disconnected without seeing the offer, so it learns nothing about the drive.
+func serveTransfer(conn net.Conn, source *os.File, offer TransferOffer, secret string) (TransferResult, error) {
+	var result TransferResult
+	conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+	var hello TransferHello
+	if err := readTransferFrame(conn, &hello); err != nil {
+		return result, err
+	}
+	if subtle.ConstantTimeCompare([]byte(normalizeFingerprint(hello.Secret)), []byte(normalizeFingerprint(secret))) != 1 {
+		return result, errTransferSecret
+	}
+	if err := writeTransferFrame(conn, offer); err != nil {
+		return result, err
+	}
+	// The receiver may be waiting on its erase confirmation.
+	conn.SetDeadline(time.Time{})
+	var request TransferRequest
+	if err := readTransferFrame(conn, &request); err != nil {
+		return result, err
+	}
+	total := extentsLength(offer.Extents)
+	if request.Resume < 0 || request.Resume > total {
+		return result, fmt.Errorf("receiver asked to resume at an invalid position %d", request.Resume)
+	}
+	if request.Resume > 0 {
+		fmt.Printf("Resuming at %.2f GB\n", float64(request.Resume)/(1024*1024*1024))
+	}
+
+	// The digest covers the whole stream, so bytes the receiver already has
+	// are still read and hashed, just not sent again.
+	writer := bufio.NewWriterSize(conn, imageChunkSize)
+	hasher := sha256.New()
+	progress := NewProgressBar("Send", total)
+	progress.Set(request.Resume)
+	buf := make([]byte, imageChunkSize)
+	var pos int64
+	for _, extent := range offer.Extents {
+		for done := int64(0); done < extent.Length; {
+			n := int64(len(buf))
+			if extent.Length-done < n {
+				n = extent.Length - done
+			}
+			if _, err := source.ReadAt(buf[:n], extent.Offset+done); err != nil {
+				progress.Stop()
+				return result, fmt.Errorf("read %s at offset %d: %w", offer.Device, extent.Offset+done, err)
+			}
+			hasher.Write(buf[:n])
+			if pos+n > request.Resume {
+				skip := int64(0)
+				if pos < request.Resume {
+					skip = request.Resume - pos
+				}
+				conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+				if _, err := writer.Write(buf[skip:n]); err != nil {
+					progress.Stop()
+					return result, err
+				}
+				progress.Add(n - skip)
+			}
+			done += n
+			pos += n
+		}
+	}
+	if _, err := writer.Write(hasher.Sum(nil)); err != nil {
+		progress.Stop()
+		return result, err
+	}
+	if err := writer.Flush(); err != nil {
+		progress.Stop()
+		return result, err
+	}
+	progress.Finish()
+
+	// The receiver reads the drive back before answering.
+	fmt.Println("Waiting for the receiver to verify...")
+	conn.SetDeadline(time.Time{})
+	if err := readTransferFrame(conn, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func receiveDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	from, _ := cmd.Flags().GetString("from")
+	fingerprint, _ := cmd.Flags().GetString("fingerprint")
+	secretFile, _ := cmd.Flags().GetString("secret-file")
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+	noVerify, _ := cmd.Flags().GetBool("no-verify")
+	retries, _ := cmd.Flags().GetInt("retries")
+
+	if strings.TrimSpace(from) == "" || strings.TrimSpace(fingerprint) == "" {
+		printError("Error: --from and --fingerprint are required; copy them from the output of cdjf send")
+		os.Exit(1)
+	}
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := checkWriteProtection(device, false); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	warnIfBehindHub(device)
+
+	secret, err := readTransferSecret(secretFile)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	config := transferClientConfig(fingerprint)
+	conn, offer, err := dialTransfer(from, config, secret)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	required := int64(0)
+	if n := len(offer.Extents); n > 0 {
+		required = offer.Extents[n-1].Offset + offer.Extents[n-1].Length
+	}
+	if diskSize, err := getDiskSizeBytes(device); err == nil && diskSize < required {
+		conn.Close()
+		printError("Error: %s (%.2f GB) is smaller than %s on the sender (%.2f GB)", device,
+			float64(diskSize)/(1024*1024*1024), offer.Device, float64(required)/(1024*1024*1024))
+		os.Exit(1)
+	}
+
+	checkpointPath, checkpoint := loadTransferCheckpoint(device, offer.ID)
+	total := extentsLength(offer.Extents)
+	source := offer.Device
+	if offer.Label != "" {
+		source = fmt.Sprintf("%s (%s)", offer.Device, offer.Label)
+	}
+	fmt.Printf("Receiving %s from %s: %.2f GB\n", source, from, float64(total)/(1024*1024*1024))
+	if checkpoint.Done > 0 {
+		fmt.Printf("Resuming an earlier transfer at %.2f GB\n", float64(checkpoint.Done)/(1024*1024*1024))
+	}
+
+	if !skipConfirm {
+		fmt.Println()
+		fmt.Println(colorize(SeverityError, "! WARNING !"))
+		fmt.Printf("This will ERASE ALL DATA on %s and replace it with %s\n", device, source)
+		response := ask("confirm-receive", "Are you sure you want to continue? (yes/no): ")
+		if response != "yes" && response != "y" {
+			conn.Close()
+			fmt.Println("Receive cancelled.")
+			return
+		}
+	}
+
+	file, release, err := openDiskForWrite(device)
+	if err != nil {
+		conn.Close()
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	dest := &imageDestination{device: device, file: file, release: release}
+	defer func() {
+		file.Close()
+		release()
+	}()
+
+	var digest []byte
+	for attempt := 0; ; attempt++ {
+		if conn == nil {
+			fmt.Printf("Reconnecting to %s in %s...\n", from, transferRetryDelay)
+			time.Sleep(transferRetryDelay)
+			var resumed TransferOffer
+			if conn, resumed, err = dialTransfer(from, config, secret); err == nil && resumed.ID != offer.ID {
+				conn.Close()
+				printError("Error: the sender is now offering different data; run cdjf receive again")
+				os.Exit(1)
+			}
+		}
+		if err == nil {
+			digest, err = receiveTransfer(conn, dest, offer, checkpointPath, &checkpoint)
+		}
+		if err == nil {
+			break
+		}
+		if conn != nil {
+			conn.Close()
+			conn = nil
+		}
+		printError("Transfer interrupted: %v", err)
+		if attempt >= retries {
+			printError("Giving up after %d attempt(s). Run the same command again to resume.", attempt+1)
+			os.Exit(1)
+		}
+	}
+	defer conn.Close()
+
+	result := TransferResult{OK: true}
+	if noVerify {
+		fmt.Println("Skipping read-back verification.")
+	} else {
+		fmt.Println("Verifying written data...")
+		verifyImageDestinations([]*imageDestination{dest}, offer.Extents, digest)
+		if dest.err != nil {
+			result = TransferResult{Error: dest.err.Error()}
+		}
+	}
+	conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+	if err := writeTransferFrame(conn, result); err != nil {
+		printWarning("Unable to report the result to the sender: %v", err)
+	}
+	os.Remove(checkpointPath)
+
+	var receiveErr error
+	if !result.OK {
+		receiveErr = errors.New(result.Error)
+	}
+	recordAudit("receive", device, offer.Label, receiveErr)
+	recordDriveWrites(device, "receive", extentsLength(offer.Extents))
+
+	if !result.OK {
+		printError("Receive failed: %s", result.Error)
+		os.Exit(1)
+	}
+	printOK("%s now matches %s", device, source)
+}
+
+// receiveTransfer asks the sender to stream from the checkpoint and writes
+// the data to the drive, saving progress as it goes. It returns the sender's
+// digest of the whole stream.
+func receiveTransfer(conn net.Conn, dest *imageDestination, offer TransferOffer, checkpointPath string, checkpoint *TransferCheckpoint) ([]byte, error) {
+	conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+	if err := writeTransferFrame(conn, TransferRequest{Resume: checkpoint.Done}); err != nil {
+		return nil, err
+	}
+
+	total := extentsLength(offer.Extents)
+	progress := NewProgressBar("Receive", total)
+	progress.Set(checkpoint.Done)
+	defer progress.Stop()
+
+	reader := bufio.NewReaderSize(conn, imageChunkSize)
+	buf := make([]byte, imageChunkSize)
+	lastSaved := checkpoint.Done
+	var pos int64
+	for _, extent := range offer.Extents {
+		if pos+extent.Length <= checkpoint.Done {
+			pos += extent.Length
+			continue
+		}
+		for done := checkpoint.Done - pos; done < extent.Length; {
+			if done < 0 {
+				done = 0
+			}
+			n := int64(len(buf))
+			if extent.Length-done < n {
+				n = extent.Length - done
+			}
+			conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+			if _, err := io.ReadFull(reader, buf[:n]); err != nil {
+				saveTransferCheckpoint(dest.file, checkpointPath, *checkpoint)
+				return nil, err
+			}
+			if _, err := dest.file.WriteAt(buf[:n], extent.Offset+done); err != nil {
+				return nil, fmt.Errorf("write %s at offset %d: %w", dest.device, extent.Offset+done, err)
+			}
+			done += n
+			checkpoint.Done = pos + done
+			progress.Add(n)
+			if checkpoint.Done-lastSaved >= transferCheckpointEvery {
+				saveTransferCheckpoint(dest.file, checkpointPath, *checkpoint)
+				lastSaved = checkpoint.Done
+			}
+		}
+		pos += extent.Length
+	}
+
+	digest := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(reader, digest); err != nil {
+		saveTransferCheckpoint(dest.file, checkpointPath, *checkpoint)
+		return nil, err
+	}
+	if err := dest.file.Sync(); err != nil {
+		return nil, fmt.Errorf("flush %s: %w", dest.device, err)
+	}
+	progress.Finish()
+	return digest, nil
+}
+
+// dialTransfer connects to a sender, gives it the secret, and reads its offer.
+func dialTransfer(address string, config *tls.Config, secret string) (net.Conn, TransferOffer, error) {
+	var offer TransferOffer
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, config)
+	if err != nil {
+		return nil, offer, fmt.Errorf("unable to connect to %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(transferIdleTimeout))
+	if err := writeTransferFrame(conn, TransferHello{Secret: secret}); err != nil {
+		conn.Close()
+		return nil, offer, fmt.Errorf("unable to send the secret: %w", err)
+	}
+	// The sender hangs up without an offer when the secret is wrong.
+	if err := readTransferFrame(conn, &offer); err != nil {
+		conn.Close()
+		return nil, offer, fmt.Errorf("unable to read the sender's offer (check the secret): %w", err)
+	}
+	if offer.Version != transferProtocolVersion {
+		conn.Close()
+		return nil, offer, fmt.Errorf("the sender uses transfer protocol v%d; update cdjf on both machines", offer.Version)
+	}
+	return conn, offer, nil
+}
+
+// readTransferSecret gets the secret cdjf send printed from secretFile, from
+// standard input when it is "-" or not a terminal, or else by asking for it
+// without echoing. It is never taken as an argument, where the process list
+// and shell history would show it.
+func readTransferSecret(secretFile string) (string, error) {
+	var secret string
+	fd := int(os.Stdin.Fd())
+	switch {
+	case secretFile != "" && secretFile != "-":
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the secret: %w", err)
+		}
+		secret = string(data)
+	case secretFile == "-" || !term.IsTerminal(fd):
+		line, err := stdinReader().ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("unable to read the secret: %w", err)
+		}
+		secret = line
+	default:
+		fmt.Print("Secret shown by cdjf send: ")
+		typed, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("unable to read the secret: %w", err)
+		}
+		secret = string(typed)
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", errors.New("the secret cannot be empty; copy it from the output of cdjf send")
+	}
+	return secret, nil
+}
+
+// transferClientConfig trusts only the sender whose certificate matches the
+// fingerprint it printed.
+func transferClientConfig(fingerprint string) *tls.Config {
+	want := normalizeFingerprint(fingerprint)
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("sender presented no certificate")
+			}
+			if normalizeFingerprint(certificateFingerprint(rawCerts[0])) != want {
+				return errors.New("sender fingerprint does not match; check --fingerprint")
+			}
+			return nil
+		},
+	}
+}
+
+// newTransferCertificate creates a short-lived self-signed certificate for one
+// send session and returns it with its fingerprint.
+func newTransferCertificate() (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "cdjf send"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(7 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return certificate, certificateFingerprint(der), nil
+}
+
+// newTransferSecret creates the one-time secret a receiver must present
+// before cdjf send streams anything to it, in the same form as fingerprints.
+func newTransferSecret() (string, error) {
+	secret := make([]byte, 10)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return groupedHex(secret), nil
+}
+
+// certificateFingerprint is a short, readable SHA-256 fingerprint such as
+// 3F2A-91C0-...
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return groupedHex(sum[:12])
+}
+
+// groupedHex formats bytes as upper-case hex in dash-separated groups of four.
+func groupedHex(data []byte) string {
+	hexed := strings.ToUpper(hex.EncodeToString(data))
+	var groups []string
+	for i := 0; i < len(hexed); i += 4 {
+		groups = append(groups, hexed[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", ":", "", " ", "").Replace(fingerprint))
+}
+
+// transferID identifies the data on offer, so a receiver only resumes a
+// transfer of the same drive contents.
+func transferID(diskSize int64, extents []Extent) string {
+	hasher := sha256.New()
+	binary.Write(hasher, binary.LittleEndian, diskSize)
+	for _, extent := range extents {
+		binary.Write(hasher, binary.LittleEndian, extent.Offset)
+		binary.Write(hasher, binary.LittleEndian, extent.Length)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)[:16])
+}
+
+// localAddresses lists this machine's LAN addresses for the receive hint.
+func localAddresses() []string {
+	var addresses []string
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range interfaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				addresses = append(addresses, ipNet.IP.String())
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		addresses = append(addresses, "<this-machine>")
+	}
+	return addresses
+}
+
+// writeTransferFrame sends a length-prefixed JSON message.
+func writeTransferFrame(w io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	_, err = w.Write(append(frame, data...))
+	return err
+}
+
+func readTransferFrame(r io.Reader, message any) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > transferMaxFrameSize {
+		return fmt.Errorf("message too large (%d bytes)", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, message)
+}
+
+// loadTransferCheckpoint returns the checkpoint path for a drive and the
+// progress already made on the given transfer, if any.
+func loadTransferCheckpoint(device, id string) (string, TransferCheckpoint) {
+	fresh := TransferCheckpoint{ID: id}
+	name := strings.NewReplacer(":", "", "/", "", "\\", "").Replace(device)
+	path, err := configFilePath(fmt.Sprintf("receive-%s.json", name))
+	if err != nil {
+		return "", fresh
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return path, fresh
+	}
+	var checkpoint TransferCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil || checkpoint.ID != id {
+		return path, fresh
+	}
+	return path, checkpoint
+}
+
+// saveTransferCheckpoint flushes the drive before recording progress so the
+// checkpoint never claims data that is not on the disk.
+func saveTransferCheckpoint(file *os.File, path string, checkpoint TransferCheckpoint) {
+	if path == "" || file.Sync() != nil {
+		return
+	}
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0o644)
+}
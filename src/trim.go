@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// errTrimUnsupported means the drive or the system cannot discard blocks.
+var errTrimUnsupported = errors.New("TRIM is not supported")
+
+// trimDrive tells the drive's controller that every free block of the fresh
+// filesystem is unused, so a USB SSD can erase them in the background and
+// keep sustained writes fast. Plain USB sticks rarely accept TRIM.
+func trimDrive(device string) error {
+	if fake := activeFakeBackend(); fake != nil {
+		if !fake.drive(device).SSD {
+			return fmt.Errorf("%w by %s", errTrimUnsupported, device)
+		}
+		return nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		// macOS only trims drives enabled with trimforce, and only on its
+		// own schedule; there is no command to trim an external volume.
+		return fmt.Errorf("%w for external drives on macOS; the drive's own garbage collection reclaims the blocks", errTrimUnsupported)
+
+	case "windows":
+		driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+		psCmd := fmt.Sprintf("Optimize-Volume -DriveLetter %s -ReTrim", driveLetter)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).CombinedOutput()
+		if err != nil {
+			message := strings.TrimSpace(string(output))
+			if strings.Contains(strings.ToLower(message), "not supported") {
+				return fmt.Errorf("%w by %s", errTrimUnsupported, device)
+			}
+			return fmt.Errorf("Optimize-Volume failed: %v\nOutput: %s", err, message)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w on %s", errTrimUnsupported, runtime.GOOS)
+}
+
+// trimAfterFormat trims a freshly formatted drive and reports the outcome.
+// A drive that cannot be trimmed is not an error.
+func trimAfterFormat(device string) {
+	err := trimDrive(device)
+	switch {
+	case err == nil:
+		printOK("Trimmed the free space on %s.", device)
+	case errors.Is(err, errTrimUnsupported):
+		fmt.Fprintf(consoleOut, "TRIM skipped for %s: %v\n", device, err)
+	default:
+		warn(device, warnSetup, "Unable to trim %s: %v", device, err)
+	}
+}
@@ -2,71 +2,227 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+// verifyEstimateMinSize is the test size above which verify probes the drive
+// speed and previews how long the run will take.
+const verifyEstimateMinSize = 1024 * 1024 * 1024
+
+// confirmVerifyDuration prints an estimated run time from a quick speed probe
+// of each drive and asks for confirmation when it exceeds the threshold.
+// Drives are verified one after another, so the estimates add up.
+func confirmVerifyDuration(devices []string, testSize int64, threshold time.Duration, limit float64) bool {
+	var total time.Duration
+	estimated := 0
+	for _, device := range devices {
+		// Only probe a drive that passes the safety checks; the main loop reports errors.
+		if validateDevice(device) != nil || ensureRemovableDevice(device) != nil {
+			continue
+		}
+		fmt.Fprintf(consoleOut, "Probing %s to estimate how long verification will take...\n", device)
+		speeds := benchmarkDrive(device)
+		if limitMBps := limit / (1024 * 1024); limitMBps > 0 {
+			speeds.WriteMBps = math.Min(speeds.WriteMBps, limitMBps)
+			speeds.ReadMBps = math.Min(speeds.ReadMBps, limitMBps)
+		}
+		estimate := estimateRunDuration(testSize, speeds)
+		if estimate <= 0 {
+			fmt.Fprintf(consoleOut, "Unable to estimate the duration for %s.\n", device)
+			continue
+		}
+		if len(devices) > 1 {
+			fmt.Fprintf(consoleOut, "  %s: about %s\n", device, formatDuration(estimate))
+		}
+		total += estimate
+		estimated++
+	}
+	if estimated == 0 {
+		return true
+	}
+
+	fmt.Fprintf(consoleOut, "Estimated duration: about %s for %.1f GB", formatDuration(total), float64(testSize)/(1024*1024*1024))
+	if len(devices) > 1 {
+		fmt.Fprintf(consoleOut, " per drive on %d drives", len(devices))
+		if estimated < len(devices) {
+			fmt.Fprintf(consoleOut, " (%d could not be estimated and are not included)", len(devices)-estimated)
+		}
+	}
+	fmt.Fprintln(consoleOut)
+
+	if threshold <= 0 || total <= threshold {
+		return true
+	}
+	response := ask("long-verify", "This will take a while. Continue? (y/N): ")
+	return response == "y" || response == "yes"
+}
+
 func verifyDrive(cmd *cobra.Command, args []string) {
 	sizeMB, _ := cmd.Flags().GetInt("size")
+	reportValue, _ := cmd.Flags().GetString("report")
+	alerts := completionAlertsFromFlags(cmd)
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+	confirmOver, _ := cmd.Flags().GetDuration("confirm-over")
+	resume, _ := cmd.Flags().GetBool("resume")
+	limitValue, _ := cmd.Flags().GetString("limit")
+	profile, useProfile := profileFromFlag(cmd)
+	thresholds := mergedBenchmarkThresholds(profile.BenchmarkThresholds)
+	if useProfile && profile.VerifySizeMB > 0 && !cmd.Flags().Changed("size") {
+		sizeMB = profile.VerifySizeMB
+	}
+	reportFormat, err := normalizeReportFormat(reportValue)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	limit, err := parseRateLimit(limitValue)
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	limiter := NewRateLimiter(limit)
+
 	if sizeMB <= 0 {
-		fmt.Fprintln(os.Stderr, "Integrity test size must be greater than zero.")
+		printError("Integrity test size must be greater than zero.")
 		os.Exit(1)
 	}
 
 	testSize := int64(sizeMB) * 1024 * 1024
-	fmt.Println("Starting integrity verification. This may take a few minutes per drive depending on speed.")
+	if !skipConfirm && testSize >= verifyEstimateMinSize && !confirmVerifyDuration(args, testSize, confirmOver, limit) {
+		fmt.Fprintln(consoleOut, "Verification cancelled.")
+		return
+	}
+	fmt.Fprintln(consoleOut, "Starting integrity verification. This may take a few minutes per drive depending on speed.")
 
-	failed := false
+	failed := 0
 	for _, device := range args {
-		fmt.Printf("\n[%s] Preparing verification...\n", device)
+		fmt.Fprintf(consoleOut, "\n[%s] Preparing verification...\n", device)
+		started := time.Now()
 
 		if err := validateDevice(device); err != nil {
-			fmt.Fprintf(os.Stderr, "[%s] Error: %v\n", device, err)
-			failed = true
+			printError("[%s] Error: %v", device, err)
+			failed++
 			continue
 		}
 
 		if err := ensureRemovableDevice(device); err != nil {
-			fmt.Fprintf(os.Stderr, "[%s] Error: %v\n", device, err)
-			failed = true
+			printError("[%s] Error: %v", device, err)
+			failed++
+			continue
+		}
+
+		if err := checkWriteProtection(device, true); err != nil {
+			printError("[%s] Error: %v", device, err)
+			failed++
 			continue
 		}
 
+		if bitLockerStatus(device).Locked {
+			printError("[%s] Error: %s is locked by BitLocker. Unlock it in File Explorer or with 'manage-bde -unlock %s -Password', then try again", device, device, device)
+			failed++
+			continue
+		}
+		warnIfBehindHub(device)
+
 		testFile, mountPoint, err := resolveTestFilePath(device, "cdjf_verify_test.tmp")
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[%s] Error: %v\n", device, err)
-			failed = true
+			printError("[%s] Error: %v", device, err)
+			failed++
 			continue
 		}
 
-		fmt.Printf("[%s] Mount point: %s\n", device, mountPoint)
-		fmt.Printf("[%s] Writing %.1f MB test pattern...\n", device, float64(testSize)/(1024*1024))
+		fmt.Fprintf(consoleOut, "[%s] Mount point: %s\n", device, mountPoint)
+		fmt.Fprintf(consoleOut, "[%s] Writing %.1f MB test pattern...\n", device, float64(testSize)/(1024*1024))
 
-		result := runIntegrityCheck(testFile, testSize)
+		result := runIntegrityCheck(testFile, testSize, resume, limiter)
+		recordDriveWrites(device, "verify", result.BytesWritten)
+		recordDriveCheck(device, "verify", result.Success())
 
-		fmt.Printf("[%s] Write speed: %.2f MB/s\n", device, result.WriteMBps)
-		fmt.Printf("[%s] Read speed: %.2f MB/s\n", device, result.ReadMBps)
+		fmt.Fprintf(consoleOut, "[%s] Write speed: %.2f MB/s\n", device, result.WriteMBps)
+		fmt.Fprintf(consoleOut, "[%s] Read speed: %.2f MB/s\n", device, result.ReadMBps)
+		if useProfile {
+			grade := benchmarkSeverity(result.BenchmarkResult, thresholds)
+			fmt.Fprintln(consoleOut, colorize(severityOf(grade), fmt.Sprintf("[%s] %s", device, grade)))
+			recordBenchmarkWarning(device, result.BenchmarkResult, thresholds)
+		}
 
 		if result.Success() {
-			fmt.Printf("[%s] Integrity check PASSED (%.1f MB verified).\n", device, float64(result.BytesVerified)/(1024*1024))
+			printOK("[%s] Integrity check PASSED (%.1f MB verified).", device, float64(result.BytesVerified)/(1024*1024))
 		} else {
-			fmt.Printf("[%s] Integrity check FAILED after %.1f MB.\n", device, float64(result.BytesVerified)/(1024*1024))
+			fmt.Fprintln(consoleOut, colorize(SeverityError, fmt.Sprintf("[%s] Integrity check FAILED after %.1f MB.", device, float64(result.BytesVerified)/(1024*1024))))
 			for _, errMsg := range result.Errors {
-				fmt.Printf("    %s\n", errMsg)
+				fmt.Fprintf(consoleOut, "    %s\n", errMsg)
 			}
-			failed = true
+			failed++
 		}
 
+		hook := HookEvent{
+			Hook:       hookPostVerify,
+			Device:     device,
+			Label:      getVolumeLabel(device),
+			Filesystem: getDriveFilesystem(device),
+			Result:     hookResultSuccess,
+			Started:    started,
+			Extra: map[string]string{
+				"write_mbps":     fmt.Sprintf("%.2f", result.WriteMBps),
+				"read_mbps":      fmt.Sprintf("%.2f", result.ReadMBps),
+				"bytes_verified": fmt.Sprintf("%d", result.BytesVerified),
+			},
+		}
+		if !result.Success() {
+			hook.Result = hookResultFailure
+			hook.Error = strings.Join(result.Errors, "; ")
+		}
+		finishOperation(hook)
+
 		logPath, logErr := writeVerifyLog(device, mountPoint, testSize, result)
 		if logErr != nil {
-			fmt.Fprintf(os.Stderr, "[%s] Warning: unable to write verification log: %v\n", device, logErr)
+			printWarning("[%s] Unable to write verification log: %v", device, logErr)
 		} else {
-			fmt.Printf("[%s] Detailed log saved to %s\n", device, logPath)
+			fmt.Fprintf(consoleOut, "[%s] Detailed log saved to %s\n", device, logPath)
+		}
+
+		if reportFormat != "" {
+			report := newGigReport("verify", "Verification Report", device)
+			report.Checks = verifyReportChecks(testSize, result)
+			report.Benchmark = result.BenchmarkResult
+			report.Passed = result.Success()
+			if path, err := writeGigReport(report, reportFormat); err != nil {
+				printWarning("[%s] Unable to write report: %v", device, err)
+			} else {
+				fmt.Fprintf(consoleOut, "[%s] Report saved to %s\n", device, path)
+			}
 		}
 	}
 
-	if failed {
+	if failed > 0 {
+		alerts.Send("cdjf: verification failed", fmt.Sprintf("%d of %d drives failed verification.", failed, len(args)), true)
 		os.Exit(1)
 	}
+	alerts.Send("cdjf: verification passed", fmt.Sprintf("%s passed verification.", strings.Join(args, ", ")), false)
+}
+
+func verifyReportChecks(testSize int64, result IntegrityResult) []PreflightCheck {
+	integrity := PreflightCheck{
+		Name:   "Integrity",
+		Status: preflightPass,
+		Detail: fmt.Sprintf("%.1f of %.1f MB written and read back without errors",
+			float64(result.BytesVerified)/(1024*1024), float64(testSize)/(1024*1024)),
+	}
+	checks := []PreflightCheck{integrity}
+	if result.Success() {
+		return checks
+	}
+
+	checks[0].Status = preflightFail
+	checks[0].Detail = fmt.Sprintf("failed after %.1f MB", float64(result.BytesVerified)/(1024*1024))
+	for _, errMsg := range result.Errors {
+		checks = append(checks, PreflightCheck{Name: "Error", Status: preflightFail, Detail: errMsg})
+	}
+	return checks
 }
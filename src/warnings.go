@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Kinds of RunWarning.
+const (
+	warnSlowDrive    = "slow_drive"
+	warnCapacity     = "capacity"
+	warnFilesystem   = "filesystem"
+	warnLabelChanged = "label_changed"
+	warnClusterSize  = "cluster_size"
+	warnFormatResult = "format_result"
+	warnSetup        = "setup"
+	warnUSBHub       = "usb_hub"
+	warnKnownIssue   = "known_issue"
+	warnStall        = "stall"
+	warnRetry        = "retry"
+)
+
+// RunWarning is a warning raised while a command ran. Warnings are kept so
+// they can be repeated together once the command finishes, after progress
+// output has scrolled them away, and attached to audit entries and webhooks.
+type RunWarning struct {
+	Device  string `json:"device,omitempty"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+var runWarnings struct {
+	mu   sync.Mutex
+	list []RunWarning
+}
+
+// warn prints a warning and keeps it for the end-of-run summary. device may
+// be empty for warnings about the whole run.
+func warn(device, kind, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	printWarning("%s", message)
+	recordWarning(device, kind, message)
+}
+
+// recordWarning keeps a warning that was already shown some other way.
+func recordWarning(device, kind, message string) {
+	runWarnings.mu.Lock()
+	defer runWarnings.mu.Unlock()
+	for _, existing := range runWarnings.list {
+		if existing.Device == device && existing.Message == message {
+			return
+		}
+	}
+	runWarnings.list = append(runWarnings.list, RunWarning{Device: device, Kind: kind, Message: message})
+}
+
+// warningsFor returns the warnings about device, plus those about the whole
+// run.
+func warningsFor(device string) []RunWarning {
+	runWarnings.mu.Lock()
+	defer runWarnings.mu.Unlock()
+	var matched []RunWarning
+	for _, warning := range runWarnings.list {
+		if warning.Device == "" || warning.Device == device {
+			matched = append(matched, warning)
+		}
+	}
+	return matched
+}
+
+// printWarningSummary repeats every warning of the run in one section.
+func printWarningSummary() {
+	runWarnings.mu.Lock()
+	defer runWarnings.mu.Unlock()
+	if len(runWarnings.list) == 0 {
+		return
+	}
+	fmt.Fprintln(consoleOut)
+	title := fmt.Sprintf("WARNINGS (%d)", len(runWarnings.list))
+	fmt.Fprintln(consoleOut, colorize(SeverityWarn, title))
+	fmt.Fprintln(consoleOut, strings.Repeat("=", len(title)))
+	for _, warning := range runWarnings.list {
+		line := "  " + warning.Message
+		if warning.Device != "" && !strings.Contains(warning.Message, warning.Device) {
+			line = fmt.Sprintf("  [%s] %s", warning.Device, warning.Message)
+		}
+		fmt.Fprintln(consoleOut, colorize(SeverityWarn, line))
+	}
+}
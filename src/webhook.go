@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// WebhookPayload is posted to every configured webhook when an operation on a
+// drive finishes. Text makes the message readable in Slack-style chat hooks.
+type WebhookPayload struct {
+	Text            string    `json:"text"`
+	Operation       string    `json:"operation"`
+	Device          string    `json:"device"`
+	Label           string    `json:"label,omitempty"`
+	Result          string    `json:"result"`
+	Error           string    `json:"error,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Host            string    `json:"host"`
+	// Warnings are those raised about the drive during the operation.
+	Warnings []RunWarning `json:"warnings,omitempty"`
+}
+
+func newWebhookPayload(event HookEvent) WebhookPayload {
+	finished := time.Now()
+	started := event.Started
+	if started.IsZero() {
+		started = finished
+	}
+	host, _ := os.Hostname()
+	payload := WebhookPayload{
+		Operation:       strings.TrimPrefix(event.Hook, "post-"),
+		Device:          event.Device,
+		Label:           event.Label,
+		Result:          event.Result,
+		Error:           event.Error,
+		Started:         started,
+		Finished:        finished,
+		DurationSeconds: finished.Sub(started).Seconds(),
+		Host:            host,
+		Warnings:        warningsFor(event.Device),
+	}
+	payload.Text = fmt.Sprintf("cdjf %s of %s on %s: %s (%s)", payload.Operation, payload.Device, host,
+		payload.Result, formatDuration(finished.Sub(started)))
+	if payload.Error != "" {
+		payload.Text += " - " + payload.Error
+	}
+	return payload
+}
+
+// sendWebhooks posts the payload to each URL, warning about any that fail.
+func sendWebhooks(urls []string, payload WebhookPayload) {
+	if len(urls) == 0 {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	for _, webhookURL := range urls {
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			// The client's error repeats the whole URL, so report only its cause.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			printWarning("[%s] webhook %s failed: %v", payload.Device, redactWebhookURL(webhookURL), err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			printWarning("[%s] webhook %s returned %s", payload.Device, redactWebhookURL(webhookURL), resp.Status)
+		}
+	}
+}
+
+// redactWebhookURL shortens a webhook URL to its scheme and host for
+// messages. Slack and Discord webhooks carry their secret in the path.
+func redactWebhookURL(webhookURL string) string {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Host == "" {
+		return "(invalid URL)"
+	}
+	redacted := parsed.Scheme + "://" + parsed.Host
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" {
+		redacted += "/..."
+	}
+	return redacted
+}
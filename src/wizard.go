@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// wizard reads the answers for 'cdjf wizard' from one reader so typed-ahead
+// input is not lost between questions.
+type wizard struct {
+	reader *bufio.Reader
+}
+
+func (w *wizard) ask(prompt string) string {
+	fmt.Print(prompt)
+	input, err := w.reader.ReadString('\n')
+	if err != nil && input == "" {
+		fmt.Println()
+		fmt.Println("Wizard cancelled.")
+		os.Exit(1)
+	}
+	return strings.TrimSpace(input)
+}
+
+// choose shows a numbered menu and returns the index picked. An empty answer
+// picks defaultIndex when it is not negative.
+func (w *wizard) choose(options []string, defaultIndex int) int {
+	for i, option := range options {
+		fmt.Printf("  %d) %s\n", i+1, option)
+	}
+	prompt := fmt.Sprintf("Choose 1-%d: ", len(options))
+	if defaultIndex >= 0 {
+		prompt = fmt.Sprintf("Choose 1-%d [%d]: ", len(options), defaultIndex+1)
+	}
+	for {
+		answer := w.ask(prompt)
+		if answer == "" && defaultIndex >= 0 {
+			return defaultIndex
+		}
+		if strings.EqualFold(answer, "q") {
+			fmt.Println("Wizard cancelled.")
+			os.Exit(0)
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return n - 1
+		}
+		fmt.Printf("Please enter a number from 1 to %d, or q to quit.\n", len(options))
+	}
+}
+
+func (w *wizard) confirm(prompt string, defaultYes bool) bool {
+	suffix := " (y/N): "
+	if defaultYes {
+		suffix = " (Y/n): "
+	}
+	answer := strings.ToLower(w.ask(prompt + suffix))
+	if answer == "" {
+		return defaultYes
+	}
+	return answer == "y" || answer == "yes"
+}
+
+func wizardStep(number int, title string) {
+	heading := fmt.Sprintf("Step %d: %s", number, title)
+	fmt.Println()
+	fmt.Println(heading)
+	fmt.Println(strings.Repeat("=", len(heading)))
+}
+
+func describeDrive(device string) string {
+	details := fmt.Sprintf("%.1f GB", getDriveSize(device))
+	if model := getDriveModel(device); model != "" {
+		details = model + ", " + details
+	}
+	if label := getVolumeLabel(device); label != "" {
+		details += fmt.Sprintf(", labeled %q", label)
+	}
+	return fmt.Sprintf("%s  (%s)", device, details)
+}
+
+// pickDrive waits until a removable drive is connected and lets the user pick
+// one from the live list.
+func (w *wizard) pickDrive() string {
+	for {
+		devices := removableDevices()
+		if len(devices) == 0 {
+			fmt.Println("No USB drives found.")
+			if strings.EqualFold(w.ask("Plug one in and press Enter to look again, or type q to quit: "), "q") {
+				fmt.Println("Wizard cancelled.")
+				os.Exit(0)
+			}
+			continue
+		}
+
+		options := make([]string, len(devices))
+		for i, device := range devices {
+			options[i] = describeDrive(device)
+		}
+		options = append(options, "Refresh the list")
+		fmt.Println("Which drive do you want to prepare?")
+		choice := w.choose(options, -1)
+		if choice == len(devices) {
+			continue
+		}
+
+		device := devices[choice]
+		if err := validateDevice(device); err != nil {
+			printError("%s cannot be used: %v", device, err)
+			continue
+		}
+		if err := ensureRemovableDevice(device); err != nil {
+			printError("%s cannot be used: %v", device, err)
+			continue
+		}
+		if err := checkWriteProtection(device, false); err != nil {
+			printError("%v", err)
+			continue
+		}
+		if status := bitLockerStatus(device); status.Protected {
+			printBitLockerWarning(device, status)
+			if !w.confirm("Remove BitLocker and use this drive anyway?", false) {
+				continue
+			}
+		}
+		if containers := apfsContainersOn(device); len(containers) > 0 {
+			printAPFSWarning(device, containers)
+			if !w.confirm("Destroy the APFS container and use this drive anyway?", false) {
+				continue
+			}
+		}
+		printKnownDriveIssues(device, knownDriveIssues(device, getDriveModel(device)))
+		return device
+	}
+}
+
+func (w *wizard) pickTarget() Target {
+	targets := []Target{defaultTarget}
+	for _, name := range sortedTargetNames() {
+		targets = append(targets, builtinTargets[name])
+	}
+	options := make([]string, len(targets))
+	for i, target := range targets {
+		options[i] = fmt.Sprintf("%s (%s)", target.Description, target.Filesystem)
+	}
+	options[0] += " - not sure? pick this"
+	fmt.Println("Which player or software will read this drive?")
+	return targets[w.choose(options, 0)]
+}
+
+func (w *wizard) pickLabel(filesystem string) string {
+	prompt := fmt.Sprintf("Drive name, up to %d letters or numbers [REKORDBOX]: ", labelMaxLength(filesystem))
+	for {
+		label := w.ask(prompt)
+		if label == "" {
+			return "REKORDBOX"
+		}
+		normalized, err := normalizeLabel(label, filesystem)
+		if err != nil {
+			fmt.Printf("%v.\n", err)
+			continue
+		}
+		return normalized
+	}
+}
+
+func runWizard(cmd *cobra.Command, args []string) {
+	w := &wizard{reader: stdinReader()}
+
+	title := "cdjf format wizard"
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	fmt.Println("This wizard prepares a USB drive for your DJ gear in a few questions.")
+	fmt.Println("Nothing is erased until you confirm on the summary screen. Type q at any menu to quit.")
+
+	policy, err := loadPolicy()
+	if err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+
+	wizardStep(1, "Pick the drive")
+	device := w.pickDrive()
+	size := getDriveSize(device)
+
+	wizardStep(2, "Pick the player")
+	target := w.pickTarget()
+	if target.MaxCapacityGB > 0 && size > target.MaxCapacityGB {
+		printWarning("This drive is %.1f GB, more than the %.0f GB recommended for %s.", size, target.MaxCapacityGB, target.Description)
+	}
+
+	wizardStep(3, "Name the drive")
+	label := w.pickLabel(target.Filesystem)
+
+	opts := FormatOptions{
+		Label:       label,
+		Filesystem:  target.Filesystem,
+		Scheme:      target.Scheme,
+		ClusterSize: target.ClusterSize,
+		Folders:     target.Folders,
+		Verify:      true,
+	}
+	if !policy.allowsFilesystem(opts.Filesystem) {
+		printError("Error: %s is not allowed by the policy in %s; pick another player.", opts.Filesystem, policyPath())
+		os.Exit(1)
+	}
+	if limitErr := checkFAT32Capacity(size, opts, runtime.GOOS); limitErr != nil {
+		printWarning("%v", limitErr)
+		if !policy.allowsFilesystem("exFAT") {
+			printError("Error: the policy in %s does not allow exFAT. Use a smaller drive.", policyPath())
+			os.Exit(1)
+		}
+		fmt.Println("CDJ-3000, XDJ-RX3, and OPUS-QUAD read exFAT; older players need a smaller drive.")
+		if !w.confirm("Use exFAT instead?", true) {
+			fmt.Println("Wizard cancelled.")
+			return
+		}
+		opts.Filesystem = "exFAT"
+	}
+
+	wizardStep(4, "Check and confirm")
+	fmt.Printf("  Drive:        %s\n", describeDrive(device))
+	fmt.Printf("  Player:       %s\n", target.Description)
+	fmt.Printf("  Filesystem:   %s (%s)\n", opts.Filesystem, opts.Scheme)
+	if opts.ClusterSize != "" {
+		fmt.Printf("  Cluster size: %s\n", opts.ClusterSize)
+	}
+	fmt.Printf("  New name:     %s\n", opts.Label)
+	if len(opts.Folders) > 0 {
+		fmt.Printf("  Folders:      %s\n", strings.Join(opts.Folders, ", "))
+	}
+	fmt.Println("  Afterwards:   verify the drive, then offer to eject it")
+	fmt.Println()
+	fmt.Println(colorize(SeverityError, fmt.Sprintf("Everything on %s will be erased.", device)))
+	if !w.confirm("Erase and format this drive now?", false) {
+		fmt.Println("Wizard cancelled. Nothing was changed.")
+		return
+	}
+
+	formatSingleDrive(device, opts)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// LogicalDisk is one Win32_LogicalDisk instance, the volume behind a drive
+// letter on Windows.
+type LogicalDisk struct {
+	DeviceID           string
+	Description        string
+	DriveType          string
+	FileSystem         string
+	FreeSpace          uint64
+	Size               uint64
+	VolumeName         string
+	VolumeSerialNumber string
+}
+
+// logicalDiskFields are the Win32_LogicalDisk properties cdjf reads, in the
+// alphabetical order wmic prints its columns in.
+var logicalDiskFields = []string{"Description", "DeviceID", "DriveType", "FileSystem", "FreeSpace", "Size", "VolumeName", "VolumeSerialNumber"}
+
+// queryLogicalDisks lists the logical disks matching a WQL filter such as
+// "DriveType=2", or all of them when filter is empty. It uses wmic's CSV
+// output, falling back to Get-CimInstance on systems where wmic has been
+// removed.
+func queryLogicalDisks(filter string) ([]LogicalDisk, error) {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("wmic"); err == nil {
+		args := []string{"logicaldisk"}
+		if filter != "" {
+			args = append(args, "where", filter)
+		}
+		args = append(args, "get", strings.Join(logicalDiskFields, ","), "/format:csv")
+		cmd = execCommand("wmic", args...)
+	} else {
+		psCmd := "Get-CimInstance Win32_LogicalDisk"
+		if filter != "" {
+			psCmd += fmt.Sprintf(" -Filter \"%s\"", filter)
+		}
+		psCmd += " | Select-Object " + strings.Join(logicalDiskFields, ",") + " | ConvertTo-Csv -NoTypeInformation"
+		cmd = execCommand("powershell", "-NoProfile", "-Command", psCmd)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := parseWindowsCSV(output, "VolumeName")
+	if err != nil {
+		return nil, err
+	}
+
+	disks := make([]LogicalDisk, 0, len(rows))
+	for _, row := range rows {
+		disk := LogicalDisk{
+			DeviceID:           row["DeviceID"],
+			Description:        row["Description"],
+			DriveType:          row["DriveType"],
+			FileSystem:         row["FileSystem"],
+			VolumeName:         row["VolumeName"],
+			VolumeSerialNumber: row["VolumeSerialNumber"],
+		}
+		disk.FreeSpace, _ = strconv.ParseUint(row["FreeSpace"], 10, 64)
+		disk.Size, _ = strconv.ParseUint(row["Size"], 10, 64)
+		if disk.DeviceID != "" {
+			disks = append(disks, disk)
+		}
+	}
+	return disks, nil
+}
+
+// windowsLogicalDisk returns the logical disk for a drive letter such as E:.
+func windowsLogicalDisk(device string) (LogicalDisk, error) {
+	driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+	if len(driveLetter) != 1 {
+		return LogicalDisk{}, fmt.Errorf("invalid drive letter %q", device)
+	}
+	disks, err := cachedLogicalDisks(fmt.Sprintf("DeviceID='%s:'", driveLetter))
+	if err != nil {
+		return LogicalDisk{}, err
+	}
+	if len(disks) == 0 {
+		return LogicalDisk{}, fmt.Errorf("drive %s: not found", driveLetter)
+	}
+	return disks[0], nil
+}
+
+// parseWindowsCSV reads CSV from wmic /format:csv or ConvertTo-Csv into one
+// map per row keyed by column name. wmic does not quote values, so a row
+// with extra commas has them folded back into the freeText column, the only
+// one that may contain commas.
+func parseWindowsCSV(output []byte, freeText string) ([]map[string]string, error) {
+	text := decodeWindowsOutput(output)
+	text = strings.ReplaceAll(text, "\r", "")
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse command output: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	freeIndex := -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		if header[i] == freeText {
+			freeIndex = i
+		}
+	}
+
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		if extra := len(record) - len(header); extra > 0 && freeIndex >= 0 {
+			joined := strings.Join(record[freeIndex:freeIndex+extra+1], ",")
+			record = append(append(record[:freeIndex:freeIndex], joined), record[freeIndex+extra+1:]...)
+		}
+		if len(record) != len(header) {
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeWindowsOutput converts command output to a string, decoding the
+// UTF-16 that wmic writes when its output is redirected on some systems.
+func decodeWindowsOutput(output []byte) string {
+	if len(output) < 2 || output[0] != 0xFF || output[1] != 0xFE {
+		return string(output)
+	}
+	units := make([]uint16, 0, len(output)/2)
+	for i := 2; i+1 < len(output); i += 2 {
+		units = append(units, uint16(output[i])|uint16(output[i+1])<<8)
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// parseMacWriteProtection reports whether diskutil info output describes
+// read-only media (a hardware lock) or a volume mounted read-only.
+func parseMacWriteProtection(output []byte) (mediaReadOnly, volumeReadOnly bool) {
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		switch key {
+		case "Media Read-Only":
+			mediaReadOnly = mediaReadOnly || strings.HasPrefix(value, "Yes")
+		case "Writable Media":
+			mediaReadOnly = mediaReadOnly || strings.HasPrefix(value, "No")
+		case "Volume Read-Only":
+			volumeReadOnly = strings.HasPrefix(value, "Yes")
+		}
+	}
+	return mediaReadOnly, volumeReadOnly
+}
+
+// checkWriteProtection fails fast when a drive cannot be written. Formatting
+// only needs writable media; verify also needs the mounted volume to be writable.
+func checkWriteProtection(device string, needWritableVolume bool) error {
+	hardwareErr := fmt.Errorf("%s is write-protected by its hardware lock. Slide the lock switch on the SD card or adapter to the unlocked position, reinsert the drive, and try again", device)
+
+	if fake := activeFakeBackend(); fake != nil {
+		drive := fake.drive(device)
+		if drive.WriteProtected {
+			return hardwareErr
+		}
+		if needWritableVolume && drive.Locked {
+			return fmt.Errorf("the volume on %s is mounted read-only. Run 'cdjf unlock %s' to remount it read/write", device, device)
+		}
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		output, err := macDiskInfo(wholeDiskIdentifier(device))
+		if err != nil {
+			return nil
+		}
+		if mediaReadOnly, _ := parseMacWriteProtection(output); mediaReadOnly {
+			return hardwareErr
+		}
+
+		if !needWritableVolume {
+			return nil
+		}
+		output, err = macDiskInfo(macVolumeIdentifier(device))
+		if err != nil {
+			return nil
+		}
+		if _, volumeReadOnly := parseMacWriteProtection(output); volumeReadOnly {
+			return fmt.Errorf("the volume on %s is mounted read-only. Run 'cdjf unlock %s' to remount it read/write", device, device)
+		}
+
+	case "windows":
+		if protected, err := volumeWriteProtected(device); err == nil && protected {
+			return hardwareErr
+		}
+
+		driveLetter := strings.ToUpper(strings.TrimSuffix(device, ":"))
+		diskNumber, err := windowsDiskNumber(driveLetter)
+		if err != nil {
+			return nil
+		}
+		psCmd := fmt.Sprintf("(Get-Disk -Number %d).IsReadOnly", diskNumber)
+		output, err := execCommand("powershell", "-NoProfile", "-Command", psCmd).Output()
+		if err != nil {
+			return nil
+		}
+		if strings.EqualFold(strings.TrimSpace(string(output)), "True") {
+			return fmt.Errorf("disk %d (%s) has the read-only attribute set. Run 'cdjf unlock %s' to clear it", diskNumber, device, device)
+		}
+	}
+
+	return nil
+}
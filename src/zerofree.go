@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// zeroFreeFileLimit keeps each filler file under the FAT32 file size limit.
+const zeroFreeFileLimit = 4*1024*1024*1024 - 1024*1024
+
+// isDiskFull reports whether a write failed because the volume is full, which
+// is how zerofree knows it has covered all the free space.
+func isDiskFull(err error) bool {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		if runtime.GOOS == "windows" {
+			// ERROR_HANDLE_DISK_FULL and ERROR_DISK_FULL.
+			if errno == 39 || errno == 112 {
+				return true
+			}
+		} else if errno == syscall.ENOSPC {
+			return true
+		}
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "no space left") || strings.Contains(message, "not enough space")
+}
+
+// fillerFiles tracks the filler files zerofree has created so an interrupted
+// run can still delete them; a stick left completely full is useless at a gig.
+type fillerFiles struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (f *fillerFiles) add(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths = append(f.paths, path)
+}
+
+func (f *fillerFiles) removeAll() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var failed []string
+	for _, path := range f.paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			failed = append(failed, path)
+		}
+	}
+	f.paths = nil
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to delete %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// writeZeroFill fills the free space under mountPoint with zeroed filler
+// files until the volume is full, or until limit bytes on fake drives, and
+// returns how many bytes it wrote.
+func writeZeroFill(mountPoint string, freeBytes, limit int64, fillers *fillerFiles) (int64, error) {
+	const chunkSize = 1024 * 1024
+	chunk := make([]byte, chunkSize)
+	simulation := simulationFor(filepath.Join(mountPoint, "cdjf_zerofree_000.tmp"))
+
+	bar := NewProgressBar("Zero", freeBytes)
+	defer bar.Stop()
+
+	var written int64
+	for index := 0; ; index++ {
+		path := filepath.Join(mountPoint, fmt.Sprintf("cdjf_zerofree_%03d.tmp", index))
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			if isDiskFull(err) {
+				break
+			}
+			return written, err
+		}
+		fillers.add(path)
+
+		var fileBytes int64
+		full := false
+		for fileBytes < zeroFreeFileLimit {
+			toWrite := int64(chunkSize)
+			if limit > 0 && limit-written < toWrite {
+				toWrite = limit - written
+			}
+			if toWrite <= 0 {
+				full = true
+				break
+			}
+			var n int
+			writeErr := withRetry(fmt.Sprintf("Zeroing free space at %.1f MB", float64(written)/(1024*1024)), func() error {
+				var err error
+				n, err = file.Write(chunk[:toWrite])
+				return err
+			})
+			simulation.wrote(n)
+			fileBytes += int64(n)
+			written += int64(n)
+			if written > freeBytes {
+				freeBytes = written
+				bar.UpdateTotal(freeBytes)
+			}
+			bar.Set(written)
+			if writeErr != nil {
+				if isDiskFull(writeErr) {
+					full = true
+					break
+				}
+				file.Close()
+				return written, writeErr
+			}
+		}
+
+		// Flush so the zeros reach the flash before the files are deleted.
+		if err := file.Sync(); err != nil && !isDiskFull(err) {
+			file.Close()
+			return written, err
+		}
+		if err := file.Close(); err != nil && !isDiskFull(err) {
+			return written, err
+		}
+		if full {
+			break
+		}
+	}
+	bar.Finish()
+	return written, nil
+}
+
+func zeroFreeDrive(cmd *cobra.Command, args []string) {
+	device := args[0]
+	skipConfirm, _ := cmd.Flags().GetBool("yes")
+
+	if err := validateDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := ensureRemovableDevice(device); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := checkWriteProtection(device, true); err != nil {
+		printError("Error: %v", err)
+		os.Exit(1)
+	}
+	if bitLockerStatus(device).Locked {
+		printError("Error: %s is locked by BitLocker. Unlock it in File Explorer or with 'manage-bde -unlock %s -Password', then try again", device, device)
+		os.Exit(1)
+	}
+	warnIfBehindHub(device)
+
+	mountPoint, err := getVolumeMountPoint(device)
+	if err != nil {
+		printError("Error: unable to find the mount point of %s: %v", device, err)
+		os.Exit(1)
+	}
+	freeGB, ok := getDriveFreeSpace(device)
+	if !ok {
+		printError("Error: unable to read the free space on %s", device)
+		os.Exit(1)
+	}
+	freeBytes := int64(freeGB * 1024 * 1024 * 1024)
+
+	title := fmt.Sprintf("Zero free space on %s", device)
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
+	fmt.Printf("Mount point: %s\n", mountPoint)
+	fmt.Printf("Free space: %.2f GB\n", freeGB)
+	measured := benchmarkDriveLimited(device, 64*1024*1024, true)
+	if measured.WriteMBps > 0 {
+		fmt.Printf("Estimated duration: about %s at %.2f MB/s\n", formatDuration(fullFormatEstimate(freeGB, measured.WriteMBps)), measured.WriteMBps)
+	}
+	fmt.Println("Files on the drive are kept. Deleted files become unrecoverable.")
+
+	if !skipConfirm {
+		response := ask("zerofree", "Continue? (y/N): ")
+		if response != "y" && response != "yes" {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	// A fake drive's free space is only a number; filling its folder until
+	// the host disk is full would be wrong.
+	var limit int64
+	if activeFakeBackend() != nil {
+		limit = freeBytes
+	}
+
+	fillers := &fillerFiles{}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	go func() {
+		<-interrupted
+		fmt.Println()
+		fmt.Println("Interrupted; deleting the filler files...")
+		if err := fillers.removeAll(); err != nil {
+			printError("Error: %v", err)
+		}
+		os.Exit(130)
+	}()
+
+	started := time.Now()
+	written, fillErr := writeZeroFill(mountPoint, freeBytes, limit, fillers)
+	recordDriveWrites(device, "zerofree", written)
+	removeErr := fillers.removeAll()
+	forgetDriveInfo()
+	elapsed := time.Since(started)
+
+	if fillErr != nil {
+		printError("Error: zeroing free space on %s failed after %.2f GB: %v", device, float64(written)/(1024*1024*1024), fillErr)
+		if removeErr != nil {
+			printError("Error: %v", removeErr)
+		}
+		os.Exit(1)
+	}
+	if removeErr != nil {
+		printError("Error: %v. Delete them by hand to get the free space back.", removeErr)
+		os.Exit(1)
+	}
+
+	speed := 0.0
+	if elapsed > 0 {
+		speed = float64(written) / (1024 * 1024) / elapsed.Seconds()
+	}
+	printOK("Zeroed %.2f GB of free space on %s in %s (%.2f MB/s).", float64(written)/(1024*1024*1024), device, formatDuration(elapsed), speed)
+	if written < freeBytes*9/10 {
+		warn(device, warnCapacity, "Only %.2f of %.2f GB free could be zeroed; the drive may report more space than it has", float64(written)/(1024*1024*1024), freeGB)
+	}
+}